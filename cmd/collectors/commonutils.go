@@ -6,7 +6,10 @@ import (
 	"github.com/netapp/harvest/v2/pkg/logging"
 	"github.com/netapp/harvest/v2/pkg/matrix"
 	"github.com/netapp/harvest/v2/pkg/tree/node"
+	"github.com/netapp/harvest/v2/pkg/util"
 	"github.com/tidwall/gjson"
+	"math"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -17,11 +20,16 @@ const (
 	MaxAllowedTimeDrift = 10 * time.Second
 )
 
-var validUnits = map[string]bool{
-	"mW":    true,
-	"W":     true,
-	"mW*hr": true,
-	"W*hr":  true,
+// powerUnits are the power units of sensors and the factor that converts them to W
+var powerUnits = map[string]float64{
+	"uW":    1e-6,
+	"mW":    1e-3,
+	"W":     1,
+	"kW":    1e3,
+	"uW*hr": 1e-6,
+	"mW*hr": 1e-3,
+	"W*hr":  1,
+	"kW*hr": 1e3,
 }
 
 type embedShelf struct {
@@ -241,8 +249,186 @@ func UpdateLagTime(instance *matrix.Instance, lastTransferSize *matrix.Metric, l
 	}
 }
 
+// flexgroupConstituentRegex matches the volume name of a flexgroup constituent, <flexgroup>__<constituent number>.
+// Very large flexgroups have constituent numbers with more than four digits.
+var flexgroupConstituentRegex = regexp.MustCompile(`^(.*)__(\d{4,})$`)
+
+// FlexgroupConstituents returns the flexgroup volume name of the instances of data that are flexgroup constituents.
+// An is_constituent label, when the collector has one, decides. Otherwise a volume whose name looks like a constituent
+// is only a constituent when it is constituent 1 or the poll has another volume of the same flexgroup, e.g. a lone
+// flexvol named foo__1234 is not a constituent. Volumes that look like constituents but are not grouped are logged.
+func FlexgroupConstituents(data *matrix.Matrix, logger *logging.Logger) map[*matrix.Instance]string {
+	siblings := make(map[string]int)
+	matches := make(map[*matrix.Instance]string)
+	constituents := make(map[*matrix.Instance]string)
+	for _, instance := range data.GetInstances() {
+		match := flexgroupConstituentRegex.FindStringSubmatch(instance.GetLabel("volume"))
+		if match == nil {
+			continue
+		}
+		switch instance.GetLabel("is_constituent") {
+		case "true":
+			constituents[instance] = match[1]
+		case "false":
+		default:
+			matches[instance] = match[1]
+			siblings[instance.GetLabel("svm")+"."+match[1]]++
+		}
+	}
+
+	for instance, flexgroup := range matches {
+		if siblings[instance.GetLabel("svm")+"."+flexgroup] > 1 || isFirstConstituent(instance.GetLabel("volume")) {
+			constituents[instance] = flexgroup
+			continue
+		}
+		logger.Debug().
+			Str("svm", instance.GetLabel("svm")).
+			Str("volume", instance.GetLabel("volume")).
+			Msg("volume looks like a flexgroup constituent but has no sibling constituents, treated as flexvol")
+	}
+	return constituents
+}
+
+// isFirstConstituent is true for the volume name of constituent 1 of a flexgroup
+func isFirstConstituent(volume string) bool {
+	match := flexgroupConstituentRegex.FindStringSubmatch(volume)
+	if match == nil {
+		return false
+	}
+	n, err := strconv.Atoi(match[2])
+	return err == nil && n == 1
+}
+
+// SetConstituentCV sets <metric>_cv on the flexgroup instances of cache, the coefficient of variation, std-dev / mean,
+// of the metric across the constituents of the flexgroup. A high CV means some constituents are much busier than
+// their siblings. constituents are keyed by flexgroup instance key and metrics are named as exported.
+// The CV is NaN when the mean is zero and only set for flexgroups with at least two constituents with a value.
+func SetConstituentCV(data *matrix.Matrix, cache *matrix.Matrix, constituents map[string][]*matrix.Instance, metrics []string, logger *logging.Logger) {
+	wanted := make(map[string]bool, len(metrics))
+	for _, name := range metrics {
+		wanted[name] = true
+	}
+	for _, m := range data.GetMetrics() {
+		if !wanted[m.GetName()] {
+			continue
+		}
+		cvName := m.GetName() + "_cv"
+		cv := cache.GetMetric(cvName)
+		for key, instances := range constituents {
+			fg := cache.GetInstance(key)
+			if fg == nil {
+				continue
+			}
+			values := make([]float64, 0, len(instances))
+			for _, instance := range instances {
+				if value, ok := m.GetValueFloat64(instance); ok {
+					values = append(values, value)
+				}
+			}
+			if len(values) < 2 {
+				continue
+			}
+			if cv == nil {
+				var err error
+				if cv, err = cache.NewMetricFloat64(cvName); err != nil {
+					logger.Error().Err(err).Str("metric", cvName).Msg("Unable to create metric")
+					break
+				}
+			}
+			mean := util.Avg(values)
+			if mean == 0 {
+				cv.SetValueNAN(fg)
+				continue
+			}
+			if err := cv.SetValueFloat64(fg, util.StdDev(values)/mean); err != nil {
+				logger.Error().Err(err).Str("metric", cvName).Str("key", key).Msg("Unable to set value on metric")
+			}
+		}
+	}
+}
+
+// SumWeightedLatencies adds the latencies of the constituents of the flexgroups of cache, weighted by the ops of the
+// constituent, to the flexgroup latencies. The ops of the constituents with a non-zero latency are added to the
+// opsPrefix+<ops key> metrics of cache, the latencies are divided by those once every constituent is added.
+// constituents are keyed by flexgroup instance key. Constituents without a latency or ops value are skipped.
+func SumWeightedLatencies(data *matrix.Matrix, cache *matrix.Matrix, constituents map[string][]*matrix.Instance, opsKeys map[string]string, rollups map[string]Rollup, opsPrefix string, logger *logging.Logger) error {
+	var err error
+	for mkey, m := range data.GetMetrics() {
+		if !m.IsExportable() && m.GetType() != "float64" {
+			continue
+		}
+		if RollupOf(m, rollups) != RollupWeighted {
+			continue
+		}
+		fgm := cache.GetMetric(mkey)
+		if fgm == nil {
+			continue
+		}
+		opsKey := OpsKeyOf(mkey, m, opsKeys)
+		ops := data.GetMetric(opsKey)
+		if ops == nil {
+			continue
+		}
+		logger.Trace().Str("metric", mkey).Str("ops", opsKey).Msg("weight by ops")
+		// A base counter can be the base of multiple metrics, so the ops are summed in a temp metric that is not exported
+		tempOps := cache.GetMetric(opsPrefix + opsKey)
+		if tempOps == nil {
+			if tempOps, err = cache.NewMetricFloat64(opsPrefix + opsKey); err != nil {
+				return err
+			}
+			tempOps.SetExportable(false)
+		}
+		for key, instances := range constituents {
+			fg := cache.GetInstance(key)
+			if fg == nil {
+				continue
+			}
+			for _, i := range instances {
+				value, ok := m.GetValueFloat64(i)
+				if !ok {
+					continue
+				}
+				opsValue, ok := ops.GetValueFloat64(i)
+				if !ok {
+					logger.Trace().Str("metric", mkey).Str("ops", opsKey).Msg("no ops value, skip")
+					continue
+				}
+				fgv, _ := fgm.GetValueFloat64(fg)
+				tempOpsV, _ := tempOps.GetValueFloat64(fg)
+				// If latency value is 0 then it's ops value is not used in weighted average calculation
+				if value != 0 {
+					if err = tempOps.SetValueFloat64(fg, tempOpsV+opsValue); err != nil {
+						logger.Error().Err(err).Str("metric", mkey).Msg("Unable to set value on metric")
+					}
+				}
+				if err = fgm.SetValueFloat64(fg, fgv+value*opsValue); err != nil {
+					logger.Error().Err(err).Str("metric", mkey).Msg("Unable to set value on metric")
+				}
+				logger.Trace().
+					Str("metric", mkey).
+					Float64("value", fgv).
+					Float64("latency", value).
+					Float64("opsValue", opsValue).
+					Float64("result", fgv+value*opsValue).
+					Msg("weighted increment")
+			}
+		}
+	}
+	return nil
+}
+
 func IsValidUnit(unit string) bool {
-	return validUnits[unit]
+	_, ok := powerUnits[unit]
+	return ok
+}
+
+// ToWatts converts a power value in unit to W, ok is false for an unknown unit
+func ToWatts(value float64, unit string) (float64, bool) {
+	factor, ok := powerUnits[unit]
+	if !ok {
+		return 0, false
+	}
+	return value * factor, true
 }
 
 func ReadPluginKey(param *node.Node, key string) bool {
@@ -253,3 +439,205 @@ func ReadPluginKey(param *node.Node, key string) bool {
 	}
 	return false
 }
+
+// ConvertSpeed converts a NIC speed label to a number and multiplies it by factor, the value of 1 Mbps.
+// Speeds ending with M are in Mbps, e.g. 400000M for a 400G port, speeds ending with G in Gbps, e.g. 100G, and other
+// speeds are used as is. The arithmetic is done in int64 since 100G+ ports overflow a 32-bit int, e.g. 400000 * 1_000_000.
+func ConvertSpeed(speed string, factor int64) (int64, error) {
+	return convertSpeed(speed, factor, math.MaxInt64)
+}
+
+// convertSpeed is ConvertSpeed with the largest allowed result as a parameter, so narrower ints can be tested
+func convertSpeed(speed string, factor int64, limit int64) (int64, error) {
+	s, multiplier := speed, int64(1)
+	if gbps, ok := strings.CutSuffix(speed, "G"); ok {
+		s, multiplier = gbps, factor*1000
+	} else if mbps, ok := strings.CutSuffix(speed, "M"); ok {
+		s, multiplier = mbps, factor
+	}
+	base, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, errs.New(errs.ErrInvalidParam, "speed "+speed+" is not numeric")
+	}
+	if base < 0 {
+		return 0, errs.New(errs.ErrInvalidParam, "speed "+speed+" is negative")
+	}
+	if multiplier > 0 && base > limit/multiplier {
+		return 0, errs.New(errs.ErrInvalidParam, "speed "+speed+" overflows")
+	}
+	return base * multiplier, nil
+}
+
+// SetNicErrorRates sets the NIC error and drop rates, rx_error_percent, tx_error_percent, rx_drop_percent and
+// tx_drop_percent, from the rx/tx total errors and drops counters. Like rx_percent, the rates are fractions in [0, 1],
+// of the packets when rx_packets and tx_packets are collected, of the bytes otherwise.
+// Rates whose counters are not collected are skipped.
+func SetNicErrorRates(data *matrix.Matrix) error {
+	for _, direction := range []string{"rx", "tx"} {
+		total := direction + "_packets"
+		if data.GetMetric(total) == nil {
+			total = direction + "_bytes"
+		}
+		if data.GetMetric(total) == nil {
+			continue
+		}
+		for counter, rate := range map[string]string{"_total_errors": "_error_percent", "_drops": "_drop_percent"} {
+			counter = direction + counter
+			if data.GetMetric(counter) == nil {
+				continue
+			}
+			metric, err := data.ComputeMetric(direction+rate, data.RatioOf(counter, total))
+			if err != nil {
+				return err
+			}
+			metric.SetProperty("raw")
+		}
+	}
+	return nil
+}
+
+// JoinTruncated joins values with commas. When the result would be longer than maxLen, the values that do not
+// fit are replaced by a count suffix, e.g. node-01,node-02,+3, so label values stay within the limits of time-series
+// databases.
+func JoinTruncated(values []string, maxLen int) string {
+	joined := strings.Join(values, ",")
+	if len(joined) <= maxLen {
+		return joined
+	}
+	var b strings.Builder
+	for i, value := range values {
+		if i > 0 {
+			value = "," + value
+		}
+		// the value must fit together with the count of the values after it
+		if b.Len()+len(value)+len(",+")+len(strconv.Itoa(len(values)-i-1)) > maxLen {
+			if i == 0 {
+				return "+" + strconv.Itoa(len(values))
+			}
+			b.WriteString(",+" + strconv.Itoa(len(values)-i))
+			break
+		}
+		b.WriteString(value)
+	}
+	return b.String()
+}
+
+// Rollup is how the values of flexgroup constituents are combined into the value of the flexgroup
+type Rollup string
+
+const (
+	RollupSum Rollup = "sum"
+	RollupAvg Rollup = "avg"
+	RollupMax Rollup = "max"
+	// RollupWeighted is the average weighted by the ops counter of the metric, used for latencies
+	RollupWeighted Rollup = "weighted"
+)
+
+// RollupOf returns the rollup of a metric. A configured rollup wins over the default by metric name suffix and
+// property:
+//   - latencies are weighted by ops
+//   - percentages, a _percent suffix or the percent property, and other averages are averaged
+//   - rates and deltas, already per second or per poll when plugins run, are summed
+//   - raw counters are summed too, the sum of cumulative counters is a cumulative counter whose rate is left
+//     to the consumer, see IsCounterSum
+func RollupOf(metric *matrix.Metric, configured map[string]Rollup) Rollup {
+	name := metric.GetName()
+	if rollup, ok := configured[name]; ok {
+		return rollup
+	}
+	switch {
+	case strings.HasSuffix(name, "_latency"):
+		return RollupWeighted
+	case strings.HasSuffix(name, "_percent"), metric.GetProperty() == "percent", metric.GetProperty() == "average":
+		return RollupAvg
+	default:
+		return RollupSum
+	}
+}
+
+// IsCounterSum is true when the flexgroup value of metric is the sum of cumulative counters. The sum is only valid
+// when every constituent reported a value, a partial sum would look like a counter reset.
+func IsCounterSum(metric *matrix.Metric, configured map[string]Rollup) bool {
+	return metric.GetProperty() == "raw" && RollupOf(metric, configured) == RollupSum
+}
+
+// ParseLatencyOps reads the ops metrics that weight latencies when the ops metric of the latency counter is not
+// the one to use, e.g.
+//
+//	latency_ops_map:
+//	  avg_latency: total_ops
+//
+// Metrics are named as exported.
+func ParseLatencyOps(param *node.Node) map[string]string {
+	m := param.GetChildS("latency_ops_map")
+	if m == nil {
+		return nil
+	}
+	latencyOps := make(map[string]string)
+	for _, child := range m.GetChildren() {
+		latencyOps[child.GetNameS()] = child.GetContentS()
+	}
+	return latencyOps
+}
+
+// LatencyOpsKeys resolves the exported names of latencyOps to the metric keys of data, latency key -> ops key.
+// Mapped ops metrics that data does not have are logged and left out, see OpsKeyOf.
+func LatencyOpsKeys(data *matrix.Matrix, latencyOps map[string]string, logger *logging.Logger) map[string]string {
+	if len(latencyOps) == 0 {
+		return nil
+	}
+	keys := make(map[string]string, len(data.GetMetrics()))
+	for key, m := range data.GetMetrics() {
+		keys[m.GetName()] = key
+	}
+	opsKeys := make(map[string]string, len(latencyOps))
+	for latency, ops := range latencyOps {
+		latencyKey, ok := keys[latency]
+		if !ok {
+			continue
+		}
+		opsKey, ok := keys[ops]
+		if !ok {
+			logger.Warn().Str("latency", latency).Str("ops", ops).Msg("mapped ops metric not found, using the ops of the latency counter")
+			continue
+		}
+		opsKeys[latencyKey] = opsKey
+	}
+	return opsKeys
+}
+
+// OpsKeyOf returns the key of the ops metric that weights the latency metric with key mkey, the mapped ops metric
+// or else the ops metric that the collector stores in the metric comment
+func OpsKeyOf(mkey string, m *matrix.Metric, opsKeys map[string]string) string {
+	if opsKey, ok := opsKeys[mkey]; ok {
+		return opsKey
+	}
+	if strings.Contains(mkey, "_latency") {
+		return m.GetComment()
+	}
+	return ""
+}
+
+// ParseRollups reads the per-metric rollups of a plugin, e.g.
+//
+//	rollup:
+//	  read_data: max
+//	  cache_hit_percent: avg
+//
+// Metrics are named as exported and the rollup is one of sum, avg or max.
+func ParseRollups(param *node.Node, logger *logging.Logger) map[string]Rollup {
+	r := param.GetChildS("rollup")
+	if r == nil {
+		return nil
+	}
+	rollups := make(map[string]Rollup)
+	for _, child := range r.GetChildren() {
+		switch rollup := Rollup(child.GetContentS()); rollup {
+		case RollupSum, RollupAvg, RollupMax:
+			rollups[child.GetNameS()] = rollup
+		default:
+			logger.Warn().Str("metric", child.GetNameS()).Str("rollup", child.GetContentS()).Msg("unknown rollup, ignoring")
+		}
+	}
+	return rollups
+}
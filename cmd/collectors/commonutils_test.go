@@ -4,6 +4,8 @@ import (
 	"github.com/netapp/harvest/v2/pkg/logging"
 	"github.com/netapp/harvest/v2/pkg/matrix"
 	"github.com/netapp/harvest/v2/pkg/tree/node"
+	"math"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -267,6 +269,46 @@ func TestGetDataInterval(t *testing.T) {
 	}
 }
 
+func TestConvertSpeed(t *testing.T) {
+	tests := []struct {
+		name    string
+		speed   string
+		factor  int64
+		limit   int64
+		want    int64
+		wantErr bool
+	}{
+		{name: "400G bps", speed: "400000M", factor: 1_000_000, limit: math.MaxInt64, want: 400_000_000_000},
+		{name: "400G Bps", speed: "400000M", factor: 125000, limit: math.MaxInt64, want: 50_000_000_000},
+		{name: "400G bps 32-bit", speed: "400000M", factor: 1_000_000, limit: math.MaxInt32, wantErr: true},
+		{name: "10G bps 32-bit", speed: "10000M", factor: 125000, limit: math.MaxInt32, want: 1_250_000_000},
+		{name: "no suffix", speed: "1250000000", factor: 125000, limit: math.MaxInt64, want: 1_250_000_000},
+		{name: "negative", speed: "-1000M", factor: 1_000_000, limit: math.MaxInt64, wantErr: true},
+		{name: "overflow", speed: "9223372036855M", factor: 1_000_000, limit: math.MaxInt64, wantErr: true},
+		{name: "auto", speed: "auto", factor: 1_000_000, limit: math.MaxInt64, wantErr: true},
+		{name: "100G bps", speed: "100G", factor: 1_000_000, limit: math.MaxInt64, want: 100_000_000_000},
+		{name: "100G Bps", speed: "100G", factor: 125000, limit: math.MaxInt64, want: 12_500_000_000},
+		{name: "40G bps", speed: "40G", factor: 1_000_000, limit: math.MaxInt64, want: 40_000_000_000},
+		{name: "40G Bps", speed: "40G", factor: 125000, limit: math.MaxInt64, want: 5_000_000_000},
+		{name: "10000M bps", speed: "10000M", factor: 1_000_000, limit: math.MaxInt64, want: 10_000_000_000},
+		{name: "10000M Bps", speed: "10000M", factor: 125000, limit: math.MaxInt64, want: 1_250_000_000},
+		{name: "plain 25000", speed: "25000", factor: 1_000_000, limit: math.MaxInt64, want: 25000},
+		{name: "400G bps 32-bit", speed: "400G", factor: 1_000_000, limit: math.MaxInt32, wantErr: true},
+		{name: "G only", speed: "G", factor: 1_000_000, limit: math.MaxInt64, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertSpeed(tt.speed, tt.factor, tt.limit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("convertSpeed() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("convertSpeed() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func generateScheduleParam(duration string) *node.Node {
 	root := node.NewS("root")
 	param := root.NewChildS("schedule", "")
@@ -334,3 +376,129 @@ func populateInstance(data *matrix.Matrix, instanceName, healthy, schedule, last
 	}
 	return instance
 }
+
+func TestJoinTruncated(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		maxLen int
+		want   string
+	}{
+		{name: "empty", values: nil, maxLen: 10, want: ""},
+		{name: "fits", values: []string{"node1", "node2"}, maxLen: 11, want: "node1,node2"},
+		{name: "truncated", values: []string{"node1", "node2", "node3", "node4"}, maxLen: 16, want: "node1,node2,+2"},
+		{name: "first too long", values: []string{"node1", "node2"}, maxLen: 4, want: "+2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := JoinTruncated(tt.values, tt.maxLen)
+			if got != tt.want {
+				t.Errorf("JoinTruncated() got = %q, want %q", got, tt.want)
+			}
+			if len(got) > tt.maxLen {
+				t.Errorf("JoinTruncated() got %d characters, want at most %d", len(got), tt.maxLen)
+			}
+		})
+	}
+}
+
+func TestRollupOf(t *testing.T) {
+	configured := map[string]Rollup{"read_latency": RollupMax, "read_data": RollupAvg}
+	tests := []struct {
+		name       string
+		property   string
+		configured map[string]Rollup
+		want       Rollup
+		wantCount  bool
+	}{
+		{name: "read_data", property: "rate", want: RollupSum},
+		{name: "total_ops", property: "rate", want: RollupSum},
+		{name: "read_blocks", property: "delta", want: RollupSum},
+		{name: "total_reads", property: "raw", want: RollupSum, wantCount: true},
+		{name: "cache_hit_percent", property: "raw", want: RollupAvg},
+		{name: "cpu_busy", property: "percent", want: RollupAvg},
+		{name: "avg_size", property: "average", want: RollupAvg},
+		{name: "read_latency", property: "average", want: RollupWeighted},
+		{name: "read_latency", property: "average", configured: configured, want: RollupMax},
+		{name: "read_data", property: "rate", configured: configured, want: RollupAvg},
+	}
+	for _, tt := range tests {
+		data := matrix.New("Volume", "volume", "volume")
+		metric, _ := data.NewMetricFloat64(tt.name)
+		metric.SetProperty(tt.property)
+		if got := RollupOf(metric, tt.configured); got != tt.want {
+			t.Errorf("RollupOf(%s, %v) got = %s, want %s", tt.name, tt.configured, got, tt.want)
+		}
+		if got := IsCounterSum(metric, tt.configured); got != tt.wantCount {
+			t.Errorf("IsCounterSum(%s, %v) got = %v, want %v", tt.name, tt.configured, got, tt.wantCount)
+		}
+	}
+}
+
+func TestToWatts(t *testing.T) {
+	tests := []struct {
+		unit   string
+		value  float64
+		want   float64
+		wantOk bool
+	}{
+		{unit: "uW", value: 250_000_000, want: 250, wantOk: true},
+		{unit: "mW", value: 250_000, want: 250, wantOk: true},
+		{unit: "W", value: 250, want: 250, wantOk: true},
+		{unit: "kW", value: 0.25, want: 250, wantOk: true},
+		{unit: "uW*hr", value: 250_000_000, want: 250, wantOk: true},
+		{unit: "mW*hr", value: 250_000, want: 250, wantOk: true},
+		{unit: "W*hr", value: 250, want: 250, wantOk: true},
+		{unit: "kW*hr", value: 0.25, want: 250, wantOk: true},
+		{unit: "MW", value: 1},
+		{unit: "w", value: 250},
+		{unit: "", value: 250},
+	}
+	for _, tt := range tests {
+		t.Run(tt.unit, func(t *testing.T) {
+			if got := IsValidUnit(tt.unit); got != tt.wantOk {
+				t.Errorf("IsValidUnit() got = %v, want %v", got, tt.wantOk)
+			}
+			got, ok := ToWatts(tt.value, tt.unit)
+			if ok != tt.wantOk || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("ToWatts() got = %v,%v, want %v,%v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestFlexgroupConstituents(t *testing.T) {
+	tests := []struct {
+		name          string
+		volumes       []string
+		isConstituent string
+		want          map[string]string
+	}{
+		{name: "without constituent 1", volumes: []string{"fg__0002", "fg__0003"}, want: map[string]string{"fg__0002": "fg", "fg__0003": "fg"}},
+		{name: "five digits only", volumes: []string{"big__10000", "big__10001"}, want: map[string]string{"big__10000": "big", "big__10001": "big"}},
+		{name: "flexvol named like a constituent", volumes: []string{"foo__1234", "vol1"}, want: map[string]string{}},
+		{name: "single constituent", volumes: []string{"single__0001"}, want: map[string]string{"single__0001": "single"}},
+		{name: "labeled constituent", volumes: []string{"fg__0001"}, isConstituent: "true", want: map[string]string{"fg__0001": "fg"}},
+		{name: "labeled flexvols", volumes: []string{"foo__0001", "foo__0002"}, isConstituent: "false", want: map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := matrix.New("ZapiPerf", "volume", "volume")
+			for _, volume := range tt.volumes {
+				instance, _ := data.NewInstance(volume)
+				instance.SetLabel("volume", volume)
+				instance.SetLabel("svm", "svm1")
+				if tt.isConstituent != "" {
+					instance.SetLabel("is_constituent", tt.isConstituent)
+				}
+			}
+			got := make(map[string]string)
+			for instance, flexgroup := range FlexgroupConstituents(data, logging.Get()) {
+				got[instance.GetLabel("volume")] = flexgroup
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got=%v want=%v", got, tt.want)
+			}
+		})
+	}
+}
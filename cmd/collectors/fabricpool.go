@@ -4,12 +4,9 @@ import (
 	"github.com/netapp/harvest/v2/pkg/logging"
 	"github.com/netapp/harvest/v2/pkg/matrix"
 	"golang.org/x/exp/maps"
-	"regexp"
 	"strings"
 )
 
-var re = regexp.MustCompile(`^(.*)__(\d{4})$`)
-
 func GetFlexGroupFabricPoolMetrics(dataMap map[string]*matrix.Matrix, object string, opName string, includeConstituents bool, l *logging.Logger) (*matrix.Matrix, error) {
 	var (
 		err                 error
@@ -34,7 +31,7 @@ func GetFlexGroupFabricPoolMetrics(dataMap map[string]*matrix.Matrix, object str
 		if !i.IsExportable() {
 			continue
 		}
-		if match := re.FindStringSubmatch(i.GetLabel("volume")); len(match) == 3 {
+		if match := flexgroupConstituentRegex.FindStringSubmatch(i.GetLabel("volume")); len(match) == 3 {
 			key := i.GetLabel("svm") + "." + match[1] + i.GetLabel("cloud_target")
 			if cache.GetInstance(key) == nil {
 				fg, _ := cache.NewInstance(key)
@@ -49,7 +46,7 @@ func GetFlexGroupFabricPoolMetrics(dataMap map[string]*matrix.Matrix, object str
 
 	// create summary
 	for _, i := range data.GetInstances() {
-		if match := re.FindStringSubmatch(i.GetLabel("volume")); len(match) == 3 {
+		if match := flexgroupConstituentRegex.FindStringSubmatch(i.GetLabel("volume")); len(match) == 3 {
 			// instance key is svm.flexgroup-volume.cloud-target-name
 			key := i.GetLabel("svm") + "." + match[1] + i.GetLabel("cloud_target")
 
@@ -1,16 +1,24 @@
 package collectors
 
 import (
+	"context"
 	"fmt"
 	"github.com/netapp/harvest/v2/cmd/poller/plugin"
 	"github.com/netapp/harvest/v2/cmd/tools/rest"
 	"github.com/netapp/harvest/v2/pkg/conf"
 	"github.com/netapp/harvest/v2/pkg/logging"
 	"github.com/netapp/harvest/v2/pkg/matrix"
+	"github.com/netapp/harvest/v2/pkg/tree"
+	"github.com/netapp/harvest/v2/pkg/tree/node"
 	"github.com/netapp/harvest/v2/pkg/util"
+	"github.com/tidwall/gjson"
+	"math"
+	"os"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -19,59 +27,276 @@ const (
 	restValueKey = "value"
 )
 
+// History keys hold the min and max reading over the last sensor interval.
+// Only ONTAP versions with sensor history report them and they must be requested in the template.
+const (
+	zapiIntervalMinKey = "environment-sensors-info.interval-min-sensor-value"
+	zapiIntervalMaxKey = "environment-sensors-info.interval-max-sensor-value"
+	restIntervalMinKey = "interval_min_value"
+	restIntervalMaxKey = "interval_max_value"
+)
+
+// Reading time keys hold when a sensor was last read, in seconds since the epoch.
+// Only ONTAP versions with sensor reading times report them and they must be requested in the template.
+// A reading_time label with an RFC 3339 timestamp is used when there is no reading time metric.
+const (
+	zapiReadingTimeKey = "environment-sensors-info.reading-time"
+	restReadingTimeKey = "reading_time"
+	readingTimeLabel   = "reading_time"
+)
+
+// chassisFRU holds the PSU topology reported by `system chassis fru show`
+type chassisFRU struct {
+	// map of PSUs node -> numNode
+	nodeToNumNode map[string]int
+	// nodes sharing a chassis, each group is sorted and unique
+	connectedNodes [][]string
+	// PSUs with their psu_info labels, only populated when info fields are requested
+	psus []psu
+}
+
+type psu struct {
+	name   string
+	nodes  []string
+	labels map[string]string
+}
+
+// psuInfoField is a chassis FRU field exported as label of psu_info
+type psuInfoField struct {
+	field string
+	label string
+}
+
+// fruDefaultFields are the chassis FRU fields requested when the template does not configure fru_fields
+var fruDefaultFields = []string{"fru-name", "type", "status", "connected-nodes", "num-nodes"}
+
+// fruMandatoryFields map PSUs to the nodes they power and are always requested
+var fruMandatoryFields = []string{"fru-name", "connected-nodes", "num-nodes"}
+
+// fruFields returns the chassis FRU fields to request: the configured fields, or the defaults when none are configured,
+// followed by the mandatory fields the configuration omits and the psu_info fields. Duplicates are removed.
+func fruFields(configured []string, infoFields []psuInfoField) []string {
+	if len(configured) == 0 {
+		configured = fruDefaultFields
+	}
+	fields := make([]string, 0, len(configured)+len(fruMandatoryFields)+len(infoFields))
+	seen := make(map[string]bool)
+	add := func(field string) {
+		if field != "" && !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+	for _, f := range configured {
+		add(f)
+	}
+	for _, f := range fruMandatoryFields {
+		add(f)
+	}
+	for _, f := range infoFields {
+		add(f.field)
+	}
+	return fields
+}
+
+// fruPageSize is the number of chassis FRU records requested per page, large clusters need several pages
+const fruPageSize = 500
+
 // CollectChassisFRU is here because both ZAPI and REST sensor.go plugin call it to collect
 // `system chassis fru show`.
 // Chassis FRU information is only available via private CLI
-func collectChassisFRU(client *rest.Client, logger *logging.Logger) (map[string]int, error) {
-	fields := []string{"fru-name", "type", "status", "connected-nodes", "num-nodes"}
+func collectChassisFRU(ctx context.Context, client *rest.Client, fields []string, infoFields []psuInfoField, logger *logging.Logger) (*chassisFRU, error) {
 	query := "api/private/cli/system/chassis/fru"
 	filter := []string{"type=psu"}
+	pageSize := fruPageSize
 	href := rest.NewHrefBuilder().
 		APIPath(query).
 		Fields(fields).
 		Filter(filter).
+		MaxRecords(&pageSize).
 		Build()
 
-	result, err := rest.Fetch(client, href)
+	result, err := rest.FetchAllContext(ctx, client, href)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch data href=%s err=%w", href, err)
 	}
 
-	// map of PSUs node -> numNode
-	nodeToNumNode := make(map[string]int)
+	return parseChassisFRU(result, client.Cluster().Name, infoFields, logger), nil
+}
+
+// defaultFRUCacheTTL is how long chassis FRU data is reused before it is collected again
+const defaultFRUCacheTTL = 30 * time.Minute
+
+// fruCache keeps the chassis FRU data across polls since the PSU topology rarely changes
+type fruCache struct {
+	ttl       time.Duration
+	fru       *chassisFRU
+	nodes     int // number of nodes when fru was collected
+	collected time.Time
+}
+
+// get returns the cached chassis FRU data while it is younger than the TTL and the cluster has the same number of
+// nodes, and otherwise the data returned by collect. When collect fails, the last good data is returned.
+func (c *fruCache) get(nodes int, now time.Time, collect func() (*chassisFRU, error), logger *logging.Logger) (*chassisFRU, error) {
+	if c.fru != nil && c.nodes == nodes && now.Sub(c.collected) < c.ttl {
+		return c.fru, nil
+	}
+	fru, err := collect()
+	if err != nil {
+		if c.fru != nil {
+			logger.Warn().Err(err).Time("collected", c.collected).Msg("Unable to refresh chassis fru, using cached data")
+			return c.fru, nil
+		}
+		return nil, err
+	}
+	c.fru, c.nodes, c.collected = fru, nodes, now
+	return fru, nil
+}
+
+// countNodes returns the number of nodes with exportable sensors
+func countNodes(data *matrix.Matrix) int {
+	nodes := make(map[string]bool)
+	for _, instance := range data.GetInstances() {
+		if instance.IsExportable() && instance.GetLabel("node") != "" {
+			nodes[instance.GetLabel("node")] = true
+		}
+	}
+	return len(nodes)
+}
+
+func parseChassisFRU(result []gjson.Result, cluster string, infoFields []psuInfoField, logger *logging.Logger) *chassisFRU {
+	fru := &chassisFRU{nodeToNumNode: make(map[string]int)}
+	seenGroups := make(map[string]bool)
 
 	for _, r := range result {
 		cn := r.Get("connected_nodes")
 		if !cn.Exists() {
 			logger.Warn().
-				Str("cluster", client.Cluster().Name).
+				Str("cluster", cluster).
 				Str("fru", r.Get("fru_name").String()).
 				Msg("fru has no connected nodes")
 			continue
 		}
 		numNodes := int(r.Get("num_nodes").Int())
+		group := make([]string, 0, len(cn.Array()))
 		for _, e := range cn.Array() {
-			nodeToNumNode[e.String()] = numNodes
+			fru.nodeToNumNode[e.String()] = numNodes
+			group = append(group, e.String())
+		}
+		if len(infoFields) > 0 {
+			p := psu{name: r.Get("fru_name").String(), nodes: group, labels: make(map[string]string)}
+			for _, f := range infoFields {
+				// private CLI returns fields with underscores
+				p.labels[f.label] = r.Get(strings.ReplaceAll(f.field, "-", "_")).String()
+			}
+			fru.psus = append(fru.psus, p)
+		}
+		// every PSU of a chassis reports the same connected nodes, only keep one group per chassis
+		sort.Strings(group)
+		groupKey := strings.Join(group, ",")
+		if !seenGroups[groupKey] {
+			seenGroups[groupKey] = true
+			fru.connectedNodes = append(fru.connectedNodes, group)
 		}
 	}
-	return nodeToNumNode, nil
+	return fru
 }
 
+// thermalExclusion is the reason of the thermal sensors excluded from the temperatures, margin sensors and sensors
+// with a value that is not positive
+const thermalExclusion = "margin or not positive"
+
 type sensorValue struct {
 	node  string
 	name  string
 	value float64
 	unit  string
+	// why an excluded sensor is not used
+	reason string
 }
 
 type environmentMetric struct {
-	key                   string
+	key string
+	// node model from the model label of the sensors, empty when the sensors are not labeled
+	model                 string
 	ambientTemperature    []float64
 	nonAmbientTemperature []float64
 	fanSpeed              []float64
-	powerSensor           map[string]*sensorValue
-	voltageSensor         map[string]*sensorValue
-	currentSensor         map[string]*sensorValue
+	// fan speeds keyed by fan module, see fanModuleRegex, and whether a fan does not belong to a module
+	fanModules   map[string][]float64
+	fanUngrouped bool
+	// fan sensors and the fans among them spinning faster than the active threshold
+	fansTotal  int
+	fansActive int
+	// non-ambient thermal sensor with the highest temperature, the first one wins a tie
+	hottestSensor *sensorValue
+	// sensors are in instance key order, voltage and current sensors are paired by position
+	powerSensor   []*sensorValue
+	voltageSensor []*sensorValue
+	currentSensor []*sensorValue
+	// inputs of dataQuality
+	sensorCount   int
+	unknownUnits  int
+	pairingFailed bool
+	fruMissing    bool
+}
+
+// addFanModule adds the speed of a fan to the module it belongs to, derived from its sensor name
+func (e *environmentMetric) addFanModule(sensorName string, speed float64) {
+	match := fanModuleRegex.FindStringSubmatch(sensorName)
+	if match == nil {
+		e.fanUngrouped = true
+		return
+	}
+	if e.fanModules == nil {
+		e.fanModules = make(map[string][]float64)
+	}
+	e.fanModules[match[1]] = append(e.fanModules[match[1]], speed)
+}
+
+// averageFanSpeed returns average_fan_speed, the mean of the fan speeds less the fraction fan_speed_trim of the
+// slowest and fastest fans.
+// With weighted_fan_speed, every fan module contributes equally no matter how many fans it holds: the speeds of a
+// module are averaged first and fan_speed_trim applies to the module averages. Nodes with a fan that does not
+// belong to a module use the unweighted average.
+func (e *environmentMetric) averageFanSpeed(opts sensorOptions) float64 {
+	if !opts.weightedFanSpeed || e.fanUngrouped || len(e.fanModules) == 0 {
+		return util.TrimmedMean(e.fanSpeed, opts.fanSpeedTrim)
+	}
+	modules := make([]string, 0, len(e.fanModules))
+	for module := range e.fanModules {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	moduleAvg := make([]float64, 0, len(modules))
+	for _, module := range modules {
+		moduleAvg = append(moduleAvg, util.Avg(e.fanModules[module]))
+	}
+	return util.TrimmedMean(moduleAvg, opts.fanSpeedTrim)
+}
+
+// dataQuality scores how trustworthy the environment metrics of the node are, from 1 (trustworthy) to 0.
+// Each of these lowers the score by 0.25:
+//   - the node is missing from the chassis FRU data, so power of a shared chassis may be counted twice
+//   - power could not be derived, the node has no power sensors and the voltage and current sensors do not pair
+//   - sensors with an unknown unit were ignored
+//
+// Excluded thermal sensors lower the score by 0.25 times the fraction of the sensors of the node that were excluded.
+func (e *environmentMetric) dataQuality(excluded int) float64 {
+	score := 1.0
+	if e.fruMissing {
+		score -= 0.25
+	}
+	if e.pairingFailed {
+		score -= 0.25
+	}
+	if e.unknownUnits > 0 {
+		score -= 0.25
+	}
+	if e.sensorCount > 0 {
+		score -= 0.25 * float64(excluded) / float64(e.sensorCount)
+	}
+	return max(score, 0)
 }
 
 var ambientRegex = regexp.MustCompile(`^(Ambient Temp|Ambient Temp \d|PSU\d AmbTemp|PSU\d Inlet|PSU\d Inlet Temp|In Flow Temp|Front Temp|Bat_Ambient \d|Riser Inlet Temp)$`)
@@ -82,50 +307,264 @@ var voltageRegex = regexp.MustCompile(`^PSU\d (\d+V|InVoltage|VIN|AC In Volt)$`)
 
 var CurrentRegex = regexp.MustCompile(`^PSU\d (\d+V Curr|Curr|InCurrent|Curr IIN|AC In Curr)$`)
 
+// psuNumberRegex extracts the PSU number from a voltage or current sensor name, e.g. 2 from PSU2 VIN
+var psuNumberRegex = regexp.MustCompile(`^PSU(\d+) `)
+
+// fanModuleRegex derives the module a fan belongs to from its sensor name.
+// e.g. Fan1_2 is the second fan of module Fan1 and PSU2 FAN is the fan of module PSU2
+var fanModuleRegex = regexp.MustCompile(`^(Fan\d+|PSU\d+)[ _]`)
+
 var eMetrics = []string{
 	"average_ambient_temperature",
 	"average_fan_speed",
 	"average_temperature",
+	"excluded_sensor_count",
 	"max_fan_speed",
 	"max_temperature",
+	"median_temperature",
 	"min_ambient_temperature",
 	"min_fan_speed",
 	"min_temperature",
+	"p95_temperature",
 	"power",
 }
 
-func calculateEnvironmentMetrics(data *matrix.Matrix, logger *logging.Logger, valueKey string, myData *matrix.Matrix, nodeToNumNode map[string]int) ([]*matrix.Matrix, error) {
+// sensorOptions are the Sensor plugin parameters used by calculateEnvironmentMetrics
+type sensorOptions struct {
+	// calibration offsets keyed by sensor name or node/sensor name
+	calibration map[string]float64
+	// primary patterns that classify sensors, nil uses builtinRegexes
+	primary *sensorRegexes
+	// fallback patterns tried for sensors that none of the primary regexes match
+	fallback *sensorRegexes
+	// units assumed for power, voltage and current sensors that do not report one
+	defaultPowerUnit   string
+	defaultVoltageUnit string
+	defaultCurrentUnit string
+	// label flagging invalid readings, nil when readings are not flagged
+	validity *sensorValidity
+	// canonical sensor names keyed by the name variants that ZAPI and REST report for the same sensor
+	canonicalNames map[string]string
+	// time a run may spend on sensors before further nodes are skipped, zero means no limit
+	timeBudget time.Duration
+	// fans spinning faster than this speed count as active, a stopped fan reports 0
+	fanActiveThreshold float64
+	// fraction of the slowest and fastest fans left out of average_fan_speed, see util.TrimmedMean
+	fanSpeedTrim float64
+	// average fan speeds per fan module before averaging them, see averageFanSpeed
+	weightedFanSpeed bool
+	// add an instance per PSU next to the node instance, see setPSUInstances
+	splitPSU bool
+	// power supply efficiency keyed by node model or defaultPowerModel, see psuEfficiency
+	efficiency map[string]float64
+}
+
+// defaultPSUEfficiency is the power supply efficiency used for models without a configured one
+const defaultPSUEfficiency = 0.93
+
+// psuEfficiency returns the power supply efficiency of a node model, the configured default or 0.93
+func (o sensorOptions) psuEfficiency(model string) float64 {
+	if e, ok := o.efficiency[model]; ok && model != "" {
+		return e
+	}
+	if e, ok := o.efficiency[defaultPowerModel]; ok {
+		return e
+	}
+	return defaultPSUEfficiency
+}
+
+// sensorValidity reads the validity flag or confidence that some hardware reports for a reading from a sensor label
+type sensorValidity struct {
+	label         string
+	minConfidence float64
+}
+
+// invalid returns why the reading of instance is invalid, or "" when it is valid or not flagged.
+// false and invalid flag a reading as invalid, as does a numeric confidence below minConfidence.
+func (v *sensorValidity) invalid(instance *matrix.Instance) string {
+	if v == nil {
+		return ""
+	}
+	value := instance.GetLabel(v.label)
+	if value == "" {
+		return ""
+	}
+	if strings.EqualFold(value, "invalid") {
+		return v.label + "=" + value
+	}
+	if valid, err := strconv.ParseBool(value); err == nil {
+		if !valid {
+			return v.label + "=" + value
+		}
+		return ""
+	}
+	if confidence, err := strconv.ParseFloat(value, 64); err == nil && confidence < v.minConfidence {
+		return fmt.Sprintf("%s=%s below %g", v.label, value, v.minConfidence)
+	}
+	return ""
+}
+
+// sensorRegexes classify sensors by name, a nil regex matches nothing
+type sensorRegexes struct {
+	ambient *regexp.Regexp
+	power   *regexp.Regexp
+	voltage *regexp.Regexp
+	current *regexp.Regexp
+}
+
+func (r *sensorRegexes) match(sensorName string) (isAmbient, isPower, isVoltage, isCurrent bool) {
+	matches := func(re *regexp.Regexp) bool {
+		return re != nil && re.MatchString(sensorName)
+	}
+	return matches(r.ambient), matches(r.power), matches(r.voltage), matches(r.current)
+}
+
+// builtinRegexes are the default primary sensor regexes
+var builtinRegexes = &sensorRegexes{ambient: ambientRegex, power: powerInRegex, voltage: voltageRegex, current: CurrentRegex}
+
+// sensorClass is the classification of a sensor by name
+type sensorClass struct {
+	ambient    bool
+	power      bool
+	voltage    bool
+	current    bool
+	byFallback bool
+}
+
+func (c sensorClass) matched() bool {
+	return c.ambient || c.power || c.voltage || c.current
+}
+
+// classifySensor matches the primary regexes and, when none of them match, the fallback regexes.
+// A nil primary uses the built-in regexes.
+func classifySensor(sensorName string, primary *sensorRegexes, fallback *sensorRegexes) sensorClass {
+	if primary == nil {
+		primary = builtinRegexes
+	}
+	var c sensorClass
+	c.ambient, c.power, c.voltage, c.current = primary.match(sensorName)
+	if fallback != nil && !c.matched() {
+		c.ambient, c.power, c.voltage, c.current = fallback.match(sensorName)
+		c.byFallback = c.matched()
+	}
+	return c
+}
+
+// offset returns the calibration offset of a sensor. A node specific offset wins over a sensor name offset.
+func (o sensorOptions) offset(node string, sensorName string) float64 {
+	if offset, ok := o.calibration[node+"/"+sensorName]; ok {
+		return offset
+	}
+	return o.calibration[sensorName]
+}
+
+// canonicalName returns the canonical name of a sensor, or the name itself when it is not a known variant
+func (o sensorOptions) canonicalName(sensorName string) string {
+	if canonical, ok := o.canonicalNames[sensorName]; ok {
+		return canonical
+	}
+	return sensorName
+}
+
+// budgetSpent reports whether the time budget of a run that started at start is used up.
+// The first node is always processed so that every run makes progress.
+func (o sensorOptions) budgetSpent(start time.Time, processedNodes int) bool {
+	return o.timeBudget > 0 && processedNodes > 0 && time.Since(start) > o.timeBudget
+}
+
+// unitOr returns unit, or the default when the sensor does not report a unit
+func unitOr(unit string, defaultUnit string) string {
+	if unit == "" {
+		return defaultUnit
+	}
+	return unit
+}
+
+func calculateEnvironmentMetrics(data *matrix.Matrix, logger *logging.Logger, valueKey string, myData *matrix.Matrix, nodeToNumNode map[string]int, opts sensorOptions) ([]*matrix.Matrix, error) {
+	output, _, err := calculateNodeEnvironment(data, logger, valueKey, myData, nodeToNumNode, opts)
+	return output, err
+}
+
+// nodeEnvironment is what calculateNodeEnvironment decided per node besides the environment metrics
+type nodeEnvironment struct {
+	// nodes whose power was derived from power sensors or from paired voltage and current sensors. The power of the
+	// other nodes is 0, see calculatePowerEstimate
+	measuredPower map[string]bool
+	// nodes skipped because the time budget was spent, see sensorOptions.budgetSpent
+	skippedNodes map[string]bool
+}
+
+// calculateNodeEnvironment is calculateEnvironmentMetrics that also returns the nodes with measured power and the
+// nodes skipped by the time budget
+func calculateNodeEnvironment(data *matrix.Matrix, logger *logging.Logger, valueKey string, myData *matrix.Matrix, nodeToNumNode map[string]int, opts sensorOptions) ([]*matrix.Matrix, nodeEnvironment, error) {
+	measuredPower := make(map[string]bool)
 	sensorEnvironmentMetricMap := make(map[string]*environmentMetric)
 	excludedSensors := make(map[string][]sensorValue)
+	// node/canonical sensor name of the sensors aggregated so far
+	seenSensors := make(map[string]bool)
+	skippedNodes := make(map[string]bool)
+	start := time.Now()
 
-	for k, instance := range data.GetInstances() {
+	for _, instance := range data.GetInstancesOrdered() {
+		// instances are kept across polls, the label is set again below when the sensor still needs the fallback
+		instance.RemoveLabel("classified_by")
 		if !instance.IsExportable() {
 			continue
 		}
+		sensorName := instance.GetLabel("sensor")
 		iKey := instance.GetLabel("node")
 		if iKey == "" {
-			logger.Warn().Str("key", k).Msg("missing node label for instance")
+			logger.Warn().Str("sensor", sensorName).Msg("missing node label for instance")
 			continue
 		}
-		sensorName := instance.GetLabel("sensor")
 		if sensorName == "" {
-			logger.Warn().Str("key", k).Msg("missing sensor name for instance")
+			logger.Warn().Str("node", iKey).Msg("missing sensor name for instance")
+			continue
+		}
+		// once the budget is spent, nodes already started are completed and the remaining nodes are skipped
+		if _, started := sensorEnvironmentMetricMap[iKey]; !started && opts.budgetSpent(start, len(sensorEnvironmentMetricMap)) {
+			skippedNodes[iKey] = true
 			continue
 		}
+		// the same sensor reported under another name, e.g. by the other protocol, is only counted once
+		canonical := opts.canonicalName(sensorName)
+		if seenSensors[iKey+"/"+canonical] {
+			logger.Debug().Str("node", iKey).Str("sensor", sensorName).Str("canonical", canonical).Msg("duplicate sensor, skipping")
+			continue
+		}
+		seenSensors[iKey+"/"+canonical] = true
+		sensorName = canonical
 		if _, ok := sensorEnvironmentMetricMap[iKey]; !ok {
 			sensorEnvironmentMetricMap[iKey] = &environmentMetric{key: iKey, ambientTemperature: []float64{}, nonAmbientTemperature: []float64{}, fanSpeed: []float64{}}
 		}
+		sensorEnvironmentMetricMap[iKey].sensorCount++
+		if model := instance.GetLabel("model"); model != "" {
+			sensorEnvironmentMetricMap[iKey].model = model
+		}
+		if reason := opts.validity.invalid(instance); reason != "" {
+			excluded := sensorValue{node: iKey, name: sensorName, reason: reason}
+			if metric := data.GetMetric(valueKey); metric != nil {
+				excluded.value, _ = metric.GetValueFloat64(instance)
+			}
+			excludedSensors[iKey] = append(excludedSensors[iKey], excluded)
+			continue
+		}
 		for mKey, metric := range data.GetMetrics() {
 			if mKey != valueKey {
 				continue
 			}
 			sensorType := instance.GetLabel("type")
 			sensorUnit := instance.GetLabel("unit")
+			value, ok := metric.GetValueFloat64(instance)
+			if ok {
+				value += opts.offset(iKey, sensorName)
+			}
 
-			isAmbientMatch := ambientRegex.MatchString(sensorName)
-			isPowerMatch := powerInRegex.MatchString(sensorName)
-			isVoltageMatch := voltageRegex.MatchString(sensorName)
-			isCurrentMatch := CurrentRegex.MatchString(sensorName)
+			class := classifySensor(sensorName, opts.primary, opts.fallback)
+			isAmbientMatch, isPowerMatch, isVoltageMatch, isCurrentMatch := class.ambient, class.power, class.voltage, class.current
+			if class.byFallback {
+				instance.SetLabel("classified_by", "fallback")
+			}
 
 			logger.Trace().
 				Bool("isAmbientMatch", isAmbientMatch).
@@ -138,81 +577,91 @@ func calculateEnvironmentMetrics(data *matrix.Matrix, logger *logging.Logger, va
 				Send()
 
 			if sensorType == "thermal" && isAmbientMatch {
-				if value, ok := metric.GetValueFloat64(instance); ok {
+				if ok {
 					sensorEnvironmentMetricMap[iKey].ambientTemperature = append(sensorEnvironmentMetricMap[iKey].ambientTemperature, value)
 				}
 			}
 
-			if sensorType == "thermal" && !isAmbientMatch {
+			// thermal sensors without a reading are ignored, not excluded
+			if sensorType == "thermal" && !isAmbientMatch && ok {
 				// Exclude temperature sensors that contains sensor name `Margin` and value < 0
-				value, ok := metric.GetValueFloat64(instance)
 				if value > 0 && !strings.Contains(sensorName, "Margin") {
-					if ok {
-						sensorEnvironmentMetricMap[iKey].nonAmbientTemperature = append(sensorEnvironmentMetricMap[iKey].nonAmbientTemperature, value)
+					em := sensorEnvironmentMetricMap[iKey]
+					em.nonAmbientTemperature = append(em.nonAmbientTemperature, value)
+					if em.hottestSensor == nil || value > em.hottestSensor.value {
+						em.hottestSensor = &sensorValue{node: iKey, name: sensorName, value: value}
 					}
 				} else {
 					excludedSensors[iKey] = append(excludedSensors[iKey], sensorValue{
-						node:  iKey,
-						name:  sensorName,
-						value: value,
+						node:   iKey,
+						name:   sensorName,
+						value:  value,
+						reason: thermalExclusion,
 					})
 				}
 			}
 
 			if sensorType == "fan" {
-				if value, ok := metric.GetValueFloat64(instance); ok {
-					sensorEnvironmentMetricMap[iKey].fanSpeed = append(sensorEnvironmentMetricMap[iKey].fanSpeed, value)
+				em := sensorEnvironmentMetricMap[iKey]
+				em.fansTotal++
+				if ok {
+					em.fanSpeed = append(em.fanSpeed, value)
+					if value > opts.fanActiveThreshold {
+						em.fansActive++
+					}
+					em.addFanModule(sensorName, value)
 				}
 			}
 
 			if isPowerMatch {
-				if value, ok := metric.GetValueFloat64(instance); ok {
-					if !IsValidUnit(sensorUnit) {
+				if ok {
+					powerUnit := unitOr(sensorUnit, opts.defaultPowerUnit)
+					if !IsValidUnit(powerUnit) {
 						logger.Warn().Str("unit", sensorUnit).Float64("value", value).Msg("unknown power unit")
+						sensorEnvironmentMetricMap[iKey].unknownUnits++
 					} else {
-						if sensorEnvironmentMetricMap[iKey].powerSensor == nil {
-							sensorEnvironmentMetricMap[iKey].powerSensor = make(map[string]*sensorValue)
-						}
-						sensorEnvironmentMetricMap[iKey].powerSensor[k] = &sensorValue{
+						sensorEnvironmentMetricMap[iKey].powerSensor = append(sensorEnvironmentMetricMap[iKey].powerSensor, &sensorValue{
 							node:  iKey,
 							name:  sensorName,
 							value: value,
-							unit:  sensorUnit,
-						}
+							unit:  powerUnit,
+						})
 					}
 				}
 			}
 
 			if isVoltageMatch {
-				if value, ok := metric.GetValueFloat64(instance); ok {
-					if sensorEnvironmentMetricMap[iKey].voltageSensor == nil {
-						sensorEnvironmentMetricMap[iKey].voltageSensor = make(map[string]*sensorValue)
-					}
-					sensorEnvironmentMetricMap[iKey].voltageSensor[k] = &sensorValue{
+				if ok {
+					sensorEnvironmentMetricMap[iKey].voltageSensor = append(sensorEnvironmentMetricMap[iKey].voltageSensor, &sensorValue{
 						node:  iKey,
 						name:  sensorName,
 						value: value,
-						unit:  sensorUnit,
-					}
+						unit:  unitOr(sensorUnit, opts.defaultVoltageUnit),
+					})
 				}
 			}
 
 			if isCurrentMatch {
-				if value, ok := metric.GetValueFloat64(instance); ok {
-					if sensorEnvironmentMetricMap[iKey].currentSensor == nil {
-						sensorEnvironmentMetricMap[iKey].currentSensor = make(map[string]*sensorValue)
-					}
-					sensorEnvironmentMetricMap[iKey].currentSensor[k] = &sensorValue{
+				if ok {
+					sensorEnvironmentMetricMap[iKey].currentSensor = append(sensorEnvironmentMetricMap[iKey].currentSensor, &sensorValue{
 						node:  iKey,
 						name:  sensorName,
 						value: value,
-						unit:  sensorUnit,
-					}
+						unit:  unitOr(sensorUnit, opts.defaultCurrentUnit),
+					})
 				}
 			}
 		}
 	}
 
+	if len(skippedNodes) > 0 {
+		logger.Warn().
+			Dur("budget", opts.timeBudget).
+			Int("processedNodes", len(sensorEnvironmentMetricMap)).
+			Int("skippedNodes", len(skippedNodes)).
+			Msg("sensor time budget exceeded, skipping remaining nodes")
+	}
+
 	if len(excludedSensors) > 0 {
 		var excludedSensorStr string
 		for k, v := range excludedSensors {
@@ -232,82 +681,93 @@ func calculateEnvironmentMetrics(data *matrix.Matrix, logger *logging.Logger, va
 		}
 		// set node label
 		instance.SetLabel("node", key)
+		// read before the power calculation converts the voltage and current sensors in place
+		var readings map[string]*psuReading
+		if opts.splitPSU {
+			readings = v.psuReadings()
+		}
 		for _, k := range eMetrics {
 			m := myData.GetMetric(k)
 			switch k {
 			case "power":
 				var sumPower float64
+				// PSU number -> power in W
+				psuPower := make(map[string]float64)
 				if len(v.powerSensor) > 0 {
+					measuredPower[key] = true
 					for _, v1 := range v.powerSensor {
-						if v1.unit == "mW" || v1.unit == "mW*hr" {
-							sumPower += v1.value / 1000
-						} else if v1.unit == "W" || v1.unit == "W*hr" {
-							sumPower += v1.value
+						if watts, ok := ToWatts(v1.value, v1.unit); ok {
+							sumPower += watts
+							psuPower[psuKey(v1.name)] += watts
 						} else {
 							logger.Logger.Warn().Str("node", key).Str("name", v1.name).Str("unit", v1.unit).Float64("value", v1.value).Msg("unknown power unit")
+							v.unknownUnits++
 						}
-						if v1.unit == "mW*hr" || v1.unit == "W*hr" {
+						if strings.HasSuffix(v1.unit, "*hr") {
 							whrSensors[v1.name] = v1
 						}
 					}
 				} else if len(v.voltageSensor) > 0 && len(v.voltageSensor) == len(v.currentSensor) {
-					// sort voltage keys
-					voltageKeys := make([]string, 0, len(v.voltageSensor))
-					for k := range v.voltageSensor {
-						voltageKeys = append(voltageKeys, k)
-					}
-					sort.Strings(voltageKeys)
-
-					// sort current keys
-					currentKeys := make([]string, 0, len(v.currentSensor))
-					for k := range v.currentSensor {
-						currentKeys = append(currentKeys, k)
-					}
-					sort.Strings(currentKeys)
-
-					for i := range currentKeys {
-						currentKey := currentKeys[i]
-						voltageKey := voltageKeys[i]
-
+					measuredPower[key] = true
+					voltageSensors := pairByPSU(v.voltageSensor, v.currentSensor)
+					for i := range v.currentSensor {
 						// get values
-						currentSensorValue := v.currentSensor[currentKey]
-						voltageSensorValue := v.voltageSensor[voltageKey]
+						currentSensorValue := v.currentSensor[i]
+						voltageSensorValue := voltageSensors[i]
 
 						// convert units
 						if currentSensorValue.unit == "mA" {
 							currentSensorValue.value = currentSensorValue.value / 1000
 						} else if currentSensorValue.unit != "A" {
 							logger.Logger.Warn().Str("node", key).Str("unit", currentSensorValue.unit).Float64("value", currentSensorValue.value).Msg("unknown current unit")
+							v.unknownUnits++
 						}
 
 						if voltageSensorValue.unit == "mV" {
 							voltageSensorValue.value = voltageSensorValue.value / 1000
 						} else if voltageSensorValue.unit != "V" {
 							logger.Logger.Warn().Str("node", key).Str("unit", voltageSensorValue.unit).Float64("value", voltageSensorValue.value).Msg("unknown voltage unit")
+							v.unknownUnits++
 						}
 
 						p := currentSensorValue.value * voltageSensorValue.value
 
 						if !strings.EqualFold(voltageSensorValue.name, "in") && !strings.EqualFold(currentSensorValue.name, "in") {
-							p = p / 0.93 // If the sensor names to do NOT contain "IN" or "in", then we need to adjust the power to account for loss in the power supply. We will use 0.93 as the power supply efficiency factor for all systems.
+							p = p / opts.psuEfficiency(v.model) // If the sensor names to do NOT contain "IN" or "in", then we need to adjust the power to account for loss in the power supply, see psuEfficiency.
 						}
 
 						sumPower += p
+						psuPower[psuKey(currentSensorValue.name)] += p
 					}
 				} else {
 					logger.Logger.Warn().Str("node", key).Int("current size", len(v.currentSensor)).Int("voltage size", len(v.voltageSensor)).Msg("current and voltage sensor are ignored")
+					v.pairingFailed = true
 				}
 
 				numNode, ok := nodeToNumNode[key]
 				if !ok {
 					logger.Logger.Warn().Str("node", key).Msg("node not found in nodeToNumNode map")
 					numNode = 1
+					// power of a shared chassis may be counted twice, let dashboards flag it
+					instance.SetLabel("fru_missing", "true")
+					v.fruMissing = true
 				}
 				sumPower = sumPower / float64(numNode)
 				err2 = m.SetValueFloat64(instance, sumPower)
 				if err2 != nil {
 					logger.Logger.Error().Float64("power", sumPower).Err(err2).Msg("Unable to set power")
 				}
+				setPSULoadImbalance(myData, instance, psuPower, logger)
+				if opts.splitPSU {
+					setPSUInstances(myData, key, readings, psuPower, numNode, logger)
+				}
+			case "excluded_sensor_count":
+				// thermal sensors excluded from the temperatures, invalid readings are not counted
+				count := float64(excludedThermal(excludedSensors[key]))
+				err2 = m.SetValueFloat64(instance, count)
+				if err2 != nil {
+					logger.Logger.Error().Float64("excluded_sensor_count", count).Err(err2).Msg("Unable to set excluded_sensor_count")
+				}
 			case "average_ambient_temperature":
 				if len(v.ambientTemperature) > 0 {
 					aaT := util.Avg(v.ambientTemperature)
@@ -328,6 +788,9 @@ func calculateEnvironmentMetrics(data *matrix.Matrix, logger *logging.Logger, va
 				if err2 != nil {
 					logger.Logger.Error().Float64("max_temperature", mT).Err(err2).Msg("Unable to set max_temperature")
 				}
+				if v.hottestSensor != nil {
+					instance.SetLabel("max_temperature_sensor", v.hottestSensor.name)
+				}
 			case "average_temperature":
 				if len(v.nonAmbientTemperature) > 0 {
 					nat := util.Avg(v.nonAmbientTemperature)
@@ -336,6 +799,22 @@ func calculateEnvironmentMetrics(data *matrix.Matrix, logger *logging.Logger, va
 						logger.Logger.Error().Float64("average_temperature", nat).Err(err2).Msg("Unable to set average_temperature")
 					}
 				}
+			case "median_temperature":
+				if len(v.nonAmbientTemperature) > 0 {
+					medT := util.Median(v.nonAmbientTemperature)
+					err2 = m.SetValueFloat64(instance, medT)
+					if err2 != nil {
+						logger.Logger.Error().Float64("median_temperature", medT).Err(err2).Msg("Unable to set median_temperature")
+					}
+				}
+			case "p95_temperature":
+				if len(v.nonAmbientTemperature) > 0 {
+					p95T := util.Percentile(v.nonAmbientTemperature, 95)
+					err2 = m.SetValueFloat64(instance, p95T)
+					if err2 != nil {
+						logger.Logger.Error().Float64("p95_temperature", p95T).Err(err2).Msg("Unable to set p95_temperature")
+					}
+				}
 			case "min_temperature":
 				mT := util.Min(v.nonAmbientTemperature)
 				err2 = m.SetValueFloat64(instance, mT)
@@ -344,7 +823,7 @@ func calculateEnvironmentMetrics(data *matrix.Matrix, logger *logging.Logger, va
 				}
 			case "average_fan_speed":
 				if len(v.fanSpeed) > 0 {
-					afs := util.Avg(v.fanSpeed)
+					afs := v.averageFanSpeed(opts)
 					err2 = m.SetValueFloat64(instance, afs)
 					if err2 != nil {
 						logger.Logger.Error().Float64("average_fan_speed", afs).Err(err2).Msg("Unable to set average_fan_speed")
@@ -364,6 +843,8 @@ func calculateEnvironmentMetrics(data *matrix.Matrix, logger *logging.Logger, va
 				}
 			}
 		}
+		setDataQuality(myData, instance, v.dataQuality(excludedThermal(excludedSensors[key])), logger)
+		setFanCounts(myData, instance, v, logger)
 	}
 
 	if len(whrSensors) > 0 {
@@ -375,74 +856,1503 @@ func calculateEnvironmentMetrics(data *matrix.Matrix, logger *logging.Logger, va
 			Msg("sensor with *hr units")
 	}
 
-	return []*matrix.Matrix{myData}, nil
+	return []*matrix.Matrix{myData}, nodeEnvironment{measuredPower: measuredPower, skippedNodes: skippedNodes}, nil
 }
 
-func NewSensor(p *plugin.AbstractPlugin) plugin.Plugin {
-	return &Sensor{AbstractPlugin: p}
+// excludedThermal returns the number of thermal sensors excluded from the temperatures, see thermalExclusion
+func excludedThermal(excluded []sensorValue) int {
+	count := 0
+	for _, e := range excluded {
+		if e.reason == thermalExclusion {
+			count++
+		}
+	}
+	return count
 }
 
-type Sensor struct {
-	*plugin.AbstractPlugin
-	data           *matrix.Matrix
-	client         *rest.Client
-	instanceKeys   map[string]string
-	instanceLabels map[string]map[string]string
+// pairByPSU returns the voltage sensors reordered so that voltage[i] and current[i] belong to the same PSU.
+// The PSU is parsed from the sensor name. When a name can not be parsed or the PSU numbers do not
+// match one to one, the voltage sensors are returned as is and the sensors are paired by index.
+func pairByPSU(voltage []*sensorValue, current []*sensorValue) []*sensorValue {
+	byPSU := make(map[string]*sensorValue, len(voltage))
+	for _, v := range voltage {
+		match := psuNumberRegex.FindStringSubmatch(v.name)
+		if match == nil {
+			return voltage
+		}
+		if _, ok := byPSU[match[1]]; ok {
+			return voltage
+		}
+		byPSU[match[1]] = v
+	}
+	paired := make([]*sensorValue, 0, len(current))
+	for _, c := range current {
+		match := psuNumberRegex.FindStringSubmatch(c.name)
+		if match == nil {
+			return voltage
+		}
+		v, ok := byPSU[match[1]]
+		if !ok {
+			return voltage
+		}
+		delete(byPSU, match[1])
+		paired = append(paired, v)
+	}
+	return paired
 }
 
-func (my *Sensor) Init() error {
+// psuKey returns the PSU number of a sensor, or the sensor name when it does not start with PSU<n>
+func psuKey(sensorName string) string {
+	if match := psuNumberRegex.FindStringSubmatch(sensorName); match != nil {
+		return match[1]
+	}
+	return sensorName
+}
 
-	var err error
-	if err := my.InitAbc(); err != nil {
-		return err
+// setPSULoadImbalance sets psu_load_imbalance = (max PSU power - min PSU power) / node power.
+// Healthy PSUs share the load evenly, so 0 is balanced and 1 means one PSU carries the whole load.
+// PSU powers and node power are both divided by the number of nodes of a shared chassis, so the ratio uses the sum
+// of the PSU powers. The metric is only set for nodes with at least two PSUs.
+func setPSULoadImbalance(myData *matrix.Matrix, instance *matrix.Instance, psuPower map[string]float64, logger *logging.Logger) {
+	if len(psuPower) < 2 {
+		return
+	}
+	powers := make([]float64, 0, len(psuPower))
+	var total float64
+	for _, p := range psuPower {
+		powers = append(powers, p)
+		total += p
+	}
+	if total <= 0 {
+		return
+	}
+	if err := matrix.CreateMetric("psu_load_imbalance", myData); err != nil {
+		logger.Error().Err(err).Msg("Unable to create psu_load_imbalance")
+		return
 	}
+	imbalance := (util.Max(powers) - util.Min(powers)) / total
+	if err := myData.GetMetric("psu_load_imbalance").SetValueFloat64(instance, imbalance); err != nil {
+		logger.Error().Float64("psu_load_imbalance", imbalance).Err(err).Msg("Unable to set psu_load_imbalance")
+	}
+}
 
-	timeout, _ := time.ParseDuration(rest.DefaultTimeout)
-	if my.client, err = rest.New(conf.ZapiPoller(my.ParentParams), timeout, my.Auth); err != nil {
-		my.Logger.Error().Err(err).Msg("connecting")
-		return err
+// psuReading is the voltage in V and current in A of one PSU
+type psuReading struct {
+	voltage, current       float64
+	hasVoltage, hasCurrent bool
+}
+
+// psuReadings returns the readings of the voltage and current sensors of the node by PSU number.
+// Sensors whose name does not start with PSU<n> or that report an unknown unit are left out.
+func (e *environmentMetric) psuReadings() map[string]*psuReading {
+	readings := make(map[string]*psuReading)
+	reading := func(name string) *psuReading {
+		match := psuNumberRegex.FindStringSubmatch(name)
+		if match == nil {
+			return nil
+		}
+		r, ok := readings[match[1]]
+		if !ok {
+			r = &psuReading{}
+			readings[match[1]] = r
+		}
+		return r
+	}
+	for _, s := range e.voltageSensor {
+		if value, ok := baseUnitValue(s.value, s.unit, "V"); ok {
+			if r := reading(s.name); r != nil {
+				r.voltage, r.hasVoltage = value, true
+			}
+		}
+	}
+	for _, s := range e.currentSensor {
+		if value, ok := baseUnitValue(s.value, s.unit, "A"); ok {
+			if r := reading(s.name); r != nil {
+				r.current, r.hasCurrent = value, true
+			}
+		}
 	}
+	return readings
+}
 
-	if err = my.client.Init(5); err != nil {
-		return err
+// baseUnitValue converts a value in unit, either base or milli base, e.g. mV, to base
+func baseUnitValue(value float64, unit string, base string) (float64, bool) {
+	switch unit {
+	case base:
+		return value, true
+	case "m" + base:
+		return value / 1000, true
 	}
+	return 0, false
+}
 
-	my.data = matrix.New(my.Parent+".Sensor", "environment_sensor", "environment_sensor")
-	my.instanceKeys = make(map[string]string)
-	my.instanceLabels = make(map[string]map[string]string)
+// setPSUInstances adds one instance per PSU of the node, keyed by <node>.PSU<n> and labeled node, psu and
+// scope=psu, with the power, voltage and current of the PSU. Like the node power, PSU power is divided by the number
+// of nodes sharing the chassis, so the PSU powers of a node add up to the node power.
+// psuPower is keyed by psuKey, sensors without a PSU<n> prefix are left out.
+func setPSUInstances(myData *matrix.Matrix, node string, readings map[string]*psuReading, psuPower map[string]float64, numNode int, logger *logging.Logger) {
+	numbers := make(map[string]bool, len(readings))
+	for number := range readings {
+		numbers[number] = true
+	}
+	for number := range psuPower {
+		if _, err := strconv.Atoi(number); err == nil {
+			numbers[number] = true
+		}
+	}
+	for _, name := range []string{"voltage", "current"} {
+		if err := matrix.CreateMetric(name, myData); err != nil {
+			logger.Error().Err(err).Str("metric", name).Msg("Unable to create metric")
+			return
+		}
+	}
 
-	// init environment metrics in plugin matrix
-	// create environment metric if not exists
-	for _, k := range eMetrics {
-		err := matrix.CreateMetric(k, my.data)
+	for number := range numbers {
+		psuName := "PSU" + number
+		key := node + "." + psuName
+		instance, err := myData.NewInstance(key)
 		if err != nil {
-			my.Logger.Warn().Err(err).Str("key", k).Msg("error while creating metric")
+			logger.Warn().Err(err).Str("key", key).Msg("Unable to create psu instance")
+			continue
+		}
+		instance.SetLabel("node", node)
+		instance.SetLabel("psu", psuName)
+		instance.SetLabel("scope", "psu")
+
+		values := make(map[string]float64)
+		if p, ok := psuPower[number]; ok {
+			values["power"] = p / float64(numNode)
+		}
+		if r := readings[number]; r != nil {
+			if r.hasVoltage {
+				values["voltage"] = r.voltage
+			}
+			if r.hasCurrent {
+				values["current"] = r.current
+			}
+		}
+		for name, value := range values {
+			if err := myData.GetMetric(name).SetValueFloat64(instance, value); err != nil {
+				logger.Error().Float64(name, value).Err(err).Str("key", key).Msg("Unable to set " + name)
+			}
 		}
 	}
-	return nil
 }
 
-func (my *Sensor) Run(dataMap map[string]*matrix.Matrix) ([]*matrix.Matrix, error) {
-	data := dataMap[my.Object]
-	// Purge and reset data
-	my.data.PurgeInstances()
-	my.data.Reset()
+func setDataQuality(myData *matrix.Matrix, instance *matrix.Instance, quality float64, logger *logging.Logger) {
+	if err := matrix.CreateMetric("sensor_data_quality", myData); err != nil {
+		logger.Error().Err(err).Msg("Unable to create sensor_data_quality")
+		return
+	}
+	if err := myData.GetMetric("sensor_data_quality").SetValueFloat64(instance, quality); err != nil {
+		logger.Error().Float64("sensor_data_quality", quality).Err(err).Msg("Unable to set sensor_data_quality")
+	}
+}
 
-	// Set all global labels if they don't already exist
-	my.data.SetGlobalLabels(data.GetGlobalLabels())
+// setFanCounts sets fans_total, the number of fan sensors of the node, and fans_active, the number of fans spinning
+// faster than the active threshold. Fans without a reading are not active. Nodes without fan sensors get neither.
+func setFanCounts(myData *matrix.Matrix, instance *matrix.Instance, e *environmentMetric, logger *logging.Logger) {
+	if e.fansTotal == 0 {
+		return
+	}
+	for name, count := range map[string]int{"fans_total": e.fansTotal, "fans_active": e.fansActive} {
+		if err := matrix.CreateMetric(name, myData); err != nil {
+			logger.Error().Err(err).Str("metric", name).Msg("Unable to create metric")
+			return
+		}
+		if err := myData.GetMetric(name).SetValueFloat64(instance, float64(count)); err != nil {
+			logger.Error().Int(name, count).Err(err).Msg("Unable to set " + name)
+		}
+	}
+}
 
-	// Collect chassis fru show, so we can determine if a controller's PSUs are shared or not
-	nodeToNumNode, err := collectChassisFRU(my.client, my.Logger)
-	if err != nil {
-		return nil, err
+// chassisReduce returns how an environment metric of the nodes of a chassis is rolled up
+func chassisReduce(metric string) func([]float64) float64 {
+	switch {
+	case metric == "power", metric == "excluded_sensor_count":
+		return util.Sum
+	case strings.HasPrefix(metric, "min_"):
+		return util.Min
+	case strings.HasPrefix(metric, "max_"):
+		return util.Max
+	default:
+		return util.Avg
 	}
-	if len(nodeToNumNode) == 0 {
-		my.Logger.Debug().Msg("No chassis field replaceable units found")
+}
+
+// calculateChassisScope adds one instance per chassis FRU group, labeled scope=chassis, that sums the power and
+// rolls up the temperatures and fan speeds of the connected nodes. Node instances are labeled scope=node so
+// dashboards can select one scope without counting power twice.
+// Node power is already divided by the number of nodes sharing the PSUs, so the chassis power is the PSU power.
+func calculateChassisScope(myData *matrix.Matrix, connectedNodes [][]string, logger *logging.Logger) {
+	for _, instance := range myData.GetInstances() {
+		// PSU instances, see setPSUInstances
+		if instance.GetLabel("psu") != "" {
+			continue
+		}
+		instance.SetLabel("scope", "node")
+	}
+	for _, nodes := range connectedNodes {
+		key := "chassis:" + strings.Join(nodes, ",")
+		instance := myData.GetInstance(key)
+		if instance == nil {
+			var err error
+			if instance, err = myData.NewInstance(key); err != nil {
+				logger.Error().Err(err).Str("key", key).Msg("Unable to create chassis instance")
+				continue
+			}
+		}
+		instance.SetLabel("scope", "chassis")
+		instance.SetLabel("nodes", strings.Join(nodes, ","))
+		for _, k := range eMetrics {
+			m := myData.GetMetric(k)
+			values := make([]float64, 0, len(nodes))
+			for _, n := range nodes {
+				if nodeInstance := myData.GetInstance(n); nodeInstance != nil {
+					if v, ok := m.GetValueFloat64(nodeInstance); ok {
+						values = append(values, v)
+					}
+				}
+			}
+			if len(values) == 0 {
+				continue
+			}
+			v := chassisReduce(k)(values)
+			if err := m.SetValueFloat64(instance, v); err != nil {
+				logger.Error().Float64(k, v).Err(err).Msg("Unable to set " + k)
+			}
+		}
 	}
+}
 
-	valueKey := zapiValueKey
-	if my.Parent == "Rest" {
-		valueKey = restValueKey
+// clusterSummaries are the cluster-wide rollups of node metrics, metric -> source node metric and reduction
+var clusterSummaries = []struct {
+	metric string
+	source string
+	reduce func([]float64) float64
+}{
+	{metric: "power_p50", source: "power", reduce: func(v []float64) float64 { return util.Percentile(v, 50) }},
+	{metric: "power_p95", source: "power", reduce: func(v []float64) float64 { return util.Percentile(v, 95) }},
+	{metric: "power_max", source: "power", reduce: util.Max},
+	{metric: "max_temperature_p95", source: "max_temperature", reduce: func(v []float64) float64 { return util.Percentile(v, 95) }},
+}
+
+// calculateClusterSummary adds a cluster instance, labeled scope=cluster, with percentiles of the node power and
+// node max temperature across all nodes of the cluster. Node instances are labeled scope=node.
+func calculateClusterSummary(myData *matrix.Matrix, logger *logging.Logger) {
+	var nodes []*matrix.Instance
+	for _, instance := range myData.GetInstances() {
+		// chassis instances have no node label, PSU instances have a psu label
+		if instance.GetLabel("node") == "" || instance.GetLabel("psu") != "" {
+			continue
+		}
+		instance.SetLabel("scope", "node")
+		nodes = append(nodes, instance)
+	}
+	if len(nodes) == 0 {
+		return
+	}
+	cluster := myData.GetInstance("cluster")
+	if cluster == nil {
+		var err error
+		if cluster, err = myData.NewInstance("cluster"); err != nil {
+			logger.Error().Err(err).Msg("Unable to create cluster instance")
+			return
+		}
+	}
+	cluster.SetLabel("scope", "cluster")
+	for _, s := range clusterSummaries {
+		source := myData.GetMetric(s.source)
+		if source == nil {
+			continue
+		}
+		values := make([]float64, 0, len(nodes))
+		for _, node := range nodes {
+			if v, ok := source.GetValueFloat64(node); ok {
+				values = append(values, v)
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		if err := matrix.CreateMetric(s.metric, myData); err != nil {
+			logger.Error().Err(err).Str("key", s.metric).Msg("Unable to create metric")
+			continue
+		}
+		v := s.reduce(values)
+		if err := myData.GetMetric(s.metric).SetValueFloat64(cluster, v); err != nil {
+			logger.Error().Float64(s.metric, v).Err(err).Msg("Unable to set " + s.metric)
+		}
+	}
+}
+
+// calculateHAPowerBalance sets ha_power_balance on both nodes of each HA pair.
+// The balance is the ratio of the higher to the lower node power, so 1 means perfectly balanced.
+// HA pairs are the chassis FRU groups with exactly two connected nodes and the metric is only
+// set when both nodes of the pair have a power value.
+func calculateHAPowerBalance(myData *matrix.Matrix, connectedNodes [][]string, logger *logging.Logger) {
+	power := myData.GetMetric("power")
+	if power == nil {
+		return
+	}
+	balance := myData.GetMetric("ha_power_balance")
+	if balance == nil {
+		var err error
+		if balance, err = myData.NewMetricFloat64("ha_power_balance"); err != nil {
+			logger.Error().Err(err).Msg("Unable to create ha_power_balance metric")
+			return
+		}
+	}
+
+	for _, pair := range connectedNodes {
+		if len(pair) != 2 {
+			continue
+		}
+		i1 := myData.GetInstance(pair[0])
+		i2 := myData.GetInstance(pair[1])
+		if i1 == nil || i2 == nil {
+			continue
+		}
+		p1, ok1 := power.GetValueFloat64(i1)
+		p2, ok2 := power.GetValueFloat64(i2)
+		if !ok1 || !ok2 {
+			continue
+		}
+		high, low := max(p1, p2), min(p1, p2)
+		if low <= 0 {
+			logger.Debug().Strs("nodes", pair).Float64("low", low).Msg("skip ha_power_balance, power is not positive")
+			continue
+		}
+		ratio := high / low
+		for _, instance := range []*matrix.Instance{i1, i2} {
+			if err := balance.SetValueFloat64(instance, ratio); err != nil {
+				logger.Error().Float64("ha_power_balance", ratio).Err(err).Msg("Unable to set ha_power_balance")
+			}
+		}
+	}
+}
+
+// calculateSensorAge sets sensor_age_seconds, the seconds since the last reading, on each sensor of data.
+// A sensor whose reading time stops moving reports a stale, constant value, its age keeps growing.
+// Sensors without a reading time are skipped.
+func calculateSensorAge(data *matrix.Matrix, timeKey string, now time.Time, logger *logging.Logger) {
+	timeMetric := data.GetMetric(timeKey)
+	var age *matrix.Metric
+	for _, instance := range data.GetInstances() {
+		if !instance.IsExportable() {
+			continue
+		}
+		var readAt time.Time
+		if timeMetric != nil {
+			if v, ok := timeMetric.GetValueFloat64(instance); ok && v > 0 {
+				readAt = time.Unix(int64(v), 0)
+			}
+		}
+		if label := instance.GetLabel(readingTimeLabel); readAt.IsZero() && label != "" {
+			t, err := time.Parse(time.RFC3339, label)
+			if err != nil {
+				logger.Debug().Err(err).Str("sensor", instance.GetLabel("sensor")).Msg("invalid reading time")
+				continue
+			}
+			readAt = t
+		}
+		if readAt.IsZero() {
+			continue
+		}
+		if age == nil {
+			if err := matrix.CreateMetric("sensor_age_seconds", data); err != nil {
+				logger.Error().Err(err).Msg("Unable to create sensor_age_seconds")
+				return
+			}
+			age = data.GetMetric("sensor_age_seconds")
+		}
+		// a reading time ahead of the poller clock is clock skew, not a fresh reading from the future
+		seconds := max(now.Sub(readAt).Seconds(), 0)
+		if err := age.SetValueFloat64(instance, seconds); err != nil {
+			logger.Error().Float64("sensor_age_seconds", seconds).Err(err).Msg("Unable to set sensor_age_seconds")
+		}
+	}
+}
+
+// calculateIntervalHistory sets sensor_interval_min and sensor_interval_max per node from the sensor history fields.
+// Only the temperature sensors used for min_temperature and max_temperature are considered.
+// Nodes whose sensors do not report history are skipped.
+func calculateIntervalHistory(data *matrix.Matrix, minKey string, maxKey string, myData *matrix.Matrix, opts sensorOptions, logger *logging.Logger) {
+	minMetric := data.GetMetric(minKey)
+	maxMetric := data.GetMetric(maxKey)
+	if minMetric == nil || maxMetric == nil {
+		logger.Debug().Str("minKey", minKey).Str("maxKey", maxKey).Msg("sensor history not collected")
+		return
+	}
+
+	// node -> interval min/max readings
+	nodeMins := make(map[string][]float64)
+	nodeMaxs := make(map[string][]float64)
+	for _, instance := range data.GetInstances() {
+		if !instance.IsExportable() || instance.GetLabel("type") != "thermal" {
+			continue
+		}
+		iKey := instance.GetLabel("node")
+		sensorName := instance.GetLabel("sensor")
+		if iKey == "" || classifySensor(sensorName, opts.primary, nil).ambient || strings.Contains(sensorName, "Margin") {
+			continue
+		}
+		offset := opts.offset(iKey, sensorName)
+		if v, ok := minMetric.GetValueFloat64(instance); ok && v > 0 {
+			nodeMins[iKey] = append(nodeMins[iKey], v+offset)
+		}
+		if v, ok := maxMetric.GetValueFloat64(instance); ok && v > 0 {
+			nodeMaxs[iKey] = append(nodeMaxs[iKey], v+offset)
+		}
+	}
+
+	setHistory := func(name string, nodeValues map[string][]float64, reduce func([]float64) float64) {
+		if len(nodeValues) == 0 {
+			return
+		}
+		if err := matrix.CreateMetric(name, myData); err != nil {
+			logger.Error().Err(err).Str("key", name).Msg("Unable to create metric")
+			return
+		}
+		metric := myData.GetMetric(name)
+		for iKey, values := range nodeValues {
+			instance := myData.GetInstance(iKey)
+			if instance == nil {
+				continue
+			}
+			v := reduce(values)
+			if err := metric.SetValueFloat64(instance, v); err != nil {
+				logger.Error().Float64(name, v).Err(err).Msg("Unable to set " + name)
+			}
+		}
+	}
+	setHistory("sensor_interval_min", nodeMins, util.Min)
+	setHistory("sensor_interval_max", nodeMaxs, util.Max)
+}
+
+// unitAggregations are the sensor_unit metrics created per distinct sensor unit
+var unitAggregations = []struct {
+	name   string
+	reduce func([]float64) float64
+}{
+	{name: "sensor_unit_min", reduce: util.Min},
+	{name: "sensor_unit_avg", reduce: util.Avg},
+	{name: "sensor_unit_max", reduce: util.Max},
+}
+
+// calculateUnitMetrics sets sensor_unit_min, sensor_unit_avg and sensor_unit_max per node for each distinct unit
+// reported by the sensors, so sensors of unknown types still surface. The unit is a metric label, e.g.
+// environment_sensor_sensor_unit_max{node="n1",unit="RPM"}, so unit names never collide with other metrics.
+// Sensors without unit are skipped.
+func calculateUnitMetrics(data *matrix.Matrix, valueKey string, myData *matrix.Matrix, opts sensorOptions, logger *logging.Logger) {
+	metric := data.GetMetric(valueKey)
+	if metric == nil {
+		return
+	}
+
+	// unit -> node -> values
+	unitValues := make(map[string]map[string][]float64)
+	for _, instance := range data.GetInstances() {
+		if !instance.IsExportable() {
+			continue
+		}
+		iKey := instance.GetLabel("node")
+		unit := instance.GetLabel("unit")
+		value, ok := metric.GetValueFloat64(instance)
+		if iKey == "" || unit == "" || !ok {
+			continue
+		}
+		if _, ok := unitValues[unit]; !ok {
+			unitValues[unit] = make(map[string][]float64)
+		}
+		unitValues[unit][iKey] = append(unitValues[unit][iKey], value+opts.offset(iKey, instance.GetLabel("sensor")))
+	}
+
+	for unit, nodeValues := range unitValues {
+		for _, agg := range unitAggregations {
+			key := agg.name + "#" + unit
+			m := myData.GetMetric(key)
+			if m == nil {
+				var err error
+				if m, err = myData.NewMetricFloat64(key, agg.name); err != nil {
+					logger.Error().Err(err).Str("key", key).Msg("Unable to create metric")
+					continue
+				}
+				m.SetLabel("unit", unit)
+			}
+			for iKey, values := range nodeValues {
+				instance := myData.GetInstance(iKey)
+				if instance == nil {
+					continue
+				}
+				v := agg.reduce(values)
+				if err := m.SetValueFloat64(instance, v); err != nil {
+					logger.Error().Float64(agg.name, v).Err(err).Msg("Unable to set " + agg.name)
+				}
+			}
+		}
+	}
+}
+
+// powerCost is the electricity rate used for power_cost_per_hour, in currency per kWh
+type powerCost struct {
+	rate         float64
+	clusterRates map[string]float64
+	currency     string
+}
+
+// rateFor returns the rate of cluster, falling back to the global rate
+func (p *powerCost) rateFor(cluster string) (float64, bool) {
+	if rate, ok := p.clusterRates[cluster]; ok {
+		return rate, true
+	}
+	return p.rate, p.rate > 0
+}
+
+// calculatePowerCost sets power_cost_per_hour = power (W) / 1000 * rate for every node with a power value.
+// PSU, chassis and cluster instances are skipped, their power is already part of the node power.
+func calculatePowerCost(myData *matrix.Matrix, rate float64, currency string, logger *logging.Logger) {
+	power := myData.GetMetric("power")
+	if power == nil {
+		return
+	}
+	if err := matrix.CreateMetric("power_cost_per_hour", myData); err != nil {
+		logger.Error().Err(err).Msg("Unable to create power_cost_per_hour")
+		return
+	}
+	cost := myData.GetMetric("power_cost_per_hour")
+	if currency != "" {
+		cost.SetLabel("currency", currency)
+	}
+	for key, instance := range myData.GetInstances() {
+		if scope := instance.GetLabel("scope"); scope != "" && scope != "node" {
+			continue
+		}
+		watts, ok := power.GetValueFloat64(instance)
+		if !ok {
+			continue
+		}
+		c := watts / 1000 * rate
+		if err := cost.SetValueFloat64(instance, c); err != nil {
+			logger.Error().Float64("power_cost_per_hour", c).Err(err).Str("node", key).Msg("Unable to set power_cost_per_hour")
+		}
+	}
+}
+
+// fanSmoothing keeps an exponential moving average of the average fan speed of each node across polls
+type fanSmoothing struct {
+	alpha float64
+	// smoothed fan speed by node
+	speeds map[string]float64
+}
+
+func newFanSmoothing(alpha float64) *fanSmoothing {
+	return &fanSmoothing{alpha: alpha, speeds: make(map[string]float64)}
+}
+
+// smooth sets fan_speed_smoothed of each node with an average fan speed. The first reading of a node starts its
+// average. Nodes without a reading in this poll are forgotten, so a node that returns starts over.
+func (s *fanSmoothing) smooth(myData *matrix.Matrix, logger *logging.Logger) {
+	average := myData.GetMetric("average_fan_speed")
+	if average == nil {
+		return
+	}
+	if err := matrix.CreateMetric("fan_speed_smoothed", myData); err != nil {
+		logger.Error().Err(err).Msg("Unable to create fan_speed_smoothed")
+		return
+	}
+	smoothed := myData.GetMetric("fan_speed_smoothed")
+	seen := make(map[string]bool)
+	for key, instance := range myData.GetInstances() {
+		speed, ok := average.GetValueFloat64(instance)
+		if !ok {
+			continue
+		}
+		seen[key] = true
+		if previous, has := s.speeds[key]; has {
+			speed = s.alpha*speed + (1-s.alpha)*previous
+		}
+		s.speeds[key] = speed
+		if err := smoothed.SetValueFloat64(instance, speed); err != nil {
+			logger.Error().Float64("fan_speed_smoothed", speed).Err(err).Str("node", key).Msg("Unable to set fan_speed_smoothed")
+		}
+	}
+	for key := range s.speeds {
+		if !seen[key] {
+			delete(s.speeds, key)
+		}
+	}
+}
+
+// wattsPerKIOPS joins node power with the node ops of a perf collector, see matrix.Reader
+type wattsPerKIOPS struct {
+	object string // published object holding the ops metric
+	ops    string // ops per second metric
+	label  string // node label of the published object
+}
+
+// calculateWattsPerKIOPS sets watts_per_kiops = power / (ops / 1000) for nodes with power and ops.
+// Nodes without ops or with zero ops are skipped.
+func calculateWattsPerKIOPS(myData *matrix.Matrix, perf *matrix.Matrix, w wattsPerKIOPS, logger *logging.Logger) {
+	power := myData.GetMetric("power")
+	ops := perf.DisplayMetric(w.ops)
+	if power == nil || ops == nil {
+		logger.Debug().Str("object", w.object).Str("ops", w.ops).Msg("ops metric not found")
+		return
+	}
+
+	nodeOps := make(map[string]float64)
+	for _, instance := range perf.GetInstances() {
+		if v, ok := ops.GetValueFloat64(instance); ok {
+			nodeOps[instance.GetLabel(w.label)] += v
+		}
+	}
+
+	if err := matrix.CreateMetric("watts_per_kiops", myData); err != nil {
+		logger.Error().Err(err).Msg("Unable to create watts_per_kiops")
+		return
+	}
+	wpk := myData.GetMetric("watts_per_kiops")
+	for key, instance := range myData.GetInstances() {
+		watts, ok := power.GetValueFloat64(instance)
+		o := nodeOps[key]
+		if !ok || o <= 0 {
+			continue
+		}
+		v := watts / (o / 1000)
+		if err := wpk.SetValueFloat64(instance, v); err != nil {
+			logger.Error().Float64("watts_per_kiops", v).Err(err).Str("node", key).Msg("Unable to set watts_per_kiops")
+		}
+	}
+}
+
+// powerRange is the power in W of a node model when idle and at full CPU load
+type powerRange struct {
+	idle float64
+	max  float64
+}
+
+// estimate interpolates the power linearly between idle and max, busy is the CPU busy percent
+func (r powerRange) estimate(busy float64) float64 {
+	busy = math.Max(0, math.Min(100, busy))
+	return r.idle + (r.max-r.idle)*busy/100
+}
+
+// defaultPowerModel is the key of the power range used for models without one
+const defaultPowerModel = "default"
+
+// powerEstimate estimates the power of nodes without power sensors, e.g. ONTAP Select, from the CPU busy percent
+// of a perf collector, see matrix.Reader
+type powerEstimate struct {
+	object string                // published object holding the cpu metric
+	cpu    string                // CPU busy percent metric
+	label  string                // node label of the published object
+	ranges map[string]powerRange // keyed by node model or defaultPowerModel
+}
+
+func (e powerEstimate) rangeOf(model string) (powerRange, bool) {
+	if r, ok := e.ranges[model]; ok {
+		return r, true
+	}
+	r, ok := e.ranges[defaultPowerModel]
+	return r, ok
+}
+
+// needsModels is true when the ranges depend on the node model
+func (e powerEstimate) needsModels() bool {
+	_, ok := e.ranges[defaultPowerModel]
+	return len(e.ranges) > 1 || !ok
+}
+
+// collectNodeModels returns the model of each node of the cluster
+func collectNodeModels(ctx context.Context, client *rest.Client) (map[string]string, error) {
+	href := rest.NewHrefBuilder().
+		APIPath("api/cluster/nodes").
+		Fields([]string{"name", "model"}).
+		Build()
+	result, err := rest.FetchContext(ctx, client, href)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch data href=%s err=%w", href, err)
+	}
+	models := make(map[string]string, len(result))
+	for _, r := range result {
+		models[r.Get("name").String()] = r.Get("model").String()
+	}
+	return models, nil
+}
+
+// modelCache keeps the node models across polls, they only change when nodes join or leave the cluster
+type modelCache struct {
+	models map[string]string
+	nodes  int // number of nodes when models was collected
+}
+
+// get returns the cached models while the cluster has the same number of nodes, and otherwise the models returned
+// by collect. When collect fails, the last good models are returned.
+func (c *modelCache) get(nodes int, collect func() (map[string]string, error), logger *logging.Logger) (map[string]string, error) {
+	if c.models != nil && c.nodes == nodes {
+		return c.models, nil
+	}
+	models, err := collect()
+	if err != nil {
+		if c.models != nil {
+			logger.Warn().Err(err).Msg("Unable to refresh node models, using cached models")
+			return c.models, nil
+		}
+		return nil, err
+	}
+	c.models, c.nodes = models, nodes
+	return models, nil
+}
+
+// calculatePowerEstimate sets the power of nodes without measured power, see calculateNodeEnvironment, to the power
+// estimated from their CPU busy percent and labels them estimated=true. Nodes with measured power are never changed.
+func calculatePowerEstimate(myData *matrix.Matrix, perf *matrix.Matrix, measuredPower map[string]bool, nodeModels map[string]string, e powerEstimate, logger *logging.Logger) {
+	power := myData.GetMetric("power")
+	cpu := perf.DisplayMetric(e.cpu)
+	if power == nil || cpu == nil {
+		logger.Debug().Str("object", e.object).Str("cpu", e.cpu).Msg("cpu metric not found")
+		return
+	}
+
+	for _, perfInstance := range perf.GetInstances() {
+		nodeName := perfInstance.GetLabel(e.label)
+		busy, ok := cpu.GetValueFloat64(perfInstance)
+		if nodeName == "" || !ok {
+			continue
+		}
+		if measuredPower[nodeName] {
+			continue
+		}
+		instance := myData.GetInstance(nodeName)
+		r, ok := e.rangeOf(nodeModels[nodeName])
+		if !ok {
+			logger.Debug().Str("node", nodeName).Str("model", nodeModels[nodeName]).Msg("no power range for model, skipping estimate")
+			continue
+		}
+		if instance == nil {
+			var err error
+			if instance, err = myData.NewInstance(nodeName); err != nil {
+				logger.Error().Err(err).Str("node", nodeName).Msg("Unable to create instance")
+				continue
+			}
+			instance.SetLabel("node", nodeName)
+		}
+		instance.SetLabel("estimated", "true")
+		v := r.estimate(busy)
+		if err := power.SetValueFloat64(instance, v); err != nil {
+			logger.Error().Float64("power", v).Err(err).Str("node", nodeName).Msg("Unable to set estimated power")
+		}
+	}
+}
+
+// oidSource maps a sensor to its SNMP OID
+type oidSource interface {
+	lookup(node string, sensorName string) (string, bool)
+}
+
+// oidMap is an oidSource configured in the plugin parameters and keyed by sensor name
+type oidMap map[string]string
+
+func (m oidMap) lookup(_ string, sensorName string) (string, bool) {
+	oid, ok := m[sensorName]
+	return oid, ok
+}
+
+// setSensorOIDs adds the oid label to each sensor instance the source has an OID for.
+// An oid label the sensor data already provides is kept.
+func setSensorOIDs(data *matrix.Matrix, source oidSource) {
+	for _, instance := range data.GetInstances() {
+		if instance.GetLabel("oid") != "" {
+			continue
+		}
+		if oid, ok := source.lookup(instance.GetLabel("node"), instance.GetLabel("sensor")); ok {
+			instance.SetLabel("oid", oid)
+		}
+	}
+}
+
+// calculatePSUInfo sets psu_info to 1 for every PSU of every node the PSU is connected to.
+// The labels of each instance are the requested chassis FRU fields, following the Prometheus info metric pattern.
+func calculatePSUInfo(psuInfo *matrix.Matrix, psus []psu, logger *logging.Logger) {
+	info := psuInfo.GetMetric("psu_info")
+	for _, p := range psus {
+		for _, node := range p.nodes {
+			key := node + "." + p.name
+			instance := psuInfo.GetInstance(key)
+			if instance == nil {
+				var err error
+				if instance, err = psuInfo.NewInstance(key); err != nil {
+					logger.Warn().Err(err).Str("key", key).Msg("Unable to create psu_info instance")
+					continue
+				}
+			}
+			for label, value := range p.labels {
+				instance.SetLabel(label, value)
+			}
+			instance.SetLabel("node", node)
+			instance.SetLabel("psu", p.name)
+			if err := info.SetValueFloat64(instance, 1); err != nil {
+				logger.Error().Err(err).Str("key", key).Msg("Unable to set psu_info")
+			}
+		}
+	}
+}
+
+func NewSensor(p *plugin.AbstractPlugin) plugin.Plugin {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Sensor{AbstractPlugin: p, ctx: ctx, cancel: cancel}
+}
+
+type Sensor struct {
+	*plugin.AbstractPlugin
+	data           *matrix.Matrix
+	client         *rest.Client
+	ctx            context.Context // aborts in-flight REST requests, see Stop
+	cancel         context.CancelFunc
+	instanceKeys   map[string]string
+	instanceLabels map[string]map[string]string
+	haPowerBalance bool
+	history        bool
+	sensorAge      bool
+	unitMetrics    bool
+	chassisScope   bool
+	clusterSummary bool
+	options        sensorOptions
+	psuInfo        *matrix.Matrix
+	psuInfoFields  []psuInfoField
+	fruFields      []string
+	fruCache       *fruCache
+	modelCache     *modelCache
+	oids           oidSource
+	powerCost      *powerCost
+	wattsPerKIOPS  *wattsPerKIOPS
+	powerEstimate  *powerEstimate
+	fanSmoothing   *fanSmoothing
+	shared         matrix.Reader
+	fallbackFile   *fallbackReloader
+	// inputs and skipped nodes of the last run, see ExplainSensor
+	lastMu      sync.Mutex
+	lastInputs  []sensorInput
+	lastSkipped map[string]bool
+}
+
+func (my *Sensor) Init() error {
+
+	var err error
+	if err := my.InitAbc(); err != nil {
+		return err
+	}
+
+	timeout, _ := time.ParseDuration(rest.DefaultTimeout)
+	if my.client, err = rest.New(conf.ZapiPoller(my.ParentParams), timeout, my.Auth); err != nil {
+		my.Logger.Error().Err(err).Msg("connecting")
+		return err
+	}
+
+	if err = my.client.Init(5); err != nil {
+		return err
+	}
+
+	my.data = matrix.New(my.Parent+".Sensor", "environment_sensor", "environment_sensor")
+	my.instanceKeys = make(map[string]string)
+	my.instanceLabels = make(map[string]map[string]string)
+	my.haPowerBalance = ReadPluginKey(my.Params, "ha_power_balance")
+	my.options.weightedFanSpeed = ReadPluginKey(my.Params, "weighted_fan_speed")
+	my.history = ReadPluginKey(my.Params, "interval_history")
+	my.sensorAge = ReadPluginKey(my.Params, "sensor_age")
+	my.unitMetrics = ReadPluginKey(my.Params, "unit_metrics")
+	my.chassisScope = ReadPluginKey(my.Params, "chassis_scope")
+	my.clusterSummary = ReadPluginKey(my.Params, "cluster_summary")
+	my.options.calibration = my.parseCalibration()
+	my.options.primary = my.parsePrimary()
+	my.options.fallback = my.parseFallback()
+	if path := my.Params.GetChildContentS("fallback_file"); path != "" {
+		my.fallbackFile = &fallbackReloader{path: path}
+		my.options.fallback = my.fallbackFile.reload(my.options.fallback, my.Logger)
+	}
+	my.parseDefaultUnits()
+	my.options.validity = my.parseValidity()
+	my.options.canonicalNames = my.parseCanonicalNames()
+	my.options.timeBudget = my.parseTimeBudget()
+	my.options.efficiency = my.parseEfficiency()
+
+	// fan_active_threshold is the speed a fan must exceed to count in fans_active, e.g. fan_active_threshold: 500
+	if t := my.Params.GetChildContentS("fan_active_threshold"); t != "" {
+		if threshold, err := strconv.ParseFloat(t, 64); err != nil || threshold < 0 {
+			my.Logger.Warn().Str("fan_active_threshold", t).Msg("invalid fan active threshold, using 0")
+		} else {
+			my.options.fanActiveThreshold = threshold
+		}
+	}
+
+	// fan_speed_trim leaves the slowest and fastest fraction of fans out of average_fan_speed, so a stuck fan
+	// does not skew it, e.g. fan_speed_trim: 0.1. With weighted_fan_speed it trims fan modules instead of fans
+	if t := my.Params.GetChildContentS("fan_speed_trim"); t != "" {
+		if trim, err := strconv.ParseFloat(t, 64); err != nil || trim < 0 || trim >= 0.5 {
+			my.Logger.Warn().Str("fan_speed_trim", t).Msg("invalid fan speed trim, using 0")
+		} else {
+			my.options.fanSpeedTrim = trim
+		}
+	}
+
+	// split_psu adds an instance per PSU with its power, voltage and current, e.g. split_psu: true
+	my.options.splitPSU = ReadPluginKey(my.Params, "split_psu")
+
+	// fan_speed_smoothing is the weight of the latest reading in fan_speed_smoothed, e.g. fan_speed_smoothing: 0.3
+	if a := my.Params.GetChildContentS("fan_speed_smoothing"); a != "" {
+		if alpha, err := strconv.ParseFloat(a, 64); err != nil || alpha <= 0 || alpha > 1 {
+			my.Logger.Warn().Str("fan_speed_smoothing", a).Msg("smoothing factor must be in (0, 1], ignoring")
+		} else {
+			my.fanSmoothing = newFanSmoothing(alpha)
+		}
+	}
+
+	if c := my.Params.GetChildS("power_cost"); c != nil {
+		my.powerCost = my.parsePowerCost(c)
+	}
+
+	// watts_per_kiops reads node ops from a collector that publishes its results, e.g.
+	//  watts_per_kiops:
+	//    object: node       # the collector template must set publish: true
+	//    ops: total_ops
+	//    label: node
+	if w := my.Params.GetChildS("watts_per_kiops"); w != nil {
+		my.wattsPerKIOPS = &wattsPerKIOPS{
+			object: w.GetChildContentS("object"),
+			ops:    w.GetChildContentS("ops"),
+			label:  w.GetChildContentS("label"),
+		}
+		if my.wattsPerKIOPS.object == "" {
+			my.wattsPerKIOPS.object = "node"
+		}
+		if my.wattsPerKIOPS.ops == "" {
+			my.wattsPerKIOPS.ops = "total_ops"
+		}
+		if my.wattsPerKIOPS.label == "" {
+			my.wattsPerKIOPS.label = "node"
+		}
+		my.shared = matrix.Shared
+	}
+
+	// power_estimate estimates the power of nodes without power sensors from the CPU busy percent that a
+	// collector publishes, e.g.
+	//  power_estimate:
+	//    object: node       # the collector template must set publish: true
+	//    cpu: cpu_busy
+	//    label: node
+	//    models:            # [idle, max] power in W by node model
+	//      default: [150, 400]
+	//      FDvM300: [200, 500]
+	if e := my.Params.GetChildS("power_estimate"); e != nil {
+		my.powerEstimate = my.parsePowerEstimate(e)
+		my.shared = matrix.Shared
+	}
+
+	// oid labels are only added when a mapping is configured, e.g.
+	//  oid:
+	//    PSU1 AmbTemp: 1.3.6.1.4.1.789.1.21.1.2.1.5.1
+	if o := my.Params.GetChildS("oid"); o != nil {
+		oids := make(oidMap)
+		for _, child := range o.GetChildren() {
+			oids[child.GetNameS()] = child.GetContentS()
+		}
+		my.oids = oids
+	}
+
+	// psu_info is only collected when chassis FRU fields are requested, e.g.
+	//  psu_info:
+	//    - firmware-version => firmware
+	//    - part-number
+	if p := my.Params.GetChildS("psu_info"); p != nil {
+		for _, f := range p.GetAllChildContentS() {
+			field, label, _, _ := util.ParseMetric(f)
+			my.psuInfoFields = append(my.psuInfoFields, psuInfoField{field: field, label: label})
+		}
+		my.psuInfo = matrix.New(my.Parent+".Sensor", "environment_sensor", "environment_sensor_psu")
+		if _, err := my.psuInfo.NewMetricFloat64("psu_info"); err != nil {
+			return err
+		}
+	}
+
+	// fru_fields replaces the default chassis FRU fields, e.g. to leave out fields a cluster does not support
+	//  fru_fields:
+	//    - fru-name
+	//    - connected-nodes
+	//    - num-nodes
+	var configuredFields []string
+	if f := my.Params.GetChildS("fru_fields"); f != nil {
+		configuredFields = f.GetAllChildContentS()
+	}
+	my.fruFields = fruFields(configuredFields, my.psuInfoFields)
+	my.Logger.Debug().Strs("fields", my.fruFields).Msg("chassis fru fields")
+
+	// fru_cache_ttl is how long chassis FRU data is reused, e.g. fru_cache_ttl: 1h. 0s collects it every poll
+	my.fruCache = &fruCache{ttl: defaultFRUCacheTTL}
+	my.modelCache = &modelCache{}
+	if t := my.Params.GetChildContentS("fru_cache_ttl"); t != "" {
+		if ttl, err := time.ParseDuration(t); err != nil || ttl < 0 {
+			my.Logger.Warn().Str("fru_cache_ttl", t).Dur("default", defaultFRUCacheTTL).Msg("invalid fru cache ttl, using default")
+		} else {
+			my.fruCache.ttl = ttl
+		}
+	}
+
+	// init environment metrics in plugin matrix
+	// create environment metric if not exists
+	for _, k := range eMetrics {
+		err := matrix.CreateMetric(k, my.data)
+		if err != nil {
+			my.Logger.Warn().Err(err).Str("key", k).Msg("error while creating metric")
+		}
+	}
+
+	// served on the profiling port, see ServeExplainSensor
+	registerExplainHandler(my)
+	return nil
+}
+
+// Stop aborts the plugin's in-flight REST requests when the poller shuts down, see plugin.Stopper, and stops
+// serving /debug/sensor. Requests made after Stop fail immediately
+func (my *Sensor) Stop() {
+	if my.cancel != nil {
+		my.cancel()
+	}
+	unregisterExplainHandler(my)
+}
+
+// parseCalibration reads the calibration offsets, e.g.
+//
+//	calibration:
+//	  PSU1 AmbTemp: -2          # all sensors with this name
+//	  node-01/Ambient Temp: 1.5 # only this sensor of node-01
+func (my *Sensor) parseCalibration() map[string]float64 {
+	calibration := make(map[string]float64)
+	c := my.Params.GetChildS("calibration")
+	if c == nil {
+		return calibration
+	}
+	for _, child := range c.GetChildren() {
+		offset, err := strconv.ParseFloat(child.GetContentS(), 64)
+		if err != nil {
+			my.Logger.Warn().Str("sensor", child.GetNameS()).Str("offset", child.GetContentS()).Msg("invalid calibration offset, ignoring")
+			continue
+		}
+		calibration[child.GetNameS()] = offset
+	}
+	my.Logger.Debug().Int("sensors", len(calibration)).Msg("calibration offsets")
+	return calibration
+}
+
+func (my *Sensor) parsePowerEstimate(e *node.Node) *powerEstimate {
+	estimate := &powerEstimate{
+		object: e.GetChildContentS("object"),
+		cpu:    e.GetChildContentS("cpu"),
+		label:  e.GetChildContentS("label"),
+		ranges: make(map[string]powerRange),
+	}
+	if estimate.object == "" {
+		estimate.object = "node"
+	}
+	if estimate.cpu == "" {
+		estimate.cpu = "cpu_busy"
+	}
+	if estimate.label == "" {
+		estimate.label = "node"
+	}
+	if models := e.GetChildS("models"); models != nil {
+		for _, child := range models.GetChildren() {
+			values := child.GetAllChildContentS()
+			if len(values) != 2 {
+				my.Logger.Warn().Str("model", child.GetNameS()).Strs("range", values).Msg("power range must be [idle, max], ignoring")
+				continue
+			}
+			idle, err1 := strconv.ParseFloat(values[0], 64)
+			maxPower, err2 := strconv.ParseFloat(values[1], 64)
+			if err1 != nil || err2 != nil || idle > maxPower {
+				my.Logger.Warn().Str("model", child.GetNameS()).Strs("range", values).Msg("invalid power range, ignoring")
+				continue
+			}
+			estimate.ranges[child.GetNameS()] = powerRange{idle: idle, max: maxPower}
+		}
+	}
+	return estimate
+}
+
+// parseEfficiency reads the power supply efficiency by node model, e.g.
+//
+//	efficiency:
+//	  default: 0.93
+//	  AFF-A900: 0.95
+//
+// Factors outside (0, 1] are ignored.
+func (my *Sensor) parseEfficiency() map[string]float64 {
+	e := my.Params.GetChildS("efficiency")
+	if e == nil {
+		return nil
+	}
+	efficiency := make(map[string]float64)
+	for _, child := range e.GetChildren() {
+		factor, err := strconv.ParseFloat(child.GetContentS(), 64)
+		if err != nil || factor <= 0 || factor > 1 {
+			my.Logger.Warn().Str("model", child.GetNameS()).Str("efficiency", child.GetContentS()).
+				Float64("default", defaultPSUEfficiency).Msg("efficiency must be in (0, 1], ignoring")
+			continue
+		}
+		efficiency[child.GetNameS()] = factor
+	}
+	return efficiency
+}
+
+// parseTimeBudget reads the time a run may spend on sensors, e.g. time_budget: 500ms
+func (my *Sensor) parseTimeBudget() time.Duration {
+	b := my.Params.GetChildContentS("time_budget")
+	if b == "" {
+		return 0
+	}
+	budget, err := time.ParseDuration(b)
+	if err != nil || budget <= 0 {
+		my.Logger.Warn().Str("time_budget", b).Msg("invalid time budget, ignoring")
+		return 0
+	}
+	return budget
+}
+
+// parseCanonicalNames reads the canonical names of sensors that are reported under different names, e.g.
+//
+//	canonical_names:
+//	  PSU1 Inlet Temp: PSU1 AmbTemp # name variant: canonical name
+//
+// Readings of the variants of a sensor are aggregated once, under the canonical name.
+func (my *Sensor) parseCanonicalNames() map[string]string {
+	c := my.Params.GetChildS("canonical_names")
+	if c == nil {
+		return nil
+	}
+	canonicalNames := make(map[string]string)
+	for _, child := range c.GetChildren() {
+		canonicalNames[child.GetNameS()] = child.GetContentS()
+	}
+	my.Logger.Debug().Int("sensors", len(canonicalNames)).Msg("canonical sensor names")
+	return canonicalNames
+}
+
+// parsePrimary reads the patterns that replace the built-in sensor regexes, e.g. for OEM sensor names
+//
+//	ambient_regex: ^(Ambient Temp|Intake Temperature)$
+//	power_regex: ^PSU\d (InPower|Input Power)$
+//	voltage_regex: ^PSU\d (VIN|Input Voltage)$
+//	current_regex: ^PSU\d (Curr IIN|Input Current)$
+//
+// Empty or invalid patterns keep the built-in regex.
+func (my *Sensor) parsePrimary() *sensorRegexes {
+	primary := *builtinRegexes
+	patterns := primary.byName()
+	for _, name := range []string{"ambient", "power", "voltage", "current"} {
+		re := patterns[name]
+		if pattern := my.Params.GetChildContentS(name + "_regex"); pattern != "" {
+			compiled, err := regexp.Compile(pattern)
+			if err != nil {
+				my.Logger.Warn().Err(err).Str("name", name+"_regex").Msg("invalid sensor pattern, using built-in")
+			} else {
+				*re = compiled
+			}
+		}
+		my.Logger.Debug().Str("name", name+"_regex").Str("pattern", (*re).String()).Msg("sensor pattern")
+	}
+	return &primary
+}
+
+// parseFallback reads the fallback patterns used for sensors the built-in regexes do not match, e.g.
+//
+//	fallback:
+//	  ambient: (?i)inlet
+//	  power: ^PSU\d+ .*(Pwr|Power)
+//
+// Sensors classified by a fallback pattern are labeled classified_by=fallback.
+func (my *Sensor) parseFallback() *sensorRegexes {
+	f := my.Params.GetChildS("fallback")
+	if f == nil {
+		return nil
+	}
+	fallback := &sensorRegexes{}
+	patterns := fallback.byName()
+	for _, child := range f.GetChildren() {
+		re, ok := patterns[child.GetNameS()]
+		if !ok {
+			my.Logger.Warn().Str("name", child.GetNameS()).Msg("unknown fallback pattern, ignoring")
+			continue
+		}
+		compiled, err := regexp.Compile(child.GetContentS())
+		if err != nil {
+			my.Logger.Warn().Err(err).Str("name", child.GetNameS()).Msg("invalid fallback pattern, ignoring")
+			continue
+		}
+		*re = compiled
+	}
+	return fallback
+}
+
+// byName returns the regexes of r by their name in the fallback patterns
+func (r *sensorRegexes) byName() map[string]**regexp.Regexp {
+	return map[string]**regexp.Regexp{
+		"ambient": &r.ambient,
+		"power":   &r.power,
+		"voltage": &r.voltage,
+		"current": &r.current,
+	}
+}
+
+// fallbackReloader reloads the fallback patterns from a YAML file when the file changes, e.g.
+//
+//	fallback_file: /opt/harvest/conf/sensor_fallback.yaml
+//
+// with the same keys as the fallback parameter
+//
+//	ambient: (?i)inlet
+//	power: ^PSU\d+ .*(Pwr|Power)
+//
+// This lets field engineers tune the patterns without restarting the poller.
+type fallbackReloader struct {
+	path    string
+	modTime time.Time
+	missing bool
+}
+
+// reload returns the patterns of the file when it changed since the last call, and current otherwise.
+// When the file can not be read or one of its patterns is invalid, current is kept and the error is logged once
+// per change of the file.
+func (f *fallbackReloader) reload(current *sensorRegexes, logger *logging.Logger) *sensorRegexes {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		if !f.missing {
+			logger.Error().Err(err).Str("path", f.path).Msg("Unable to stat fallback file, keeping previous patterns")
+			f.missing = true
+			f.modTime = time.Time{}
+		}
+		return current
+	}
+	f.missing = false
+	if info.ModTime().Equal(f.modTime) {
+		return current
+	}
+	f.modTime = info.ModTime()
+	n, err := tree.ImportYaml(f.path)
+	if err != nil {
+		logger.Error().Err(err).Str("path", f.path).Msg("Unable to read fallback file, keeping previous patterns")
+		return current
+	}
+	fallback := &sensorRegexes{}
+	patterns := fallback.byName()
+	for _, child := range n.GetChildren() {
+		re, ok := patterns[child.GetNameS()]
+		if !ok {
+			logger.Error().Str("path", f.path).Str("name", child.GetNameS()).Msg("Unknown fallback pattern, keeping previous patterns")
+			return current
+		}
+		if *re, err = regexp.Compile(child.GetContentS()); err != nil {
+			logger.Error().Err(err).Str("path", f.path).Str("name", child.GetNameS()).Msg("Invalid fallback pattern, keeping previous patterns")
+			return current
+		}
+	}
+	logger.Info().Str("path", f.path).Msg("Reloaded fallback patterns")
+	return fallback
+}
+
+// parseValidity reads the sensor label that flags invalid readings, e.g.
+//
+//	validity:
+//	  label: reading_valid   # the template must collect it, e.g. ^reading-valid => reading_valid
+//	  min_confidence: 0.8    # optional, for labels with a numeric confidence, defaults to 0.5
+//
+// Invalid readings are excluded from the environment metrics. Without validity, all readings are used.
+func (my *Sensor) parseValidity() *sensorValidity {
+	v := my.Params.GetChildS("validity")
+	if v == nil {
+		return nil
+	}
+	validity := &sensorValidity{label: v.GetChildContentS("label"), minConfidence: 0.5}
+	if validity.label == "" {
+		my.Logger.Warn().Msg("validity without label, ignoring")
+		return nil
+	}
+	if c := v.GetChildContentS("min_confidence"); c != "" {
+		minConfidence, err := strconv.ParseFloat(c, 64)
+		if err != nil {
+			my.Logger.Warn().Str("min_confidence", c).Msg("invalid min_confidence, using the default")
+		} else {
+			validity.minConfidence = minConfidence
+		}
+	}
+	return validity
+}
+
+// parseDefaultUnits reads the units assumed for sensors that do not report one, e.g.
+//
+//	default_power_unit: W
+//	default_voltage_unit: mV
+//	default_current_unit: mA
+//
+// Sensors that report a unit keep it, so unknown units are still logged.
+func (my *Sensor) parseDefaultUnits() {
+	defaults := []struct {
+		param string
+		unit  *string
+		valid func(string) bool
+	}{
+		{param: "default_power_unit", unit: &my.options.defaultPowerUnit, valid: IsValidUnit},
+		{param: "default_voltage_unit", unit: &my.options.defaultVoltageUnit, valid: func(u string) bool { return u == "mV" || u == "V" }},
+		{param: "default_current_unit", unit: &my.options.defaultCurrentUnit, valid: func(u string) bool { return u == "mA" || u == "A" }},
+	}
+	for _, d := range defaults {
+		unit := my.Params.GetChildContentS(d.param)
+		if unit == "" {
+			continue
+		}
+		if !d.valid(unit) {
+			my.Logger.Warn().Str(d.param, unit).Msg("invalid default unit, ignoring")
+			continue
+		}
+		*d.unit = unit
+	}
+}
+
+// parsePowerCost reads the electricity rate in currency per kWh, e.g.
+//
+//	power_cost:
+//	  rate: 0.12       # all clusters
+//	  currency: USD
+//	  clusters:
+//	    cluster-01: 0.2 # only this cluster
+func (my *Sensor) parsePowerCost(c *node.Node) *powerCost {
+	p := &powerCost{clusterRates: make(map[string]float64), currency: c.GetChildContentS("currency")}
+	if r := c.GetChildContentS("rate"); r != "" {
+		rate, err := strconv.ParseFloat(r, 64)
+		if err != nil {
+			my.Logger.Warn().Str("rate", r).Msg("invalid power cost rate, ignoring")
+		} else {
+			p.rate = rate
+		}
+	}
+	if clusters := c.GetChildS("clusters"); clusters != nil {
+		for _, child := range clusters.GetChildren() {
+			rate, err := strconv.ParseFloat(child.GetContentS(), 64)
+			if err != nil {
+				my.Logger.Warn().Str("cluster", child.GetNameS()).Str("rate", child.GetContentS()).Msg("invalid power cost rate, ignoring")
+				continue
+			}
+			p.clusterRates[child.GetNameS()] = rate
+		}
+	}
+	return p
+}
+
+// estimatePower estimates the power of nodes without measured power, before the metrics derived from power.
+// nodes is the number of nodes of the cluster, the node models are collected again when it changes
+func (my *Sensor) estimatePower(measuredPower map[string]bool, nodes int) {
+	perf, ok := my.shared.Get(my.powerEstimate.object)
+	if !ok {
+		my.Logger.Debug().Str("object", my.powerEstimate.object).Msg("no published data, skipping power estimate")
+		return
+	}
+	var models map[string]string
+	if my.powerEstimate.needsModels() {
+		var err error
+		models, err = my.modelCache.get(nodes, func() (map[string]string, error) {
+			return collectNodeModels(my.ctx, my.client)
+		}, my.Logger)
+		if err != nil {
+			my.Logger.Warn().Err(err).Msg("Unable to collect node models, using the default power range")
+		}
+	}
+	calculatePowerEstimate(my.data, perf, measuredPower, models, *my.powerEstimate, my.Logger)
+}
+
+func (my *Sensor) Run(dataMap map[string]*matrix.Matrix) ([]*matrix.Matrix, error) {
+	data := dataMap[my.Object]
+	// Purge and reset data
+	my.data.PurgeInstances()
+	my.data.Reset()
+
+	// Set all global labels if they don't already exist
+	my.data.SetGlobalLabels(data.GetGlobalLabels())
+
+	if my.fallbackFile != nil {
+		fallback := my.fallbackFile.reload(my.options.fallback, my.Logger)
+		// ExplainSensor reads the options while holding lastMu
+		my.lastMu.Lock()
+		my.options.fallback = fallback
+		my.lastMu.Unlock()
+	}
+
+	// Collect chassis fru show, so we can determine if a controller's PSUs are shared or not
+	fru, err := my.fruCache.get(countNodes(data), time.Now(), func() (*chassisFRU, error) {
+		return collectChassisFRU(my.ctx, my.client, my.fruFields, my.psuInfoFields, my.Logger)
+	}, my.Logger)
+	if err != nil {
+		return nil, err
+	}
+	if len(fru.nodeToNumNode) == 0 {
+		my.Logger.Debug().Msg("No chassis field replaceable units found")
+	}
+
+	valueKey, minKey, maxKey, timeKey := zapiValueKey, zapiIntervalMinKey, zapiIntervalMaxKey, zapiReadingTimeKey
+	if my.Parent == "Rest" {
+		valueKey, minKey, maxKey, timeKey = restValueKey, restIntervalMinKey, restIntervalMaxKey, restReadingTimeKey
+	}
+	inputs := sensorInputs(data, valueKey, my.options.validity)
+	output, env, err := calculateNodeEnvironment(data, my.Logger, valueKey, my.data, fru.nodeToNumNode, my.options)
+	if err != nil {
+		return nil, err
+	}
+	my.lastMu.Lock()
+	my.lastInputs, my.lastSkipped = inputs, env.skippedNodes
+	my.lastMu.Unlock()
+	if my.powerEstimate != nil {
+		my.estimatePower(env.measuredPower, countNodes(data))
+	}
+	if my.fanSmoothing != nil {
+		my.fanSmoothing.smooth(my.data, my.Logger)
+	}
+	if my.history {
+		calculateIntervalHistory(data, minKey, maxKey, my.data, my.options, my.Logger)
+	}
+	if my.sensorAge {
+		calculateSensorAge(data, timeKey, time.Now(), my.Logger)
+	}
+	if my.unitMetrics {
+		calculateUnitMetrics(data, valueKey, my.data, my.options, my.Logger)
+	}
+	if my.haPowerBalance {
+		calculateHAPowerBalance(my.data, fru.connectedNodes, my.Logger)
+	}
+	if my.chassisScope {
+		calculateChassisScope(my.data, fru.connectedNodes, my.Logger)
+	}
+	if my.clusterSummary {
+		calculateClusterSummary(my.data, my.Logger)
+	}
+	if my.powerCost != nil {
+		if rate, ok := my.powerCost.rateFor(data.GetGlobalLabels()["cluster"]); ok {
+			calculatePowerCost(my.data, rate, my.powerCost.currency, my.Logger)
+		}
+	}
+	if my.wattsPerKIOPS != nil {
+		if perf, ok := my.shared.Get(my.wattsPerKIOPS.object); ok {
+			calculateWattsPerKIOPS(my.data, perf, *my.wattsPerKIOPS, my.Logger)
+		} else {
+			my.Logger.Debug().Str("object", my.wattsPerKIOPS.object).Msg("no published data, skipping watts_per_kiops")
+		}
+	}
+	if my.oids != nil {
+		setSensorOIDs(data, my.oids)
+	}
+	if my.psuInfo != nil {
+		my.psuInfo.PurgeInstances()
+		my.psuInfo.Reset()
+		my.psuInfo.SetGlobalLabels(data.GetGlobalLabels())
+		calculatePSUInfo(my.psuInfo, fru.psus, my.Logger)
+		output = append(output, my.psuInfo)
 	}
-	return calculateEnvironmentMetrics(data, my.Logger, valueKey, my.data, nodeToNumNode)
+	return output, nil
 }
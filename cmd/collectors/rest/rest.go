@@ -30,6 +30,7 @@ import (
 	"github.com/netapp/harvest/v2/pkg/tree/node"
 	"github.com/tidwall/gjson"
 	"os"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -38,11 +39,18 @@ import (
 
 type Rest struct {
 	*collector.AbstractCollector
-	Client    *rest.Client
-	Prop      *prop
-	endpoints []*endPoint
+	Client     *rest.Client
+	Prop       *prop
+	endpoints  []*endPoint
+	labelCache *collector.LabelCache
+	// field that splits the data query into one query per node, see getData
+	splitField       string
+	fetchConcurrency int
 }
 
+// defaultFetchConcurrency is the number of per node queries in flight with split_by_node
+const defaultFetchConcurrency = 4
+
 type endPoint struct {
 	prop *prop
 	name string
@@ -60,6 +68,8 @@ type prop struct {
 	Fields         []string
 	APIType        string // public, private
 	Filter         []string
+	JoinLabel      string // endpoints only, label of the main instances used to join the endpoint records
+	JoinField      string // endpoints only, field of the endpoint records matched against JoinLabel
 }
 
 type Metric struct {
@@ -148,6 +158,17 @@ func (r *Rest) InitVars(config *node.Node) {
 	} else {
 		r.Logger.Info().Str("timeout", rest.DefaultTimeout).Msg("Using default timeout")
 	}
+
+	// split_by_node: node.name queries the records of each node separately, see getData
+	r.splitField = config.GetChildContentS("split_by_node")
+	r.fetchConcurrency = defaultFetchConcurrency
+	if c := config.GetChildContentS("fetch_concurrency"); c != "" {
+		if concurrency, err := strconv.Atoi(c); err != nil || concurrency < 1 {
+			r.Logger.Warn().Str("fetch_concurrency", c).Int("default", defaultFetchConcurrency).Msg("invalid fetch concurrency, using default")
+		} else {
+			r.fetchConcurrency = concurrency
+		}
+	}
 }
 
 func (r *Rest) InitClient() error {
@@ -240,6 +261,16 @@ func (r *Rest) initEndPoints() error {
 				if line1.GetNameS() == "counters" {
 					r.ParseRestCounters(line1, &prop)
 				}
+				if line1.GetNameS() == "join" {
+					prop.JoinLabel = line1.GetChildContentS("label")
+					prop.JoinField = line1.GetChildContentS("field")
+				}
+			}
+			if (prop.JoinLabel == "") != (prop.JoinField == "") {
+				return errs.New(errs.ErrInvalidParam, "endpoint "+prop.Query+" join requires both label and field")
+			}
+			if prop.JoinField != "" && prop.APIType == "private" {
+				prop.Fields = append(prop.Fields, prop.JoinField)
 			}
 			e.prop = &prop
 			r.endpoints = append(r.endpoints, &e)
@@ -299,14 +330,10 @@ func (r *Rest) PollData() (map[string]*matrix.Matrix, error) {
 
 	startTime = time.Now()
 
-	href := rest.NewHrefBuilder().
-		APIPath(r.Prop.Query).
-		Fields(r.Prop.Fields).
-		Filter(r.Prop.Filter).
-		ReturnTimeout(r.Prop.ReturnTimeOut).
-		Build()
+	// when the cached labels are fresh, only fetch instance keys and metrics
+	cached := r.labelCache != nil && r.labelCache.IsFresh(startTime)
 
-	if records, err = r.GetRestData(href); err != nil {
+	if records, err = r.getData(cached); err != nil {
 		return nil, err
 	}
 
@@ -314,12 +341,117 @@ func (r *Rest) PollData() (map[string]*matrix.Matrix, error) {
 		return nil, errs.New(errs.ErrNoInstance, "no "+r.Object+" instances on cluster")
 	}
 
-	return r.pollData(startTime, records, func(e *endPoint) ([]gjson.Result, error) {
+	if cached && !r.labelCache.Matches(r.instanceKeys(records)) {
+		r.Logger.Debug().Msg("instances changed, refreshing label cache")
+		cached = false
+		if records, err = r.getData(false); err != nil {
+			return nil, err
+		}
+	}
+
+	return r.pollData(startTime, records, cached, func(e *endPoint) ([]gjson.Result, error) {
 		return r.processEndPoint(e)
 	})
 }
 
-func (r *Rest) pollData(startTime time.Time, records []gjson.Result, endpointFunc func(e *endPoint) ([]gjson.Result, error)) (map[string]*matrix.Matrix, error) {
+// dataHref returns the href of the data query, filter is added to the filter of the template
+func (r *Rest) dataHref(cached bool, filter ...string) string {
+	fields := r.Prop.Fields
+	if cached {
+		fields = r.cachedFields()
+	}
+	return rest.NewHrefBuilder().
+		APIPath(r.Prop.Query).
+		Fields(fields).
+		Filter(append(slices.Clone(r.Prop.Filter), filter...)).
+		ReturnTimeout(r.Prop.ReturnTimeOut).
+		Build()
+}
+
+// getData fetches the records of the object.
+// With split_by_node, the data query is split into one query per node of the cluster, filtered by the split field,
+// and fetch_concurrency of these queries are in flight at a time, see rest.FetchConcurrent. The pages of each query
+// are still fetched one after the other. Records that do not belong to exactly one node, e.g. unowned disks, are
+// not collected, so only split queries whose records all have the split field set.
+func (r *Rest) getData(cached bool) ([]gjson.Result, error) {
+	if r.splitField == "" {
+		return r.GetRestData(r.dataHref(cached))
+	}
+	nodes, err := r.getNodeNames()
+	if err != nil {
+		return nil, err
+	}
+	hrefs := make([]string, 0, len(nodes))
+	for _, nodeName := range nodes {
+		hrefs = append(hrefs, r.dataHref(cached, r.splitField+"="+nodeName))
+	}
+	r.Logger.Debug().Str("split", r.splitField).Int("queries", len(hrefs)).Int("concurrency", r.fetchConcurrency).Msg("")
+	result, err := rest.FetchConcurrent(r.Client, hrefs, r.fetchConcurrency)
+	if err != nil {
+		return r.handleError(err)
+	}
+	return result, nil
+}
+
+// getNodeNames returns the names of the nodes of the cluster
+func (r *Rest) getNodeNames() ([]string, error) {
+	href := rest.NewHrefBuilder().
+		APIPath("api/cluster/nodes").
+		Fields([]string{"name"}).
+		ReturnTimeout(r.Prop.ReturnTimeOut).
+		Build()
+	records, err := r.GetRestData(href)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(records))
+	for _, record := range records {
+		if name := record.Get("name").String(); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// cachedFields are the fields requested while instance labels are served from the label cache
+func (r *Rest) cachedFields() []string {
+	fields := make([]string, 0, len(r.Prop.InstanceKeys)+len(r.Prop.Metrics))
+	fields = append(fields, r.Prop.InstanceKeys...)
+	for name := range r.Prop.Metrics {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields[len(r.Prop.InstanceKeys):])
+	return fields
+}
+
+// instanceKeys returns the instance key of each record, records without key are skipped
+func (r *Rest) instanceKeys(records []gjson.Result) []string {
+	keys := make([]string, 0, len(records))
+	for _, instanceData := range records {
+		if key := r.instanceKey(r.Prop, instanceData); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (r *Rest) instanceKey(prop *prop, instanceData gjson.Result) string {
+	var instanceKey string
+	for _, k := range prop.InstanceKeys {
+		value := instanceData.Get(k)
+		if value.Exists() {
+			instanceKey += value.String()
+		} else {
+			r.Logger.Trace().Str("key", k).Msg("missing key")
+		}
+	}
+	return instanceKey
+}
+
+// pollData handles the records of the main query and then the endpoints.
+// When cached is true, records only hold instance keys and metrics and the instance labels are restored from the
+// label cache. The cache only holds labels of the main query, endpoint labels are always fresh.
+func (r *Rest) pollData(startTime time.Time, records []gjson.Result, cached bool, endpointFunc func(e *endPoint) ([]gjson.Result, error)) (map[string]*matrix.Matrix, error) {
 
 	var (
 		count        uint64
@@ -327,10 +459,20 @@ func (r *Rest) pollData(startTime time.Time, records []gjson.Result, endpointFun
 	)
 
 	apiD = time.Since(startTime)
+	pollStart := startTime
 	startTime = time.Now()
 
 	count = r.HandleResults(records, r.Prop, false)
 
+	// before the endpoints, so the labels they set are not overwritten by cached ones
+	if r.labelCache != nil {
+		if cached {
+			r.labelCache.Restore(r.Matrix[r.Object])
+		} else {
+			r.labelCache.Update(r.Matrix[r.Object], pollStart)
+		}
+	}
+
 	// process endpoints
 	eCount := r.processEndPoints(endpointFunc)
 	count += eCount
@@ -380,7 +522,11 @@ func (r *Rest) processEndPoints(endpointFunc func(e *endPoint) ([]gjson.Result,
 			r.Logger.Debug().Str("APIPath", endpoint.prop.Query).Msg("no instances on cluster")
 			continue
 		}
-		count = r.HandleResults(records, endpoint.prop, true)
+		if endpoint.prop.JoinLabel != "" {
+			count = r.joinResults(records, endpoint.prop)
+		} else {
+			count = r.HandleResults(records, endpoint.prop, true)
+		}
 	}
 
 	return count
@@ -464,14 +610,7 @@ func (r *Rest) HandleResults(result []gjson.Result, prop *prop, isEndPoint bool)
 
 		if len(prop.InstanceKeys) != 0 {
 			// extract instance key(s)
-			for _, k := range prop.InstanceKeys {
-				value := instanceData.Get(k)
-				if value.Exists() {
-					instanceKey += value.String()
-				} else {
-					r.Logger.Trace().Str("key", k).Msg("missing key")
-				}
-			}
+			instanceKey = r.instanceKey(prop, instanceData)
 
 			if instanceKey == "" {
 				r.Logger.Trace().Msg("Instance key is empty, skipping")
@@ -507,56 +646,7 @@ func (r *Rest) HandleResults(result []gjson.Result, prop *prop, isEndPoint bool)
 		if !isEndPoint {
 			instance.ClearLabels()
 		}
-		for label, display := range prop.InstanceLabels {
-			value := instanceData.Get(label)
-			if value.Exists() {
-				if value.IsArray() {
-					var labelArray []string
-					for _, r := range value.Array() {
-						labelString := r.String()
-						labelArray = append(labelArray, labelString)
-					}
-					sort.Strings(labelArray)
-					instance.SetLabel(display, strings.Join(labelArray, ","))
-				} else {
-					instance.SetLabel(display, value.String())
-				}
-				count++
-			} else {
-				r.Logger.Trace().Str("instKey", instanceKey).Str("label", label).Msg("Missing label value")
-			}
-		}
-
-		for _, metric := range prop.Metrics {
-			metr, ok := mat.GetMetrics()[metric.Name]
-			if !ok {
-				if metr, err = mat.NewMetricFloat64(metric.Name, metric.Label); err != nil {
-					r.Logger.Error().Err(err).
-						Str("name", metric.Name).
-						Msg("NewMetricFloat64")
-				}
-			}
-			f := instanceData.Get(metric.Name)
-			if f.Exists() {
-				var floatValue float64
-				switch metric.MetricType {
-				case "duration":
-					floatValue = HandleDuration(f.String())
-				case "timestamp":
-					floatValue = HandleTimestamp(f.String())
-				case "":
-					floatValue = f.Float()
-				default:
-					r.Logger.Warn().Str("type", metric.MetricType).Str("metric", metric.Name).Msg("unknown metric type")
-				}
-
-				if err = metr.SetValueFloat64(instance, floatValue); err != nil {
-					r.Logger.Error().Err(err).Str("key", metric.Name).Str("metric", metric.Label).
-						Msg("Unable to set float key on metric")
-				}
-				count++
-			}
-		}
+		count += r.setInstanceData(mat, instance, instanceKey, instanceData, prop)
 
 		// for endpoints, we want to remove common keys from metric count
 		if isEndPoint {
@@ -576,6 +666,98 @@ func (r *Rest) HandleResults(result []gjson.Result, prop *prop, isEndPoint bool)
 	return count
 }
 
+// setInstanceData sets the labels and metrics of prop from instanceData on instance and returns the number of values set
+func (r *Rest) setInstanceData(mat *matrix.Matrix, instance *matrix.Instance, instanceKey string, instanceData gjson.Result, prop *prop) uint64 {
+	var (
+		err   error
+		count uint64
+	)
+	for label, display := range prop.InstanceLabels {
+		value := instanceData.Get(label)
+		if value.Exists() {
+			if value.IsArray() {
+				var labelArray []string
+				for _, r := range value.Array() {
+					labelString := r.String()
+					labelArray = append(labelArray, labelString)
+				}
+				sort.Strings(labelArray)
+				instance.SetLabel(display, strings.Join(labelArray, ","))
+			} else {
+				instance.SetLabel(display, value.String())
+			}
+			count++
+		} else {
+			r.Logger.Trace().Str("instKey", instanceKey).Str("label", label).Msg("Missing label value")
+		}
+	}
+
+	for _, metric := range prop.Metrics {
+		metr, ok := mat.GetMetrics()[metric.Name]
+		if !ok {
+			if metr, err = mat.NewMetricFloat64(metric.Name, metric.Label); err != nil {
+				r.Logger.Error().Err(err).
+					Str("name", metric.Name).
+					Msg("NewMetricFloat64")
+			}
+		}
+		f := instanceData.Get(metric.Name)
+		if f.Exists() {
+			var floatValue float64
+			switch metric.MetricType {
+			case "duration":
+				floatValue = HandleDuration(f.String())
+			case "timestamp":
+				floatValue = HandleTimestamp(f.String())
+			case "":
+				floatValue = f.Float()
+			default:
+				r.Logger.Warn().Str("type", metric.MetricType).Str("metric", metric.Name).Msg("unknown metric type")
+			}
+
+			if err = metr.SetValueFloat64(instance, floatValue); err != nil {
+				r.Logger.Error().Err(err).Str("key", metric.Name).Str("metric", metric.Label).
+					Msg("Unable to set float key on metric")
+			}
+			count++
+		}
+	}
+	return count
+}
+
+// joinResults correlates endpoint records with the instances of the main matrix by a shared value instead of the instance key.
+// Every instance whose prop.JoinLabel equals the prop.JoinField of a record gets the labels and metrics of that record.
+// When the join field is an array, the record joins each of its elements.
+func (r *Rest) joinResults(records []gjson.Result, prop *prop) uint64 {
+	var count uint64
+	mat := r.Matrix[r.Object]
+
+	byValue := make(map[string]gjson.Result)
+	for _, record := range records {
+		value := record.Get(prop.JoinField)
+		if !value.Exists() {
+			r.Logger.Trace().Str("field", prop.JoinField).Msg("missing join field")
+			continue
+		}
+		if value.IsArray() {
+			for _, v := range value.Array() {
+				byValue[v.String()] = record
+			}
+		} else {
+			byValue[value.String()] = record
+		}
+	}
+
+	for key, instance := range mat.GetInstances() {
+		record, ok := byValue[instance.GetLabel(prop.JoinLabel)]
+		if !ok {
+			continue
+		}
+		count += r.setInstanceData(mat, instance, key, record, prop)
+	}
+	return count
+}
+
 func (r *Rest) GetRestData(href string) ([]gjson.Result, error) {
 	r.Logger.Debug().Str("href", href).Msg("")
 	if href == "" {
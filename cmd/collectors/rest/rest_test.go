@@ -5,13 +5,21 @@ import (
 	"github.com/netapp/harvest/v2/cmd/collectors"
 	"github.com/netapp/harvest/v2/cmd/poller/collector"
 	"github.com/netapp/harvest/v2/cmd/poller/options"
+	"github.com/netapp/harvest/v2/cmd/tools/rest"
+	"github.com/netapp/harvest/v2/pkg/auth"
 	"github.com/netapp/harvest/v2/pkg/conf"
+	"github.com/netapp/harvest/v2/pkg/logging"
 	"github.com/netapp/harvest/v2/pkg/matrix"
 	"github.com/netapp/harvest/v2/pkg/tree"
 	"github.com/netapp/harvest/v2/pkg/tree/node"
 	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -75,7 +83,7 @@ func TestMain(m *testing.M) {
 	benchRest = newRest("Volume", "volume.yaml")
 	fullPollData = collectors.JSONToGson("testdata/volume-1.json.gz", true)
 	now := time.Now().Truncate(time.Second)
-	_, _ = benchRest.pollData(now, fullPollData, volumeEndpoints)
+	_, _ = benchRest.pollData(now, fullPollData, false, volumeEndpoints)
 
 	os.Exit(m.Run())
 }
@@ -87,12 +95,12 @@ func BenchmarkRestPerf_PollData(b *testing.B) {
 
 	for i := 0; i < b.N; i++ {
 		now = now.Add(time.Minute * 15)
-		mi, _ := benchRest.pollData(now, fullPollData, volumeEndpoints)
+		mi, _ := benchRest.pollData(now, fullPollData, false, volumeEndpoints)
 
 		for _, mm := range mi {
 			ms = append(ms, mm)
 		}
-		mi, err = benchRest.pollData(now, fullPollData, volumeEndpoints)
+		mi, err = benchRest.pollData(now, fullPollData, false, volumeEndpoints)
 		if err != nil {
 			b.Errorf("error: %v", err)
 		}
@@ -125,7 +133,7 @@ func Test_pollDataVolume(t *testing.T) {
 			now := time.Now().Truncate(time.Second)
 			pollData := collectors.JSONToGson(tt.pollDataPath1, true)
 
-			mm, err := r.pollData(now, pollData, volumeEndpoints)
+			mm, err := r.pollData(now, pollData, false, volumeEndpoints)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -144,6 +152,176 @@ func Test_pollDataVolume(t *testing.T) {
 	}
 }
 
+func Test_labelCache(t *testing.T) {
+	r := newRest("Volume", "volume.yaml")
+	r.labelCache = collector.NewLabelCache(time.Hour)
+	now := time.Now().Truncate(time.Second)
+
+	// the endpoint sets is_sis_volume of uuid-42, its value changes between polls
+	sisVolume := "false"
+	endpoints := func(e *endPoint) ([]gjson.Result, error) {
+		if e.prop.Query != "api/private/cli/volume" {
+			return nil, nil
+		}
+		return []gjson.Result{gjson.Parse(`{"volume": "uuid-42", "vserver": "", "is_sis_volume": "` + sisVolume + `"}`)}, nil
+	}
+
+	full := syntheticVolumes(r, 100, true)
+	if _, err := r.pollData(now, full, false, endpoints); err != nil {
+		t.Fatal(err)
+	}
+	want := r.Matrix[r.Object].GetInstance("uuid-42").Copy()
+	if !r.labelCache.IsFresh(now) {
+		t.Fatal("expected a full poll to update the label cache")
+	}
+
+	cached := syntheticVolumes(r, 100, false)
+	if !r.labelCache.Matches(r.instanceKeys(cached)) {
+		t.Fatal("expected cached instance keys to match")
+	}
+	sisVolume = "true"
+	want["is_sis_volume"] = "true"
+	if _, err := r.pollData(now, cached, true, endpoints); err != nil {
+		t.Fatal(err)
+	}
+	instance := r.Matrix[r.Object].GetInstance("uuid-42")
+	for k, v := range want {
+		if got := instance.GetLabel(k); got != v {
+			t.Errorf("label %s got=%s want=%s", k, got, v)
+		}
+	}
+
+	if r.labelCache.Matches(r.instanceKeys(syntheticVolumes(r, 101, false))) {
+		t.Error("expected new instance to invalidate the label cache")
+	}
+
+	fields := r.cachedFields()
+	if len(fields) != len(r.Prop.InstanceKeys)+len(r.Prop.Metrics) {
+		t.Errorf("cachedFields got=%d fields want=%d", len(fields), len(r.Prop.InstanceKeys)+len(r.Prop.Metrics))
+	}
+}
+
+func Test_joinResults(t *testing.T) {
+	volumes := gjson.Parse(`[
+		{"name": "vol1", "svm": {"name": "svm1"}},
+		{"name": "vol2", "svm": {"name": "svm1"}},
+		{"name": "vol3", "svm": {"name": "svm2"}},
+		{"name": "vol4", "svm": {"name": "svm3"}}
+	]`).Array()
+
+	tests := []struct {
+		name      string
+		field     string
+		records   string
+		languages map[string]string
+		quotas    map[string]float64
+	}{
+		{
+			name:  "scalar join field",
+			field: "vserver",
+			records: `[
+				{"vserver": "svm1", "language": "c.utf_8", "quota": 10},
+				{"vserver": "svm2", "language": "en_us", "quota": 20}
+			]`,
+			languages: map[string]string{"svm1vol1": "c.utf_8", "svm1vol2": "c.utf_8", "svm2vol3": "en_us", "svm3vol4": ""},
+			quotas:    map[string]float64{"svm1vol1": 10, "svm1vol2": 10, "svm2vol3": 20},
+		},
+		{
+			name:  "array join field",
+			field: "vservers",
+			records: `[
+				{"vservers": ["svm1", "svm3"], "language": "c.utf_8", "quota": 30}
+			]`,
+			languages: map[string]string{"svm1vol1": "c.utf_8", "svm1vol2": "c.utf_8", "svm2vol3": "", "svm3vol4": "c.utf_8"},
+			quotas:    map[string]float64{"svm1vol1": 30, "svm1vol2": 30, "svm3vol4": 30},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRest("Volume", "volume.yaml")
+			r.HandleResults(volumes, r.Prop, false)
+
+			p := &prop{
+				InstanceLabels: map[string]string{"language": "language"},
+				Metrics:        map[string]*Metric{"quota": {Name: "quota", Label: "quota"}},
+				JoinLabel:      "svm",
+				JoinField:      tt.field,
+			}
+			r.joinResults(gjson.Parse(tt.records).Array(), p)
+
+			mat := r.Matrix[r.Object]
+			if len(mat.GetInstances()) != len(volumes) {
+				t.Errorf("join must not add instances, got %d", len(mat.GetInstances()))
+			}
+			for key, want := range tt.languages {
+				if got := mat.GetInstance(key).GetLabel("language"); got != want {
+					t.Errorf("%s language got=%s want=%s", key, got, want)
+				}
+			}
+			quota := mat.GetMetric("quota")
+			for key, instance := range mat.GetInstances() {
+				got, ok := quota.GetValueFloat64(instance)
+				want, joined := tt.quotas[key]
+				if ok != joined || got != want {
+					t.Errorf("%s quota got=%v,%v want=%v,%v", key, got, ok, want, joined)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkLabelCache compares parsing a large synthetic cluster with and without cached instance labels
+func BenchmarkLabelCache(b *testing.B) {
+	r := newRest("Volume", "volume.yaml")
+	full := syntheticVolumes(r, 20000, true)
+	cached := syntheticVolumes(r, 20000, false)
+	r.labelCache = collector.NewLabelCache(time.Hour)
+	r.HandleResults(full, r.Prop, false)
+	r.labelCache.Update(r.Matrix[r.Object], time.Now())
+
+	b.Run("full", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			r.HandleResults(full, r.Prop, false)
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			r.labelCache.Matches(r.instanceKeys(cached))
+			r.HandleResults(cached, r.Prop, false)
+			r.labelCache.Restore(r.Matrix[r.Object])
+		}
+	})
+}
+
+// syntheticVolumes returns n volume records with unique keys and, when withLabels is true, all template labels
+func syntheticVolumes(r *Rest, n int, withLabels bool) []gjson.Result {
+	records := make([]gjson.Result, 0, n)
+	for i := 0; i < n; i++ {
+		record := "{}"
+		if withLabels {
+			for label := range r.Prop.InstanceLabels {
+				if strings.Contains(label, "#") {
+					continue
+				}
+				record, _ = sjson.Set(record, label, fmt.Sprintf("%s-%d", label, i%50))
+			}
+		}
+		for _, key := range r.Prop.InstanceKeys {
+			record, _ = sjson.Set(record, key, "")
+		}
+		record, _ = sjson.Set(record, r.Prop.InstanceKeys[0], fmt.Sprintf("uuid-%d", i))
+		for name := range r.Prop.Metrics {
+			record, _ = sjson.Set(record, name, i)
+		}
+		records = append(records, gjson.Parse(record))
+	}
+	return records
+}
+
+func noEndpoints(*endPoint) ([]gjson.Result, error) {
+	return nil, nil
+}
+
 func volumeEndpoints(e *endPoint) ([]gjson.Result, error) {
 	path := "testdata/" + strings.ReplaceAll(e.prop.Query, "/", "-") + ".json.gz"
 	gson := collectors.JSONToGson(path, true)
@@ -179,3 +357,53 @@ objects:
 	}
 	return root
 }
+
+func Test_splitByNode(t *testing.T) {
+	var queried sync.Map
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/cluster/nodes" {
+			_, _ = fmt.Fprint(w, `{"records":[{"name":"n1"},{"name":"n2"},{"name":"n3"}],"num_records":3}`)
+			return
+		}
+		nodeName := r.URL.Query().Get("node.name")
+		queried.Store(nodeName, true)
+		_, _ = fmt.Fprintf(w, `{"records":[{"uuid":"%[1]s-a"},{"uuid":"%[1]s-b"}],"num_records":2}`, nodeName)
+	}))
+	defer server.Close()
+
+	insecure := true
+	poller := &conf.Poller{
+		Addr:           strings.TrimPrefix(server.URL, "https://"),
+		Username:       "admin",
+		Password:       "password",
+		UseInsecureTLS: &insecure,
+	}
+	client, err := rest.New(poller, 5*time.Second, auth.NewCredentials(poller, logging.Get()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newRest("Volume", "volume.yaml")
+	r.Client = client
+	r.splitField = "node.name"
+	r.fetchConcurrency = 2
+
+	records, err := r.getData(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, record := range records {
+		got = append(got, record.Get("uuid").String())
+	}
+	// the records of the nodes are in node order
+	want := []string{"n1-a", "n1-b", "n2-a", "n2-b", "n3-a", "n3-b"}
+	if !slices.Equal(got, want) {
+		t.Errorf("records got=%v want=%v", got, want)
+	}
+	for _, nodeName := range []string{"n1", "n2", "n3"} {
+		if _, ok := queried.Load(nodeName); !ok {
+			t.Errorf("node %s not queried", nodeName)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package rest
 
 import (
 	"fmt"
+	"github.com/netapp/harvest/v2/cmd/poller/collector"
 	"github.com/netapp/harvest/v2/pkg/errs"
 	"github.com/netapp/harvest/v2/pkg/tree/node"
 	"github.com/netapp/harvest/v2/pkg/util"
@@ -66,6 +67,16 @@ func (r *Rest) InitCache() error {
 
 	r.ParseRestCounters(counters, r.Prop)
 
+	// instance labels are cached between refreshes only when label_cache_refresh is set.
+	// The cache is keyed by instance key, so templates without keys can not use it.
+	if refresh := r.Params.GetChildContentS("label_cache_refresh"); refresh != "" && len(r.Prop.InstanceKeys) > 0 {
+		if d, err := time.ParseDuration(refresh); err == nil {
+			r.labelCache = collector.NewLabelCache(d)
+		} else {
+			r.Logger.Warn().Err(err).Str("label_cache_refresh", refresh).Msg("Invalid duration, label cache disabled")
+		}
+	}
+
 	r.Logger.Debug().
 		Strs("extracted Instance Keys", r.Prop.InstanceKeys).
 		Int("numMetrics", len(r.Prop.Metrics)).
@@ -7,32 +7,115 @@ Package Description:
           - "rc_percent":    receive data utilization percent
           - "tx_percent":    sent data utilization percent
           - "util_percent":  max utilization percent
+          - "rx_error_percent", "tx_error_percent", "rx_drop_percent", "tx_drop_percent":
+                             errors and drops per packet, when collected
+          - "util_overflow": 1 if rx_percent or tx_percent were outside [0, 1] and clamped, 0 otherwise
+          - "duplex_half":   1 if the duplex label is half, 0 for other duplex values, NaN without duplex label
 		  - "nic_state":     0 if port is up, 1 otherwise
+    Skips loopback ports, see exclude_type_regex and exclude_name_prefix
+    Trims redundant prefixes from the type label, see trim_type_prefix
 */
 
 package nic
 
 import (
+	"github.com/netapp/harvest/v2/cmd/collectors"
 	"github.com/netapp/harvest/v2/cmd/poller/plugin"
 	"github.com/netapp/harvest/v2/pkg/errs"
 	"github.com/netapp/harvest/v2/pkg/matrix"
-	"math"
+	"github.com/netapp/harvest/v2/pkg/util"
+	"regexp"
 	"strconv"
 	"strings"
 )
 
+// by default, loopback ports are skipped since they have no meaningful speed
+const defaultExcludeTypeRegex = `(?i)loopback`
+
+var defaultExcludeNamePrefix = []string{"lo"}
+
+// redundant prefixes trimmed from the nic type label, e.g. if_nic_data becomes data
+var defaultTrimTypePrefix = []string{"nic_", "if_"}
+
 type Nic struct {
 	*plugin.AbstractPlugin
+	excludeType       *regexp.Regexp
+	excludeNamePrefix []string
+	trimTypePrefix    []string
+	clampUtil         bool
 }
 
 func New(p *plugin.AbstractPlugin) plugin.Plugin {
 	return &Nic{AbstractPlugin: p}
 }
 
+func (n *Nic) Init() error {
+	var err error
+	if err = n.InitAbc(); err != nil {
+		return err
+	}
+
+	typeRegex := defaultExcludeTypeRegex
+	if t := n.Params.GetChildContentS("exclude_type_regex"); t != "" {
+		typeRegex = t
+	}
+	if n.excludeType, err = regexp.Compile(typeRegex); err != nil {
+		return errs.New(errs.ErrInvalidParam, "exclude_type_regex: "+err.Error())
+	}
+
+	n.excludeNamePrefix = defaultExcludeNamePrefix
+	if p := n.Params.GetChildS("exclude_name_prefix"); p != nil {
+		n.excludeNamePrefix = p.GetAllChildContentS()
+	}
+
+	n.trimTypePrefix = defaultTrimTypePrefix
+	if p := n.Params.GetChildS("trim_type_prefix"); p != nil {
+		n.trimTypePrefix = p.GetAllChildContentS()
+	}
+
+	// rx/tx can exceed the rated speed due to counter jitter, clamping keeps rx_percent, tx_percent and util_percent
+	// in [0, 1]. Clamping is on unless clamp_util_percent is false
+	n.clampUtil = true
+	if n.Params.GetChildContentS("clamp_util_percent") != "" {
+		n.clampUtil = collectors.ReadPluginKey(n.Params, "clamp_util_percent")
+	}
+	return nil
+}
+
+// trimType strips the configured prefixes from nicType in order, repeating until none match
+// so that stacked prefixes like if_nic_ are removed regardless of their order
+func (n *Nic) trimType(nicType string) string {
+	for {
+		trimmed := nicType
+		for _, prefix := range n.trimTypePrefix {
+			if prefix != "" {
+				trimmed = strings.TrimPrefix(trimmed, prefix)
+			}
+		}
+		if trimmed == nicType {
+			return trimmed
+		}
+		nicType = trimmed
+	}
+}
+
+// isExcluded returns true for ports that should be skipped entirely, e.g. loopback ports
+func (n *Nic) isExcluded(name string, nicType string) bool {
+	if n.excludeType != nil && nicType != "" && n.excludeType.MatchString(nicType) {
+		return true
+	}
+	for _, prefix := range n.excludeNamePrefix {
+		if name != "" && strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // Run speed label is reported in bits-per-second and rx/tx is reported as bytes-per-second
 func (n *Nic) Run(dataMap map[string]*matrix.Matrix) ([]*matrix.Matrix, error) {
 
-	var read, write, rx, tx, util *matrix.Metric
+	var read, write, rx, tx, utilPercent, utilOverflow, duplexHalf *matrix.Metric
 	var err error
 	data := dataMap[n.Object]
 
@@ -60,9 +143,25 @@ func (n *Nic) Run(dataMap map[string]*matrix.Matrix) ([]*matrix.Matrix, error) {
 		}
 	}
 
-	if util = data.GetMetric("util_percent"); util == nil {
-		if util, err = data.NewMetricFloat64("util_percent"); err == nil {
-			util.SetProperty("raw")
+	if utilPercent = data.GetMetric("util_percent"); utilPercent == nil {
+		if utilPercent, err = data.NewMetricFloat64("util_percent"); err == nil {
+			utilPercent.SetProperty("raw")
+		} else {
+			return nil, err
+		}
+	}
+
+	if utilOverflow = data.GetMetric("util_overflow"); utilOverflow == nil {
+		if utilOverflow, err = data.NewMetricFloat64("util_overflow"); err == nil {
+			utilOverflow.SetProperty("raw")
+		} else {
+			return nil, err
+		}
+	}
+
+	if duplexHalf = data.GetMetric("duplex_half"); duplexHalf == nil {
+		if duplexHalf, err = data.NewMetricFloat64("duplex_half"); err == nil {
+			duplexHalf.SetProperty("raw")
 		} else {
 			return nil, err
 		}
@@ -70,34 +169,48 @@ func (n *Nic) Run(dataMap map[string]*matrix.Matrix) ([]*matrix.Matrix, error) {
 
 	for _, instance := range data.GetInstances() {
 
-		var speed, base int
+		// example name = cluster_name:e0a
+		// nic          = e0a
+		if i := instance.GetLabel("id"); i != "" {
+			if split := strings.Split(instance.GetLabel("id"), ":"); len(split) >= 2 {
+				instance.SetLabel("nic", split[1])
+			}
+		}
+
+		if n.isExcluded(instance.GetLabel("nic"), instance.GetLabel("type")) {
+			instance.SetExportable(false)
+			continue
+		}
+
+		var speed int64
 		var s string
 		var err error
 		s = instance.GetLabel("speed")
 		if s != "" {
-			if strings.HasSuffix(s, "M") {
-				base, err = strconv.Atoi(strings.TrimSuffix(s, "M"))
-				if err != nil {
-					n.Logger.Warn().Msgf("convert speed [%s]", s)
-				} else {
-					// NIC speed value converted from Mbps to Bps(bytes per second)
-					speed = base * 125000
-					n.Logger.Trace().
-						Str("originalSpeed", s).
-						Int("convertedSpeed", speed).
-						Msg("converted speed to numeric")
-				}
-			} else if speed, err = strconv.Atoi(s); err != nil {
-				n.Logger.Warn().Msgf("convert speed [%s]", s)
+			// NIC speed value converted from Mbps or Gbps to Bps(bytes per second)
+			if speed, err = collectors.ConvertSpeed(s, 125000); err != nil {
+				n.Logger.Warn().Err(err).Str("speed", s).Msg("convert speed")
+			} else {
+				n.Logger.Trace().
+					Str("originalSpeed", s).
+					Int64("convertedSpeed", speed).
+					Msg("converted speed to numeric")
 			}
 
 			if speed != 0 {
 
 				var rxBytes, txBytes, rxPercent, txPercent float64
 				var rxOk, txOk bool
+				overflow := 0.0
 
 				if rxBytes, rxOk = read.GetValueFloat64(instance); rxOk {
 					rxPercent = rxBytes / float64(speed)
+					if rxPercent < 0 || rxPercent > 1 {
+						overflow = 1
+					}
+					if n.clampUtil {
+						rxPercent = util.Clamp(rxPercent, 0, 1)
+					}
 					err := rx.SetValueFloat64(instance, rxPercent)
 					if err != nil {
 						n.Logger.Error().Stack().Err(err).Msg("error")
@@ -106,6 +219,12 @@ func (n *Nic) Run(dataMap map[string]*matrix.Matrix) ([]*matrix.Matrix, error) {
 
 				if txBytes, txOk = write.GetValueFloat64(instance); txOk {
 					txPercent = txBytes / float64(speed)
+					if txPercent < 0 || txPercent > 1 {
+						overflow = 1
+					}
+					if n.clampUtil {
+						txPercent = util.Clamp(txPercent, 0, 1)
+					}
 					err := tx.SetValueFloat64(instance, txPercent)
 					if err != nil {
 						n.Logger.Error().Stack().Err(err).Msg("error")
@@ -113,42 +232,60 @@ func (n *Nic) Run(dataMap map[string]*matrix.Matrix) ([]*matrix.Matrix, error) {
 				}
 
 				if rxOk || txOk {
-					err := util.SetValueFloat64(instance, math.Max(rxPercent, txPercent))
-					if err != nil {
+					if err := utilOverflow.SetValueFloat64(instance, overflow); err != nil {
 						n.Logger.Error().Stack().Err(err).Msg("error")
 					}
 				}
 			}
 		}
 
-		if s = instance.GetLabel("speed"); strings.HasSuffix(s, "M") {
-			base, err = strconv.Atoi(strings.TrimSuffix(s, "M"))
-			if err != nil {
-				n.Logger.Warn().Msgf("convert speed [%s]", s)
+		if s = instance.GetLabel("speed"); strings.HasSuffix(s, "M") || strings.HasSuffix(s, "G") {
+			// NIC speed value converted from Mbps or Gbps to bps(bits per second)
+			if speed, err = collectors.ConvertSpeed(s, 1_000_000); err != nil {
+				n.Logger.Warn().Err(err).Str("speed", s).Msg("convert speed")
 			} else {
-				// NIC speed value converted from Mbps to bps(bits per second)
-				speed = base * 1_000_000
-				instance.SetLabel("speed", strconv.Itoa(speed))
+				// dashboards show the speed as reported by ONTAP, e.g. 10000M
+				instance.SetLabelPreserving("speed", strconv.FormatInt(speed, 10), "speed_original")
 				n.Logger.Trace().
 					Str("originalSpeed", s).
-					Int("convertedSpeed", speed).
+					Int64("convertedSpeed", speed).
 					Msg("converted speed to numeric")
 			}
 		}
 
-		// truncate redundant prefix in nic type
-		if t := instance.GetLabel("type"); strings.HasPrefix(t, "nic_") {
-			instance.SetLabel("type", strings.TrimPrefix(t, "nic_"))
+		// 1 for half-duplex links, NaN when the port does not report its duplex
+		if duplex := instance.GetLabel("duplex"); duplex != "" {
+			half := 0.0
+			if strings.EqualFold(duplex, "half") {
+				half = 1
+			}
+			if err = duplexHalf.SetValueFloat64(instance, half); err != nil {
+				n.Logger.Error().Err(err).Str("duplex", duplex).Msg("set duplex_half")
+			}
+		} else {
+			duplexHalf.SetValueNAN(instance)
 		}
-		// example name = cluster_name:e0a
-		// nic          = e0a
 
-		if i := instance.GetLabel("id"); i != "" {
-			if split := strings.Split(instance.GetLabel("id"), ":"); len(split) >= 2 {
-				instance.SetLabel("nic", split[1])
-			}
+		// truncate redundant prefixes in nic type
+		if t := instance.GetLabel("type"); t != "" {
+			instance.SetLabel("type", n.trimType(t))
 		}
+	}
+
+	// utilization is the busier direction
+	busier := data.MaxOf("rx_percent", "tx_percent")
+	if _, err = data.ComputeMetric(utilPercent.GetName(), func(instance *matrix.Instance) (float64, bool) {
+		value, ok := busier(instance)
+		if ok && n.clampUtil {
+			value = util.Clamp(value, 0, 1)
+		}
+		return value, ok
+	}); err != nil {
+		return nil, err
+	}
 
+	if err = collectors.SetNicErrorRates(data); err != nil {
+		return nil, err
 	}
 
 	return nil, nil
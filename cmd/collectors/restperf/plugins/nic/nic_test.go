@@ -0,0 +1,102 @@
+package nic
+
+import (
+	"bytes"
+	"github.com/netapp/harvest/v2/cmd/poller/options"
+	"github.com/netapp/harvest/v2/cmd/poller/plugin"
+	"github.com/netapp/harvest/v2/pkg/logging"
+	"github.com/netapp/harvest/v2/pkg/matrix"
+	"github.com/netapp/harvest/v2/pkg/tree/node"
+	"github.com/rs/zerolog"
+	"strconv"
+	"testing"
+)
+
+func TestNic_Excluded(t *testing.T) {
+	params := node.NewS("Nic")
+	n := &Nic{AbstractPlugin: plugin.New("RestPerf", options.New(), params, nil, "nic", nil)}
+	if err := n.Init(); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zl := zerolog.New(&buf).Level(zerolog.WarnLevel)
+	n.Logger = &logging.Logger{Logger: &zl}
+
+	data := matrix.New("RestPerf", "nic", "nic")
+	rx, _ := data.NewMetricFloat64("receive_bytes")
+	tx, _ := data.NewMetricFloat64("transmit_bytes")
+	ports := []struct {
+		name    string
+		nicType string
+		speed   string
+	}{
+		{name: "e0a", nicType: "nic_ixl", speed: "10000M"},
+		{name: "losk", nicType: "nic_ixl", speed: "auto"},
+		{name: "e0z", nicType: "nic_loopback", speed: "auto"},
+	}
+	for _, p := range ports {
+		name := p.name
+		instance, _ := data.NewInstance(name)
+		instance.SetLabel("id", "cluster:"+name)
+		instance.SetLabel("type", p.nicType)
+		instance.SetLabel("speed", p.speed)
+		_ = rx.SetValueFloat64(instance, 125000)
+		_ = tx.SetValueFloat64(instance, 125000)
+	}
+
+	if _, err := n.Run(map[string]*matrix.Matrix{"nic": data}); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.Len() != 0 {
+		t.Errorf("expected no warnings, got %s", buf.String())
+	}
+	for _, p := range ports {
+		instance := data.GetInstance(p.name)
+		excluded := p.name != "e0a"
+		if instance.IsExportable() == excluded {
+			t.Errorf("port %s expected exportable=%v", p.name, !excluded)
+		}
+		_, ok := data.GetMetric("util_percent").GetValueFloat64(instance)
+		if ok == excluded {
+			t.Errorf("port %s expected util_percent set=%v", p.name, !excluded)
+		}
+	}
+}
+
+func TestNic_ClampUtil(t *testing.T) {
+	for _, clamp := range []bool{false, true} {
+		params := node.NewS("Nic")
+		params.NewChildS("clamp_util_percent", strconv.FormatBool(clamp))
+		n := &Nic{AbstractPlugin: plugin.New("RestPerf", options.New(), params, nil, "nic", nil)}
+		if err := n.Init(); err != nil {
+			t.Fatal(err)
+		}
+
+		data := matrix.New("RestPerf", "nic", "nic")
+		rx, _ := data.NewMetricFloat64("receive_bytes")
+		_, _ = data.NewMetricFloat64("transmit_bytes")
+		instance, _ := data.NewInstance("e0a")
+		instance.SetLabel("speed", "1000M")
+		// 10% above the rated speed of 125,000,000 bytes per second
+		_ = rx.SetValueFloat64(instance, 137_500_000)
+
+		if _, err := n.Run(map[string]*matrix.Matrix{"nic": data}); err != nil {
+			t.Fatal(err)
+		}
+
+		want := 1.1
+		if clamp {
+			want = 1
+		}
+		if got, _ := data.GetMetric("util_percent").GetValueFloat64(instance); got != want {
+			t.Errorf("clamp=%v expected util_percent=%v, got %v", clamp, want, got)
+		}
+		if got, _ := data.GetMetric("rx_percent").GetValueFloat64(instance); got != want {
+			t.Errorf("clamp=%v expected rx_percent=%v, got %v", clamp, want, got)
+		}
+		if got, _ := data.GetMetric("util_overflow").GetValueFloat64(instance); got != 1 {
+			t.Errorf("clamp=%v expected util_overflow=1, got %v", clamp, got)
+		}
+	}
+}
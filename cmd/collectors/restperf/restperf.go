@@ -79,6 +79,8 @@ type perfProp struct {
 	latencyIoReqd       int
 	qosLabels           map[string]string
 	disableConstituents bool
+	semantics           *matrix.SemanticsChecker
+	warmup              *matrix.Warmup
 }
 
 type metricResponse struct {
@@ -178,6 +180,13 @@ func (r *RestPerf) InitMatrix() error {
 	// init perf properties
 	r.perfProp.latencyIoReqd = r.loadParamInt("latency_io_reqd", latencyIoReqd)
 	r.perfProp.isCacheEmpty = true
+	if r.Params.GetChildContentS("check_counter_semantics") == "true" {
+		r.perfProp.semantics = matrix.NewSemanticsChecker()
+	}
+	var err error
+	if r.perfProp.warmup, err = collector.ParseWarmup(r.Params.GetChildContentS("warmup"), time.Now()); err != nil {
+		return err
+	}
 	// overwrite from abstract collector
 	mat.Object = r.Prop.Object
 	// Add system (cluster) name
@@ -1063,6 +1072,10 @@ func (r *RestPerf) pollData(startTime time.Time, perfRecords []rest.PerfRecord)
 	// cache raw data for next poll
 	cachedData := curMat.Clone(matrix.With{Data: true, Metrics: true, Instances: true, ExportInstances: true})
 
+	if r.perfProp.semantics != nil {
+		r.checkCounterSemantics(cachedData)
+	}
+
 	orderedNonDenominatorMetrics := make([]*matrix.Metric, 0, len(curMat.GetMetrics()))
 	orderedNonDenominatorKeys := make([]string, 0, len(orderedNonDenominatorMetrics))
 
@@ -1224,6 +1237,10 @@ func (r *RestPerf) pollData(startTime time.Time, perfRecords []rest.PerfRecord)
 	_ = r.Metadata.LazySetValueInt64("calc_time", "data", calcD.Microseconds())
 	_ = r.Metadata.LazySetValueUint64("skips", "data", uint64(totalSkips))
 
+	if r.perfProp.warmup != nil && r.perfProp.warmup.Apply(curMat, time.Now()) {
+		r.Logger.Debug().Msg("warming up, cooked counters are not exported")
+	}
+
 	// store cache for next poll
 	r.Matrix[r.Object] = cachedData
 
@@ -1321,6 +1338,23 @@ func (r *RestPerf) getParentOpsCounters(data *matrix.Matrix) error {
 	return nil
 }
 
+// checkCounterSemantics logs an advisory for counters whose raw values do not behave like their counter type
+func (r *RestPerf) checkCounterSemantics(raw *matrix.Matrix) {
+	for key, metric := range raw.GetMetrics() {
+		if c := r.counterLookup(metric, key); c != nil {
+			metric.SetProperty(c.counterType)
+		}
+	}
+	for _, a := range r.perfProp.semantics.Observe(raw) {
+		r.Logger.Warn().
+			Str("counter", a.Metric).
+			Str("property", a.Property).
+			Str("suggested", a.Suggested).
+			Float64("ratio", a.Ratio).
+			Msg("counter property looks wrong, check the template")
+	}
+}
+
 func (r *RestPerf) counterLookup(metric *matrix.Metric, metricKey string) *counter {
 	var c *counter
 
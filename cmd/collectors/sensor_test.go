@@ -1,16 +1,31 @@
 package collectors
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/netapp/harvest/v2/cmd/poller/collector"
 	"github.com/netapp/harvest/v2/cmd/poller/plugin"
+	"github.com/netapp/harvest/v2/cmd/tools/rest"
+	"github.com/netapp/harvest/v2/pkg/auth"
+	"github.com/netapp/harvest/v2/pkg/conf"
 	"github.com/netapp/harvest/v2/pkg/logging"
 	"github.com/netapp/harvest/v2/pkg/matrix"
 	"github.com/netapp/harvest/v2/pkg/tree"
 	"github.com/netapp/harvest/v2/pkg/tree/node"
+	"github.com/tidwall/gjson"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 var testxml = "testdata/sensor.xml"
@@ -23,12 +38,31 @@ func TestMain(m *testing.M) {
 }
 
 func loadTestdata() {
+	mat = loadSensorXML(testxml,
+		"environment-sensors-info.critical-high-threshold",
+		"environment-sensors-info.critical-low-threshold",
+		"environment-sensors-info.threshold-sensor-value",
+	)
+
+	sensor.data = matrix.New("Sensor", "environment_sensor", "environment_sensor")
+	sensor.instanceKeys = make(map[string]string)
+	sensor.instanceLabels = make(map[string]map[string]string)
+	sensor.AbstractPlugin.Logger = logging.Get()
+
+	for _, k := range eMetrics {
+		_ = matrix.CreateMetric(k, sensor.data)
+	}
+}
+
+// loadSensorXML loads a ZAPI environment-sensors-get-iter response into a matrix with the given metrics
+func loadSensorXML(path string, metricKeys ...string) *matrix.Matrix {
 	// setup matrix data
 	var err error
+	mat := matrix.New("TestRemoveInstance", "sensor", "test")
 	var fetch func(*matrix.Instance, *node.Node, []string)
-	dat, err := os.ReadFile(testxml)
+	dat, err := os.ReadFile(path)
 	if err != nil {
-		abs, _ := filepath.Abs(testxml)
+		abs, _ := filepath.Abs(path)
 		fmt.Printf("failed to load %s\n", abs)
 		panic(err)
 	}
@@ -61,12 +95,11 @@ func loadTestdata() {
 		}
 	}
 
-	mat = matrix.New("TestRemoveInstance", "sensor", "test")
 	instanceKeyPath := [][]string{{"environment-sensors-info", "node-name"}, {"environment-sensors-info", "sensor-name"}}
 	shortestPathPrefix := []string{"environment-sensors-info"}
-	_, _ = mat.NewMetricInt64("environment-sensors-info.critical-high-threshold")
-	_, _ = mat.NewMetricInt64("environment-sensors-info.critical-low-threshold")
-	_, _ = mat.NewMetricInt64("environment-sensors-info.threshold-sensor-value")
+	for _, key := range metricKeys {
+		_, _ = mat.NewMetricInt64(key)
+	}
 	response, err := tree.LoadXML(dat)
 	if err != nil {
 		panic(err)
@@ -90,15 +123,7 @@ func loadTestdata() {
 		fetch(instance, instanceElem, make([]string, 0))
 
 	}
-
-	sensor.data = matrix.New("Sensor", "environment_sensor", "environment_sensor")
-	sensor.instanceKeys = make(map[string]string)
-	sensor.instanceLabels = make(map[string]map[string]string)
-	sensor.AbstractPlugin.Logger = logging.Get()
-
-	for _, k := range eMetrics {
-		_ = matrix.CreateMetric(k, sensor.data)
-	}
+	return mat
 }
 
 // Verified temperature sensor values by parsing, pivoting, etc. externally via dasel, jq, miller
@@ -135,7 +160,7 @@ func TestSensor_Run(t *testing.T) {
 		"cdot-k3-07": 1,
 		"cdot-k3-08": 1,
 	}
-	omat, err := calculateEnvironmentMetrics(mat, logging.Get(), zapiValueKey, sensor.data, nodeToNumNode)
+	omat, err := calculateEnvironmentMetrics(mat, logging.Get(), zapiValueKey, sensor.data, nodeToNumNode, sensorOptions{})
 	if err != nil {
 		t.Errorf("got err %v", err)
 	}
@@ -146,8 +171,11 @@ func TestSensor_Run(t *testing.T) {
 		"max_fan_speed":               {"cdot-k3-05": 7700, "cdot-k3-06": 7700, "cdot-k3-07": 7700, "cdot-k3-08": 7700},
 		"min_fan_speed":               {"cdot-k3-05": 4600, "cdot-k3-06": 4500, "cdot-k3-07": 4600, "cdot-k3-08": 4500},
 		"power":                       {"cdot-k3-05": 383.4, "cdot-k3-06": 347.9, "cdot-k3-07": 340.8, "cdot-k3-08": 362.1},
+		"excluded_sensor_count":       {"cdot-k3-05": 2},
 		"average_temperature":         {"cdot-k3-05": 26.823529411764707, "cdot-k3-06": 26.352941176470587, "cdot-k3-07": 26.352941176470587, "cdot-k3-08": 27.176470588235293},
 		"max_temperature":             {"cdot-k3-05": 36, "cdot-k3-06": 35, "cdot-k3-07": 35, "cdot-k3-08": 36},
+		"median_temperature":          {"cdot-k3-05": 27, "cdot-k3-06": 27, "cdot-k3-07": 27, "cdot-k3-08": 28},
+		"p95_temperature":             {"cdot-k3-05": 35.2, "cdot-k3-06": 35, "cdot-k3-07": 33.4, "cdot-k3-08": 36},
 		"min_ambient_temperature":     {"cdot-k3-05": 21, "cdot-k3-06": 21, "cdot-k3-07": 21, "cdot-k3-08": 21},
 		"min_temperature":             {"cdot-k3-05": 19, "cdot-k3-06": 19, "cdot-k3-07": 19, "cdot-k3-08": 20},
 	}
@@ -166,3 +194,2157 @@ func TestSensor_Run(t *testing.T) {
 		}
 	}
 }
+
+func TestParseChassisFRU(t *testing.T) {
+	result := gjson.Parse(`[
+		{"fru_name": "PSU1", "num_nodes": 2, "connected_nodes": ["n2", "n1"]},
+		{"fru_name": "PSU2", "num_nodes": 2, "connected_nodes": ["n1", "n2"]},
+		{"fru_name": "PSU3", "num_nodes": 1, "connected_nodes": ["n3"]},
+		{"fru_name": "PSU4"}
+	]`).Array()
+
+	fru := parseChassisFRU(result, "cluster", nil, logging.Get())
+
+	if got := fru.nodeToNumNode["n1"]; got != 2 {
+		t.Errorf("nodeToNumNode[n1] expected 2, got %d", got)
+	}
+	if got := len(fru.connectedNodes); got != 2 {
+		t.Fatalf("connectedNodes expected 2 groups, got %d %v", got, fru.connectedNodes)
+	}
+	if got := strings.Join(fru.connectedNodes[0], ","); got != "n1,n2" {
+		t.Errorf("connectedNodes[0] expected n1,n2, got %s", got)
+	}
+}
+
+func TestCalculateHAPowerBalance(t *testing.T) {
+	tests := []struct {
+		name     string
+		power    map[string]float64
+		expected map[string]float64
+	}{
+		{name: "balanced", power: map[string]float64{"n1": 400, "n2": 400}, expected: map[string]float64{"n1": 1, "n2": 1}},
+		{name: "imbalanced", power: map[string]float64{"n1": 300, "n2": 600}, expected: map[string]float64{"n1": 2, "n2": 2}},
+		{name: "partner missing", power: map[string]float64{"n1": 300}, expected: map[string]float64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+			power, _ := data.NewMetricFloat64("power")
+			for node, value := range tt.power {
+				instance, _ := data.NewInstance(node)
+				_ = power.SetValueFloat64(instance, value)
+			}
+
+			calculateHAPowerBalance(data, [][]string{{"n1", "n2"}, {"n3"}}, logging.Get())
+
+			balance := data.GetMetric("ha_power_balance")
+			for key, instance := range data.GetInstances() {
+				got, ok := balance.GetValueFloat64(instance)
+				exp, want := tt.expected[key]
+				if ok != want {
+					t.Errorf("instance %s expected set=%v, got set=%v", key, want, ok)
+				}
+				if got != exp {
+					t.Errorf("instance %s expected %v, got %v", key, exp, got)
+				}
+			}
+		})
+	}
+}
+
+func TestCalculateChassisScope(t *testing.T) {
+	data := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+	for _, k := range eMetrics {
+		_, _ = data.NewMetricFloat64(k)
+	}
+	nodeValues := map[string]map[string]float64{
+		"n1": {"power": 300, "average_temperature": 30, "min_temperature": 20, "max_temperature": 45},
+		"n2": {"power": 500, "average_temperature": 40, "min_temperature": 25, "max_temperature": 55},
+	}
+	for node, values := range nodeValues {
+		instance, _ := data.NewInstance(node)
+		instance.SetLabel("node", node)
+		for k, v := range values {
+			_ = data.GetMetric(k).SetValueFloat64(instance, v)
+		}
+	}
+
+	calculateChassisScope(data, [][]string{{"n1", "n2"}}, logging.Get())
+
+	for _, node := range []string{"n1", "n2"} {
+		if got := data.GetInstance(node).GetLabel("scope"); got != "node" {
+			t.Errorf("instance %s expected scope=node, got %s", node, got)
+		}
+	}
+	chassis := data.GetInstance("chassis:n1,n2")
+	if chassis == nil {
+		t.Fatalf("chassis instance not created, instances=%v", data.GetInstances())
+	}
+	if got := chassis.GetLabel("scope"); got != "chassis" {
+		t.Errorf("chassis expected scope=chassis, got %s", got)
+	}
+	if got := chassis.GetLabel("nodes"); got != "n1,n2" {
+		t.Errorf("chassis expected nodes=n1,n2, got %s", got)
+	}
+	expected := map[string]float64{"power": 800, "average_temperature": 35, "min_temperature": 20, "max_temperature": 55}
+	for k, exp := range expected {
+		got, ok := data.GetMetric(k).GetValueFloat64(chassis)
+		if !ok || got != exp {
+			t.Errorf("chassis %s expected %v, got %v set=%v", k, exp, got, ok)
+		}
+	}
+	if _, ok := data.GetMetric("average_fan_speed").GetValueFloat64(chassis); ok {
+		t.Errorf("chassis average_fan_speed expected unset")
+	}
+}
+
+func TestCalculateClusterSummary(t *testing.T) {
+	data := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+	for _, k := range eMetrics {
+		_, _ = data.NewMetricFloat64(k)
+	}
+	power := data.GetMetric("power")
+	maxTemperature := data.GetMetric("max_temperature")
+	nodes := map[string][2]float64{
+		"n1": {400, 60},
+		"n2": {100, 45},
+		"n3": {300, 70},
+		"n4": {200, 50},
+		"n5": {500, 80},
+	}
+	for node, values := range nodes {
+		instance, _ := data.NewInstance(node)
+		instance.SetLabel("node", node)
+		_ = power.SetValueFloat64(instance, values[0])
+		_ = maxTemperature.SetValueFloat64(instance, values[1])
+	}
+	// chassis rollups are not nodes
+	chassis, _ := data.NewInstance("chassis:n1,n2")
+	chassis.SetLabel("scope", "chassis")
+	_ = power.SetValueFloat64(chassis, 500)
+
+	calculateClusterSummary(data, logging.Get())
+
+	cluster := data.GetInstance("cluster")
+	if cluster == nil {
+		t.Fatal("cluster instance not created")
+	}
+	if got := cluster.GetLabel("scope"); got != "cluster" {
+		t.Errorf("cluster expected scope=cluster, got %s", got)
+	}
+	if got := data.GetInstance("n1").GetLabel("scope"); got != "node" {
+		t.Errorf("n1 expected scope=node, got %s", got)
+	}
+	want := map[string]float64{"power_p50": 300, "power_p95": 480, "power_max": 500, "max_temperature_p95": 78}
+	for name, exp := range want {
+		metric := data.GetMetric(name)
+		if metric == nil {
+			t.Fatalf("%s not created", name)
+		}
+		got, ok := metric.GetValueFloat64(cluster)
+		if !ok || math.Abs(got-exp) > 1e-9 {
+			t.Errorf("%s got=%v,%t want=%v", name, got, ok, exp)
+		}
+	}
+}
+
+func TestCalculateWeightedFanSpeed(t *testing.T) {
+	tests := []struct {
+		name     string
+		fans     map[string]float64
+		weighted bool
+		opts     sensorOptions
+		labels   map[string]map[string]string
+		expected float64
+	}{
+		{
+			name:     "unweighted",
+			fans:     map[string]float64{"PSU1 FAN": 4000, "Fan1_1": 7000, "Fan1_2": 7000, "Fan1_3": 7000},
+			expected: 6250,
+		},
+		{
+			name:     "weighted by module",
+			fans:     map[string]float64{"PSU1 FAN": 4000, "Fan1_1": 7000, "Fan1_2": 7000, "Fan1_3": 7000},
+			weighted: true,
+			expected: 5500,
+		},
+		{
+			name:     "no module falls back to simple average",
+			fans:     map[string]float64{"PSU1 FAN": 4000, "Fan1_1": 7000, "Fan1_2": 7000, "System Fan": 6000},
+			weighted: true,
+			expected: 6000,
+		},
+		{
+			name:     "invalid reading excluded",
+			fans:     map[string]float64{"PSU1 FAN": 4000, "Fan1_1": 7000, "Fan1_2": 7000, "Fan2_1": 0},
+			weighted: true,
+			opts:     sensorOptions{validity: &sensorValidity{label: "reading_valid", minConfidence: 0.5}},
+			labels:   map[string]map[string]string{"Fan2_1": {"reading_valid": "false"}},
+			expected: 5500,
+		},
+		{
+			name:     "duplicate sensor counted once with canonical offset",
+			fans:     map[string]float64{"PSU1 FAN": 4000, "PSU1 Fan": 4000, "Fan1_1": 7000},
+			weighted: true,
+			opts: sensorOptions{
+				canonicalNames: map[string]string{"PSU1 Fan": "PSU1 FAN"},
+				calibration:    map[string]float64{"n1/PSU1 FAN": 1000},
+			},
+			expected: 6000,
+		},
+		{
+			name:     "trim applies to module averages",
+			fans:     map[string]float64{"PSU1 FAN": 4000, "PSU2 FAN": 4100, "Fan1_1": 7000, "Fan1_2": 7000, "Fan2_1": 60000},
+			weighted: true,
+			opts:     sensorOptions{fanSpeedTrim: 0.25},
+			expected: 5550,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := matrix.New("Sensor", "sensor", "sensor")
+			value, _ := data.NewMetricFloat64(zapiValueKey)
+			for name, speed := range tt.fans {
+				instance, _ := data.NewInstance("n1." + name)
+				instance.SetLabel("node", "n1")
+				instance.SetLabel("sensor", name)
+				instance.SetLabel("type", "fan")
+				for k, v := range tt.labels[name] {
+					instance.SetLabel(k, v)
+				}
+				_ = value.SetValueFloat64(instance, speed)
+			}
+			myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+			for _, k := range eMetrics {
+				_ = matrix.CreateMetric(k, myData)
+			}
+
+			opts := tt.opts
+			opts.weightedFanSpeed = tt.weighted
+			_, _ = calculateEnvironmentMetrics(data, logging.Get(), zapiValueKey, myData, nil, opts)
+
+			got, _ := myData.GetMetric("average_fan_speed").GetValueFloat64(myData.GetInstance("n1"))
+			if got != tt.expected {
+				t.Errorf("average_fan_speed expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSensorCalibration(t *testing.T) {
+	tests := []struct {
+		name        string
+		calibration map[string]float64
+		expected    map[string]float64
+	}{
+		{
+			name:     "no offsets",
+			expected: map[string]float64{"average_ambient_temperature": 22, "min_ambient_temperature": 21, "max_temperature": 40},
+		},
+		{
+			name:        "sensor name offset",
+			calibration: map[string]float64{"Ambient Temp": -3},
+			expected:    map[string]float64{"average_ambient_temperature": 20.5, "min_ambient_temperature": 20, "max_temperature": 40},
+		},
+		{
+			name:        "node offset wins",
+			calibration: map[string]float64{"CPU0 Temp": 10, "n1/CPU0 Temp": -5},
+			expected:    map[string]float64{"average_ambient_temperature": 22, "min_ambient_temperature": 21, "max_temperature": 35},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := matrix.New("Sensor", "sensor", "sensor")
+			value, _ := data.NewMetricFloat64(zapiValueKey)
+			sensors := map[string]float64{"Ambient Temp": 23, "PSU1 Inlet": 21, "CPU0 Temp": 40}
+			for name, v := range sensors {
+				instance, _ := data.NewInstance("n1." + name)
+				instance.SetLabel("node", "n1")
+				instance.SetLabel("sensor", name)
+				instance.SetLabel("type", "thermal")
+				_ = value.SetValueFloat64(instance, v)
+			}
+			myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+			for _, k := range eMetrics {
+				_ = matrix.CreateMetric(k, myData)
+			}
+
+			_, _ = calculateEnvironmentMetrics(data, logging.Get(), zapiValueKey, myData, nil, sensorOptions{calibration: tt.calibration})
+
+			for k, exp := range tt.expected {
+				got, _ := myData.GetMetric(k).GetValueFloat64(myData.GetInstance("n1"))
+				if got != exp {
+					t.Errorf("%s expected %v, got %v", k, exp, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPSUInfo(t *testing.T) {
+	dat, err := os.ReadFile("testdata/chassis_fru.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := []psuInfoField{{field: "firmware-version", label: "firmware"}, {field: "part-number", label: "part_number"}}
+	fru := parseChassisFRU(gjson.GetBytes(dat, "records").Array(), "cluster", fields, logging.Get())
+
+	if len(fru.psus) != 3 {
+		t.Fatalf("expected 3 psus, got %d", len(fru.psus))
+	}
+
+	psuInfo := matrix.New("Sensor", "environment_sensor", "environment_sensor_psu")
+	_, _ = psuInfo.NewMetricFloat64("psu_info")
+	calculatePSUInfo(psuInfo, fru.psus, logging.Get())
+
+	expected := map[string]map[string]string{
+		"cdot-k3-05.PSU1": {"node": "cdot-k3-05", "psu": "PSU1", "firmware": "3.4", "part_number": "114-00087+A2"},
+		"cdot-k3-06.PSU1": {"node": "cdot-k3-06", "psu": "PSU1", "firmware": "3.4", "part_number": "114-00087+A2"},
+		"cdot-k3-05.PSU2": {"node": "cdot-k3-05", "psu": "PSU2", "firmware": "3.5", "part_number": "114-00087+A2"},
+		"cdot-k3-07.PSU1": {"node": "cdot-k3-07", "psu": "PSU1", "firmware": "", "part_number": "114-00146+B0"},
+	}
+	for key, labels := range expected {
+		instance := psuInfo.GetInstance(key)
+		if instance == nil {
+			t.Errorf("instance %s not found", key)
+			continue
+		}
+		if v, ok := psuInfo.GetMetric("psu_info").GetValueFloat64(instance); !ok || v != 1 {
+			t.Errorf("instance %s expected psu_info=1, got %v", key, v)
+		}
+		for label, want := range labels {
+			if got := instance.GetLabel(label); got != want {
+				t.Errorf("instance %s label %s expected %s, got %s", key, label, want, got)
+			}
+		}
+	}
+}
+
+func TestIntervalHistory(t *testing.T) {
+	tests := []struct {
+		name        string
+		calibration map[string]float64
+		node        string
+		expectedMin float64
+		expectedMax float64
+		hasHistory  bool
+	}{
+		{name: "ambient, margin and fans are ignored", node: "node-a", expectedMin: 20, expectedMax: 62, hasHistory: true},
+		{name: "calibrated", node: "node-a", calibration: map[string]float64{"CPU0 Temp": -2}, expectedMin: 20, expectedMax: 60, hasHistory: true},
+		{name: "no history", node: "node-b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := loadSensorXML("testdata/sensor_history.xml", zapiValueKey, zapiIntervalMinKey, zapiIntervalMaxKey)
+			myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+			for _, k := range eMetrics {
+				_ = matrix.CreateMetric(k, myData)
+			}
+			opts := sensorOptions{calibration: tt.calibration}
+			_, _ = calculateEnvironmentMetrics(data, logging.Get(), zapiValueKey, myData, nil, opts)
+			calculateIntervalHistory(data, zapiIntervalMinKey, zapiIntervalMaxKey, myData, opts, logging.Get())
+
+			instance := myData.GetInstance(tt.node)
+			if instance == nil {
+				t.Fatalf("missing instance %s", tt.node)
+			}
+			gotMin, okMin := myData.GetMetric("sensor_interval_min").GetValueFloat64(instance)
+			gotMax, okMax := myData.GetMetric("sensor_interval_max").GetValueFloat64(instance)
+			if okMin != tt.hasHistory || okMax != tt.hasHistory {
+				t.Fatalf("expected history=%v, got min=%v max=%v", tt.hasHistory, okMin, okMax)
+			}
+			if !tt.hasHistory {
+				return
+			}
+			if gotMin != tt.expectedMin {
+				t.Errorf("sensor_interval_min expected %v, got %v", tt.expectedMin, gotMin)
+			}
+			if gotMax != tt.expectedMax {
+				t.Errorf("sensor_interval_max expected %v, got %v", tt.expectedMax, gotMax)
+			}
+		})
+	}
+}
+
+func TestIntervalHistoryNotCollected(t *testing.T) {
+	myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+	calculateIntervalHistory(mat, zapiIntervalMinKey, zapiIntervalMaxKey, myData, sensorOptions{}, logging.Get())
+	if myData.GetMetric("sensor_interval_min") != nil || myData.GetMetric("sensor_interval_max") != nil {
+		t.Errorf("expected no history metrics when history fields are not collected")
+	}
+}
+
+func TestVoltageCurrentPairing(t *testing.T) {
+	type sensor struct {
+		key   string
+		name  string
+		value float64
+		unit  string
+	}
+	tests := []struct {
+		name     string
+		sensors  []sensor
+		expected float64
+	}{
+		{
+			// sorted instance keys put PSU2 VIN before PSU1 VIN but PSU1 Curr before PSU2 Curr
+			name: "paired by psu number",
+			sensors: []sensor{
+				{key: "1", name: "PSU1 Curr IIN", value: 1, unit: "A"},
+				{key: "2", name: "PSU2 Curr IIN", value: 3, unit: "A"},
+				{key: "3", name: "PSU2 VIN", value: 100, unit: "V"},
+				{key: "4", name: "PSU1 VIN", value: 200, unit: "V"},
+			},
+			expected: (200*1 + 100*3) / 0.93,
+		},
+		{
+			name: "index fallback when psu numbers do not match",
+			sensors: []sensor{
+				{key: "1", name: "PSU1 Curr IIN", value: 1, unit: "A"},
+				{key: "2", name: "PSU2 Curr IIN", value: 3, unit: "A"},
+				{key: "3", name: "PSU3 VIN", value: 100, unit: "V"},
+				{key: "4", name: "PSU1 VIN", value: 200, unit: "V"},
+			},
+			expected: (100*1 + 200*3) / 0.93,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := matrix.New("Sensor", "sensor", "sensor")
+			value, _ := data.NewMetricFloat64(restValueKey)
+			for _, s := range tt.sensors {
+				instance, _ := data.NewInstance(s.key)
+				instance.SetLabel("node", "n1")
+				instance.SetLabel("sensor", s.name)
+				instance.SetLabel("unit", s.unit)
+				_ = value.SetValueFloat64(instance, s.value)
+			}
+			myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+			for _, k := range eMetrics {
+				_ = matrix.CreateMetric(k, myData)
+			}
+
+			_, _ = calculateEnvironmentMetrics(data, logging.Get(), restValueKey, myData, nil, sensorOptions{})
+
+			got, _ := myData.GetMetric("power").GetValueFloat64(myData.GetInstance("n1"))
+			if math.Abs(got-tt.expected) > 1e-9 {
+				t.Errorf("power expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSensorOIDs(t *testing.T) {
+	tests := []struct {
+		name     string
+		oids     oidSource
+		expected map[string]string
+	}{
+		{
+			name:     "not configured",
+			expected: map[string]string{"n1.PSU1 AmbTemp": "", "n1.CPU0 Temp": "", "n1.Fan1": "9.9"},
+		},
+		{
+			name:     "mapped by sensor name",
+			oids:     oidMap{"PSU1 AmbTemp": "1.3.6.1.4.1.789.1.21.1.2.1.5.1", "Fan1": "1.2"},
+			expected: map[string]string{"n1.PSU1 AmbTemp": "1.3.6.1.4.1.789.1.21.1.2.1.5.1", "n1.CPU0 Temp": "", "n1.Fan1": "9.9"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := matrix.New("Sensor", "sensor", "sensor")
+			for _, name := range []string{"PSU1 AmbTemp", "CPU0 Temp", "Fan1"} {
+				instance, _ := data.NewInstance("n1." + name)
+				instance.SetLabel("node", "n1")
+				instance.SetLabel("sensor", name)
+			}
+			// oid provided by the sensor data
+			data.GetInstance("n1.Fan1").SetLabel("oid", "9.9")
+
+			if tt.oids != nil {
+				setSensorOIDs(data, tt.oids)
+			}
+
+			for key, exp := range tt.expected {
+				if got := data.GetInstance(key).GetLabel("oid"); got != exp {
+					t.Errorf("%s oid expected %q, got %q", key, exp, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPowerCost(t *testing.T) {
+	rates := &powerCost{rate: 0.12, clusterRates: map[string]float64{"c2": 0.2}, currency: "USD"}
+	tests := []struct {
+		name     string
+		cost     *powerCost
+		cluster  string
+		expected float64
+		skipped  bool
+	}{
+		{name: "global rate", cost: rates, cluster: "c1", expected: 0.06},
+		{name: "cluster rate", cost: rates, cluster: "c2", expected: 0.1},
+		{name: "no rate", cost: &powerCost{clusterRates: map[string]float64{"c2": 0.2}}, cluster: "c1", skipped: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+			power, _ := myData.NewMetricFloat64("power")
+			instance, _ := myData.NewInstance("n1")
+			_ = power.SetValueFloat64(instance, 500)
+
+			if rate, ok := tt.cost.rateFor(tt.cluster); ok {
+				calculatePowerCost(myData, rate, tt.cost.currency, logging.Get())
+			}
+
+			cost := myData.GetMetric("power_cost_per_hour")
+			if tt.skipped {
+				if cost != nil {
+					t.Fatal("expected power_cost_per_hour to be skipped")
+				}
+				return
+			}
+			got, _ := cost.GetValueFloat64(instance)
+			if math.Abs(got-tt.expected) > 1e-9 {
+				t.Errorf("power_cost_per_hour expected %v, got %v", tt.expected, got)
+			}
+			if c := cost.GetLabel("currency"); c != "USD" {
+				t.Errorf("currency expected USD, got %s", c)
+			}
+		})
+	}
+}
+
+func TestPowerCostNodeScope(t *testing.T) {
+	myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+	for _, k := range eMetrics {
+		_, _ = myData.NewMetricFloat64(k)
+	}
+	for _, node := range []string{"n1", "n2"} {
+		instance, _ := myData.NewInstance(node)
+		instance.SetLabel("node", node)
+		_ = myData.GetMetric("power").SetValueFloat64(instance, 500)
+	}
+
+	calculateChassisScope(myData, [][]string{{"n1", "n2"}}, logging.Get())
+	calculateClusterSummary(myData, logging.Get())
+	calculatePowerCost(myData, 0.12, "", logging.Get())
+
+	cost := myData.GetMetric("power_cost_per_hour")
+	for _, node := range []string{"n1", "n2"} {
+		if got, ok := cost.GetValueFloat64(myData.GetInstance(node)); !ok || math.Abs(got-0.06) > 1e-9 {
+			t.Errorf("%s power_cost_per_hour got=%v,%t want=0.06", node, got, ok)
+		}
+	}
+	for _, key := range []string{"chassis:n1,n2", "cluster"} {
+		if got, ok := cost.GetValueFloat64(myData.GetInstance(key)); ok {
+			t.Errorf("%s power_cost_per_hour got=%v want unset", key, got)
+		}
+	}
+}
+
+func TestSensorFallback(t *testing.T) {
+	fallback := &sensorRegexes{
+		ambient: regexp.MustCompile(`(?i)inlet`),
+		power:   regexp.MustCompile(`^PSU\d+ .*(Pwr|Power)`),
+	}
+	tests := []struct {
+		name       string
+		fallback   *sensorRegexes
+		expected   map[string]float64
+		classified map[string]string
+	}{
+		{
+			name:       "primary only",
+			expected:   map[string]float64{"average_ambient_temperature": 21, "max_temperature": 40, "power": 100},
+			classified: map[string]string{"PSU1 Inlet": "", "Bezel Inlet": "", "PSU2 Pwr Out": ""},
+		},
+		{
+			name:     "fallback for unmatched sensors",
+			fallback: fallback,
+			// PSU1 Inlet matches the primary ambient regex, Bezel Inlet and PSU2 Pwr Out only match the fallback
+			expected:   map[string]float64{"average_ambient_temperature": 22, "max_temperature": 40, "power": 150},
+			classified: map[string]string{"PSU1 Inlet": "", "Bezel Inlet": "fallback", "PSU2 Pwr Out": "fallback", "PSU1 InPower": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := matrix.New("Sensor", "sensor", "sensor")
+			value, _ := data.NewMetricFloat64(zapiValueKey)
+			sensors := []struct {
+				name  string
+				typ   string
+				unit  string
+				value float64
+			}{
+				{name: "PSU1 Inlet", typ: "thermal", unit: "C", value: 21},
+				{name: "Bezel Inlet", typ: "thermal", unit: "C", value: 23},
+				{name: "CPU0 Temp", typ: "thermal", unit: "C", value: 40},
+				{name: "PSU1 InPower", typ: "unknown", unit: "W", value: 100},
+				{name: "PSU2 Pwr Out", typ: "unknown", unit: "W", value: 50},
+			}
+			for _, s := range sensors {
+				instance, _ := data.NewInstance("n1." + s.name)
+				instance.SetLabel("node", "n1")
+				instance.SetLabel("sensor", s.name)
+				instance.SetLabel("type", s.typ)
+				instance.SetLabel("unit", s.unit)
+				_ = value.SetValueFloat64(instance, s.value)
+			}
+			myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+			for _, k := range eMetrics {
+				_ = matrix.CreateMetric(k, myData)
+			}
+
+			_, _ = calculateEnvironmentMetrics(data, logging.Get(), zapiValueKey, myData, nil, sensorOptions{fallback: tt.fallback})
+
+			for k, exp := range tt.expected {
+				got, _ := myData.GetMetric(k).GetValueFloat64(myData.GetInstance("n1"))
+				if got != exp {
+					t.Errorf("%s expected %v, got %v", k, exp, got)
+				}
+			}
+			for name, exp := range tt.classified {
+				if got := data.GetInstance("n1." + name).GetLabel("classified_by"); got != exp {
+					t.Errorf("%s classified_by expected %q, got %q", name, exp, got)
+				}
+			}
+		})
+	}
+
+	// the collector keeps its instances across polls, a sensor the primary regexes match again loses the label
+	data := matrix.New("Sensor", "sensor", "sensor")
+	value, _ := data.NewMetricFloat64(zapiValueKey)
+	instance, _ := data.NewInstance("n1.Bezel Inlet")
+	instance.SetLabel("node", "n1")
+	instance.SetLabel("sensor", "Bezel Inlet")
+	instance.SetLabel("type", "thermal")
+	_ = value.SetValueFloat64(instance, 23)
+	for _, opts := range []sensorOptions{
+		{fallback: fallback},
+		{primary: &sensorRegexes{ambient: regexp.MustCompile(`Inlet$`)}, fallback: fallback},
+	} {
+		myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+		for _, k := range eMetrics {
+			_ = matrix.CreateMetric(k, myData)
+		}
+		_, _ = calculateEnvironmentMetrics(data, logging.Get(), zapiValueKey, myData, nil, opts)
+	}
+	if got := instance.GetLabel("classified_by"); got != "" {
+		t.Errorf("classified_by after primary match expected \"\", got %q", got)
+	}
+}
+
+func TestWattsPerKIOPS(t *testing.T) {
+	perf := matrix.New("ZapiPerf", "node", "node")
+	ops, _ := perf.NewMetricFloat64("total_ops")
+	for node, v := range map[string]float64{"n1": 2000, "n2": 0} {
+		instance, _ := perf.NewInstance(node)
+		instance.SetLabel("node", node)
+		_ = ops.SetValueFloat64(instance, v)
+	}
+	shared := matrix.NewRegistry()
+	shared.Publish(perf)
+
+	myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+	power, _ := myData.NewMetricFloat64("power")
+	for node, v := range map[string]float64{"n1": 500, "n2": 400, "n3": 300} {
+		instance, _ := myData.NewInstance(node)
+		_ = power.SetValueFloat64(instance, v)
+	}
+
+	w := wattsPerKIOPS{object: "node", ops: "total_ops", label: "node"}
+	published, ok := shared.Get(w.object)
+	if !ok {
+		t.Fatal("expected published node data")
+	}
+	calculateWattsPerKIOPS(myData, published, w, logging.Get())
+
+	wpk := myData.GetMetric("watts_per_kiops")
+	expected := map[string]struct {
+		value float64
+		ok    bool
+	}{
+		"n1": {value: 250, ok: true},
+		// zero ops and missing ops are skipped
+		"n2": {},
+		"n3": {},
+	}
+	for node, exp := range expected {
+		got, ok := wpk.GetValueFloat64(myData.GetInstance(node))
+		if ok != exp.ok || got != exp.value {
+			t.Errorf("%s watts_per_kiops got=%v,%v want=%v,%v", node, got, ok, exp.value, exp.ok)
+		}
+	}
+}
+
+func TestSensorDefaultUnits(t *testing.T) {
+	type sensor struct {
+		name  string
+		value float64
+		unit  string
+	}
+	tests := []struct {
+		name     string
+		sensors  []sensor
+		opts     sensorOptions
+		expected float64
+	}{
+		{
+			name:    "unitless power dropped without default",
+			sensors: []sensor{{name: "PSU1 InPower", value: 200}, {name: "PSU2 InPower", value: 300}},
+		},
+		{
+			name:     "unitless power with default",
+			sensors:  []sensor{{name: "PSU1 InPower", value: 200}, {name: "PSU2 InPower", value: 300}},
+			opts:     sensorOptions{defaultPowerUnit: "W"},
+			expected: 500,
+		},
+		{
+			name:     "reported unit wins over default",
+			sensors:  []sensor{{name: "PSU1 InPower", value: 200, unit: "W"}, {name: "PSU2 InPower", value: 300000, unit: "mW"}},
+			opts:     sensorOptions{defaultPowerUnit: "W"},
+			expected: 500,
+		},
+		{
+			name:    "unknown power unit is still skipped",
+			sensors: []sensor{{name: "PSU1 InPower", value: 200, unit: "MW"}},
+			opts:    sensorOptions{defaultPowerUnit: "W"},
+		},
+		{
+			name: "unitless voltage and current with defaults",
+			sensors: []sensor{
+				{name: "PSU1 VIN", value: 200000},
+				{name: "PSU1 Curr IIN", value: 1000},
+			},
+			opts:     sensorOptions{defaultVoltageUnit: "mV", defaultCurrentUnit: "mA"},
+			expected: 200 / 0.93,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := matrix.New("Sensor", "sensor", "sensor")
+			value, _ := data.NewMetricFloat64(restValueKey)
+			for i, s := range tt.sensors {
+				instance, _ := data.NewInstance(strconv.Itoa(i))
+				instance.SetLabel("node", "n1")
+				instance.SetLabel("sensor", s.name)
+				instance.SetLabel("unit", s.unit)
+				_ = value.SetValueFloat64(instance, s.value)
+			}
+			myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+			for _, k := range eMetrics {
+				_ = matrix.CreateMetric(k, myData)
+			}
+
+			_, _ = calculateEnvironmentMetrics(data, logging.Get(), restValueKey, myData, nil, tt.opts)
+
+			got, _ := myData.GetMetric("power").GetValueFloat64(myData.GetInstance("n1"))
+			if math.Abs(got-tt.expected) > 1e-9 {
+				t.Errorf("power expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSensorFRUMissing(t *testing.T) {
+	data := matrix.New("Sensor", "sensor", "sensor")
+	value, _ := data.NewMetricFloat64(restValueKey)
+	for i, node := range []string{"n1", "n2"} {
+		instance, _ := data.NewInstance(strconv.Itoa(i))
+		instance.SetLabel("node", node)
+		instance.SetLabel("sensor", "PSU1 InPower")
+		instance.SetLabel("unit", "W")
+		_ = value.SetValueFloat64(instance, 400)
+	}
+	myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+	for _, k := range eMetrics {
+		_ = matrix.CreateMetric(k, myData)
+	}
+
+	// n2 is not in the chassis FRU data
+	_, _ = calculateEnvironmentMetrics(data, logging.Get(), restValueKey, myData, map[string]int{"n1": 2}, sensorOptions{})
+
+	expected := map[string]struct {
+		power   float64
+		missing string
+	}{
+		"n1": {power: 200},
+		"n2": {power: 400, missing: "true"},
+	}
+	for node, exp := range expected {
+		instance := myData.GetInstance(node)
+		if got := instance.GetLabel("fru_missing"); got != exp.missing {
+			t.Errorf("%s fru_missing expected %q, got %q", node, exp.missing, got)
+		}
+		if got, _ := myData.GetMetric("power").GetValueFloat64(instance); got != exp.power {
+			t.Errorf("%s power expected %v, got %v", node, exp.power, got)
+		}
+	}
+}
+
+func TestMaxTemperatureSensor(t *testing.T) {
+	type sensor struct {
+		node  string
+		name  string
+		value float64
+	}
+	sensors := []sensor{
+		// ambient and Margin sensors are not candidates
+		{node: "n1", name: "Ambient Temp", value: 60},
+		{node: "n1", name: "CPU0 Temp Margin", value: -5},
+		{node: "n1", name: "CPU0 Temp", value: 45},
+		{node: "n1", name: "DIMM Temp", value: 52},
+		{node: "n1", name: "PCH Temp", value: 38},
+		// the first of two equally hot sensors wins
+		{node: "n2", name: "CPU0 Temp", value: 50},
+		{node: "n2", name: "CPU1 Temp", value: 50},
+		// no candidate, no label
+		{node: "n3", name: "Ambient Temp", value: 25},
+	}
+	data := matrix.New("Sensor", "sensor", "sensor")
+	value, _ := data.NewMetricFloat64(zapiValueKey)
+	for i, s := range sensors {
+		instance, _ := data.NewInstance(strconv.Itoa(i))
+		instance.SetLabel("node", s.node)
+		instance.SetLabel("sensor", s.name)
+		instance.SetLabel("type", "thermal")
+		_ = value.SetValueFloat64(instance, s.value)
+	}
+	myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+	for _, k := range eMetrics {
+		_ = matrix.CreateMetric(k, myData)
+	}
+
+	_, _ = calculateEnvironmentMetrics(data, logging.Get(), zapiValueKey, myData, nil, sensorOptions{})
+
+	expected := map[string]string{"n1": "DIMM Temp", "n2": "CPU0 Temp", "n3": ""}
+	for node, want := range expected {
+		if got := myData.GetInstance(node).GetLabel("max_temperature_sensor"); got != want {
+			t.Errorf("%s max_temperature_sensor got=%q want=%q", node, got, want)
+		}
+	}
+}
+
+func TestUnitMetrics(t *testing.T) {
+	type sensor struct {
+		node  string
+		name  string
+		value float64
+		unit  string
+	}
+	sensors := []sensor{
+		{node: "n1", name: "Inlet Humidity", value: 40, unit: "%RH"},
+		{node: "n1", name: "Outlet Humidity", value: 50, unit: "%RH"},
+		{node: "n1", name: "Coolant Flow", value: 3, unit: "L/min"},
+		{node: "n2", name: "Inlet Humidity", value: 30, unit: "%RH"},
+		// no unit, skipped
+		{node: "n2", name: "Status", value: 1},
+	}
+	data := matrix.New("Sensor", "sensor", "sensor")
+	value, _ := data.NewMetricFloat64(zapiValueKey)
+	for i, s := range sensors {
+		instance, _ := data.NewInstance(strconv.Itoa(i))
+		instance.SetLabel("node", s.node)
+		instance.SetLabel("sensor", s.name)
+		instance.SetLabel("unit", s.unit)
+		_ = value.SetValueFloat64(instance, s.value)
+	}
+	myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+	for _, k := range eMetrics {
+		_ = matrix.CreateMetric(k, myData)
+	}
+	_, _ = calculateEnvironmentMetrics(data, logging.Get(), zapiValueKey, myData, nil, sensorOptions{})
+
+	calculateUnitMetrics(data, zapiValueKey, myData, sensorOptions{}, logging.Get())
+
+	expected := map[string]map[string]float64{
+		"sensor_unit_min#%RH":   {"n1": 40, "n2": 30},
+		"sensor_unit_avg#%RH":   {"n1": 45, "n2": 30},
+		"sensor_unit_max#%RH":   {"n1": 50, "n2": 30},
+		"sensor_unit_avg#L/min": {"n1": 3},
+	}
+	for key, nodes := range expected {
+		m := myData.GetMetric(key)
+		if m == nil {
+			t.Fatalf("metric %s not created", key)
+		}
+		if !strings.HasPrefix(m.GetName(), "sensor_unit_") || m.GetLabel("unit") != strings.Split(key, "#")[1] {
+			t.Errorf("%s name=%s unit=%s", key, m.GetName(), m.GetLabel("unit"))
+		}
+		for node, want := range nodes {
+			if got, ok := m.GetValueFloat64(myData.GetInstance(node)); !ok || got != want {
+				t.Errorf("%s %s got=%v,%t want=%v", key, node, got, ok, want)
+			}
+		}
+	}
+	if _, ok := myData.GetMetric("sensor_unit_avg#L/min").GetValueFloat64(myData.GetInstance("n2")); ok {
+		t.Errorf("n2 has no L/min sensor")
+	}
+	// the fixed metrics are still there
+	for _, k := range eMetrics {
+		if myData.GetMetric(k) == nil {
+			t.Errorf("metric %s missing", k)
+		}
+	}
+}
+
+func TestPSULoadImbalance(t *testing.T) {
+	type sensor struct {
+		node  string
+		name  string
+		value float64
+		unit  string
+	}
+	sensors := []sensor{
+		// balanced
+		{node: "n1", name: "PSU1 InPower", value: 200, unit: "W"},
+		{node: "n1", name: "PSU2 InPower", value: 200, unit: "W"},
+		// imbalanced, mixed units
+		{node: "n2", name: "PSU1 InPower", value: 300, unit: "W"},
+		{node: "n2", name: "PSU2 InPower", value: 100000, unit: "mW"},
+		// voltage and current pairs
+		{node: "n3", name: "PSU1 VIN", value: 200, unit: "V"},
+		{node: "n3", name: "PSU2 VIN", value: 200, unit: "V"},
+		{node: "n3", name: "PSU1 Curr IIN", value: 1.5, unit: "A"},
+		{node: "n3", name: "PSU2 Curr IIN", value: 0.5, unit: "A"},
+		// a single PSU
+		{node: "n4", name: "PSU1 InPower", value: 300, unit: "W"},
+	}
+	data := matrix.New("Sensor", "sensor", "sensor")
+	value, _ := data.NewMetricFloat64(restValueKey)
+	for i, s := range sensors {
+		instance, _ := data.NewInstance(strconv.Itoa(i))
+		instance.SetLabel("node", s.node)
+		instance.SetLabel("sensor", s.name)
+		instance.SetLabel("unit", s.unit)
+		_ = value.SetValueFloat64(instance, s.value)
+	}
+	myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+	for _, k := range eMetrics {
+		_ = matrix.CreateMetric(k, myData)
+	}
+
+	// n2 shares its chassis, which does not change the ratio
+	_, _ = calculateEnvironmentMetrics(data, logging.Get(), restValueKey, myData, map[string]int{"n1": 1, "n2": 2, "n3": 1, "n4": 1}, sensorOptions{})
+
+	imbalance := myData.GetMetric("psu_load_imbalance")
+	if imbalance == nil {
+		t.Fatal("psu_load_imbalance not created")
+	}
+	expected := map[string]struct {
+		value float64
+		ok    bool
+	}{
+		"n1": {value: 0, ok: true},
+		"n2": {value: 0.5, ok: true},
+		"n3": {value: 0.5, ok: true},
+		"n4": {},
+	}
+	for node, exp := range expected {
+		got, ok := imbalance.GetValueFloat64(myData.GetInstance(node))
+		if ok != exp.ok || math.Abs(got-exp.value) > 1e-9 {
+			t.Errorf("%s psu_load_imbalance got=%v,%t want=%v,%t", node, got, ok, exp.value, exp.ok)
+		}
+	}
+}
+
+func TestSensorAge(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	data := matrix.New("Sensor", "sensor", "sensor")
+	readingTime, _ := data.NewMetricFloat64(restReadingTimeKey)
+	sensors := []struct {
+		name    string
+		epoch   float64
+		label   string
+		wantAge float64
+		wantOk  bool
+	}{
+		{name: "fresh", epoch: float64(now.Add(-5 * time.Second).Unix()), wantAge: 5, wantOk: true},
+		{name: "stale", epoch: float64(now.Add(-time.Hour).Unix()), wantAge: 3600, wantOk: true},
+		{name: "label", label: now.Add(-30 * time.Second).Format(time.RFC3339), wantAge: 30, wantOk: true},
+		{name: "future", epoch: float64(now.Add(time.Minute).Unix()), wantAge: 0, wantOk: true},
+		{name: "invalid label", label: "yesterday"},
+		{name: "no reading time"},
+	}
+	for _, s := range sensors {
+		instance, _ := data.NewInstance(s.name)
+		instance.SetLabel("sensor", s.name)
+		if s.epoch != 0 {
+			_ = readingTime.SetValueFloat64(instance, s.epoch)
+		}
+		if s.label != "" {
+			instance.SetLabel(readingTimeLabel, s.label)
+		}
+	}
+
+	calculateSensorAge(data, restReadingTimeKey, now, logging.Get())
+
+	age := data.GetMetric("sensor_age_seconds")
+	if age == nil {
+		t.Fatal("sensor_age_seconds not created")
+	}
+	for _, s := range sensors {
+		got, ok := age.GetValueFloat64(data.GetInstance(s.name))
+		if ok != s.wantOk || got != s.wantAge {
+			t.Errorf("%s sensor_age_seconds got=%v,%t want=%v,%t", s.name, got, ok, s.wantAge, s.wantOk)
+		}
+	}
+}
+
+func TestSensorAgeNotCollected(t *testing.T) {
+	data := matrix.New("Sensor", "sensor", "sensor")
+	instance, _ := data.NewInstance("a")
+	instance.SetLabel("sensor", "a")
+
+	calculateSensorAge(data, restReadingTimeKey, time.Now(), logging.Get())
+
+	if data.GetMetric("sensor_age_seconds") != nil {
+		t.Errorf("expected no sensor_age_seconds without reading times")
+	}
+}
+
+func TestFallbackReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sensor_fallback.yaml")
+	modTime := time.Now()
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		// file systems with coarse timestamps could report the same mtime for quick writes
+		modTime = modTime.Add(time.Second)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reloader := &fallbackReloader{path: path}
+	logger := logging.Get()
+
+	write("ambient: (?i)inlet air\n")
+	first := reloader.reload(nil, logger)
+	if first == nil || !classifySensor("Inlet Air", nil, first).ambient {
+		t.Fatalf("expected Inlet Air to be ambient after the first load")
+	}
+	if got := reloader.reload(first, logger); got != first {
+		t.Errorf("expected the same patterns when the file did not change")
+	}
+
+	// config change between runs
+	write("power: ^Chassis Pwr$\n")
+	second := reloader.reload(first, logger)
+	if c := classifySensor("Chassis Pwr", nil, second); !c.power || !c.byFallback {
+		t.Errorf("expected Chassis Pwr to be a fallback power sensor after reload, got %+v", c)
+	}
+	if classifySensor("Inlet Air", nil, second).ambient {
+		t.Errorf("expected the ambient pattern to be gone after reload")
+	}
+
+	// an invalid pattern keeps the previous good patterns
+	write("power: ^Chassis Pwr$\nambient: (inlet\n")
+	if got := reloader.reload(second, logger); got != second {
+		t.Errorf("expected the previous patterns after an invalid reload")
+	}
+	write("unknown: inlet\n")
+	if got := reloader.reload(second, logger); got != second {
+		t.Errorf("expected the previous patterns after a reload with an unknown pattern")
+	}
+
+	// a removed file keeps the previous good patterns
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := reloader.reload(second, logger); got != second {
+		t.Errorf("expected the previous patterns when the file is removed")
+	}
+}
+
+func TestSensorValidity(t *testing.T) {
+	type sensor struct {
+		name     string
+		value    float64
+		validity string
+	}
+	sensors := []sensor{
+		{name: "CPU0 Temp", value: 40, validity: "true"},
+		{name: "CPU1 Temp", value: 50},
+		{name: "CPU2 Temp", value: 200, validity: "false"},
+		{name: "CPU3 Temp", value: 300, validity: "INVALID"},
+		{name: "CPU4 Temp", value: 60, validity: "0.9"},
+		{name: "CPU5 Temp", value: 400, validity: "0.3"},
+		{name: "PSU1 InPower", value: 100, validity: "1"},
+		{name: "PSU2 InPower", value: 900, validity: "0"},
+		{name: "CPU6 Margin Temp", value: -5},
+	}
+	newData := func() (*matrix.Matrix, *matrix.Matrix) {
+		data := matrix.New("Sensor", "sensor", "sensor")
+		value, _ := data.NewMetricFloat64(restValueKey)
+		for i, s := range sensors {
+			instance, _ := data.NewInstance(strconv.Itoa(i))
+			instance.SetLabel("node", "n1")
+			instance.SetLabel("sensor", s.name)
+			instance.SetLabel("unit", "W")
+			if strings.HasSuffix(s.name, "Temp") {
+				instance.SetLabel("type", "thermal")
+				instance.SetLabel("unit", "C")
+			}
+			if s.validity != "" {
+				instance.SetLabel("reading_valid", s.validity)
+			}
+			_ = value.SetValueFloat64(instance, s.value)
+		}
+		myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+		for _, k := range eMetrics {
+			_ = matrix.CreateMetric(k, myData)
+		}
+		return data, myData
+	}
+	tests := []struct {
+		name     string
+		validity *sensorValidity
+		want     map[string]float64
+	}{
+		{name: "no validity", want: map[string]float64{"max_temperature": 400, "power": 1000, "excluded_sensor_count": 1}},
+		// invalid readings are not counted as excluded thermal sensors
+		{name: "validity", validity: &sensorValidity{label: "reading_valid", minConfidence: 0.5},
+			want: map[string]float64{"max_temperature": 60, "average_temperature": 50, "power": 100, "excluded_sensor_count": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, myData := newData()
+			_, _ = calculateEnvironmentMetrics(data, logging.Get(), restValueKey, myData, map[string]int{"n1": 1}, sensorOptions{validity: tt.validity})
+			instance := myData.GetInstance("n1")
+			for name, want := range tt.want {
+				if got, _ := myData.GetMetric(name).GetValueFloat64(instance); got != want {
+					t.Errorf("%s got=%v want=%v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSensorDataQuality(t *testing.T) {
+	type sensor struct {
+		node       string
+		name       string
+		sensorType string
+		value      float64
+		unit       string
+	}
+	sensors := []sensor{
+		// trustworthy
+		{node: "good", name: "PSU1 InPower", value: 200, unit: "W"},
+		{node: "good", name: "CPU0 Temp", sensorType: "thermal", value: 50, unit: "C"},
+		// missing from the FRU data
+		{node: "nofru", name: "PSU1 InPower", value: 200, unit: "W"},
+		// unpaired voltage and current sensors
+		{node: "unpaired", name: "PSU1 VIN", value: 200, unit: "V"},
+		{node: "unpaired", name: "PSU2 VIN", value: 200, unit: "V"},
+		{node: "unpaired", name: "PSU1 Curr IIN", value: 1.5, unit: "A"},
+		// unknown power unit
+		{node: "unit", name: "PSU1 InPower", value: 200, unit: "MW"},
+		// half of the sensors excluded
+		{node: "excluded", name: "PSU1 InPower", value: 200, unit: "W"},
+		{node: "excluded", name: "CPU0 Temp Margin", sensorType: "thermal", value: -5, unit: "C"},
+		// everything wrong and all thermal sensors excluded
+		{node: "bad", name: "PSU1 InPower", value: 200, unit: "MW"},
+		{node: "bad", name: "PSU1 VIN", value: 200, unit: "V"},
+		{node: "bad", name: "CPU0 Temp Margin", sensorType: "thermal", value: -5, unit: "C"},
+		{node: "bad", name: "CPU1 Temp Margin", sensorType: "thermal", value: -5, unit: "C"},
+	}
+	data := matrix.New("Sensor", "sensor", "sensor")
+	value, _ := data.NewMetricFloat64(restValueKey)
+	for i, s := range sensors {
+		instance, _ := data.NewInstance(strconv.Itoa(i))
+		instance.SetLabel("node", s.node)
+		instance.SetLabel("sensor", s.name)
+		instance.SetLabel("type", s.sensorType)
+		instance.SetLabel("unit", s.unit)
+		_ = value.SetValueFloat64(instance, s.value)
+	}
+	myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+	for _, k := range eMetrics {
+		_ = matrix.CreateMetric(k, myData)
+	}
+
+	nodeToNumNode := map[string]int{"good": 1, "unpaired": 1, "unit": 1, "excluded": 1}
+	_, _ = calculateEnvironmentMetrics(data, logging.Get(), restValueKey, myData, nodeToNumNode, sensorOptions{})
+
+	quality := myData.GetMetric("sensor_data_quality")
+	if quality == nil {
+		t.Fatal("sensor_data_quality not created")
+	}
+	expected := map[string]float64{
+		"good":     1,
+		"nofru":    0.75,
+		"unpaired": 0.75,
+		"unit":     0.5,
+		"excluded": 0.875,
+		"bad":      0.125,
+	}
+	for node, want := range expected {
+		got, ok := quality.GetValueFloat64(myData.GetInstance(node))
+		if !ok || math.Abs(got-want) > 1e-9 {
+			t.Errorf("%s sensor_data_quality got=%v,%t want=%v", node, got, ok, want)
+		}
+	}
+}
+
+func TestExplainSensor(t *testing.T) {
+	data := loadSensorXML(testxml, zapiValueKey)
+	inputs := sensorInputs(data, zapiValueKey, nil)
+	opts := sensorOptions{calibration: map[string]float64{"cdot-k3-05/PSU1 Inlet": -1}}
+
+	tests := []struct {
+		node     string
+		sensor   string
+		contains []string
+	}{
+		{
+			node:     "cdot-k3-05",
+			sensor:   "PSU1 Inlet",
+			contains: []string{"calibration offset -1 applied", "ambient=true", "counted in average_ambient_temperature"},
+		},
+		{
+			node:     "cdot-k3-05",
+			sensor:   "PSU1 PIN",
+			contains: []string{"power=true", "power: counted in power"},
+		},
+		{
+			node:     "cdot-k3-05",
+			sensor:   "PSU1 VIN",
+			contains: []string{"voltage=true", "voltage/current: not used, node has 2 power sensors"},
+		},
+		{
+			node:     "cdot-k3-05",
+			sensor:   "no such sensor",
+			contains: []string{"was not collected in the last poll"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sensor, func(t *testing.T) {
+			got := explainSensor(inputs, opts, nil, tt.node, tt.sensor)
+			for _, c := range tt.contains {
+				if !strings.Contains(got, c) {
+					t.Errorf("explanation does not contain %q:\n%s", c, got)
+				}
+			}
+		})
+	}
+}
+
+func TestExplainSensorDropped(t *testing.T) {
+	inputs := []sensorInput{
+		{node: "n1", name: "PSU1 InPower", unit: "W", value: 100, hasValue: true, exportable: true},
+		{node: "n1", name: "PSU1 Power In", unit: "W", value: 100, hasValue: true, exportable: true},
+		{node: "n1", name: "CPU0 Temp", sensorType: "thermal", unit: "C", value: 50, hasValue: true, exportable: true, invalid: "valid=false"},
+		{node: "n2", name: "Custom Power", unit: "W", value: 120, hasValue: true, exportable: true},
+		{node: "n3", name: "PSU1 InPower", unit: "W", value: 90, hasValue: true, exportable: true},
+	}
+	opts := sensorOptions{
+		canonicalNames: map[string]string{"PSU1 Power In": "PSU1 InPower", "Custom Power": "PSU1 InPower"},
+		calibration:    map[string]float64{"n2/PSU1 InPower": 5},
+	}
+	skippedNodes := map[string]bool{"n3": true}
+
+	tests := []struct {
+		node     string
+		sensor   string
+		contains []string
+		excludes []string
+	}{
+		{node: "n1", sensor: "PSU1 InPower", contains: []string{"power: counted in power"}},
+		{
+			node:     "n1",
+			sensor:   "PSU1 Power In",
+			contains: []string{`duplicate of canonical "PSU1 InPower" reported as "PSU1 InPower", skipped`},
+			excludes: []string{"counted in power"},
+		},
+		{
+			node:     "n1",
+			sensor:   "CPU0 Temp",
+			contains: []string{"invalid reading valid=false, excluded"},
+			excludes: []string{"counted in"},
+		},
+		{
+			node:     "n2",
+			sensor:   "Custom Power",
+			contains: []string{`canonical name "PSU1 InPower"`, "calibration offset 5 applied", "power=true", "power: counted in power"},
+		},
+		{
+			node:     "n3",
+			sensor:   "PSU1 InPower",
+			contains: []string{"node skipped, the sensor time budget was exceeded"},
+			excludes: []string{"counted in power"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.node+"/"+tt.sensor, func(t *testing.T) {
+			got := explainSensor(inputs, opts, skippedNodes, tt.node, tt.sensor)
+			for _, c := range tt.contains {
+				if !strings.Contains(got, c) {
+					t.Errorf("explanation does not contain %q:\n%s", c, got)
+				}
+			}
+			for _, c := range tt.excludes {
+				if strings.Contains(got, c) {
+					t.Errorf("explanation contains %q:\n%s", c, got)
+				}
+			}
+		})
+	}
+}
+
+func TestThermalSensorWithoutValue(t *testing.T) {
+	data := matrix.New("Sensor", "sensor", "sensor")
+	value, _ := data.NewMetricFloat64(restValueKey)
+	for _, name := range []string{"CPU0 Temp", "CPU1 Temp"} {
+		instance, _ := data.NewInstance("n1/" + name)
+		instance.SetLabel("node", "n1")
+		instance.SetLabel("sensor", name)
+		instance.SetLabel("type", "thermal")
+		instance.SetLabel("unit", "C")
+	}
+	// CPU1 Temp has no reading
+	_ = value.SetValueFloat64(data.GetInstance("n1/CPU0 Temp"), 50)
+
+	myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+	for _, k := range eMetrics {
+		_ = matrix.CreateMetric(k, myData)
+	}
+	if _, err := calculateEnvironmentMetrics(data, logging.Get(), restValueKey, myData, map[string]int{"n1": 1}, sensorOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	n1 := myData.GetInstance("n1")
+	if got, _ := myData.GetMetric("excluded_sensor_count").GetValueFloat64(n1); got != 0 {
+		t.Errorf("excluded_sensor_count got=%v want=0", got)
+	}
+	if got, _ := myData.GetMetric("min_temperature").GetValueFloat64(n1); got != 50 {
+		t.Errorf("min_temperature got=%v want=50", got)
+	}
+	got := explainSensor(sensorInputs(data, restValueKey, nil), sensorOptions{}, nil, "n1", "CPU1 Temp")
+	if !strings.Contains(got, "no value, ignored") {
+		t.Errorf("explanation does not contain %q:\n%s", "no value, ignored", got)
+	}
+}
+
+func TestServeExplainSensor(t *testing.T) {
+	serve := func() string {
+		w := httptest.NewRecorder()
+		ServeExplainSensor(w, httptest.NewRequest(http.MethodGet, "/debug/sensor?node=n1&sensor=s1", nil))
+		return w.Body.String()
+	}
+	newSensor := func(parent string) *Sensor {
+		return NewSensor(plugin.New(parent, nil, node.NewS("Sensor"), nil, "sensor", nil)).(*Sensor)
+	}
+
+	// a reloaded plugin replaces its predecessor
+	old := newSensor("Rest")
+	registerExplainHandler(old)
+	reloaded := newSensor("Rest")
+	registerExplainHandler(reloaded)
+	zapi := newSensor("Zapi")
+	registerExplainHandler(zapi)
+	if got := strings.Count(serve(), "Sensor plugin has not run yet"); got != 2 {
+		t.Errorf("explanations got=%d want=2", got)
+	}
+
+	// stopping the replaced plugin keeps its successor
+	old.Stop()
+	if got := serve(); !strings.Contains(got, "Rest.Sensor") {
+		t.Errorf("reloaded plugin not served:\n%s", got)
+	}
+
+	reloaded.Stop()
+	zapi.Stop()
+	if got := serve(); got != "" {
+		t.Errorf("stopped plugins served:\n%s", got)
+	}
+}
+
+// loadSensorCorpus reads expected sensor categories from a corpus file, see testdata/sensor_corpus.txt
+func loadSensorCorpus(t *testing.T, path string) map[string]string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := make(map[string]string)
+	for _, line := range strings.Split(string(b), "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		category, name, ok := strings.Cut(line, "|")
+		if !ok {
+			t.Fatalf("invalid corpus line %q", line)
+		}
+		expected[strings.TrimSpace(name)] = strings.TrimSpace(category)
+	}
+	return expected
+}
+
+func TestSensorRegexCoverage(t *testing.T) {
+	expected := loadSensorCorpus(t, "testdata/sensor_corpus.txt")
+	corpus := make([]string, 0, len(expected))
+	for name := range expected {
+		corpus = append(corpus, name)
+	}
+
+	coverage := checkSensorCoverage(corpus, nil)
+
+	got := make(map[string][]string)
+	categories := map[string][]string{
+		"ambient": coverage.ambient,
+		"power":   coverage.power,
+		"voltage": coverage.voltage,
+		"current": coverage.current,
+		"none":    coverage.unmatched,
+	}
+	for category, names := range categories {
+		for _, name := range names {
+			got[name] = append(got[name], category)
+		}
+	}
+	for name, category := range expected {
+		if len(got[name]) != 1 || got[name][0] != category {
+			t.Errorf("%q classified as %v, expected %s", name, got[name], category)
+		}
+	}
+
+	// fallback regexes only apply to names the built-in regexes do not match
+	coverage = checkSensorCoverage([]string{"Fan1 Speed", "PSU1 PIN"}, &sensorRegexes{power: regexp.MustCompile(`^(Fan|PSU)`)})
+	if len(coverage.power) != 2 || len(coverage.unmatched) != 0 {
+		t.Errorf("fallback coverage got power=%v unmatched=%v", coverage.power, coverage.unmatched)
+	}
+}
+
+func TestSensorCanonicalNames(t *testing.T) {
+	type sensor struct {
+		node  string
+		name  string
+		value float64
+	}
+	// n1 reports PSU1 power and ambient temperature under the ZAPI and the REST name
+	sensors := []sensor{
+		{node: "n1", name: "PSU1 InPower", value: 100},
+		{node: "n1", name: "PSU1 Power In", value: 100},
+		{node: "n1", name: "PSU2 InPower", value: 150},
+		{node: "n1", name: "PSU1 AmbTemp", value: 25},
+		{node: "n1", name: "PSU1 Inlet Temp", value: 25},
+		{node: "n2", name: "PSU1 Power In", value: 120},
+	}
+	newData := func() (*matrix.Matrix, *matrix.Matrix) {
+		data := matrix.New("Sensor", "sensor", "sensor")
+		value, _ := data.NewMetricFloat64(restValueKey)
+		for i, s := range sensors {
+			instance, _ := data.NewInstance(strconv.Itoa(i))
+			instance.SetLabel("node", s.node)
+			instance.SetLabel("sensor", s.name)
+			instance.SetLabel("unit", "W")
+			if strings.HasSuffix(s.name, "Temp") {
+				instance.SetLabel("type", "thermal")
+				instance.SetLabel("unit", "C")
+			}
+			_ = value.SetValueFloat64(instance, s.value)
+		}
+		myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+		for _, k := range eMetrics {
+			_ = matrix.CreateMetric(k, myData)
+		}
+		return data, myData
+	}
+	canonicalNames := map[string]string{
+		"PSU1 Power In":   "PSU1 InPower",
+		"PSU1 Inlet Temp": "PSU1 AmbTemp",
+	}
+	tests := []struct {
+		name           string
+		canonicalNames map[string]string
+		want           map[string]map[string]float64
+	}{
+		{name: "double counted", want: map[string]map[string]float64{
+			"n1": {"power": 350, "average_ambient_temperature": 25},
+			"n2": {"power": 120},
+		}},
+		{name: "canonical names", canonicalNames: canonicalNames, want: map[string]map[string]float64{
+			"n1": {"power": 250, "average_ambient_temperature": 25},
+			"n2": {"power": 120},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, myData := newData()
+			_, _ = calculateEnvironmentMetrics(data, logging.Get(), restValueKey, myData, map[string]int{"n1": 1, "n2": 1},
+				sensorOptions{canonicalNames: tt.canonicalNames})
+			for node, metrics := range tt.want {
+				instance := myData.GetInstance(node)
+				for name, want := range metrics {
+					if got, _ := myData.GetMetric(name).GetValueFloat64(instance); got != want {
+						t.Errorf("%s %s got=%v want=%v", node, name, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPowerRangeEstimate(t *testing.T) {
+	r := powerRange{idle: 150, max: 400}
+	tests := []struct {
+		busy float64
+		want float64
+	}{
+		{busy: 0, want: 150},
+		{busy: 25, want: 212.5},
+		{busy: 50, want: 275},
+		{busy: 100, want: 400},
+		{busy: 130, want: 400},
+		{busy: -5, want: 150},
+	}
+	for _, tt := range tests {
+		if got := r.estimate(tt.busy); got != tt.want {
+			t.Errorf("busy=%v got=%v want=%v", tt.busy, got, tt.want)
+		}
+	}
+}
+
+func TestCalculatePowerEstimate(t *testing.T) {
+	// n1 has power sensors, n2 only temperature sensors and n3, n4 and n5 no sensors at all
+	data := matrix.New("Sensor", "sensor", "sensor")
+	value, _ := data.NewMetricFloat64(restValueKey)
+	for _, s := range []struct {
+		node, name, sensorType, unit string
+		value                        float64
+	}{
+		{node: "n1", name: "PSU1 InPower", unit: "W", value: 320},
+		{node: "n1", name: "CPU0 Temp", sensorType: "thermal", unit: "C", value: 50},
+		{node: "n2", name: "CPU0 Temp", sensorType: "thermal", unit: "C", value: 45},
+	} {
+		instance, _ := data.NewInstance(s.node + "/" + s.name)
+		instance.SetLabel("node", s.node)
+		instance.SetLabel("sensor", s.name)
+		instance.SetLabel("type", s.sensorType)
+		instance.SetLabel("unit", s.unit)
+		_ = value.SetValueFloat64(instance, s.value)
+	}
+	myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+	for _, k := range eMetrics {
+		_ = matrix.CreateMetric(k, myData)
+	}
+	_, env, err := calculateNodeEnvironment(data, logging.Get(), restValueKey, myData, map[string]int{"n1": 1, "n2": 1}, sensorOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !env.measuredPower["n1"] || env.measuredPower["n2"] {
+		t.Errorf("measured power got=%v want only n1", env.measuredPower)
+	}
+	// the node without power sensors gets power 0, which must not block the estimate
+	if got, ok := myData.GetMetric("power").GetValueFloat64(myData.GetInstance("n2")); !ok || got != 0 {
+		t.Errorf("n2 power before estimate got=%v,%v want=0", got, ok)
+	}
+
+	perf := matrix.New("ZapiPerf", "node", "node")
+	cpu, _ := perf.NewMetricFloat64("cpu_busy")
+	for node, busy := range map[string]float64{"n1": 90, "n2": 50, "n3": 20, "n4": 100, "n5": 10} {
+		instance, _ := perf.NewInstance(node)
+		instance.SetLabel("node", node)
+		_ = cpu.SetValueFloat64(instance, busy)
+	}
+
+	estimate := powerEstimate{object: "node", cpu: "cpu_busy", label: "node", ranges: map[string]powerRange{
+		defaultPowerModel: {idle: 100, max: 300},
+		"FDvM300":         {idle: 200, max: 500},
+	}}
+	if !estimate.needsModels() {
+		t.Errorf("expected models to be needed")
+	}
+	models := map[string]string{"n1": "FDvM300", "n2": "FDvM200", "n3": "FDvM300", "n4": "FDvM300"}
+	calculatePowerEstimate(myData, perf, env.measuredPower, models, estimate, logging.Get())
+
+	tests := []struct {
+		node          string
+		wantPower     float64
+		wantEstimated string
+	}{
+		{node: "n1", wantPower: 320},
+		{node: "n2", wantPower: 200, wantEstimated: "true"},
+		{node: "n3", wantPower: 260, wantEstimated: "true"},
+		{node: "n4", wantPower: 500, wantEstimated: "true"},
+		{node: "n5", wantPower: 120, wantEstimated: "true"},
+	}
+	for _, tt := range tests {
+		instance := myData.GetInstance(tt.node)
+		if instance == nil {
+			t.Errorf("%s missing", tt.node)
+			continue
+		}
+		if got, _ := myData.GetMetric("power").GetValueFloat64(instance); got != tt.wantPower {
+			t.Errorf("%s power got=%v want=%v", tt.node, got, tt.wantPower)
+		}
+		if got := instance.GetLabel("estimated"); got != tt.wantEstimated {
+			t.Errorf("%s estimated got=%q want=%q", tt.node, got, tt.wantEstimated)
+		}
+		if got := instance.GetLabel("node"); got != tt.node {
+			t.Errorf("%s node label got=%q", tt.node, got)
+		}
+	}
+}
+
+func TestModelCache(t *testing.T) {
+	calls := 0
+	var collectErr error
+	collect := func() (map[string]string, error) {
+		calls++
+		if collectErr != nil {
+			return nil, collectErr
+		}
+		return map[string]string{"n1": "FDvM" + strconv.Itoa(calls)}, nil
+	}
+	logger := logging.Get()
+	cache := &modelCache{}
+
+	steps := []struct {
+		name      string
+		nodes     int
+		err       error
+		wantCalls int
+		wantModel string
+	}{
+		{name: "first poll collects", nodes: 2, wantCalls: 1, wantModel: "FDvM1"},
+		{name: "cached", nodes: 2, wantCalls: 1, wantModel: "FDvM1"},
+		{name: "node count changed", nodes: 3, wantCalls: 2, wantModel: "FDvM2"},
+		{name: "failed refresh keeps last good", nodes: 4, err: errors.New("timeout"), wantCalls: 3, wantModel: "FDvM2"},
+	}
+	for _, s := range steps {
+		collectErr = s.err
+		models, err := cache.get(s.nodes, collect, logger)
+		if err != nil {
+			t.Fatalf("%s: unexpected err %v", s.name, err)
+		}
+		if calls != s.wantCalls || models["n1"] != s.wantModel {
+			t.Errorf("%s: calls got=%d want=%d model got=%s want=%s", s.name, calls, s.wantCalls, models["n1"], s.wantModel)
+		}
+	}
+}
+
+func TestSensorTimeBudget(t *testing.T) {
+	const nodes = 2000
+	newData := func() (*matrix.Matrix, *matrix.Matrix) {
+		data := matrix.New("Sensor", "sensor", "sensor")
+		value, _ := data.NewMetricFloat64(restValueKey)
+		for i := 0; i < nodes; i++ {
+			node := fmt.Sprintf("n%04d", i)
+			for j, name := range []string{"PSU1 InPower", "CPU0 Temp", "CPU1 Temp", "Bat Temp"} {
+				instance, _ := data.NewInstance(node + "/" + strconv.Itoa(j))
+				instance.SetLabel("node", node)
+				instance.SetLabel("sensor", name)
+				instance.SetLabel("unit", "W")
+				if j > 0 {
+					instance.SetLabel("type", "thermal")
+					instance.SetLabel("unit", "C")
+				}
+				_ = value.SetValueFloat64(instance, 100)
+			}
+		}
+		myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+		for _, k := range eMetrics {
+			_ = matrix.CreateMetric(k, myData)
+		}
+		return data, myData
+	}
+
+	tests := []struct {
+		name    string
+		budget  time.Duration
+		skipped bool
+	}{
+		{name: "no budget", budget: 0},
+		{name: "generous budget", budget: time.Minute},
+		{name: "tight budget", budget: time.Nanosecond, skipped: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, myData := newData()
+			_, _ = calculateEnvironmentMetrics(data, logging.Get(), restValueKey, myData, nil, sensorOptions{timeBudget: tt.budget})
+			processed := len(myData.GetInstances())
+			if !tt.skipped && processed != nodes {
+				t.Errorf("processed nodes got=%d want=%d", processed, nodes)
+			}
+			if tt.skipped && (processed == 0 || processed == nodes) {
+				t.Errorf("processed nodes got=%d want between 1 and %d", processed, nodes-1)
+			}
+			// nodes that were started are complete
+			for _, instance := range myData.GetInstances() {
+				if got, _ := myData.GetMetric("power").GetValueFloat64(instance); got != 100 {
+					t.Errorf("%s power got=%v want=100", instance.GetLabel("node"), got)
+				}
+			}
+		})
+	}
+}
+
+func TestFanSmoothing(t *testing.T) {
+	s := newFanSmoothing(0.5)
+	run := func(speeds map[string]float64) *matrix.Matrix {
+		myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+		for _, k := range eMetrics {
+			_ = matrix.CreateMetric(k, myData)
+		}
+		for node, speed := range speeds {
+			instance, _ := myData.NewInstance(node)
+			instance.SetLabel("node", node)
+			_ = myData.GetMetric("average_fan_speed").SetValueFloat64(instance, speed)
+		}
+		s.smooth(myData, logging.Get())
+		return myData
+	}
+	smoothed := func(myData *matrix.Matrix, node string) float64 {
+		v, _ := myData.GetMetric("fan_speed_smoothed").GetValueFloat64(myData.GetInstance(node))
+		return v
+	}
+
+	// a jittery series alternating between 5000 and 7000 rpm
+	noisy := []float64{5000, 7000, 5000, 7000, 5000, 7000}
+	want := []float64{5000, 6000, 5500, 6250, 5625, 6312.5}
+	for i, speed := range noisy {
+		speeds := map[string]float64{"n1": speed}
+		// n2 disappears in the third poll
+		if i != 2 {
+			speeds["n2"] = 4000 + float64(i)*100
+		}
+		myData := run(speeds)
+		if got := smoothed(myData, "n1"); got != want[i] {
+			t.Errorf("poll %d n1 smoothed got=%v want=%v", i, got, want[i])
+		}
+		if got, _ := myData.GetMetric("average_fan_speed").GetValueFloat64(myData.GetInstance("n1")); got != speed {
+			t.Errorf("poll %d n1 average_fan_speed got=%v want=%v", i, got, speed)
+		}
+		if i == 2 {
+			if _, ok := s.speeds["n2"]; ok {
+				t.Errorf("poll %d n2 state not evicted", i)
+			}
+		}
+		// after returning, n2 starts over from its reading
+		if i == 3 {
+			if got := smoothed(myData, "n2"); got != 4300 {
+				t.Errorf("poll %d n2 smoothed got=%v want=4300", i, got)
+			}
+		}
+	}
+}
+
+func TestFRUFields(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured []string
+		infoFields []psuInfoField
+		want       []string
+	}{
+		{name: "default", want: []string{"fru-name", "type", "status", "connected-nodes", "num-nodes"}},
+		{name: "default with psu_info", infoFields: []psuInfoField{{field: "firmware-version", label: "firmware"}},
+			want: []string{"fru-name", "type", "status", "connected-nodes", "num-nodes", "firmware-version"}},
+		{name: "trimmed", configured: []string{"fru-name", "connected-nodes", "num-nodes"},
+			want: []string{"fru-name", "connected-nodes", "num-nodes"}},
+		{name: "mandatory fields omitted", configured: []string{"serial-number"},
+			want: []string{"serial-number", "fru-name", "connected-nodes", "num-nodes"}},
+		{name: "duplicates", configured: []string{"num-nodes", "part-number", "part-number"},
+			infoFields: []psuInfoField{{field: "part-number", label: "part_number"}},
+			want:       []string{"num-nodes", "part-number", "fru-name", "connected-nodes"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fruFields(tt.configured, tt.infoFields); !slices.Equal(got, tt.want) {
+				t.Errorf("fruFields() got=%v want=%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFanCounts(t *testing.T) {
+	type sensor struct {
+		node, name, sensorType string
+		value                  float64
+		noValue                bool
+	}
+	sensors := []sensor{
+		{node: "n1", name: "Fan1", sensorType: "fan", value: 5000},
+		{node: "n1", name: "Fan2", sensorType: "fan", value: 6000},
+		{node: "n1", name: "Fan3", sensorType: "fan", value: 0},
+		{node: "n1", name: "Fan4", sensorType: "fan", value: 300},
+		{node: "n1", name: "Fan5", sensorType: "fan", noValue: true},
+		{node: "n1", name: "CPU0 Temp", sensorType: "thermal", value: 50},
+		{node: "n2", name: "CPU0 Temp", sensorType: "thermal", value: 50},
+	}
+	newData := func() (*matrix.Matrix, *matrix.Matrix) {
+		data := matrix.New("Sensor", "sensor", "sensor")
+		value, _ := data.NewMetricFloat64(restValueKey)
+		for i, s := range sensors {
+			instance, _ := data.NewInstance(strconv.Itoa(i))
+			instance.SetLabel("node", s.node)
+			instance.SetLabel("sensor", s.name)
+			instance.SetLabel("type", s.sensorType)
+			if !s.noValue {
+				_ = value.SetValueFloat64(instance, s.value)
+			}
+		}
+		myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+		for _, k := range eMetrics {
+			_ = matrix.CreateMetric(k, myData)
+		}
+		return data, myData
+	}
+
+	tests := []struct {
+		name       string
+		threshold  float64
+		wantActive float64
+	}{
+		{name: "default threshold", wantActive: 3},
+		{name: "slow fans inactive", threshold: 500, wantActive: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, myData := newData()
+			_, _ = calculateEnvironmentMetrics(data, logging.Get(), restValueKey, myData, nil, sensorOptions{fanActiveThreshold: tt.threshold})
+			n1 := myData.GetInstance("n1")
+			if got, _ := myData.GetMetric("fans_total").GetValueFloat64(n1); got != 5 {
+				t.Errorf("fans_total got=%v want=5", got)
+			}
+			if got, _ := myData.GetMetric("fans_active").GetValueFloat64(n1); got != tt.wantActive {
+				t.Errorf("fans_active got=%v want=%v", got, tt.wantActive)
+			}
+			n2 := myData.GetInstance("n2")
+			if got, ok := myData.GetMetric("fans_total").GetValueFloat64(n2); ok {
+				t.Errorf("n2 without fans has fans_total=%v", got)
+			}
+		})
+	}
+}
+
+func TestFanSpeedTrim(t *testing.T) {
+	data := matrix.New("Sensor", "sensor", "sensor")
+	value, _ := data.NewMetricFloat64(restValueKey)
+	// Fan5 is stuck at an implausible speed
+	for i, speed := range []float64{5000, 5100, 5200, 5300, 60000} {
+		instance, _ := data.NewInstance(strconv.Itoa(i))
+		instance.SetLabel("node", "n1")
+		instance.SetLabel("sensor", "Fan"+strconv.Itoa(i+1))
+		instance.SetLabel("type", "fan")
+		_ = value.SetValueFloat64(instance, speed)
+	}
+
+	tests := []struct {
+		name string
+		trim float64
+		want float64
+	}{
+		{name: "no trim", want: 16120},
+		{name: "trim slowest and fastest", trim: 0.2, want: 5200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+			for _, k := range eMetrics {
+				_ = matrix.CreateMetric(k, myData)
+			}
+			_, _ = calculateEnvironmentMetrics(data, logging.Get(), restValueKey, myData, nil, sensorOptions{fanSpeedTrim: tt.trim})
+			if got, _ := myData.GetMetric("average_fan_speed").GetValueFloat64(myData.GetInstance("n1")); got != tt.want {
+				t.Errorf("average_fan_speed got=%v want=%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitPSU(t *testing.T) {
+	type sensor struct {
+		node  string
+		name  string
+		value float64
+		unit  string
+	}
+	sensors := []sensor{
+		// power sensors, voltage and current are reported alongside
+		{node: "n1", name: "PSU1 InPower", value: 200, unit: "W"},
+		{node: "n1", name: "PSU2 InPower", value: 100000, unit: "mW"},
+		{node: "n1", name: "PSU1 VIN", value: 230, unit: "V"},
+		{node: "n1", name: "PSU1 Curr IIN", value: 900, unit: "mA"},
+		// power derived from voltage and current pairs
+		{node: "n2", name: "PSU1 VIN", value: 200, unit: "V"},
+		{node: "n2", name: "PSU2 VIN", value: 200, unit: "V"},
+		{node: "n2", name: "PSU1 Curr IIN", value: 1.5, unit: "A"},
+		{node: "n2", name: "PSU2 Curr IIN", value: 0.5, unit: "A"},
+	}
+	newData := func() (*matrix.Matrix, *matrix.Matrix) {
+		data := matrix.New("Sensor", "sensor", "sensor")
+		value, _ := data.NewMetricFloat64(restValueKey)
+		for i, s := range sensors {
+			instance, _ := data.NewInstance(strconv.Itoa(i))
+			instance.SetLabel("node", s.node)
+			instance.SetLabel("sensor", s.name)
+			instance.SetLabel("unit", s.unit)
+			_ = value.SetValueFloat64(instance, s.value)
+		}
+		myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+		for _, k := range eMetrics {
+			_ = matrix.CreateMetric(k, myData)
+		}
+		return data, myData
+	}
+
+	t.Run("aggregate by default", func(t *testing.T) {
+		data, myData := newData()
+		_, _ = calculateEnvironmentMetrics(data, logging.Get(), restValueKey, myData, map[string]int{"n1": 1, "n2": 1}, sensorOptions{})
+		if got := len(myData.GetInstances()); got != 2 {
+			t.Errorf("instances got=%d want=2", got)
+		}
+	})
+
+	t.Run("split", func(t *testing.T) {
+		data, myData := newData()
+		// n1 shares its chassis with another node
+		_, _ = calculateEnvironmentMetrics(data, logging.Get(), restValueKey, myData, map[string]int{"n1": 2, "n2": 1}, sensorOptions{splitPSU: true})
+
+		type want struct {
+			power, voltage, current float64
+			hasVoltage              bool
+		}
+		expected := map[string]want{
+			"n1.PSU1": {power: 100, voltage: 230, current: 0.9, hasVoltage: true},
+			"n1.PSU2": {power: 50},
+			"n2.PSU1": {power: 300 / 0.93, voltage: 200, current: 1.5, hasVoltage: true},
+			"n2.PSU2": {power: 100 / 0.93, voltage: 200, current: 0.5, hasVoltage: true},
+		}
+		if got := len(myData.GetInstances()); got != 2+len(expected) {
+			t.Errorf("instances got=%d want=%d", got, 2+len(expected))
+		}
+		for key, exp := range expected {
+			instance := myData.GetInstance(key)
+			if instance == nil {
+				t.Errorf("%s missing", key)
+				continue
+			}
+			if instance.GetLabel("psu") != key[3:] || instance.GetLabel("node") != key[:2] || instance.GetLabel("scope") != "psu" {
+				t.Errorf("%s labels got=%v", key, instance.GetLabels())
+			}
+			if got, _ := myData.GetMetric("power").GetValueFloat64(instance); math.Abs(got-exp.power) > 1e-9 {
+				t.Errorf("%s power got=%v want=%v", key, got, exp.power)
+			}
+			voltage, ok := myData.GetMetric("voltage").GetValueFloat64(instance)
+			if ok != exp.hasVoltage || math.Abs(voltage-exp.voltage) > 1e-9 {
+				t.Errorf("%s voltage got=%v,%t want=%v,%t", key, voltage, ok, exp.voltage, exp.hasVoltage)
+			}
+			current, _ := myData.GetMetric("current").GetValueFloat64(instance)
+			if math.Abs(current-exp.current) > 1e-9 {
+				t.Errorf("%s current got=%v want=%v", key, current, exp.current)
+			}
+		}
+
+		// the node aggregate is kept
+		if got, _ := myData.GetMetric("power").GetValueFloat64(myData.GetInstance("n1")); got != 150 {
+			t.Errorf("n1 power got=%v want=150", got)
+		}
+
+		// cluster rollups only use node instances
+		calculateClusterSummary(myData, logging.Get())
+		if got, _ := myData.GetMetric("power_max").GetValueFloat64(myData.GetInstance("cluster")); math.Abs(got-400/0.93) > 1e-9 {
+			t.Errorf("power_max got=%v want=%v", got, 400/0.93)
+		}
+		if got := myData.GetInstance("n1.PSU1").GetLabel("scope"); got != "psu" {
+			t.Errorf("psu scope got=%s", got)
+		}
+	})
+}
+
+func TestPSUEfficiency(t *testing.T) {
+	type sensor struct {
+		node, model, name string
+		value             float64
+	}
+	sensors := []sensor{
+		{node: "n1", model: "AFF-A900", name: "PSU1 VIN", value: 200},
+		{node: "n1", model: "AFF-A900", name: "PSU1 Curr IIN", value: 1},
+		{node: "n2", model: "FAS2750", name: "PSU1 VIN", value: 200},
+		{node: "n2", model: "FAS2750", name: "PSU1 Curr IIN", value: 1},
+		{node: "n3", name: "PSU1 VIN", value: 200},
+		{node: "n3", name: "PSU1 Curr IIN", value: 1},
+	}
+	newData := func() (*matrix.Matrix, *matrix.Matrix) {
+		data := matrix.New("Sensor", "sensor", "sensor")
+		value, _ := data.NewMetricFloat64(restValueKey)
+		for i, s := range sensors {
+			instance, _ := data.NewInstance(strconv.Itoa(i))
+			instance.SetLabel("node", s.node)
+			instance.SetLabel("sensor", s.name)
+			instance.SetLabel("model", s.model)
+			_ = value.SetValueFloat64(instance, s.value)
+		}
+		myData := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+		for _, k := range eMetrics {
+			_ = matrix.CreateMetric(k, myData)
+		}
+		return data, myData
+	}
+
+	tests := []struct {
+		name       string
+		efficiency map[string]float64
+		want       map[string]float64
+	}{
+		{name: "not configured", want: map[string]float64{"n1": 200 / 0.93, "n2": 200 / 0.93, "n3": 200 / 0.93}},
+		{name: "by model", efficiency: map[string]float64{"AFF-A900": 0.8},
+			want: map[string]float64{"n1": 250, "n2": 200 / 0.93, "n3": 200 / 0.93}},
+		{name: "by model and default", efficiency: map[string]float64{"AFF-A900": 0.8, "default": 0.5},
+			want: map[string]float64{"n1": 250, "n2": 400, "n3": 400}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, myData := newData()
+			_, _ = calculateEnvironmentMetrics(data, logging.Get(), restValueKey, myData, nil, sensorOptions{efficiency: tt.efficiency})
+			for node, want := range tt.want {
+				if got, _ := myData.GetMetric("power").GetValueFloat64(myData.GetInstance(node)); math.Abs(got-want) > 1e-9 {
+					t.Errorf("%s power got=%v want=%v", node, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseEfficiency(t *testing.T) {
+	params := node.NewS("Sensor")
+	efficiency := params.NewChildS("efficiency", "")
+	efficiency.NewChildS("default", "0.9")
+	efficiency.NewChildS("AFF-A900", "0.95")
+	efficiency.NewChildS("zero", "0")
+	efficiency.NewChildS("above one", "1.2")
+	efficiency.NewChildS("not a number", "high")
+	s := &Sensor{AbstractPlugin: plugin.New("Rest", nil, params, nil, "sensor", nil)}
+	s.Logger = logging.Get()
+
+	got := s.parseEfficiency()
+	want := map[string]float64{"default": 0.9, "AFF-A900": 0.95}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("efficiency got=%v want=%v", got, want)
+	}
+}
+
+func TestParsePrimary(t *testing.T) {
+	params := node.NewS("Sensor")
+	params.NewChildS("ambient_regex", "^Intake Temperature$")
+	params.NewChildS("power_regex", "^PSU\\d (InPower")
+	s := &Sensor{AbstractPlugin: plugin.New("Rest", nil, params, nil, "sensor", nil)}
+	s.Logger = logging.Get()
+
+	primary := s.parsePrimary()
+	tests := []struct {
+		name string
+		want sensorClass
+	}{
+		{name: "Intake Temperature", want: sensorClass{ambient: true}},
+		// replaced by ambient_regex
+		{name: "Ambient Temp"},
+		// the invalid power_regex keeps the built-in regex
+		{name: "PSU1 InPower", want: sensorClass{power: true}},
+		{name: "PSU1 VIN", want: sensorClass{voltage: true}},
+		{name: "PSU1 Curr IIN", want: sensorClass{current: true}},
+	}
+	for _, tt := range tests {
+		if got := classifySensor(tt.name, primary, nil); got != tt.want {
+			t.Errorf("%s got=%+v want=%+v", tt.name, got, tt.want)
+		}
+	}
+
+	// the built-in regexes are not changed
+	if !classifySensor("Ambient Temp", nil, nil).ambient {
+		t.Errorf("built-in ambient regex changed")
+	}
+}
+
+func TestFRUCache(t *testing.T) {
+	calls := 0
+	var collectErr error
+	collect := func() (*chassisFRU, error) {
+		calls++
+		if collectErr != nil {
+			return nil, collectErr
+		}
+		return &chassisFRU{nodeToNumNode: map[string]int{"n1": calls}}, nil
+	}
+	logger := logging.Get()
+	start := time.Now()
+	cache := &fruCache{ttl: time.Hour}
+
+	steps := []struct {
+		name      string
+		nodes     int
+		after     time.Duration
+		err       error
+		wantCalls int
+		wantNum   int
+	}{
+		{name: "first poll collects", nodes: 2, wantCalls: 1, wantNum: 1},
+		{name: "cached within ttl", nodes: 2, after: 30 * time.Minute, wantCalls: 1, wantNum: 1},
+		{name: "node count changed", nodes: 3, after: 31 * time.Minute, wantCalls: 2, wantNum: 2},
+		{name: "ttl expired", nodes: 3, after: 2 * time.Hour, wantCalls: 3, wantNum: 3},
+		{name: "failed refresh keeps last good", nodes: 3, after: 4 * time.Hour, err: errors.New("timeout"), wantCalls: 4, wantNum: 3},
+	}
+	for _, s := range steps {
+		collectErr = s.err
+		fru, err := cache.get(s.nodes, start.Add(s.after), collect, logger)
+		if err != nil {
+			t.Fatalf("%s: unexpected err %v", s.name, err)
+		}
+		if calls != s.wantCalls || fru.nodeToNumNode["n1"] != s.wantNum {
+			t.Errorf("%s: calls got=%d want=%d numNode got=%d want=%d", s.name, calls, s.wantCalls, fru.nodeToNumNode["n1"], s.wantNum)
+		}
+	}
+
+	// nothing cached yet
+	empty := &fruCache{ttl: time.Hour}
+	if _, err := empty.get(1, start, collect, logger); err == nil {
+		t.Errorf("expected the collect error without cached data")
+	}
+}
+
+func TestSensorStop(t *testing.T) {
+	received := make(chan struct{})
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		// hang until the client gives up
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	insecure := true
+	poller := &conf.Poller{
+		Addr:           strings.TrimPrefix(server.URL, "https://"),
+		Username:       "admin",
+		Password:       "password",
+		UseInsecureTLS: &insecure,
+	}
+	client, err := rest.New(poller, time.Minute, auth.NewCredentials(poller, logging.Get()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSensor(plugin.New("Rest", nil, node.NewS("Sensor"), nil, "sensor", nil)).(*Sensor)
+	s.client = client
+	done := make(chan error, 1)
+	go func() {
+		_, err := collectChassisFRU(s.ctx, s.client, nil, nil, logging.Get())
+		done <- err
+	}()
+	<-received
+
+	// the poller stops its collectors on shutdown, which stop their plugins
+	c := &collector.AbstractCollector{Plugins: map[string][]plugin.Plugin{"sensor": {s}}}
+	c.Stop()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("collectChassisFRU still in flight after Stop")
+	}
+}
@@ -0,0 +1,280 @@
+package collectors
+
+import (
+	"fmt"
+	"github.com/netapp/harvest/v2/pkg/matrix"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// sensorInput is the part of a sensor instance used by calculateEnvironmentMetrics, kept to explain the last run
+type sensorInput struct {
+	node       string
+	name       string
+	sensorType string
+	unit       string
+	value      float64
+	hasValue   bool
+	exportable bool
+	// why the reading is invalid, see sensorValidity
+	invalid string
+}
+
+// sensorInputs copies the inputs of the sensors of data
+func sensorInputs(data *matrix.Matrix, valueKey string, validity *sensorValidity) []sensorInput {
+	metric := data.GetMetric(valueKey)
+	inputs := make([]sensorInput, 0, len(data.GetInstances()))
+	for _, instance := range data.GetInstancesOrdered() {
+		in := sensorInput{
+			node:       instance.GetLabel("node"),
+			name:       instance.GetLabel("sensor"),
+			sensorType: instance.GetLabel("type"),
+			unit:       instance.GetLabel("unit"),
+			exportable: instance.IsExportable(),
+			invalid:    validity.invalid(instance),
+		}
+		if metric != nil {
+			in.value, in.hasValue = metric.GetValueFloat64(instance)
+		}
+		inputs = append(inputs, in)
+	}
+	return inputs
+}
+
+// droppedSensors replays the checks calculateEnvironmentMetrics makes before it reads the value of a sensor, in the
+// same order, and returns why each input is dropped, "" when it is used
+func droppedSensors(inputs []sensorInput, opts sensorOptions, skippedNodes map[string]bool) []string {
+	dropped := make([]string, len(inputs))
+	// node/canonical sensor name to the name of the sensor that was counted
+	seen := make(map[string]string)
+	for i, in := range inputs {
+		switch {
+		case !in.exportable:
+			dropped[i] = "not exportable, ignored"
+		case in.node == "" || in.name == "":
+			dropped[i] = "missing node or sensor name, ignored"
+		case skippedNodes[in.node]:
+			dropped[i] = "node skipped, the sensor time budget was exceeded"
+		default:
+			canonical := opts.canonicalName(in.name)
+			key := in.node + "/" + canonical
+			if first, ok := seen[key]; ok {
+				dropped[i] = fmt.Sprintf("duplicate of canonical %q reported as %q, skipped", canonical, first)
+				continue
+			}
+			seen[key] = in.name
+			if in.invalid != "" {
+				dropped[i] = fmt.Sprintf("invalid reading %s, excluded", in.invalid)
+			}
+		}
+	}
+	return dropped
+}
+
+// explainSensor reconstructs how calculateEnvironmentMetrics classified one sensor, one decision per line.
+// skippedNodes are the nodes the last run skipped because the time budget was spent.
+func explainSensor(inputs []sensorInput, opts sensorOptions, skippedNodes map[string]bool, nodeName string, sensorName string) string {
+	idx := -1
+	for i := range inputs {
+		if inputs[i].node == nodeName && inputs[i].name == sensorName {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return fmt.Sprintf("sensor %q of node %q was not collected in the last poll", sensorName, nodeName)
+	}
+	in := inputs[idx]
+
+	var b strings.Builder
+	line := func(format string, a ...any) {
+		_, _ = fmt.Fprintf(&b, format+"\n", a...)
+	}
+	line("sensor %q of node %q type=%q unit=%q", in.name, in.node, in.sensorType, in.unit)
+	dropped := droppedSensors(inputs, opts, skippedNodes)
+	if dropped[idx] != "" {
+		line(dropped[idx])
+		return b.String()
+	}
+	// the loop classifies and calibrates the canonical name
+	name := opts.canonicalName(in.name)
+	if name != in.name {
+		line("canonical name %q", name)
+	}
+	if !in.hasValue {
+		if in.sensorType == "fan" {
+			line("no value, only counted in fans_total")
+			return b.String()
+		}
+		line("no value, ignored")
+		return b.String()
+	}
+	value := in.value
+	if offset := opts.offset(in.node, name); offset != 0 {
+		value += offset
+		line("calibration offset %g applied, value %g => %g", offset, in.value, value)
+	} else {
+		line("value %g", value)
+	}
+
+	class := classifySensor(name, opts.primary, opts.fallback)
+	isAmbient, isPower, isVoltage, isCurrent := class.ambient, class.power, class.voltage, class.current
+	classifiedBy := "built-in"
+	if class.byFallback {
+		classifiedBy = "fallback"
+	}
+	line("%s regexes: ambient=%t power=%t voltage=%t current=%t", classifiedBy, isAmbient, isPower, isVoltage, isCurrent)
+
+	used := false
+	switch {
+	case in.sensorType == "thermal" && isAmbient:
+		line("ambient temperature: counted in average_ambient_temperature and min_ambient_temperature")
+		used = true
+	case in.sensorType == "thermal" && strings.Contains(name, "Margin"):
+		line("thermal margin sensor: excluded from temperature metrics")
+		used = true
+	case in.sensorType == "thermal" && value <= 0:
+		line("thermal value <= 0: excluded from temperature metrics")
+		used = true
+	case in.sensorType == "thermal":
+		line("temperature: counted in min_temperature, average_temperature and max_temperature")
+		used = true
+	case in.sensorType == "fan":
+		line("fan: counted in min_fan_speed, average_fan_speed and max_fan_speed")
+		used = true
+	}
+
+	// power sensors of the node take precedence over voltage and current pairs
+	nodePowerSensors := 0
+	for i, other := range inputs {
+		if other.node == in.node && dropped[i] == "" && other.hasValue &&
+			classifySensor(opts.canonicalName(other.name), opts.primary, opts.fallback).power &&
+			IsValidUnit(unitOr(other.unit, opts.defaultPowerUnit)) {
+			nodePowerSensors++
+		}
+	}
+	if isPower {
+		used = true
+		unit := unitOr(in.unit, opts.defaultPowerUnit)
+		switch {
+		case !IsValidUnit(unit):
+			line("power: unknown unit %q, skipped", in.unit)
+		case unit != in.unit:
+			line("power: no unit, default %s assumed, counted in power", unit)
+		default:
+			line("power: counted in power")
+		}
+	}
+	if isVoltage || isCurrent {
+		used = true
+		if nodePowerSensors > 0 {
+			line("voltage/current: not used, node has %d power sensors", nodePowerSensors)
+		} else {
+			line("voltage/current: multiplied with its pair and counted in power when the node has as many voltage as current sensors")
+		}
+	}
+	if !used {
+		line("not used by any environment metric")
+	}
+	return b.String()
+}
+
+// ExplainSensor explains how the named sensor of node was classified in the last run
+func (my *Sensor) ExplainSensor(nodeName string, sensorName string) string {
+	my.lastMu.Lock()
+	defer my.lastMu.Unlock()
+	if my.lastInputs == nil {
+		return "Sensor plugin has not run yet"
+	}
+	return explainSensor(my.lastInputs, my.options, my.lastSkipped, nodeName, sensorName)
+}
+
+var (
+	explainMu sync.Mutex
+	// the Sensor plugins that serve /debug/sensor, by collector and object, see explainKey
+	explainSensors = make(map[string]*Sensor)
+)
+
+// explainKey identifies a Sensor plugin across reloads, a re-initialized plugin replaces its predecessor
+func explainKey(my *Sensor) string {
+	return my.Parent + "." + my.Object
+}
+
+// registerExplainHandler makes my answer /debug/sensor queries, see ServeExplainSensor
+func registerExplainHandler(my *Sensor) {
+	explainMu.Lock()
+	defer explainMu.Unlock()
+	explainSensors[explainKey(my)] = my
+}
+
+// unregisterExplainHandler stops my from answering /debug/sensor queries, unless it was already replaced
+func unregisterExplainHandler(my *Sensor) {
+	explainMu.Lock()
+	defer explainMu.Unlock()
+	if explainSensors[explainKey(my)] == my {
+		delete(explainSensors, explainKey(my))
+	}
+}
+
+// ServeExplainSensor serves /debug/sensor?node=<node>&sensor=<sensor name> on the profiling port of the poller.
+// Every registered Sensor plugin explains how it classified the sensor in its last run.
+func ServeExplainSensor(w http.ResponseWriter, r *http.Request) {
+	nodeName := r.URL.Query().Get("node")
+	sensorName := r.URL.Query().Get("sensor")
+	if nodeName == "" || sensorName == "" {
+		http.Error(w, "usage: /debug/sensor?node=<node>&sensor=<sensor name>", http.StatusBadRequest)
+		return
+	}
+	explainMu.Lock()
+	keys := make([]string, 0, len(explainSensors))
+	for key := range explainSensors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	sensors := make([]*Sensor, 0, len(keys))
+	for _, key := range keys {
+		sensors = append(sensors, explainSensors[key])
+	}
+	explainMu.Unlock()
+	for _, s := range sensors {
+		_, _ = fmt.Fprintf(w, "%s\n%s\n", s.Parent+".Sensor", s.ExplainSensor(nodeName, sensorName))
+	}
+}
+
+// sensorCoverage lists the sensor names of a corpus per category. A name matching several categories is listed
+// in each of them.
+type sensorCoverage struct {
+	ambient   []string
+	power     []string
+	voltage   []string
+	current   []string
+	unmatched []string
+}
+
+// checkSensorCoverage classifies a corpus of sensor names, e.g. the sensor names of sample dumps of many platforms,
+// with the built-in regexes and the optional fallback regexes. It is meant for tests that catch regex regressions.
+func checkSensorCoverage(corpus []string, fallback *sensorRegexes) sensorCoverage {
+	var c sensorCoverage
+	for _, name := range corpus {
+		class := classifySensor(name, nil, fallback)
+		if !class.matched() {
+			c.unmatched = append(c.unmatched, name)
+			continue
+		}
+		if class.ambient {
+			c.ambient = append(c.ambient, name)
+		}
+		if class.power {
+			c.power = append(c.power, name)
+		}
+		if class.voltage {
+			c.voltage = append(c.voltage, name)
+		}
+		if class.current {
+			c.current = append(c.current, name)
+		}
+	}
+	return c
+}
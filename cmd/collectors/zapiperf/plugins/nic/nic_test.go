@@ -0,0 +1,321 @@
+package nic
+
+import (
+	"bytes"
+	"github.com/netapp/harvest/v2/cmd/poller/options"
+	"github.com/netapp/harvest/v2/cmd/poller/plugin"
+	"github.com/netapp/harvest/v2/pkg/logging"
+	"github.com/netapp/harvest/v2/pkg/matrix"
+	"github.com/netapp/harvest/v2/pkg/tree/node"
+	"github.com/rs/zerolog"
+	"strconv"
+	"testing"
+)
+
+func TestNic_Excluded(t *testing.T) {
+	params := node.NewS("Nic")
+	n := &Nic{AbstractPlugin: plugin.New("ZapiPerf", options.New(), params, nil, "nic", nil)}
+	if err := n.Init(); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zl := zerolog.New(&buf).Level(zerolog.WarnLevel)
+	n.Logger = &logging.Logger{Logger: &zl}
+
+	data := matrix.New("ZapiPerf", "nic", "nic")
+	rx, _ := data.NewMetricFloat64("rx_bytes")
+	tx, _ := data.NewMetricFloat64("tx_bytes")
+	ports := []struct {
+		name    string
+		nicType string
+		speed   string
+	}{
+		{name: "e0a", nicType: "nic_ixl", speed: "10000M"},
+		{name: "losk", nicType: "nic_ixl", speed: "auto"},
+		{name: "e0z", nicType: "nic_loopback", speed: "auto"},
+	}
+	for _, p := range ports {
+		name := p.name
+		instance, _ := data.NewInstance(name)
+		instance.SetLabel("nic", name)
+		instance.SetLabel("type", p.nicType)
+		instance.SetLabel("speed", p.speed)
+		_ = rx.SetValueFloat64(instance, 125000)
+		_ = tx.SetValueFloat64(instance, 125000)
+	}
+
+	if _, err := n.Run(map[string]*matrix.Matrix{"nic": data}); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.Len() != 0 {
+		t.Errorf("expected no warnings, got %s", buf.String())
+	}
+	for _, p := range ports {
+		instance := data.GetInstance(p.name)
+		excluded := p.name != "e0a"
+		if instance.IsExportable() == excluded {
+			t.Errorf("port %s expected exportable=%v", p.name, !excluded)
+		}
+		_, ok := data.GetMetric("util_percent").GetValueFloat64(instance)
+		if ok == excluded {
+			t.Errorf("port %s expected util_percent set=%v", p.name, !excluded)
+		}
+	}
+}
+
+func TestNic_ClampUtil(t *testing.T) {
+	for _, clamp := range []bool{false, true} {
+		params := node.NewS("Nic")
+		params.NewChildS("clamp_util_percent", strconv.FormatBool(clamp))
+		n := &Nic{AbstractPlugin: plugin.New("ZapiPerf", options.New(), params, nil, "nic", nil)}
+		if err := n.Init(); err != nil {
+			t.Fatal(err)
+		}
+
+		data := matrix.New("ZapiPerf", "nic", "nic")
+		rx, _ := data.NewMetricFloat64("rx_bytes")
+		_, _ = data.NewMetricFloat64("tx_bytes")
+		instance, _ := data.NewInstance("e0a")
+		instance.SetLabel("speed", "1000M")
+		// 10% above the rated speed of 125,000,000 bytes per second
+		_ = rx.SetValueFloat64(instance, 137_500_000)
+
+		if _, err := n.Run(map[string]*matrix.Matrix{"nic": data}); err != nil {
+			t.Fatal(err)
+		}
+
+		want := 1.1
+		if clamp {
+			want = 1
+		}
+		if got, _ := data.GetMetric("util_percent").GetValueFloat64(instance); got != want {
+			t.Errorf("clamp=%v expected util_percent=%v, got %v", clamp, want, got)
+		}
+		if got, _ := data.GetMetric("rx_percent").GetValueFloat64(instance); got != want {
+			t.Errorf("clamp=%v expected rx_percent=%v, got %v", clamp, want, got)
+		}
+		if got, _ := data.GetMetric("util_overflow").GetValueFloat64(instance); got != 1 {
+			t.Errorf("clamp=%v expected util_overflow=1, got %v", clamp, got)
+		}
+	}
+}
+
+func TestNic_400GSpeed(t *testing.T) {
+	n := &Nic{AbstractPlugin: plugin.New("ZapiPerf", options.New(), node.NewS("Nic"), nil, "nic", nil)}
+	if err := n.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := matrix.New("ZapiPerf", "nic", "nic")
+	rx, _ := data.NewMetricFloat64("rx_bytes")
+	_, _ = data.NewMetricFloat64("tx_bytes")
+	instance, _ := data.NewInstance("e0a")
+	instance.SetLabel("speed", "400000M")
+	// a quarter of the rated speed of 50,000,000,000 bytes per second
+	_ = rx.SetValueFloat64(instance, 12_500_000_000)
+
+	if _, err := n.Run(map[string]*matrix.Matrix{"nic": data}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := instance.GetLabel("speed"); got != "400000000000" {
+		t.Errorf("expected speed=400000000000, got %s", got)
+	}
+	if got := instance.GetLabel("speed_original"); got != "400000M" {
+		t.Errorf("expected speed_original=400000M, got %s", got)
+	}
+	if got, _ := data.GetMetric("util_percent").GetValueFloat64(instance); got != 0.25 {
+		t.Errorf("expected util_percent=0.25, got %v", got)
+	}
+}
+
+func TestNic_ErrorRates(t *testing.T) {
+	newNic := func() *Nic {
+		n := &Nic{AbstractPlugin: plugin.New("ZapiPerf", options.New(), node.NewS("Nic"), nil, "nic", nil)}
+		if err := n.Init(); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	rates := []string{"rx_error_percent", "tx_error_percent", "rx_drop_percent", "tx_drop_percent"}
+
+	t.Run("with error counters", func(t *testing.T) {
+		data := matrix.New("ZapiPerf", "nic", "nic")
+		metrics := map[string]float64{
+			"rx_bytes":        1_000_000,
+			"tx_bytes":        500_000,
+			"rx_packets":      1000,
+			"rx_total_errors": 10,
+			"rx_drops":        0,
+			// no tx_packets, tx rates are per byte
+			"tx_total_errors": 50,
+		}
+		instance, _ := data.NewInstance("e0a")
+		instance.SetLabel("speed", "1000M")
+		for name, value := range metrics {
+			m, _ := data.NewMetricFloat64(name)
+			_ = m.SetValueFloat64(instance, value)
+		}
+
+		if _, err := newNic().Run(map[string]*matrix.Matrix{"nic": data}); err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[string]float64{"rx_error_percent": 0.01, "rx_drop_percent": 0, "tx_error_percent": 0.0001}
+		for _, name := range rates {
+			metric := data.GetMetric(name)
+			exp, ok := want[name]
+			if !ok {
+				if metric != nil {
+					t.Errorf("%s expected to be skipped", name)
+				}
+				continue
+			}
+			if metric == nil {
+				t.Fatalf("%s not created", name)
+			}
+			if got, _ := metric.GetValueFloat64(instance); got != exp {
+				t.Errorf("%s got=%v want=%v", name, got, exp)
+			}
+		}
+	})
+
+	t.Run("without error counters", func(t *testing.T) {
+		data := matrix.New("ZapiPerf", "nic", "nic")
+		rx, _ := data.NewMetricFloat64("rx_bytes")
+		_, _ = data.NewMetricFloat64("tx_bytes")
+		instance, _ := data.NewInstance("e0a")
+		instance.SetLabel("speed", "1000M")
+		_ = rx.SetValueFloat64(instance, 1_000_000)
+
+		if _, err := newNic().Run(map[string]*matrix.Matrix{"nic": data}); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range rates {
+			if data.GetMetric(name) != nil {
+				t.Errorf("%s expected to be skipped", name)
+			}
+		}
+	})
+}
+
+func TestNic_GbpsSpeed(t *testing.T) {
+	n := &Nic{AbstractPlugin: plugin.New("ZapiPerf", options.New(), node.NewS("Nic"), nil, "nic", nil)}
+	if err := n.Init(); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zl := zerolog.New(&buf).Level(zerolog.WarnLevel)
+	n.Logger = &logging.Logger{Logger: &zl}
+
+	tests := []struct {
+		speed     string
+		rxBytes   float64
+		wantSpeed string
+	}{
+		// half of the rated speed in bytes per second
+		{speed: "100G", rxBytes: 6_250_000_000, wantSpeed: "100000000000"},
+		{speed: "40G", rxBytes: 2_500_000_000, wantSpeed: "40000000000"},
+		{speed: "10000M", rxBytes: 625_000_000, wantSpeed: "10000000000"},
+		// speeds without a suffix are used as is
+		{speed: "25000", rxBytes: 12500, wantSpeed: "25000"},
+	}
+	data := matrix.New("ZapiPerf", "nic", "nic")
+	rx, _ := data.NewMetricFloat64("rx_bytes")
+	_, _ = data.NewMetricFloat64("tx_bytes")
+	for _, tt := range tests {
+		instance, _ := data.NewInstance(tt.speed)
+		instance.SetLabel("speed", tt.speed)
+		_ = rx.SetValueFloat64(instance, tt.rxBytes)
+	}
+
+	if _, err := n.Run(map[string]*matrix.Matrix{"nic": data}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no warnings, got %s", buf.String())
+	}
+	for _, tt := range tests {
+		instance := data.GetInstance(tt.speed)
+		if got := instance.GetLabel("speed"); got != tt.wantSpeed {
+			t.Errorf("%s expected speed=%s, got %s", tt.speed, tt.wantSpeed, got)
+		}
+		if got, _ := data.GetMetric("util_percent").GetValueFloat64(instance); got != 0.5 {
+			t.Errorf("%s expected util_percent=0.5, got %v", tt.speed, got)
+		}
+	}
+}
+
+func TestNic_DuplexHalf(t *testing.T) {
+	n := &Nic{AbstractPlugin: plugin.New("ZapiPerf", options.New(), node.NewS("Nic"), nil, "nic", nil)}
+	if err := n.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := matrix.New("ZapiPerf", "nic", "nic")
+	_, _ = data.NewMetricFloat64("rx_bytes")
+	_, _ = data.NewMetricFloat64("tx_bytes")
+	tests := []struct {
+		nic    string
+		duplex string
+		want   float64
+		wantOk bool
+	}{
+		{nic: "e0a", duplex: "half", want: 1, wantOk: true},
+		{nic: "e0b", duplex: "full", want: 0, wantOk: true},
+		{nic: "e0c"},
+	}
+	for _, tt := range tests {
+		instance, _ := data.NewInstance(tt.nic)
+		instance.SetLabel("nic", tt.nic)
+		instance.SetLabel("speed", "10000M")
+		if tt.duplex != "" {
+			instance.SetLabel("duplex", tt.duplex)
+		}
+	}
+
+	if _, err := n.Run(map[string]*matrix.Matrix{"nic": data}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		got, ok := data.GetMetric("duplex_half").GetValueFloat64(data.GetInstance(tt.nic))
+		if ok != tt.wantOk || got != tt.want {
+			t.Errorf("%s expected duplex_half=%v,%t, got %v,%t", tt.nic, tt.want, tt.wantOk, got, ok)
+		}
+	}
+}
+
+func TestNic_TrimTypePrefix(t *testing.T) {
+	n := &Nic{AbstractPlugin: plugin.New("ZapiPerf", options.New(), node.NewS("Nic"), nil, "nic", nil)}
+	if err := n.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := matrix.New("ZapiPerf", "nic", "nic")
+	_, _ = data.NewMetricFloat64("rx_bytes")
+	_, _ = data.NewMetricFloat64("tx_bytes")
+	tests := []struct {
+		nic     string
+		nicType string
+		want    string
+	}{
+		{nic: "e0a", nicType: "if_nic_data", want: "data"},
+		{nic: "e0b", nicType: "nic_data", want: "data"},
+		{nic: "e0c", nicType: "data", want: "data"},
+	}
+	for _, tt := range tests {
+		instance, _ := data.NewInstance(tt.nic)
+		instance.SetLabel("type", tt.nicType)
+		instance.SetLabel("speed", "10000M")
+	}
+
+	if _, err := n.Run(map[string]*matrix.Matrix{"nic": data}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		if got := data.GetInstance(tt.nic).GetLabel("type"); got != tt.want {
+			t.Errorf("%s expected type=%s, got %s", tt.nicType, tt.want, got)
+		}
+	}
+}
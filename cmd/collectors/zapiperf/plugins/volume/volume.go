@@ -10,7 +10,6 @@ import (
 	"github.com/netapp/harvest/v2/pkg/matrix"
 	"github.com/netapp/harvest/v2/pkg/set"
 	"maps"
-	"regexp"
 	"sort"
 	"strings"
 )
@@ -19,6 +18,10 @@ type Volume struct {
 	*plugin.AbstractPlugin
 	styleType           string
 	includeConstituents bool
+	pruneEmptyMetrics   bool
+	rollups             map[string]collectors.Rollup
+	constituentCV       []string
+	latencyOps          map[string]string
 }
 
 func New(p *plugin.AbstractPlugin) plugin.Plugin {
@@ -38,8 +41,19 @@ func (v *Volume) Init() error {
 		v.styleType = "type"
 	}
 
-	// Read template to decide inclusion of flexgroup constituents
-	v.includeConstituents = collectors.ReadPluginKey(v.Params, "include_constituents")
+	// Read template to decide inclusion of flexgroup constituents, export_constituents is an alias
+	v.includeConstituents = collectors.ReadPluginKey(v.Params, "include_constituents") ||
+		collectors.ReadPluginKey(v.Params, "export_constituents")
+	// latencies are NaN for volumes without ops, don't export latencies that are NaN for every volume
+	v.pruneEmptyMetrics = collectors.ReadPluginKey(v.Params, "prune_empty_metrics")
+	// how constituent values are combined, by default latencies are weighted, percentages averaged and others summed
+	v.rollups = collectors.ParseRollups(v.Params, v.Logger)
+	// ops metrics that weight latencies, by default the ops metric of the latency counter
+	v.latencyOps = collectors.ParseLatencyOps(v.Params)
+	// metrics whose distribution across the constituents of a flexgroup is exported as <metric>_cv
+	if cv := v.Params.GetChildS("constituent_cv"); cv != nil {
+		v.constituentCV = cv.GetAllChildContentS()
+	}
 	return nil
 }
 
@@ -56,9 +70,18 @@ func (v *Volume) Run(dataMap map[string]*matrix.Matrix) ([]*matrix.Matrix, error
 	data := dataMap[v.Object]
 	style := v.styleType
 	opsKeyPrefix := "temp_"
-	re := regexp.MustCompile(`^(.*)__(\d{4})$`)
+	countKeyPrefix := "temp_count_"
+	constituents := collectors.FlexgroupConstituents(data, v.Logger)
+	opsKeys := collectors.LatencyOpsKeys(data, v.latencyOps, v.Logger)
 
 	fgAggrMap := make(map[string]*set.Set)
+	fgNodeMap := make(map[string]*set.Set)
+	// number of constituents of each flexgroup
+	fgConstituents := make(map[string]int)
+	// constituents of each flexgroup that are exported unless include_constituents is false
+	fgExportable := make(map[string][]*matrix.Instance)
+	// constituents of each flexgroup in the local cache, whose latencies are weighted by ops
+	fgMembers := make(map[string][]*matrix.Instance)
 	flexgroupAggrsMap := make(map[string]*set.Set)
 	// volume_aggr_labels metric is deprecated now and will be removed later.
 	metricName := "labels"
@@ -70,7 +93,7 @@ func (v *Volume) Run(dataMap map[string]*matrix.Matrix) ([]*matrix.Matrix, error
 		v.Logger.Error().Err(err).Msg("add metric")
 		return nil, err
 	}
-	v.Logger.Trace().Msgf("added metric: (%s) %v", metricName, metric)
+	v.Logger.Trace().Str("metric", metricName).Msg("added metric")
 
 	cache := data.Clone(matrix.With{Data: false, Metrics: true, Instances: false, ExportInstances: true})
 	cache.UUID += ".Volume"
@@ -80,23 +103,24 @@ func (v *Volume) Run(dataMap map[string]*matrix.Matrix) ([]*matrix.Matrix, error
 		if !i.IsExportable() {
 			continue
 		}
-		if match := re.FindStringSubmatch(i.GetLabel("volume")); len(match) == 3 {
+		if flexgroup, ok := constituents[i]; ok {
 			// instance key is svm.flexgroup-volume
-			key := i.GetLabel("svm") + "." + match[1]
+			key := i.GetLabel("svm") + "." + flexgroup
 			if cache.GetInstance(key) == nil {
 				fg, _ := cache.NewInstance(key)
 				fg.SetLabels(maps.Clone(i.GetLabels()))
-				fg.SetLabel("volume", match[1])
+				fg.SetLabel("volume", flexgroup)
 				// Flexgroup don't show any node
 				fg.SetLabel("node", "")
 				fg.SetLabel(style, "flexgroup")
 				fgAggrMap[key] = set.New()
+				fgNodeMap[key] = set.New()
 			}
 
 			if volumeAggrmetric.GetInstance(key) == nil {
 				flexgroupInstance, _ := volumeAggrmetric.NewInstance(key)
 				flexgroupInstance.SetLabels(maps.Clone(i.GetLabels()))
-				flexgroupInstance.SetLabel("volume", match[1])
+				flexgroupInstance.SetLabel("volume", flexgroup)
 				// Flexgroup don't show any node
 				flexgroupInstance.SetLabel("node", "")
 				flexgroupInstance.SetLabel(style, "flexgroup")
@@ -106,7 +130,14 @@ func (v *Volume) Run(dataMap map[string]*matrix.Matrix) ([]*matrix.Matrix, error
 				}
 			}
 			fgAggrMap[key].Add(i.GetLabel("aggr"))
+			fgConstituents[key]++
+			if node := i.GetLabel("node"); node != "" {
+				fgNodeMap[key].Add(node)
+			}
 			flexgroupAggrsMap[key].Add(i.GetLabel("aggr"))
+			if i.IsExportable() {
+				fgExportable[key] = append(fgExportable[key], i)
+			}
 			i.SetLabel(style, "flexgroup_constituent")
 			i.SetExportable(v.includeConstituents)
 		} else {
@@ -126,15 +157,19 @@ func (v *Volume) Run(dataMap map[string]*matrix.Matrix) ([]*matrix.Matrix, error
 
 	}
 
-	v.Logger.Debug().Msgf("extracted %d flexgroup volumes", len(cache.GetInstances()))
+	v.Logger.Debug().Int("flexgroups", len(cache.GetInstances())).Msg("extracted flexgroup volumes")
+
+	if err = setFlexgroupNodes(cache, fgNodeMap); err != nil {
+		return nil, err
+	}
 
 	// cache.Reset()
 
 	// create summary
 	for _, i := range data.GetInstances() {
-		if match := re.FindStringSubmatch(i.GetLabel("volume")); len(match) == 3 {
+		if flexgroup, ok := constituents[i]; ok {
 			// instance key is svm.flexgroup-volume
-			key := i.GetLabel("svm") + "." + match[1]
+			key := i.GetLabel("svm") + "." + flexgroup
 
 			// set aggrs label for flexgroup in new metrics
 			flexgroupInstance := volumeAggrmetric.GetInstance(key)
@@ -147,9 +182,10 @@ func (v *Volume) Run(dataMap map[string]*matrix.Matrix) ([]*matrix.Matrix, error
 
 			fg := cache.GetInstance(key)
 			if fg == nil {
-				v.Logger.Error().Err(nil).Msgf("instance [%s] not in local cache", key)
+				v.Logger.Error().Str("key", key).Msg("instance not in local cache")
 				continue
 			}
+			fgMembers[key] = append(fgMembers[key], i)
 
 			// set aggrs label for fg, make sure the order of aggregate is same for each poll
 			aggrs := fgAggrMap[key].Values()
@@ -164,113 +200,140 @@ func (v *Volume) Run(dataMap map[string]*matrix.Matrix) ([]*matrix.Matrix, error
 
 				fgm := cache.GetMetric(mkey)
 				if fgm == nil {
-					v.Logger.Error().Err(nil).Msgf("metric [%s] not in local cache", mkey)
+					v.Logger.Error().Str("metric", mkey).Msg("metric not in local cache")
 					continue
 				}
 
-				v.Logger.Trace().Msgf("(%s) handling metric (%s)", fg.GetLabel("volume"), mkey)
+				v.Logger.Trace().Str("volume", fg.GetLabel("volume")).Str("metric", mkey).Msg("handling metric")
 
 				if value, ok := m.GetValueFloat64(i); ok {
 
-					fgv, _ := fgm.GetValueFloat64(fg)
-
-					// non-latency metrics: simple sum
-					if !strings.HasSuffix(m.GetName(), "_latency") {
+					fgv, recorded := fgm.GetValueFloat64(fg)
 
+					switch rollup := collectors.RollupOf(m, v.rollups); rollup {
+					case collectors.RollupMax:
+						if !recorded || value > fgv {
+							if err := fgm.SetValueFloat64(fg, value); err != nil {
+								v.Logger.Error().Err(err).Str("metric", mkey).Msg("Unable to set value on metric")
+							}
+						}
+						continue
+					case collectors.RollupSum, collectors.RollupAvg:
+						// simple sum, averages are divided by the number of constituents below
 						err := fgm.SetValueFloat64(fg, fgv+value)
 						if err != nil {
-							v.Logger.Error().Err(err).Msg("error")
+							v.Logger.Error().Err(err).Str("metric", mkey).Msg("Unable to set value on metric")
 						}
-						// just for debugging
-						fgv2, _ := fgm.GetValueFloat64(fg)
-
-						v.Logger.Trace().Msgf("   > simple increment %f + %f = %f", fgv, value, fgv2)
-						continue
-					}
-
-					// latency metric: weighted sum
-					opsKey := ""
-					if strings.Contains(mkey, "_latency") {
-						opsKey = m.GetComment()
-					}
-					v.Logger.Trace().Msgf("    > weighted increment <%s * %s>", mkey, opsKey)
-
-					if ops := data.GetMetric(opsKey); ops != nil {
-						if opsValue, ok := ops.GetValueFloat64(i); ok {
-							var tempOpsV float64
-
-							prod := value * opsValue
-							tempOpsKey := opsKeyPrefix + opsKey
-							// Create temp ops metrics. These should not be exported.
-							// A base counter can be part base for multiple metrics hence we should not be changing base counter for weighted average calculation
-							tempOps := cache.GetMetric(tempOpsKey)
-
-							if tempOps == nil {
-								if tempOps, err = cache.NewMetricFloat64(tempOpsKey); err != nil {
+						// averages divide by the count, counter sums compare it with the number of constituents
+						if rollup == collectors.RollupAvg || collectors.IsCounterSum(m, v.rollups) {
+							count := cache.GetMetric(countKeyPrefix + mkey)
+							if count == nil {
+								if count, err = cache.NewMetricFloat64(countKeyPrefix + mkey); err != nil {
 									return nil, err
 								}
-								tempOps.SetExportable(false)
-							} else {
-								tempOpsV, _ = tempOps.GetValueFloat64(fg)
-							}
-							// If latency value is 0 then it's ops value is not used in weighted average calculation
-							if value != 0 {
-								err = tempOps.SetValueFloat64(fg, tempOpsV+opsValue)
-								if err != nil {
-									v.Logger.Error().Err(err).Msg("error")
-								}
+								count.SetExportable(false)
 							}
-							err = fgm.SetValueFloat64(fg, fgv+prod)
-							if err != nil {
-								v.Logger.Error().Err(err).Msg("error")
+							n, _ := count.GetValueFloat64(fg)
+							if err = count.SetValueFloat64(fg, n+1); err != nil {
+								v.Logger.Error().Err(err).Str("metric", mkey).Msg("Unable to set value on metric")
 							}
-
-							// debugging
-							fgv2, _ := fgm.GetValueFloat64(fg)
-
-							v.Logger.Trace().Msgf("       %f + (%f * %f) (=%f) = %f", fgv, value, opsValue, prod, fgv2)
-						} else {
-							v.Logger.Trace().Msg("       no ops value SKIP")
 						}
+						// just for debugging
+						fgv2, _ := fgm.GetValueFloat64(fg)
+
+						v.Logger.Trace().Str("metric", mkey).Float64("value", fgv).Float64("increment", value).Float64("result", fgv2).Msg("simple increment")
+						continue
 					}
+
+					// latencies are weighted by ops, see SumWeightedLatencies
 				}
 			}
 		}
 	}
 
-	// normalize latency values
-	for _, i := range cache.GetInstances() {
+	if err = collectors.SumWeightedLatencies(data, cache, fgMembers, opsKeys, v.rollups, opsKeyPrefix, v.Logger); err != nil {
+		return nil, err
+	}
+
+	// normalize averages and latency values
+	for key, i := range cache.GetInstances() {
 		if !i.IsExportable() {
 			continue
 		}
 		for mkey, m := range cache.GetMetrics() {
-			if m.IsExportable() && strings.HasSuffix(m.GetName(), "_latency") {
-
-				if value, ok := m.GetValueFloat64(i); ok {
-
-					opsKey := ""
-					if strings.Contains(mkey, "_latency") {
-						opsKey = m.GetComment()
+			if m.IsExportable() && collectors.IsCounterSum(m, v.rollups) {
+				if count := cache.GetMetric(countKeyPrefix + mkey); count != nil {
+					if n, _ := count.GetValueFloat64(i); int(n) < fgConstituents[key] {
+						m.SetValueNAN(i)
 					}
+				}
+			}
+		}
+	}
 
-					// fetch from temp metrics
-					if ops := cache.GetMetric(opsKeyPrefix + opsKey); ops != nil {
+	// averages are sums of the constituent values, divide them by the number of constituents with a value
+	for mkey, m := range cache.GetMetrics() {
+		if !m.IsExportable() || collectors.RollupOf(m, v.rollups) != collectors.RollupAvg {
+			continue
+		}
+		if count := cache.GetMetric(countKeyPrefix + mkey); count != nil {
+			m.DivideBy(count)
+		}
+	}
 
-						if opsValue, ok := ops.GetValueFloat64(i); ok && opsValue != 0 {
-							err := m.SetValueFloat64(i, value/opsValue)
-							if err != nil {
-								v.Logger.Error().Err(err).Msgf("error")
-							}
-						} else {
-							m.SetValueNAN(i)
-						}
-					}
-				}
+	// latencies are sums weighted by ops, divide them by the ops of the constituents with a latency
+	for mkey, m := range cache.GetMetrics() {
+		if !m.IsExportable() || collectors.RollupOf(m, v.rollups) != collectors.RollupWeighted {
+			continue
+		}
+		opsKey := collectors.OpsKeyOf(mkey, m, opsKeys)
+		if cache.GetMetric(opsKeyPrefix+opsKey) == nil {
+			continue
+		}
+		if _, err := cache.RatioMetric(mkey, mkey, opsKeyPrefix+opsKey, matrix.ValueNaN); err != nil {
+			v.Logger.Error().Err(err).Str("metric", mkey).Msg("Unable to set value on metric")
+		}
+	}
 
-			}
+	if len(v.constituentCV) > 0 {
+		collectors.SetConstituentCV(data, cache, fgExportable, v.constituentCV, v.Logger)
+	}
+
+	if v.pruneEmptyMetrics {
+		if pruned := cache.PruneEmptyMetrics(); len(pruned) > 0 {
+			v.Logger.Debug().Strs("metrics", pruned).Msg("pruned metrics without values")
 		}
 	}
 
 	// volume_aggr_labels metric is deprecated now and will be removed later.
 	return []*matrix.Matrix{cache, volumeAggrmetric}, nil
 }
+
+// maxNodesLabelLength limits the length of the nodes label of flexgroups spread over many nodes
+const maxNodesLabelLength = 256
+
+// setFlexgroupNodes sets the node_count metric and the nodes label, the sorted nodes hosting the constituents,
+// of the flexgroups in cache
+func setFlexgroupNodes(cache *matrix.Matrix, fgNodeMap map[string]*set.Set) error {
+	nodeCount := cache.GetMetric("node_count")
+	if nodeCount == nil {
+		var err error
+		if nodeCount, err = cache.NewMetricFloat64("node_count"); err != nil {
+			return err
+		}
+		nodeCount.SetProperty("raw")
+	}
+	for key, nodeSet := range fgNodeMap {
+		fg := cache.GetInstance(key)
+		if fg == nil {
+			continue
+		}
+		nodes := nodeSet.Values()
+		sort.Strings(nodes)
+		fg.SetLabel("nodes", collectors.JoinTruncated(nodes, maxNodesLabelLength))
+		if err := nodeCount.SetValueFloat64(fg, float64(len(nodes))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,458 @@
+package volume
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/netapp/harvest/v2/cmd/poller/options"
+	"github.com/netapp/harvest/v2/cmd/poller/plugin"
+	"github.com/netapp/harvest/v2/pkg/logging"
+	"github.com/netapp/harvest/v2/pkg/matrix"
+	"github.com/netapp/harvest/v2/pkg/tree/node"
+	"github.com/rs/zerolog"
+	"strconv"
+	"testing"
+)
+
+func TestVolume_FlexgroupNodes(t *testing.T) {
+	params := node.NewS("Volume")
+	v := &Volume{AbstractPlugin: plugin.New("ZapiPerf", options.New(), params, nil, "volume", nil)}
+	if err := v.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := matrix.New("ZapiPerf", "volume", "volume")
+	readOps, _ := data.NewMetricFloat64("read_ops")
+	constituents := []struct {
+		volume string
+		node   string
+		aggr   string
+	}{
+		{volume: "fg__0001", node: "node2", aggr: "aggr2"},
+		{volume: "fg__0002", node: "node1", aggr: "aggr1"},
+		{volume: "fg__0003", node: "node2", aggr: "aggr3"},
+		{volume: "fg__0004", node: "node3", aggr: "aggr4"},
+		{volume: "single__0001", node: "node1", aggr: "aggr1"},
+		{volume: "flexvol", node: "node1", aggr: "aggr1"},
+	}
+	for _, c := range constituents {
+		instance, _ := data.NewInstance(c.volume)
+		instance.SetLabel("volume", c.volume)
+		instance.SetLabel("svm", "svm1")
+		instance.SetLabel("node", c.node)
+		instance.SetLabel("aggr", c.aggr)
+		_ = readOps.SetValueFloat64(instance, 10)
+	}
+
+	output, err := v.Run(map[string]*matrix.Matrix{"volume": data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := output[0]
+
+	tests := []struct {
+		key       string
+		nodes     string
+		nodeCount float64
+	}{
+		{key: "svm1.fg", nodes: "node1,node2,node3", nodeCount: 3},
+		{key: "svm1.single", nodes: "node1", nodeCount: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			fg := cache.GetInstance(tt.key)
+			if fg == nil {
+				t.Fatalf("flexgroup %s not found", tt.key)
+			}
+			if got := fg.GetLabel("nodes"); got != tt.nodes {
+				t.Errorf("nodes got = %q, want %q", got, tt.nodes)
+			}
+			if got := fg.GetLabel("node"); got != "" {
+				t.Errorf("node got = %q, want empty", got)
+			}
+			if got, _ := cache.GetMetric("node_count").GetValueFloat64(fg); got != tt.nodeCount {
+				t.Errorf("node_count got = %v, want %v", got, tt.nodeCount)
+			}
+		})
+	}
+	if cache.GetInstance("svm1.flexvol") != nil {
+		t.Errorf("flexvol should not be a flexgroup")
+	}
+}
+
+func TestVolume_Rollup(t *testing.T) {
+	newVolume := func(params *node.Node) *Volume {
+		v := &Volume{AbstractPlugin: plugin.New("ZapiPerf", options.New(), params, nil, "volume", nil)}
+		if err := v.Init(); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	rollupParams := node.NewS("Volume")
+	rollupParams.NewChildS("rollup", "").NewChildS("read_data", "max")
+
+	tests := []struct {
+		name   string
+		params *node.Node
+		want   map[string]float64
+	}{
+		{name: "defaults", params: node.NewS("Volume"),
+			want: map[string]float64{"read_data": 600, "cache_hit_percent": 60}},
+		{name: "configured", params: rollupParams,
+			want: map[string]float64{"read_data": 300, "cache_hit_percent": 60}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := matrix.New("ZapiPerf", "volume", "volume")
+			readData, _ := data.NewMetricFloat64("read_data")
+			cacheHit, _ := data.NewMetricFloat64("cache_hit_percent")
+			for i, c := range []struct {
+				readData float64
+				cacheHit float64
+			}{{100, 40}, {200, 60}, {300, 80}} {
+				instance, _ := data.NewInstance(strconv.Itoa(i))
+				instance.SetLabel("volume", "fg__000"+strconv.Itoa(i+1))
+				instance.SetLabel("svm", "svm1")
+				_ = readData.SetValueFloat64(instance, c.readData)
+				_ = cacheHit.SetValueFloat64(instance, c.cacheHit)
+			}
+
+			output, err := newVolume(tt.params).Run(map[string]*matrix.Matrix{"volume": data})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cache := output[0]
+			fg := cache.GetInstance("svm1.fg")
+			for name, want := range tt.want {
+				if got, _ := cache.GetMetric(name).GetValueFloat64(fg); got != want {
+					t.Errorf("%s got = %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestVolume_StructuredLogging(t *testing.T) {
+	v := &Volume{AbstractPlugin: plugin.New("ZapiPerf", options.New(), node.NewS("Volume"), nil, "volume", nil)}
+	if err := v.Init(); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zl := zerolog.New(&buf).Level(zerolog.TraceLevel)
+	v.Logger = &logging.Logger{Logger: &zl}
+	defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+	zerolog.SetGlobalLevel(zerolog.TraceLevel)
+
+	data := matrix.New("ZapiPerf", "volume", "volume")
+	readOps, _ := data.NewMetricFloat64("read_ops")
+	readLatency, _ := data.NewMetricFloat64("read_latency")
+	readLatency.SetComment("read_ops")
+	for i := 0; i < 2; i++ {
+		instance, _ := data.NewInstance(strconv.Itoa(i))
+		instance.SetLabel("volume", "fg__000"+strconv.Itoa(i+1))
+		instance.SetLabel("svm", "svm1")
+		_ = readOps.SetValueFloat64(instance, 10)
+		_ = readLatency.SetValueFloat64(instance, 200)
+	}
+	if _, err := v.Run(map[string]*matrix.Matrix{"volume": data}); err != nil {
+		t.Fatal(err)
+	}
+
+	// every diagnostic log is a JSON object with a constant message and its values as fields
+	wantFields := map[string][]string{
+		"extracted flexgroup volumes": {"flexgroups"},
+		"handling metric":             {"volume", "metric"},
+		"simple increment":            {"metric", "value", "increment", "result"},
+		"weighted increment":          {"metric", "value", "latency", "opsValue", "result"},
+	}
+	seen := make(map[string]bool)
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		var entry map[string]any
+		if err := decoder.Decode(&entry); err != nil {
+			t.Fatalf("log is not JSON: %v", err)
+		}
+		msg, _ := entry["message"].(string)
+		fields, ok := wantFields[msg]
+		if !ok {
+			continue
+		}
+		seen[msg] = true
+		for _, field := range fields {
+			if _, ok := entry[field]; !ok {
+				t.Errorf("%q missing field %s: %v", msg, field, entry)
+			}
+		}
+	}
+	for msg := range wantFields {
+		if !seen[msg] {
+			t.Errorf("%q not logged", msg)
+		}
+	}
+}
+
+func TestVolume_RollupByProperty(t *testing.T) {
+	v := &Volume{AbstractPlugin: plugin.New("ZapiPerf", options.New(), node.NewS("Volume"), nil, "volume", nil)}
+	if err := v.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := matrix.New("ZapiPerf", "volume", "volume")
+	// read_data is a rate, computed by the collector before plugins run, total_reads a raw cumulative counter
+	readData, _ := data.NewMetricFloat64("read_data")
+	readData.SetProperty("rate")
+	totalReads, _ := data.NewMetricFloat64("total_reads")
+	totalReads.SetProperty("raw")
+	constituents := []struct {
+		volume     string
+		readData   float64
+		totalReads float64
+		noReads    bool
+	}{
+		{volume: "fg__0001", readData: 100, totalReads: 1000},
+		{volume: "fg__0002", readData: 250, totalReads: 3000},
+		{volume: "partial__0001", readData: 100, totalReads: 1000},
+		{volume: "partial__0002", readData: 50, noReads: true},
+	}
+	for _, c := range constituents {
+		instance, _ := data.NewInstance(c.volume)
+		instance.SetLabel("volume", c.volume)
+		instance.SetLabel("svm", "svm1")
+		_ = readData.SetValueFloat64(instance, c.readData)
+		if !c.noReads {
+			_ = totalReads.SetValueFloat64(instance, c.totalReads)
+		}
+	}
+
+	output, err := v.Run(map[string]*matrix.Matrix{"volume": data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := output[0]
+
+	fg := cache.GetInstance("svm1.fg")
+	if got, _ := cache.GetMetric("read_data").GetValueFloat64(fg); got != 350 {
+		t.Errorf("read_data got = %v, want 350", got)
+	}
+	if got, ok := cache.GetMetric("total_reads").GetValueFloat64(fg); !ok || got != 4000 {
+		t.Errorf("total_reads got = %v %v, want 4000", got, ok)
+	}
+	if got := cache.GetMetric("total_reads").GetProperty(); got != "raw" {
+		t.Errorf("total_reads property got = %s, want raw", got)
+	}
+
+	// a partial sum of counters would look like a counter reset
+	partial := cache.GetInstance("svm1.partial")
+	if got, _ := cache.GetMetric("read_data").GetValueFloat64(partial); got != 150 {
+		t.Errorf("partial read_data got = %v, want 150", got)
+	}
+	if got, ok := cache.GetMetric("total_reads").GetValueFloat64(partial); ok {
+		t.Errorf("partial total_reads got = %v, want no value", got)
+	}
+}
+
+func TestVolume_LargeFlexgroup(t *testing.T) {
+	params := node.NewS("Volume")
+	v := &Volume{AbstractPlugin: plugin.New("ZapiPerf", options.New(), params, nil, "volume", nil)}
+	if err := v.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := matrix.New("ZapiPerf", "volume", "volume")
+	readOps, _ := data.NewMetricFloat64("read_ops")
+	for _, volume := range []string{"big__0001", "big__9999", "big__10000", "big__12345", "foo__1234"} {
+		instance, _ := data.NewInstance(volume)
+		instance.SetLabel("volume", volume)
+		instance.SetLabel("svm", "svm1")
+		instance.SetLabel("node", "node1")
+		instance.SetLabel("aggr", "aggr1")
+		_ = readOps.SetValueFloat64(instance, 10)
+	}
+
+	output, err := v.Run(map[string]*matrix.Matrix{"volume": data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := output[0]
+
+	fg := cache.GetInstance("svm1.big")
+	if fg == nil {
+		t.Fatalf("flexgroup svm1.big not found")
+	}
+	if got, _ := cache.GetMetric("read_ops").GetValueFloat64(fg); got != 40 {
+		t.Errorf("read_ops got = %v, want 40", got)
+	}
+	for _, volume := range []string{"big__0001", "big__9999", "big__10000", "big__12345"} {
+		if got := data.GetInstance(volume).GetLabel("style"); got != "flexgroup_constituent" {
+			t.Errorf("%s style got = %q, want flexgroup_constituent", volume, got)
+		}
+	}
+
+	// a flexvol whose name looks like a constituent of a flexgroup without constituent 1
+	if cache.GetInstance("svm1.foo") != nil {
+		t.Errorf("foo__1234 should not be grouped")
+	}
+	if got := data.GetInstance("foo__1234").GetLabel("style"); got != "flexvol" {
+		t.Errorf("foo__1234 style got = %q, want flexvol", got)
+	}
+}
+
+func TestVolume_ConstituentCV(t *testing.T) {
+	params := node.NewS("Volume")
+	cv := params.NewChildS("constituent_cv", "")
+	cv.NewChildS("", "total_ops")
+	v := &Volume{AbstractPlugin: plugin.New("ZapiPerf", options.New(), params, nil, "volume", nil)}
+	if err := v.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := matrix.New("ZapiPerf", "volume", "volume")
+	totalOps, _ := data.NewMetricFloat64("total_ops")
+	constituents := []struct {
+		volume     string
+		ops        float64
+		noValue    bool
+		notExports bool
+	}{
+		// mean 20, std-dev 10
+		{volume: "skew__0001", ops: 10},
+		{volume: "skew__0002", ops: 30},
+		// excluded constituents are not part of the distribution
+		{volume: "skew__0003", ops: 1000, notExports: true},
+		{volume: "idle__0001", ops: 0},
+		{volume: "idle__0002", ops: 0},
+		{volume: "one__0001", ops: 10},
+		{volume: "one__0002", noValue: true},
+	}
+	for _, c := range constituents {
+		instance, _ := data.NewInstance(c.volume)
+		instance.SetLabel("volume", c.volume)
+		instance.SetLabel("svm", "svm1")
+		instance.SetExportable(!c.notExports)
+		if !c.noValue {
+			_ = totalOps.SetValueFloat64(instance, c.ops)
+		}
+	}
+
+	output, err := v.Run(map[string]*matrix.Matrix{"volume": data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := output[0]
+	cvMetric := cache.GetMetric("total_ops_cv")
+	if cvMetric == nil {
+		t.Fatal("total_ops_cv not created")
+	}
+
+	if got, ok := cvMetric.GetValueFloat64(cache.GetInstance("svm1.skew")); !ok || got != 0.5 {
+		t.Errorf("skew total_ops_cv got = %v,%t want 0.5", got, ok)
+	}
+	// a zero mean is NaN, which is not exported
+	if got, ok := cvMetric.GetValueFloat64(cache.GetInstance("svm1.idle")); ok {
+		t.Errorf("idle total_ops_cv got = %v, want NaN", got)
+	}
+	if got, ok := cvMetric.GetValueFloat64(cache.GetInstance("svm1.one")); ok {
+		t.Errorf("one total_ops_cv got = %v, want no value", got)
+	}
+}
+
+func TestVolume_ExportConstituents(t *testing.T) {
+	tests := []struct {
+		name   string
+		param  string
+		export bool
+	}{
+		{name: "default"},
+		{name: "export_constituents", param: "export_constituents", export: true},
+		{name: "include_constituents", param: "include_constituents", export: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := node.NewS("Volume")
+			if tt.param != "" {
+				params.NewChildS(tt.param, "true")
+			}
+			v := &Volume{AbstractPlugin: plugin.New("ZapiPerf", options.New(), params, nil, "volume", nil)}
+			if err := v.Init(); err != nil {
+				t.Fatal(err)
+			}
+
+			data := matrix.New("ZapiPerf", "volume", "volume")
+			readOps, _ := data.NewMetricFloat64("read_ops")
+			for _, volume := range []string{"fg__0001", "fg__0002"} {
+				instance, _ := data.NewInstance(volume)
+				instance.SetLabel("volume", volume)
+				instance.SetLabel("svm", "svm1")
+				_ = readOps.SetValueFloat64(instance, 10)
+			}
+
+			output, err := v.Run(map[string]*matrix.Matrix{"volume": data})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := output[0].GetMetric("read_ops").GetValueFloat64(output[0].GetInstance("svm1.fg")); got != 20 {
+				t.Errorf("flexgroup read_ops got = %v, want 20", got)
+			}
+			for _, instance := range data.GetInstances() {
+				if instance.IsExportable() != tt.export {
+					t.Errorf("%s exportable got = %t, want %t", instance.GetLabel("volume"), instance.IsExportable(), tt.export)
+				}
+				if got := instance.GetLabel("style"); got != "flexgroup_constituent" {
+					t.Errorf("%s style got = %q, want flexgroup_constituent", instance.GetLabel("volume"), got)
+				}
+			}
+		})
+	}
+}
+
+func TestVolume_LatencyOpsMap(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  string
+		want float64
+	}{
+		{name: "ops of the latency counter", want: 17.5},
+		{name: "mapped ops", ops: "read_ops", want: 12.5},
+		{name: "missing mapped ops", ops: "no_such_ops", want: 17.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := node.NewS("Volume")
+			if tt.ops != "" {
+				params.NewChildS("latency_ops_map", "").NewChildS("avg_latency", tt.ops)
+			}
+			v := &Volume{AbstractPlugin: plugin.New("ZapiPerf", options.New(), params, nil, "volume", nil)}
+			if err := v.Init(); err != nil {
+				t.Fatal(err)
+			}
+
+			data := matrix.New("ZapiPerf", "volume", "volume")
+			latency, _ := data.NewMetricFloat64("avg_latency")
+			latency.SetComment("total_ops")
+			totalOps, _ := data.NewMetricFloat64("total_ops")
+			readOps, _ := data.NewMetricFloat64("read_ops")
+			constituents := []struct {
+				volume                     string
+				latency, totalOps, readOps float64
+			}{
+				{volume: "fg__0001", latency: 10, totalOps: 1, readOps: 3},
+				{volume: "fg__0002", latency: 20, totalOps: 3, readOps: 1},
+			}
+			for _, c := range constituents {
+				instance, _ := data.NewInstance(c.volume)
+				instance.SetLabel("volume", c.volume)
+				instance.SetLabel("svm", "svm1")
+				_ = latency.SetValueFloat64(instance, c.latency)
+				_ = totalOps.SetValueFloat64(instance, c.totalOps)
+				_ = readOps.SetValueFloat64(instance, c.readOps)
+			}
+
+			output, err := v.Run(map[string]*matrix.Matrix{"volume": data})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := output[0].GetMetric("avg_latency").GetValueFloat64(output[0].GetInstance("svm1.fg")); got != tt.want {
+				t.Errorf("avg_latency got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -85,6 +85,8 @@ type ZapiPerf struct {
 	isCacheEmpty    bool
 	keyName         string
 	keyNameIndex    int
+	semantics       *matrix.SemanticsChecker
+	warmup          *matrix.Warmup
 	testFilePath    string // Used only from unit test
 }
 
@@ -161,6 +163,13 @@ func (z *ZapiPerf) InitCache() error {
 	z.batchSize = z.loadParamInt("batch_size", batchSize)
 	z.latencyIoReqd = z.loadParamInt("latency_io_reqd", latencyIoReqd)
 	z.isCacheEmpty = true
+	if z.loadParamStr("check_counter_semantics", "false") == "true" {
+		z.semantics = matrix.NewSemanticsChecker()
+	}
+	var err error
+	if z.warmup, err = collector.ParseWarmup(z.loadParamStr("warmup", ""), time.Now()); err != nil {
+		return err
+	}
 	z.object = z.loadParamStr("object", "")
 	z.keyName, z.keyNameIndex = z.initKeyName()
 	// hack to override from AbstractCollector
@@ -768,6 +777,17 @@ func (z *ZapiPerf) PollData() (map[string]*matrix.Matrix, error) {
 	// cache raw data for next poll
 	cachedData := curMat.Clone(matrix.With{Data: true, Metrics: true, Instances: true, ExportInstances: true}) // @TODO implement copy data
 
+	if z.semantics != nil {
+		for _, a := range z.semantics.Observe(cachedData) {
+			z.Logger.Warn().
+				Str("counter", a.Metric).
+				Str("property", a.Property).
+				Str("suggested", a.Suggested).
+				Float64("ratio", a.Ratio).
+				Msg("counter property looks wrong, check the template")
+		}
+	}
+
 	// order metrics, such that those requiring base counters are processed last
 	orderedMetrics := make([]*matrix.Metric, 0, len(curMat.GetMetrics()))
 	orderedKeys := make([]string, 0, len(orderedMetrics))
@@ -895,6 +915,10 @@ func (z *ZapiPerf) PollData() (map[string]*matrix.Matrix, error) {
 	_ = z.Metadata.LazySetValueInt64("calc_time", "data", calcD.Microseconds())
 	_ = z.Metadata.LazySetValueUint64("skips", "data", uint64(totalSkips))
 
+	if z.warmup != nil && z.warmup.Apply(curMat, time.Now()) {
+		z.Logger.Debug().Msg("warming up, cooked counters are not exported")
+	}
+
 	// store cache for next poll
 	z.Matrix[z.Object] = cachedData
 
@@ -26,6 +26,10 @@ import (
    - https://docs.influxdata.com/influxdb/v2.0/write-data/developer-tools/api/
    - https://docs.influxdata.com/influxdb/v2.0/reference/syntax/line-protocol/
 
+   With version 1, the exporter writes to the InfluxDB 1.x /write endpoint of a database instead:
+
+   - https://docs.influxdata.com/influxdb/v1.8/tools/api/#write-http-endpoint
+
 */
 
 const (
@@ -33,6 +37,7 @@ const (
 	defaultTimeout       = 5
 	defaultAPIVersion    = "2"
 	defaultAPIPrecision  = "s"
+	apiVersion1          = "1"
 	expectedResponseCode = 204
 )
 
@@ -49,9 +54,11 @@ var protectedFieldNames = map[string]string{
 
 type InfluxDB struct {
 	*exporter.AbstractExporter
-	client *http.Client
-	url    string
-	token  string
+	client    *http.Client
+	url       string
+	token     string
+	precision string
+	changes   *matrix.ChangeTracker
 }
 
 func New(abc *exporter.AbstractExporter) exporter.Exporter {
@@ -65,10 +72,13 @@ func (e *InfluxDB) Init() error {
 	}
 
 	var (
-		url, addr, bucket, org, token, version, precision *string
-		port                                              *int
+		url, addr, bucket, org, token, version, precision, database *string
+		port                                                        *int
 	)
 
+	// version 1 writes to a database, authentication is optional
+	v1 := e.Params.Version != nil && *e.Params.Version == apiVersion1
+
 	// check the required / optional parameters
 	// customer should provide either url or addr
 	// url is expected to be the full write URL with all query params specified (optionally with scheme)
@@ -81,6 +91,11 @@ func (e *InfluxDB) Init() error {
 	if url = e.Params.URL; url != nil {
 		e.url = *url
 		dbEndpoint = "url"
+		// InfluxDB uses nanoseconds when the write URL does not specify a precision
+		e.precision = "ns"
+		if u, err := url2.Parse(*url); err == nil && u.Query().Get("precision") != "" {
+			e.precision = u.Query().Get("precision")
+		}
 	} else {
 		if addr = e.Params.Addr; addr == nil {
 			return errs.New(errs.ErrMissingParam, "url or addr")
@@ -96,34 +111,48 @@ func (e *InfluxDB) Init() error {
 		}
 		e.Logger.Debug().Msgf("using api version [%s]", *version)
 
-		if bucket = e.Params.Bucket; bucket == nil {
-			return errs.New(errs.ErrMissingParam, "bucket")
-		}
-		e.Logger.Debug().Msgf("using bucket [%s]", *bucket)
+		if v1 {
+			if database = e.Params.Database; database == nil {
+				return errs.New(errs.ErrMissingParam, "database")
+			}
+			e.Logger.Debug().Msgf("using database [%s]", *database)
+		} else {
+			if bucket = e.Params.Bucket; bucket == nil {
+				return errs.New(errs.ErrMissingParam, "bucket")
+			}
+			e.Logger.Debug().Msgf("using bucket [%s]", *bucket)
 
-		if org = e.Params.Org; org == nil {
-			return errs.New(errs.ErrMissingParam, "org")
+			if org = e.Params.Org; org == nil {
+				return errs.New(errs.ErrMissingParam, "org")
+			}
+			e.Logger.Debug().Msgf("using organization [%s]", *org)
 		}
-		e.Logger.Debug().Msgf("using organization [%s]", *org)
 
 		if precision = e.Params.Precision; precision == nil {
 			p := defaultAPIPrecision
 			precision = &p
 		}
 		e.Logger.Debug().Msgf("using api precision [%s]", *precision)
+		e.precision = *precision
 
 		//goland:noinspection HttpUrlsUsage
 		urlToUSe := "http://" + *addr + ":" + strconv.Itoa(*port)
 		url = &urlToUSe
-		e.url = fmt.Sprintf("%s/api/v%s/write?org=%s&bucket=%s&precision=%s",
-			*url, *version, url2.PathEscape(*org), url2.PathEscape(*bucket), *precision)
+		if v1 {
+			e.url = fmt.Sprintf("%s/write?db=%s&precision=%s", *url, url2.QueryEscape(*database), *precision)
+		} else {
+			e.url = fmt.Sprintf("%s/api/v%s/write?org=%s&bucket=%s&precision=%s",
+				*url, *version, url2.PathEscape(*org), url2.PathEscape(*bucket), *precision)
+		}
 	}
 
-	if token = e.Params.Token; token == nil {
+	// InfluxDB 1.8 accepts a token in the form username:password, earlier 1.x versions may run without authentication
+	if token = e.Params.Token; token != nil {
+		e.token = *token
+		e.Logger.Debug().Msg("will use authorization with api token")
+	} else if !v1 {
 		return errs.New(errs.ErrMissingParam, "token")
 	}
-	e.token = *token
-	e.Logger.Debug().Msg("will use authorization with api token")
 
 	// timeout parameter
 	timeout := time.Duration(defaultTimeout) * time.Second
@@ -142,6 +171,11 @@ func (e *InfluxDB) Init() error {
 	// construct HTTP client
 	e.client = &http.Client{Timeout: timeout}
 
+	if e.Params.ChangedOnly {
+		e.changes = matrix.NewChangeTracker(0, e.Params.ChangedOnlyEpsilon)
+		e.Logger.Debug().Msg("will only export changed values")
+	}
+
 	return nil
 }
 
@@ -159,6 +193,10 @@ func (e *InfluxDB) Export(data *matrix.Matrix) (exporter.Stats, error) {
 
 	s = time.Now()
 
+	if e.changes != nil {
+		data = e.changes.Changed(data)
+	}
+
 	// render the metrics, i.e. convert to InfluxDb line protocol
 	if metrics, stats, err = e.Render(data); err == nil && len(metrics) != 0 {
 		// fix render time
@@ -210,7 +248,9 @@ func (e *InfluxDB) Emit(data [][]byte) error {
 		return err
 	}
 
-	request.Header.Set("Authorization", "Token "+e.token)
+	if e.token != "" {
+		request.Header.Set("Authorization", "Token "+e.token)
+	}
 
 	if response, err = e.client.Do(request); err != nil {
 		return err
@@ -258,6 +298,12 @@ func (e *InfluxDB) Render(data *matrix.Matrix) ([][]byte, exporter.Stats, error)
 		global.AddTag(key, value)
 	}
 
+	// when the collector aligned the timestamps of this cycle, all measurements share it
+	var timestamp string
+	if ts := data.GetTimestamp(); !ts.IsZero() {
+		timestamp = formatTimestamp(ts, e.precision)
+	}
+
 	// render one measurement for each instance
 	for key, instance := range data.GetInstances() {
 
@@ -271,6 +317,12 @@ func (e *InfluxDB) Render(data *matrix.Matrix) ([][]byte, exporter.Stats, error)
 
 		m := NewMeasurement(object, len(global.tagSet))
 		copy(m.tagSet, global.tagSet)
+		m.SetTimestamp(timestamp)
+		if ts := instance.GetTimestamp(); !ts.IsZero() {
+			m.SetTimestamp(formatTimestamp(ts, e.precision))
+		}
+		// metrics measured at another time than the instance go to a measurement of their own
+		var measuredApart []*Measurement
 
 		// tag set
 		if includeAll {
@@ -314,7 +366,7 @@ func (e *InfluxDB) Render(data *matrix.Matrix) ([][]byte, exporter.Stats, error)
 				continue
 			}
 
-			value, ok := metric.GetValueString(instance)
+			value, ok := data.ExportValueString(metric, instance)
 
 			if !ok {
 				continue
@@ -332,22 +384,34 @@ func (e *InfluxDB) Render(data *matrix.Matrix) ([][]byte, exporter.Stats, error)
 				fieldName = rename
 			}
 
-			m.AddField(fieldName, value)
+			target := m
+			if ts := metric.GetTimestamp(instance); !ts.IsZero() {
+				if formatted := formatTimestamp(ts, e.precision); formatted != m.timestamp {
+					target = measurementAt(&measuredApart, m, formatted)
+				}
+			}
+			target.AddField(fieldName, value)
 			countTmp++
 		}
 
 		e.Logger.Trace().Msgf("rendering from: %s", m.String())
 
 		// skip instance with no tag set (no metrics)
-		if len(m.fieldSet) == 0 {
+		if len(m.fieldSet) == 0 && len(measuredApart) == 0 {
 			e.Logger.Debug().Msgf("skip instance (%s), no field set parsed", key)
-		} else if r, err := m.Render(); err == nil {
-			rendered = append(rendered, []byte(r))
-			// logger.Debug(e.Prefix, "M= [%s%s%s]", color.Blue, r, color.End)
-			count += countTmp
-		} else {
-			e.Logger.Debug().Msg(err.Error())
+			continue
 		}
+		for _, measurement := range append([]*Measurement{m}, measuredApart...) {
+			if len(measurement.fieldSet) == 0 {
+				continue
+			}
+			if r, err := measurement.Render(); err == nil {
+				rendered = append(rendered, []byte(r))
+			} else {
+				e.Logger.Debug().Msg(err.Error())
+			}
+		}
+		count += countTmp
 	}
 
 	e.Logger.Debug().Msgf("rendered %d measurements with %d data points for (%s)", len(rendered), count, object)
@@ -359,3 +423,32 @@ func (e *InfluxDB) Render(data *matrix.Matrix) ([][]byte, exporter.Stats, error)
 	}
 	return rendered, exporter.Stats{InstancesExported: instancesExported, MetricsExported: count}, nil
 }
+
+// measurementAt returns the measurement of measurements with the given timestamp and creates it, with the tags of m,
+// when there is none
+func measurementAt(measurements *[]*Measurement, m *Measurement, timestamp string) *Measurement {
+	for _, measurement := range *measurements {
+		if measurement.timestamp == timestamp {
+			return measurement
+		}
+	}
+	measurement := NewMeasurement(m.measurement, len(m.tagSet))
+	copy(measurement.tagSet, m.tagSet)
+	measurement.SetTimestamp(timestamp)
+	*measurements = append(*measurements, measurement)
+	return measurement
+}
+
+// formatTimestamp formats t as a line protocol timestamp in the given precision
+func formatTimestamp(t time.Time, precision string) string {
+	switch precision {
+	case "s":
+		return strconv.FormatInt(t.Unix(), 10)
+	case "ms":
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	case "us":
+		return strconv.FormatInt(t.UnixMicro(), 10)
+	default:
+		return strconv.FormatInt(t.UnixNano(), 10)
+	}
+}
@@ -8,17 +8,35 @@ import (
 	"github.com/netapp/harvest/v2/cmd/poller/options"
 	"github.com/netapp/harvest/v2/pkg/conf"
 	"github.com/netapp/harvest/v2/pkg/matrix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 )
 
 func setupInfluxDB(t *testing.T, exporterName string) *InfluxDB {
-	opts := options.New()
-	opts.Debug = true
-
 	_, err := conf.LoadHarvestConfig("../../tools/doctor/testdata/testConfig.yml")
 	if err != nil {
 		panic(err)
 	}
+	return newInfluxDB(t, exporterName)
+}
+
+// setupInfluxDBFrom is setupInfluxDB with the exporters of this package's testdata/configFile
+func setupInfluxDBFrom(t *testing.T, configFile string, exporterName string) *InfluxDB {
+	conf.TestLoadHarvestConfig("testdata/" + configFile)
+	// later tests load the shared config again
+	t.Cleanup(func() { conf.TestLoadHarvestConfig("../../tools/doctor/testdata/testConfig.yml") })
+	return newInfluxDB(t, exporterName)
+}
+
+func newInfluxDB(t *testing.T, exporterName string) *InfluxDB {
+	opts := options.New()
+	opts.Debug = true
+
 	e, ok := conf.Config.Exporters[exporterName]
 	if !ok {
 		t.Fatalf(`exporter (%v) not defined in config`, exporterName)
@@ -73,6 +91,46 @@ func TestVersionParameter(t *testing.T) {
 	}
 }
 
+// test that version 1 writes to the /write endpoint of a database and only sends a token when one is configured
+func TestVersion1(t *testing.T) {
+	tests := []struct {
+		exporterName string
+		url          string
+		auth         string
+	}{
+		{exporterName: "influx-test-v1", url: "http://localhost:8086/write?db=netapp+harvest&precision=s"},
+		{exporterName: "influx-test-v1-token", url: "http://localhost:8086/write?db=harvest&precision=s", auth: "Token user:pass"},
+		{exporterName: "influx-test-v2", url: "http://localhost:8086/api/v2/write?org=netapp&bucket=harvest&precision=s", auth: "Token abcdefghijklmnopqrstuvwxyz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.exporterName, func(t *testing.T) {
+			influx := setupInfluxDBFrom(t, "version1.yml", tt.exporterName)
+			if influx.url != tt.url {
+				t.Errorf("url expected [%s] got [%s]", tt.url, influx.url)
+			}
+
+			var got *http.Request
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+				w.WriteHeader(expectedResponseCode)
+			}))
+			defer server.Close()
+
+			u, _ := url.Parse(influx.url)
+			influx.url = server.URL + u.RequestURI()
+			if err := influx.Emit([][]byte{[]byte("volume size=1")}); err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if got.URL.RequestURI() != u.RequestURI() {
+				t.Errorf("endpoint expected [%s] got [%s]", u.RequestURI(), got.URL.RequestURI())
+			}
+			if auth := got.Header.Get("Authorization"); auth != tt.auth {
+				t.Errorf("authorization expected [%s] got [%s]", tt.auth, auth)
+			}
+		})
+	}
+}
+
 // test that `bucket`, `org`, `port`, and `precision` fields are ignored when using the `url` field
 func TestUrlIgnores(t *testing.T) {
 	expectedURL := "https://example.com:8086/api/v2/write?org=harvest&bucket=harvest&precision=s"
@@ -133,3 +191,88 @@ func TestWhiteSpaceInParameter(t *testing.T) {
 		t.Fatalf("FAIL - expected [%s]\n                             got [%s]", expectedURL, influx.url)
 	}
 }
+
+// test that all measurements of a matrix share the aligned cycle timestamp
+func TestAlignedTimestamp(t *testing.T) {
+	influx := setupInfluxDB(t, "influx-test-addr")
+
+	data := matrix.New("test_exporter", "influxd_test_data", "influxd_test_data")
+	data.SetExportOptions(matrix.DefaultExportOptions())
+	m1, _ := data.NewMetricInt64("metric1")
+	m2, _ := data.NewMetricFloat64("metric2")
+	for _, key := range []string{"a", "b", "c"} {
+		i, _ := data.NewInstance(key)
+		i.SetLabel("test_label", key)
+		_ = m1.SetValueInt64(i, 1)
+		_ = m2.SetValueFloat64(i, 2.5)
+	}
+
+	rendered, _, err := influx.Render(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rendered {
+		if fields := strings.Fields(string(r)); len(fields) != 2 {
+			t.Errorf("expected no timestamp without alignment, got [%s]", r)
+		}
+	}
+
+	cycleStart := time.Unix(1700000000, 0)
+	data.SetTimestamp(cycleStart)
+	rendered, _, err = influx.Render(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rendered) != 3 {
+		t.Fatalf("expected 3 measurements, got %d", len(rendered))
+	}
+	for _, r := range rendered {
+		if !strings.HasSuffix(string(r), " 1700000000") {
+			t.Errorf("expected cycle timestamp, got [%s]", r)
+		}
+	}
+}
+
+// test that instance and metric timestamps take precedence over the cycle timestamp
+func TestTimestampOverride(t *testing.T) {
+	influx := setupInfluxDB(t, "influx-test-addr")
+
+	data := matrix.New("test_exporter", "influxd_test_data", "influxd_test_data")
+	data.SetExportOptions(matrix.DefaultExportOptions())
+	data.SetTimestamp(time.Unix(1700000060, 0))
+	m1, _ := data.NewMetricInt64("metric1")
+	m2, _ := data.NewMetricFloat64("metric2")
+	for _, key := range []string{"cycle", "instance", "metric"} {
+		i, _ := data.NewInstance(key)
+		i.SetLabel("test_label", key)
+		_ = m1.SetValueInt64(i, 1)
+		_ = m2.SetValueFloat64(i, 2.5)
+	}
+	data.GetInstance("instance").SetTimestamp(time.Unix(1700000030, 0))
+	data.GetInstance("metric").SetTimestamp(time.Unix(1700000030, 0))
+	m2.SetTimestamp(data.GetInstance("metric"), time.Unix(1700000010, 0))
+
+	rendered, _, err := influx.Render(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{
+		"influxd_test_data,test_label=cycle metric1=1,metric2=2.5 1700000060":    true,
+		"influxd_test_data,test_label=instance metric1=1,metric2=2.5 1700000030": true,
+		"influxd_test_data,test_label=metric metric1=1 1700000030":               true,
+		"influxd_test_data,test_label=metric metric2=2.5 1700000010":             true,
+	}
+	if len(rendered) != len(want) {
+		t.Fatalf("expected %d measurements, got %d", len(want), len(rendered))
+	}
+	for _, r := range rendered {
+		// the order of fields follows the metric map, sort them before comparing
+		fields := strings.Fields(string(r))
+		fieldSet := strings.Split(fields[1], ",")
+		sort.Strings(fieldSet)
+		got := fields[0] + " " + strings.Join(fieldSet, ",") + " " + fields[2]
+		if !want[got] {
+			t.Errorf("unexpected measurement [%s]", r)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+/*
+ * Copyright NetApp Inc, 2024 All rights reserved
+ */
+
+package otlp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/netapp/harvest/v2/cmd/poller/exporter"
+	"github.com/netapp/harvest/v2/pkg/errs"
+	"github.com/netapp/harvest/v2/pkg/matrix"
+	"github.com/netapp/harvest/v2/pkg/requests"
+	"io"
+	"net/http"
+	url2 "net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* Push metrics to an OpenTelemetry collector with the OpenTelemetry Protocol (OTLP).
+   Metrics are encoded as an ExportMetricsServiceRequest and sent with either transport:
+
+   - http: OTLP/HTTP with binary protobuf, POST to <endpoint>/v1/metrics
+   - grpc: OTLP/gRPC, unary call of MetricsService/Export. gRPC runs over HTTP/2, which requires an https endpoint
+
+   - https://opentelemetry.io/docs/specs/otlp/
+*/
+
+const (
+	defaultTimeout  = 5
+	defaultProtocol = protocolHTTP
+	protocolHTTP    = "http"
+	protocolGRPC    = "grpc"
+	httpPath        = "/v1/metrics"
+	grpcPath        = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+	scopeName       = "harvest"
+)
+
+type OTLP struct {
+	*exporter.AbstractExporter
+	client   *http.Client
+	url      string
+	protocol string
+	headers  map[string]string
+	// lastRender is when each matrix was last rendered, by UUID and object, the start of the interval of its deltas
+	lastRender map[string]uint64
+}
+
+func New(abc *exporter.AbstractExporter) exporter.Exporter {
+	return &OTLP{AbstractExporter: abc}
+}
+
+func (e *OTLP) Init() error {
+
+	if err := e.InitAbc(); err != nil {
+		return err
+	}
+
+	if e.Params.Endpoint == nil {
+		return errs.New(errs.ErrMissingParam, "endpoint")
+	}
+	endpoint := strings.TrimSuffix(*e.Params.Endpoint, "/")
+	u, err := url2.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return errs.New(errs.ErrInvalidParam, "endpoint "+endpoint)
+	}
+
+	e.protocol = defaultProtocol
+	if p := e.Params.Protocol; p != nil {
+		e.protocol = *p
+	}
+	switch e.protocol {
+	case protocolHTTP:
+		e.url = endpoint + httpPath
+	case protocolGRPC:
+		if u.Scheme != "https" {
+			return errs.New(errs.ErrInvalidParam, "protocol grpc requires an https endpoint")
+		}
+		e.url = endpoint + grpcPath
+	default:
+		return errs.New(errs.ErrInvalidParam, "protocol "+e.protocol)
+	}
+	e.headers = e.Params.Headers
+	e.lastRender = make(map[string]uint64)
+
+	timeout := time.Duration(defaultTimeout) * time.Second
+	if ct := e.Params.ClientTimeout; ct != nil {
+		if t, err := strconv.Atoi(*ct); err == nil {
+			timeout = time.Duration(t) * time.Second
+		} else {
+			e.Logger.Warn().Str("client_timeout", *ct).Int("default", defaultTimeout).Msg("invalid client_timeout, using default")
+		}
+	}
+
+	e.Logger.Debug().Str("url", e.url).Str("protocol", e.protocol).Int("headers", len(e.headers)).Msg("")
+
+	// the default transport negotiates HTTP/2 with https endpoints, which gRPC needs
+	e.client = &http.Client{Timeout: timeout}
+
+	return nil
+}
+
+func (e *OTLP) Export(data *matrix.Matrix) (exporter.Stats, error) {
+
+	e.Lock()
+	defer e.Unlock()
+
+	s := time.Now()
+
+	resource, stats := e.Render(data)
+	if len(resource.Metrics) != 0 {
+		if err := e.Metadata.LazyAddValueInt64("time", "render", time.Since(s).Microseconds()); err != nil {
+			e.Logger.Error().Stack().Err(err).Msg("metadata render time")
+		}
+		// in debug mode, don't actually export but write to log
+		if e.Options.Debug {
+			e.Logger.Debug().Int("metrics", len(resource.Metrics)).Msg("simulating export since in debug mode")
+			return stats, nil
+		}
+		if err := e.Emit(Marshal([]*ResourceMetrics{resource})); err != nil {
+			e.Logger.Error().Stack().Err(err).
+				Str("object", data.Object).
+				Str("uuid", data.UUID).
+				Msg("Failed to emit metrics")
+			return stats, err
+		}
+	}
+
+	e.Logger.Debug().Str("object", data.Object).Uint64("dataPoints", stats.MetricsExported).Msg("exported")
+
+	if err := e.Metadata.LazySetValueInt64("time", "export", time.Since(s).Microseconds()); err != nil {
+		e.Logger.Error().Err(err).Msg("metadata export time")
+	}
+
+	if metadata, _ := e.Render(e.Metadata); len(metadata.Metrics) != 0 {
+		if err := e.Emit(Marshal([]*ResourceMetrics{metadata})); err != nil {
+			e.Logger.Error().Err(err).Msg("emit metadata")
+		}
+	}
+
+	return stats, nil
+}
+
+// Emit sends an encoded ExportMetricsServiceRequest to the collector
+func (e *OTLP) Emit(payload []byte) error {
+	var body []byte
+	contentType := "application/x-protobuf"
+	if e.protocol == protocolGRPC {
+		// length-prefixed message, uncompressed
+		body = append(body, 0)
+		body = binary.BigEndian.AppendUint32(body, uint32(len(payload)))
+		body = append(body, payload...)
+		contentType = "application/grpc"
+	} else {
+		body = payload
+	}
+
+	request, err := requests.New("POST", e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", contentType)
+	if e.protocol == protocolGRPC {
+		request.Header.Set("Te", "trailers")
+	}
+	for k, v := range e.headers {
+		request.Header.Set(k, v)
+	}
+
+	response, err := e.client.Do(request)
+	if err != nil {
+		return errs.New(errs.ErrConnection, err.Error())
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer response.Body.Close()
+	// the gRPC status is only complete once the body, and with it the trailers, are read
+	responseBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return errs.New(errs.ErrAPIResponse, err.Error())
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %d %s", errs.ErrAPIRequestRejected, response.StatusCode, string(responseBody))
+	}
+	if e.protocol == protocolGRPC {
+		status := response.Trailer.Get("Grpc-Status")
+		message := response.Trailer.Get("Grpc-Message")
+		// a response without a message carries the status in the headers
+		if status == "" {
+			status = response.Header.Get("Grpc-Status")
+			message = response.Header.Get("Grpc-Message")
+		}
+		if status != "0" {
+			return fmt.Errorf("%w: grpc-status %s %s", errs.ErrAPIRequestRejected, status, message)
+		}
+	}
+	return nil
+}
+
+// Render maps a matrix to the metrics of one resource. Global labels become resource attributes and instance labels
+// data point attributes, as selected by the export options. Deltas, counters cooked by the collector, are exported
+// as monotonic delta sums over the interval since the previous render of the matrix, the first render of a matrix
+// skips them. Everything else is exported as a gauge: a raw metric is not necessarily a counter, e.g. util_percent or
+// the heartbeat metric.
+func (e *OTLP) Render(data *matrix.Matrix) (*ResourceMetrics, exporter.Stats) {
+	var count, instancesExported uint64
+
+	resource := &ResourceMetrics{
+		Resource:  sortedAttributes(data.GetGlobalLabels()),
+		ScopeName: scopeName,
+	}
+
+	var keysToInclude []string
+	includeAll := data.GetExportOptions().GetChildContentS("include_all_labels") == "true"
+	if x := data.GetExportOptions().GetChildS("instance_keys"); x != nil {
+		keysToInclude = x.GetAllChildContentS()
+	}
+
+	now := time.Now()
+	renderKey := data.UUID + "." + data.Object
+	start := e.lastRender[renderKey]
+	e.lastRender[renderKey] = uint64(now.UnixNano())
+	metrics := make(map[string]*Metric)
+	var names []string
+
+	for _, instance := range data.GetInstances() {
+		if !instance.IsExportable() {
+			continue
+		}
+
+		labels := make(map[string]string)
+		if includeAll {
+			for label, value := range instance.GetLabels() {
+				if value != "" {
+					labels[label] = value
+				}
+			}
+		} else {
+			for _, key := range keysToInclude {
+				if value := instance.GetLabel(key); value != "" {
+					labels[key] = value
+				}
+			}
+		}
+
+		exported := false
+		for _, metric := range data.GetMetrics() {
+			if !metric.IsExportable() {
+				continue
+			}
+			value, ok := data.ExportValueFloat64(metric, instance)
+			if !ok {
+				continue
+			}
+			// a delta sum needs the start of its interval, which is unknown on the first render of the matrix
+			if metric.GetProperty() == "delta" && start == 0 {
+				continue
+			}
+
+			name := data.Object + "_" + metric.GetName()
+			m, has := metrics[name]
+			if !has {
+				m = &Metric{Name: name, Description: metric.GetComment()}
+				if metric.GetProperty() == "delta" {
+					m.Sum, m.Temporality, m.Monotonic = true, TemporalityDelta, true
+				}
+				metrics[name] = m
+				names = append(names, name)
+			}
+
+			attributes := labels
+			if metric.HasLabels() {
+				attributes = make(map[string]string, len(labels)+len(metric.GetLabels()))
+				for k, v := range labels {
+					attributes[k] = v
+				}
+				for k, v := range metric.GetLabels() {
+					attributes[k] = v
+				}
+			}
+
+			ts := now
+			if t, _ := data.ExportTimestamp(metric, instance); !t.IsZero() {
+				ts = t
+			}
+			dp := DataPoint{
+				Attributes: sortedAttributes(attributes),
+				TimeNano:   uint64(ts.UnixNano()),
+				Value:      value,
+			}
+			if m.Sum {
+				dp.StartTimeNano = start
+			}
+			m.DataPoints = append(m.DataPoints, dp)
+			count++
+			exported = true
+		}
+		if exported {
+			instancesExported++
+		}
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		resource.Metrics = append(resource.Metrics, metrics[name])
+	}
+
+	e.AddExportCount(count)
+	if err := e.Metadata.LazySetValueUint64("count", "export", count); err != nil {
+		e.Logger.Error().Stack().Err(err).Msg("metadata export count")
+	}
+	return resource, exporter.Stats{InstancesExported: instancesExported, MetricsExported: count}
+}
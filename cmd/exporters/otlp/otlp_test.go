@@ -0,0 +1,337 @@
+package otlp
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/netapp/harvest/v2/cmd/poller/exporter"
+	"github.com/netapp/harvest/v2/cmd/poller/options"
+	"github.com/netapp/harvest/v2/pkg/conf"
+	"github.com/netapp/harvest/v2/pkg/errs"
+	"github.com/netapp/harvest/v2/pkg/matrix"
+	"github.com/netapp/harvest/v2/pkg/tree/node"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newOTLP(t *testing.T, params conf.Exporter) *OTLP {
+	e := &OTLP{AbstractExporter: exporter.New("OTLP", "otlp", options.New(), params, nil)}
+	if err := e.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func newData() *matrix.Matrix {
+	data := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+	data.SetGlobalLabel("cluster", "c1")
+	data.SetGlobalLabel("datacenter", "dc1")
+	exportOptions := node.NewS("export_options")
+	exportOptions.NewChildS("instance_keys", "").NewChildS("", "node")
+	data.SetExportOptions(exportOptions)
+
+	power, _ := data.NewMetricFloat64("power")
+	power.SetComment("node power in W")
+	reads, _ := data.NewMetricFloat64("total_reads")
+	reads.SetProperty("raw")
+	delta, _ := data.NewMetricFloat64("reads")
+	delta.SetProperty("delta")
+	hidden, _ := data.NewMetricFloat64("hidden")
+	hidden.SetExportable(false)
+
+	instance, _ := data.NewInstance("n1")
+	instance.SetLabel("node", "n1")
+	instance.SetLabel("model", "not exported")
+	_ = power.SetValueFloat64(instance, 250.5)
+	_ = reads.SetValueFloat64(instance, 1000)
+	_ = delta.SetValueFloat64(instance, 10)
+	_ = hidden.SetValueFloat64(instance, 1)
+	data.SetTimestamp(time.Unix(1700000000, 0))
+	return data
+}
+
+func TestRender(t *testing.T) {
+	e := newOTLP(t, conf.Exporter{Endpoint: strPtr("http://localhost:4318")})
+
+	dataPoint := func(value float64) []DataPoint {
+		return []DataPoint{{Attributes: []KeyValue{{Key: "node", Value: "n1"}}, TimeNano: 1700000000 * 1e9, Value: value}}
+	}
+	power := &Metric{Name: "environment_sensor_power", Description: "node power in W", DataPoints: dataPoint(250.5)}
+	totalReads := &Metric{Name: "environment_sensor_total_reads", DataPoints: dataPoint(1000)}
+
+	// the start of the interval of the deltas is unknown on the first render, they are skipped
+	before := uint64(time.Now().UnixNano())
+	resource, stats := e.Render(newData())
+	after := uint64(time.Now().UnixNano())
+
+	wantResource := []KeyValue{{Key: "cluster", Value: "c1"}, {Key: "datacenter", Value: "dc1"}}
+	if !reflect.DeepEqual(resource.Resource, wantResource) {
+		t.Errorf("resource attributes got=%v want=%v", resource.Resource, wantResource)
+	}
+	if stats.InstancesExported != 1 || stats.MetricsExported != 2 {
+		t.Errorf("first render stats got=%+v want 1 instance and 2 metrics", stats)
+	}
+	if want := []*Metric{power, totalReads}; !reflect.DeepEqual(resource.Metrics, want) {
+		for _, m := range resource.Metrics {
+			t.Logf("got %+v", m)
+		}
+		t.Errorf("first render metrics do not match")
+	}
+
+	// the deltas of the next render cover the interval since the first one
+	resource, stats = e.Render(newData())
+	if stats.InstancesExported != 1 || stats.MetricsExported != 3 {
+		t.Errorf("stats got=%+v want 1 instance and 3 metrics", stats)
+	}
+	if len(resource.Metrics) != 3 {
+		t.Fatalf("metrics got=%d want=3", len(resource.Metrics))
+	}
+	start := resource.Metrics[1].DataPoints[0].StartTimeNano
+	if start < before || start > after {
+		t.Errorf("delta start time got=%d want between %d and %d", start, before, after)
+	}
+	reads := dataPoint(10)
+	reads[0].StartTimeNano = start
+	want := []*Metric{
+		power,
+		{Name: "environment_sensor_reads", Sum: true, Temporality: TemporalityDelta, Monotonic: true, DataPoints: reads},
+		totalReads,
+	}
+	if !reflect.DeepEqual(resource.Metrics, want) {
+		for _, m := range resource.Metrics {
+			t.Logf("got %+v", m)
+		}
+		t.Errorf("metrics do not match")
+	}
+}
+
+// field is one decoded protobuf field, either a varint/fixed64 value or length delimited bytes
+type field struct {
+	value uint64
+	bytes []byte
+}
+
+// decode splits a protobuf message into its fields by field number
+func decode(t *testing.T, b []byte) map[int][]field {
+	t.Helper()
+	fields := make(map[int][]field)
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		b = b[n:]
+		var f field
+		switch tag & 7 {
+		case wireVarint:
+			f.value, n = binary.Uvarint(b)
+			b = b[n:]
+		case wireFixed64:
+			f.value = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			f.bytes = b[n : n+int(size)]
+			b = b[n+int(size):]
+		default:
+			t.Fatalf("unexpected wire type %d", tag&7)
+		}
+		fields[int(tag>>3)] = append(fields[int(tag>>3)], f)
+	}
+	return fields
+}
+
+func decodeAttributes(t *testing.T, fields []field) map[string]string {
+	attributes := make(map[string]string)
+	for _, f := range fields {
+		kv := decode(t, f.bytes)
+		value := decode(t, kv[2][0].bytes)
+		attributes[string(kv[1][0].bytes)] = string(value[1][0].bytes)
+	}
+	return attributes
+}
+
+// checkPayload asserts that payload is an ExportMetricsServiceRequest with the attributes and values of newData
+func checkPayload(t *testing.T, payload []byte) {
+	request := decode(t, payload)
+	resourceMetrics := decode(t, request[1][0].bytes)
+
+	resource := decode(t, resourceMetrics[1][0].bytes)
+	if got := decodeAttributes(t, resource[1]); !reflect.DeepEqual(got, map[string]string{"cluster": "c1", "datacenter": "dc1"}) {
+		t.Errorf("resource attributes got=%v", got)
+	}
+
+	scopeMetrics := decode(t, resourceMetrics[2][0].bytes)
+	if scope := decode(t, scopeMetrics[1][0].bytes); string(scope[1][0].bytes) != scopeName {
+		t.Errorf("scope name got=%s want=%s", scope[1][0].bytes, scopeName)
+	}
+	if len(scopeMetrics[2]) != 3 {
+		t.Fatalf("metrics got=%d want=3", len(scopeMetrics[2]))
+	}
+
+	// the first metric is the power gauge
+	metric := decode(t, scopeMetrics[2][0].bytes)
+	if name := string(metric[1][0].bytes); name != "environment_sensor_power" {
+		t.Errorf("metric name got=%s", name)
+	}
+	if _, ok := metric[5]; !ok {
+		t.Fatalf("power is not a gauge")
+	}
+	gauge := decode(t, metric[5][0].bytes)
+	dp := decode(t, gauge[1][0].bytes)
+	if got := decodeAttributes(t, dp[7]); !reflect.DeepEqual(got, map[string]string{"node": "n1"}) {
+		t.Errorf("data point attributes got=%v", got)
+	}
+	if got := math.Float64frombits(dp[4][0].value); got != 250.5 {
+		t.Errorf("data point value got=%v want=250.5", got)
+	}
+	if got := dp[3][0].value; got != 1700000000*1e9 {
+		t.Errorf("data point time got=%v", got)
+	}
+
+	// the second metric is the reads delta, a monotonic delta sum
+	metric = decode(t, scopeMetrics[2][1].bytes)
+	if _, ok := metric[7]; !ok {
+		t.Fatalf("reads is not a sum")
+	}
+	sum := decode(t, metric[7][0].bytes)
+	if sum[2][0].value != uint64(TemporalityDelta) || sum[3][0].value != 1 {
+		t.Errorf("sum temporality=%d monotonic=%d", sum[2][0].value, sum[3][0].value)
+	}
+	dp = decode(t, sum[1][0].bytes)
+	if got := math.Float64frombits(dp[4][0].value); got != 10 {
+		t.Errorf("sum value got=%v want=10", got)
+	}
+
+	// the last metric is the raw total_reads, a raw metric is a gauge
+	metric = decode(t, scopeMetrics[2][2].bytes)
+	if _, ok := metric[5]; !ok {
+		t.Fatalf("total_reads is not a gauge")
+	}
+	if _, ok := metric[7]; ok {
+		t.Errorf("total_reads is a sum")
+	}
+}
+
+func TestEmitHTTP(t *testing.T) {
+	var got []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != httpPath {
+			t.Errorf("path got=%s want=%s", r.URL.Path, httpPath)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-protobuf" {
+			t.Errorf("content type got=%s", ct)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer secret" {
+			t.Errorf("authorization header got=%s", auth)
+		}
+		// the exporter's own metadata follows the data
+		if got == nil {
+			got, _ = io.ReadAll(r.Body)
+		}
+	}))
+	defer server.Close()
+
+	e := newOTLP(t, conf.Exporter{Endpoint: strPtr(server.URL), Headers: map[string]string{"Authorization": "Bearer secret"}})
+	// the deltas are exported from the second render on
+	e.Render(newData())
+	if _, err := e.Export(newData()); err != nil {
+		t.Fatal(err)
+	}
+	checkPayload(t, got)
+}
+
+func TestEmitGRPC(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  string
+		wantErr bool
+	}{
+		{name: "ok", status: "0"},
+		{name: "rejected", status: "3", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []byte
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.ProtoMajor != 2 {
+					t.Errorf("protocol got=%s want HTTP/2", r.Proto)
+				}
+				if r.URL.Path != grpcPath {
+					t.Errorf("path got=%s want=%s", r.URL.Path, grpcPath)
+				}
+				if ct := r.Header.Get("Content-Type"); ct != "application/grpc" {
+					t.Errorf("content type got=%s", ct)
+				}
+				body, _ := io.ReadAll(r.Body)
+				if size := binary.BigEndian.Uint32(body[1:5]); body[0] != 0 || int(size) != len(body)-5 {
+					t.Errorf("message prefix compressed=%d size=%d body=%d", body[0], size, len(body))
+				}
+				got = body[5:]
+				w.Header().Set("Content-Type", "application/grpc")
+				w.Header().Set(http.TrailerPrefix+"Grpc-Status", tt.status)
+			}))
+			server.EnableHTTP2 = true
+			server.StartTLS()
+			defer server.Close()
+
+			e := newOTLP(t, conf.Exporter{Endpoint: strPtr(server.URL), Protocol: strPtr(protocolGRPC)})
+			e.client = server.Client()
+			// the deltas are exported from the second render on
+			e.Render(newData())
+			resource, _ := e.Render(newData())
+			err := e.Emit(Marshal([]*ResourceMetrics{resource}))
+			if tt.wantErr {
+				if !errors.Is(err, errs.ErrAPIRequestRejected) {
+					t.Errorf("err got=%v want %v", err, errs.ErrAPIRequestRejected)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkPayload(t, got)
+		})
+	}
+}
+
+func TestInit(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  conf.Exporter
+		wantURL string
+		wantErr error
+	}{
+		{name: "http", params: conf.Exporter{Endpoint: strPtr("http://otel:4318/")}, wantURL: "http://otel:4318/v1/metrics"},
+		{name: "grpc", params: conf.Exporter{Endpoint: strPtr("https://otel:4317"), Protocol: strPtr("grpc")},
+			wantURL: "https://otel:4317" + grpcPath},
+		{name: "grpc without tls", params: conf.Exporter{Endpoint: strPtr("http://otel:4317"), Protocol: strPtr("grpc")},
+			wantErr: errs.ErrInvalidParam},
+		{name: "unknown protocol", params: conf.Exporter{Endpoint: strPtr("http://otel:4318"), Protocol: strPtr("udp")},
+			wantErr: errs.ErrInvalidParam},
+		{name: "missing endpoint", params: conf.Exporter{}, wantErr: errs.ErrMissingParam},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &OTLP{AbstractExporter: exporter.New("OTLP", "otlp", options.New(), tt.params, nil)}
+			err := e.Init()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("err got=%v want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.url != tt.wantURL {
+				t.Errorf("url got=%s want=%s", e.url, tt.wantURL)
+			}
+		})
+	}
+}
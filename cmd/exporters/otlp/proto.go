@@ -0,0 +1,171 @@
+/*
+ * Copyright NetApp Inc, 2024 All rights reserved
+ */
+
+package otlp
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+// The types below are the subset of the OpenTelemetry metrics data model that Harvest exports. They marshal to the
+// protobuf wire format of opentelemetry-proto v1, the field numbers are those of
+//
+//   - https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/metrics/v1/metrics.proto
+//   - https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/common/v1/common.proto
+//   - https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/collector/metrics/v1/metrics_service.proto
+
+// Temporality is the aggregation temporality of a sum
+type Temporality int
+
+const (
+	TemporalityDelta      Temporality = 1
+	TemporalityCumulative Temporality = 2
+)
+
+// KeyValue is an attribute with a string value
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// ResourceMetrics are the metrics of one resource, i.e. one matrix
+type ResourceMetrics struct {
+	Resource  []KeyValue
+	ScopeName string
+	Metrics   []*Metric
+}
+
+// Metric is a gauge, or a sum when Sum is true
+type Metric struct {
+	Name        string
+	Description string
+	Sum         bool
+	Temporality Temporality
+	Monotonic   bool
+	DataPoints  []DataPoint
+}
+
+// DataPoint is one value of a metric
+type DataPoint struct {
+	Attributes []KeyValue
+	// StartTimeNano is the start of the interval of a delta sum, zero when unknown
+	StartTimeNano uint64
+	TimeNano      uint64
+	Value         float64
+}
+
+// sortedAttributes returns the labels as attributes ordered by key
+func sortedAttributes(labels map[string]string) []KeyValue {
+	attributes := make([]KeyValue, 0, len(labels))
+	for k, v := range labels {
+		attributes = append(attributes, KeyValue{Key: k, Value: v})
+	}
+	sort.Slice(attributes, func(i, j int) bool {
+		return attributes[i].Key < attributes[j].Key
+	})
+	return attributes
+}
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func appendTag(b []byte, field int, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+func appendString(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = appendTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendMessage(b []byte, field int, message []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(message)))
+	return append(b, message...)
+}
+
+func appendFixed64(b []byte, field int, v uint64) []byte {
+	b = appendTag(b, field, wireFixed64)
+	return binary.LittleEndian.AppendUint64(b, v)
+}
+
+func appendVarint(b []byte, field int, v uint64) []byte {
+	b = appendTag(b, field, wireVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+// Marshal encodes an ExportMetricsServiceRequest with the given resource metrics
+func Marshal(resources []*ResourceMetrics) []byte {
+	var b []byte
+	for _, r := range resources {
+		b = appendMessage(b, 1, r.marshal())
+	}
+	return b
+}
+
+func (r *ResourceMetrics) marshal() []byte {
+	var resource []byte
+	for _, kv := range r.Resource {
+		resource = appendMessage(resource, 1, kv.marshal())
+	}
+	var scope []byte
+	scope = appendString(scope, 1, r.ScopeName)
+	var scopeMetrics []byte
+	scopeMetrics = appendMessage(scopeMetrics, 1, scope)
+	for _, m := range r.Metrics {
+		scopeMetrics = appendMessage(scopeMetrics, 2, m.marshal())
+	}
+
+	var b []byte
+	b = appendMessage(b, 1, resource)
+	return appendMessage(b, 2, scopeMetrics)
+}
+
+func (kv KeyValue) marshal() []byte {
+	var value []byte
+	value = appendString(value, 1, kv.Value)
+	var b []byte
+	b = appendString(b, 1, kv.Key)
+	return appendMessage(b, 2, value)
+}
+
+func (m *Metric) marshal() []byte {
+	var data []byte
+	for _, dp := range m.DataPoints {
+		data = appendMessage(data, 1, dp.marshal())
+	}
+	var b []byte
+	b = appendString(b, 1, m.Name)
+	b = appendString(b, 2, m.Description)
+	if !m.Sum {
+		return appendMessage(b, 5, data)
+	}
+	data = appendVarint(data, 2, uint64(m.Temporality))
+	if m.Monotonic {
+		data = appendVarint(data, 3, 1)
+	}
+	return appendMessage(b, 7, data)
+}
+
+func (dp DataPoint) marshal() []byte {
+	var b []byte
+	if dp.StartTimeNano != 0 {
+		b = appendFixed64(b, 2, dp.StartTimeNano)
+	}
+	b = appendFixed64(b, 3, dp.TimeNano)
+	b = appendFixed64(b, 4, math.Float64bits(dp.Value))
+	for _, kv := range dp.Attributes {
+		b = appendMessage(b, 7, kv.marshal())
+	}
+	return b
+}
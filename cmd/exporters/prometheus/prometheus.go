@@ -419,7 +419,7 @@ func (p *Prometheus) render(data *matrix.Matrix) ([][]byte, exporter.Stats) {
 
 			p.Logger.Trace().Str("mkey", mkey).Msg("rendering metric")
 
-			if value, ok := metric.GetValueString(instance); ok {
+			if value, ok := data.ExportValueString(metric, instance); ok {
 
 				// metric is array, determine if this is a plain array or histogram
 				if metric.HasLabels() {
@@ -450,12 +450,13 @@ func (p *Prometheus) render(data *matrix.Matrix) ([][]byte, exporter.Stats) {
 						metricLabels = append(metricLabels, escape(replacer, k, v))
 					}
 					x := fmt.Sprintf(
-						"%s_%s{%s,%s} %s",
+						"%s_%s{%s,%s} %s%s",
 						prefix,
 						metric.GetName(),
 						strings.Join(instanceKeys, ","),
 						strings.Join(metricLabels, ","),
 						value,
+						sampleTimestamp(data, metric, instance),
 					)
 
 					if p.addMetaTags && !tagged.Has(prefix+"_"+metric.GetName()) {
@@ -467,7 +468,8 @@ func (p *Prometheus) render(data *matrix.Matrix) ([][]byte, exporter.Stats) {
 					rendered = append(rendered, []byte(x))
 					// scalar metric
 				} else {
-					x := fmt.Sprintf("%s_%s{%s} %s", prefix, metric.GetName(), strings.Join(instanceKeys, ","), value)
+					x := fmt.Sprintf("%s_%s{%s} %s%s", prefix, metric.GetName(), strings.Join(instanceKeys, ","), value,
+						sampleTimestamp(data, metric, instance))
 
 					if p.addMetaTags && !tagged.Has(prefix+"_"+metric.GetName()) {
 						tagged.Add(prefix + "_" + metric.GetName())
@@ -567,6 +569,15 @@ func (p *Prometheus) render(data *matrix.Matrix) ([][]byte, exporter.Stats) {
 	return rendered, stats
 }
 
+// sampleTimestamp returns the timestamp, in milliseconds, to append to the sample of metric for instance.
+// It is empty unless the metric or the instance carries its own timestamp, otherwise Prometheus uses the scrape time.
+func sampleTimestamp(data *matrix.Matrix, metric *matrix.Metric, instance *matrix.Instance) string {
+	if ts, override := data.ExportTimestamp(metric, instance); override {
+		return " " + strconv.FormatInt(ts.UnixMilli(), 10)
+	}
+	return ""
+}
+
 var numAndUnitRe = regexp.MustCompile(`(\d+)\s*(\w+)`)
 
 // normalizeHistogram tries to normalize ONTAP values by converting units to multiples of the smallest unit.
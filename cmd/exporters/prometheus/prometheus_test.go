@@ -6,7 +6,15 @@ package prometheus
 
 import (
 	"bytes"
+	"github.com/netapp/harvest/v2/cmd/poller/exporter"
+	"github.com/netapp/harvest/v2/cmd/poller/options"
+	"github.com/netapp/harvest/v2/pkg/conf"
+	"github.com/netapp/harvest/v2/pkg/matrix"
+	"github.com/netapp/harvest/v2/pkg/tree/node"
+	"math"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestFilterMetaTags(t *testing.T) {
@@ -48,3 +56,74 @@ func TestFilterMetaTags(t *testing.T) {
 
 	t.Log("OK - output is exactly what is expected")
 }
+
+func TestRenderTimestampOverride(t *testing.T) {
+	p := &Prometheus{AbstractExporter: exporter.New("Prometheus", "prom", options.New(), conf.Exporter{}, nil)}
+
+	data := matrix.New("sensor", "sensor", "sensor")
+	exportOptions := node.NewS("export_options")
+	exportOptions.NewChildS("instance_keys", "").NewChildS("", "sensor")
+	data.SetExportOptions(exportOptions)
+	data.SetTimestamp(time.Unix(1700000060, 0))
+	reading, _ := data.NewMetricFloat64("reading")
+	threshold, _ := data.NewMetricFloat64("threshold")
+	for _, key := range []string{"cycle", "instance", "metric"} {
+		instance, _ := data.NewInstance(key)
+		instance.SetLabel("sensor", key)
+		_ = reading.SetValueFloat64(instance, 1)
+		_ = threshold.SetValueFloat64(instance, 2)
+	}
+	data.GetInstance("instance").SetTimestamp(time.Unix(1700000030, 0))
+	data.GetInstance("metric").SetTimestamp(time.Unix(1700000030, 0))
+	reading.SetTimestamp(data.GetInstance("metric"), time.Unix(1700000010, 0))
+
+	// per-metric > per-instance > cycle, the cycle is left to the scrape time
+	want := map[string]bool{
+		`sensor_reading{sensor="cycle"} 1`:                    true,
+		`sensor_threshold{sensor="cycle"} 2`:                  true,
+		`sensor_reading{sensor="instance"} 1 1700000030000`:   true,
+		`sensor_threshold{sensor="instance"} 2 1700000030000`: true,
+		`sensor_reading{sensor="metric"} 1 1700000010000`:     true,
+		`sensor_threshold{sensor="metric"} 2 1700000030000`:   true,
+	}
+	rendered, _ := p.render(data)
+	if len(rendered) != len(want) {
+		t.Fatalf("expected %d samples, got %d: %s", len(want), len(rendered), bytes.Join(rendered, []byte("\n")))
+	}
+	for _, r := range rendered {
+		if !want[string(r)] {
+			t.Errorf("unexpected sample [%s]", r)
+		}
+	}
+	if strings.Contains(string(bytes.Join(rendered, nil)), "1700000060") {
+		t.Errorf("cycle timestamp should not be rendered")
+	}
+}
+
+func TestRenderNaNAsAbsent(t *testing.T) {
+	p := &Prometheus{AbstractExporter: exporter.New("Prometheus", "prom", options.New(), conf.Exporter{}, nil)}
+
+	data := matrix.New("nic", "nic", "nic")
+	exportOptions := node.NewS("export_options")
+	exportOptions.NewChildS("instance_keys", "").NewChildS("", "nic")
+	data.SetExportOptions(exportOptions)
+	utilPercent, _ := data.NewMetricFloat64("util_percent")
+	for _, key := range []string{"e0a", "e0b"} {
+		instance, _ := data.NewInstance(key)
+		instance.SetLabel("nic", key)
+	}
+	_ = utilPercent.SetValueFloat64(data.GetInstance("e0a"), 0.5)
+	_ = utilPercent.SetValueFloat64(data.GetInstance("e0b"), math.NaN())
+
+	for _, absent := range []bool{false, true} {
+		data.SetExportNaNAsAbsent(absent)
+		rendered, _ := p.render(data.Clone(matrix.With{Data: true, Metrics: true, Instances: true, ExportInstances: true}))
+		got := string(bytes.Join(rendered, []byte("\n")))
+		if !strings.Contains(got, `nic_util_percent{nic="e0a"} 0.5`) {
+			t.Errorf("absent=%v expected e0a to be rendered, got %s", absent, got)
+		}
+		if hasNaN := strings.Contains(got, `nic_util_percent{nic="e0b"} NaN`); hasNaN == absent {
+			t.Errorf("absent=%v expected NaN rendered=%v, got %s", absent, !absent, got)
+		}
+	}
+}
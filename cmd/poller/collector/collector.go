@@ -68,6 +68,7 @@ type Collector interface {
 	LoadPlugins(*node.Node, Collector, string) error
 	LoadPlugin(string, *plugin.AbstractPlugin) plugin.Plugin
 	CollectAutoSupport(p *Payload)
+	Stop()
 }
 
 const (
@@ -316,12 +317,44 @@ func (c *AbstractCollector) Start(wg *sync.WaitGroup) {
 	retryDelay := 1
 	c.SetStatus(0, "running")
 
+	// when enabled, all matrices of a collection cycle are exported with the cycle start as timestamp
+	alignTimestamps := c.Params.GetChildContentS("align_timestamps") == "true"
+
+	// when enabled, all series are labeled with the collector and protocol that produced them.
+	// Opt-in since it changes the labels of every series
+	sourceLabels := c.Params.GetChildContentS("source_labels") == "true"
+
+	// expected metric bounds, values outside them are logged or, with bounds_action: drop, not exported
+	bounds := parseBounds(c.Params.GetChildS("bounds"), c.Logger)
+	dropOutOfBounds := c.Params.GetChildContentS("bounds_action") == "drop"
+
+	// when enabled, the results are shared with the plugins of other collectors, see matrix.Shared
+	publish := c.Params.GetChildContentS("publish") == "true"
+
+	// metrics computed from other metrics of the object with an expression, before plugins run
+	computed := parseComputedMetrics(c.Params.GetChildS("computed_metrics"), c.Logger)
+
+	// with export_nan: absent, exporters skip NaN values instead of emitting them, see matrix.SetExportNaNAsAbsent
+	nanAsAbsent := c.Params.GetChildContentS("export_nan") == "absent"
+
+	// slowly changing metrics can be exported less often than they are collected
+	decimator := parseExportEvery(c.Params.GetChildS("export_every"), c.Logger)
+
+	// harvest_collector_heartbeat advances every successful data poll of exported data, see heartbeat.
+	// heartbeat: false turns it off
+	var hb *heartbeat
+	if c.Params.GetChildContentS("heartbeat") != "false" && c.Matrix[c.Object].IsExportable() {
+		hb = newHeartbeat(c.Name, c.Object)
+	}
+
 	for {
 
 		// We can't reset metadata here because autosupport metadata is reset
 		// https://github.com/NetApp/harvest-private/issues/114 for details
 
 		results := make([]*matrix.Matrix, 0)
+		cycleStart := time.Now()
+		dataPolled := false
 
 		// run all scheduled tasks
 		for _, task := range c.Schedule.GetTasks() {
@@ -354,25 +387,9 @@ func (c *AbstractCollector) Start(wg *sync.WaitGroup) {
 					c.Logger.Debug().Msgf("handling error during [%s] poll...", task.Name)
 				}
 				switch {
-				// target system is unreachable
-				// enter standby mode and retry with some delay that will be increased if we fail again
+				// target system is unreachable, e.g. a ZAPI or REST request timed out
 				case errors.Is(err, errs.ErrConnection):
-					if retryDelay < 1024 {
-						retryDelay *= 4
-					}
-					if !c.Schedule.IsStandBy() {
-						c.Logger.Warn().
-							Str("task", task.Name).
-							Int("retryDelaySecs", retryDelay).
-							Msg("target unreachable, entering standby mode and retry")
-					}
-					c.Logger.Debug().
-						Err(err).
-						Str("task", task.Name).
-						Int("retryDelaySecs", retryDelay).
-						Msg("target unreachable, entering standby mode and retry")
-					c.Schedule.SetStandByMode(task, time.Duration(retryDelay)*time.Second)
-					c.SetStatus(1, errs.ErrConnection.Error())
+					retryDelay = c.standByUnreachable(task, err, retryDelay)
 				// there are no instances to collect
 				case errors.Is(err, errs.ErrNoInstance):
 					c.Schedule.SetStandByModeMax(task, 5*time.Minute)
@@ -427,6 +444,10 @@ func (c *AbstractCollector) Start(wg *sync.WaitGroup) {
 				c.SetStatus(0, "running")
 			}
 
+			if task.Name == "data" {
+				dataPolled = true
+			}
+
 			if data != nil {
 
 				for _, value := range data {
@@ -436,6 +457,10 @@ func (c *AbstractCollector) Start(wg *sync.WaitGroup) {
 				// run plugins after data poll
 				if task.Name == "data" {
 
+					if len(computed) > 0 {
+						computeMetrics(data, computed, c.Logger)
+					}
+
 					pluginStart = time.Now()
 
 					for _, v := range c.Plugins {
@@ -476,6 +501,39 @@ func (c *AbstractCollector) Start(wg *sync.WaitGroup) {
 
 		c.Logger.Trace().Int("results", len(results)).Msg("exporting data")
 
+		if len(bounds) > 0 {
+			validateBounds(results, bounds, dropOutOfBounds, c.Logger)
+		}
+
+		if alignTimestamps {
+			setCycleTimestamp(results, cycleStart)
+		}
+
+		if sourceLabels {
+			setSourceLabels(results, c.Name)
+		}
+
+		if nanAsAbsent {
+			setExportNaNAsAbsent(results)
+		}
+
+		if publish {
+			for _, data := range results {
+				matrix.Shared.Publish(data)
+			}
+		}
+
+		toExport := results
+		if decimator != nil {
+			toExport = make([]*matrix.Matrix, 0, len(results))
+			for _, data := range results {
+				toExport = append(toExport, decimator.Apply(data))
+			}
+		}
+		if dataPolled && hb != nil {
+			toExport = append(toExport, hb.beat(c.Matrix[c.Object].GetGlobalLabels()))
+		}
+
 		exportStart = time.Now()
 		exporterStats := exporter.Stats{}
 
@@ -496,9 +554,9 @@ func (c *AbstractCollector) Start(wg *sync.WaitGroup) {
 			}
 
 			// Continue if metadata failed, since it might be specific to metadata
-			for _, data := range results {
+			for _, data := range toExport {
 				if data.IsExportable() {
-					stats, err := e.Export(data)
+					stats, err := e.Export(e.Relabel(data))
 					if err != nil {
 						c.Logger.Error().Err(err).Str("exporter", e.GetName()).Msg("export data")
 						break
@@ -623,6 +681,29 @@ func (c *AbstractCollector) GetStatus() (uint8, string, string) {
 	return c.Status, Status[c.Status], c.Message
 }
 
+// standByUnreachable enters standby mode after task failed with err because the target is unreachable and returns
+// the delay in seconds before task is retried. The delay grows fourfold with every consecutive failure, up to 1024s,
+// and is reset when the collector recovers.
+func (c *AbstractCollector) standByUnreachable(task *schedule.Task, err error, retryDelay int) int {
+	if retryDelay < 1024 {
+		retryDelay *= 4
+	}
+	if !c.Schedule.IsStandBy() {
+		c.Logger.Warn().
+			Str("task", task.Name).
+			Int("retryDelaySecs", retryDelay).
+			Msg("target unreachable, entering standby mode and retry")
+	}
+	c.Logger.Debug().
+		Err(err).
+		Str("task", task.Name).
+		Int("retryDelaySecs", retryDelay).
+		Msg("target unreachable, entering standby mode and retry")
+	c.Schedule.SetStandByMode(task, time.Duration(retryDelay)*time.Second)
+	c.SetStatus(1, errs.ErrConnection.Error())
+	return retryDelay
+}
+
 // SetStatus sets the current state of the collector to one
 // of the values defined by CollectorStatus
 func (c *AbstractCollector) SetStatus(status uint8, msg string) {
@@ -673,6 +754,18 @@ func (c *AbstractCollector) LoadPlugin(_ string, _ *plugin.AbstractPlugin) plugi
 	return nil
 }
 
+// Stop stops the plugins of the collector that implement plugin.Stopper, e.g. to abort their in-flight requests
+// when the poller shuts down
+func (c *AbstractCollector) Stop() {
+	for _, plugins := range c.Plugins {
+		for _, p := range plugins {
+			if stopper, ok := p.(plugin.Stopper); ok {
+				stopper.Stop()
+			}
+		}
+	}
+}
+
 // LoadPlugins loads built-in plugins or dynamically loads custom plugins
 // and adds them to the collector
 func (c *AbstractCollector) LoadPlugins(params *node.Node, collector Collector, key string) error {
@@ -0,0 +1,78 @@
+package collector
+
+import (
+	"errors"
+	"github.com/netapp/harvest/v2/cmd/poller/schedule"
+	"github.com/netapp/harvest/v2/cmd/tools/rest"
+	"github.com/netapp/harvest/v2/pkg/auth"
+	"github.com/netapp/harvest/v2/pkg/conf"
+	"github.com/netapp/harvest/v2/pkg/errs"
+	"github.com/netapp/harvest/v2/pkg/logging"
+	"github.com/netapp/harvest/v2/pkg/matrix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_standByUnreachable(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		// hang until the client times out
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	insecure := true
+	poller := &conf.Poller{
+		Addr:           strings.TrimPrefix(server.URL, "https://"),
+		Username:       "admin",
+		Password:       "password",
+		UseInsecureTLS: &insecure,
+	}
+	client, err := rest.New(poller, 50*time.Millisecond, auth.NewCredentials(poller, logging.Get()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &AbstractCollector{Name: "Rest", Object: "Volume", Logger: logging.Get(), Schedule: schedule.New()}
+	if err := c.Schedule.NewTask("data", time.Minute, 0, func() (map[string]*matrix.Matrix, error) {
+		_, err := rest.Fetch(client, "api/storage/volumes")
+		return nil, err
+	}, false, "Rest:Volume"); err != nil {
+		t.Fatal(err)
+	}
+	task := c.Schedule.GetTask("data")
+
+	_, err = task.Run()
+	// the cause of a REST timeout is kept
+	if !errors.Is(err, errs.ErrConnection) {
+		t.Fatalf("expected errs.ErrConnection, got %v", err)
+	}
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) || !urlErr.Timeout() {
+		t.Errorf("expected a *url.Error timeout, got %v", err)
+	}
+
+	// a single timeout puts the collector in standby and retries the task after 4s
+	retryDelay := c.standByUnreachable(task, err, 1)
+	if retryDelay != 4 {
+		t.Errorf("retryDelay got=%d want=4", retryDelay)
+	}
+	if !c.Schedule.IsStandBy() || !c.Schedule.IsTaskStandBy(task) {
+		t.Errorf("expected the data task in standby")
+	}
+	if got := task.GetInterval(); got != 4*time.Second {
+		t.Errorf("interval got=%s want=4s", got)
+	}
+	if c.Status != 1 || c.Message != errs.ErrConnection.Error() {
+		t.Errorf("status got=%d,%q want=1,%q", c.Status, c.Message, errs.ErrConnection.Error())
+	}
+
+	// the next successful poll restores the interval
+	c.Schedule.Recover()
+	if c.Schedule.IsStandBy() || task.GetInterval() != time.Minute {
+		t.Errorf("expected the schedule to recover, standby=%t interval=%s", c.Schedule.IsStandBy(), task.GetInterval())
+	}
+}
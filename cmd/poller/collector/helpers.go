@@ -19,13 +19,17 @@ import (
 	"github.com/netapp/harvest/v2/cmd/poller/plugin/metricagent"
 	"github.com/netapp/harvest/v2/pkg/conf"
 	"github.com/netapp/harvest/v2/pkg/errs"
+	"github.com/netapp/harvest/v2/pkg/logging"
+	"github.com/netapp/harvest/v2/pkg/matrix"
 	"github.com/netapp/harvest/v2/pkg/tree"
 	"github.com/netapp/harvest/v2/pkg/tree/node"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // ImportTemplate looks for a collector's template by searching confPaths for the first template that exists in
@@ -221,3 +225,222 @@ func GetBuiltinPlugin(name string, abc *plugin.AbstractPlugin) plugin.Plugin {
 
 	return nil
 }
+
+// setCycleTimestamp sets the same timestamp on all matrices of a collection cycle so exporters
+// write all of their points at the cycle start instead of the time each matrix was exported.
+func setCycleTimestamp(results []*matrix.Matrix, cycleStart time.Time) {
+	for _, data := range results {
+		data.SetTimestamp(cycleStart)
+	}
+}
+
+// setSourceLabels labels all matrices of a collection cycle, including those of plugins, with the collector and
+// the protocol that produced them. This tells apart the series of an object collected by both ZAPI and REST.
+func setSourceLabels(results []*matrix.Matrix, collectorName string) {
+	protocol := collectorProtocol(collectorName)
+	for _, data := range results {
+		data.SetGlobalLabel("collector", collectorName)
+		if protocol != "" {
+			data.SetGlobalLabel("protocol", protocol)
+		}
+	}
+}
+
+// setExportNaNAsAbsent makes exporters skip the NaN values of all matrices of a collection cycle, including those of
+// plugins, e.g. the latencies of idle flexgroups computed by the Volume plugin
+func setExportNaNAsAbsent(results []*matrix.Matrix) {
+	for _, data := range results {
+		data.SetExportNaNAsAbsent(true)
+	}
+}
+
+// heartbeat counts the successful data polls of a collector-object as harvest_collector_heartbeat. The counter
+// advances every cycle even when the collected values do not change, so a counter that stops advancing tells a
+// stalled collector apart from static data.
+type heartbeat struct {
+	data     *matrix.Matrix
+	metric   *matrix.Metric
+	instance *matrix.Instance
+	beats    uint64
+}
+
+func newHeartbeat(collectorName, object string) *heartbeat {
+	data := matrix.New(collectorName+"."+object+".heartbeat", "harvest_collector", "harvest_collector")
+	exportOptions := node.NewS("export_options")
+	keys := exportOptions.NewChildS("instance_keys", "")
+	keys.NewChildS("", "collector")
+	keys.NewChildS("", "object")
+	keys.NewChildS("", "cluster")
+	data.SetExportOptions(exportOptions)
+	metric, _ := data.NewMetricUint64("heartbeat")
+	metric.SetProperty("raw")
+	instance, _ := data.NewInstance(object)
+	instance.SetLabel("collector", collectorName)
+	instance.SetLabel("object", object)
+	return &heartbeat{data: data, metric: metric, instance: instance}
+}
+
+// beat advances the heartbeat. The cluster of the global labels of the collected data is an instance label of the
+// heartbeat, the other global labels, e.g. datacenter, are carried as is.
+func (h *heartbeat) beat(globalLabels map[string]string) *matrix.Matrix {
+	h.beats++
+	labels := make(map[string]string, len(globalLabels))
+	for k, v := range globalLabels {
+		if k != "cluster" {
+			labels[k] = v
+		}
+	}
+	h.data.SetGlobalLabels(labels)
+	h.instance.SetLabel("cluster", globalLabels["cluster"])
+	_ = h.metric.SetValueUint64(h.instance, h.beats)
+	return h.data
+}
+
+// collectorProtocol returns the protocol a collector uses to talk to the cluster, "" when it is neither ZAPI nor REST
+func collectorProtocol(collectorName string) string {
+	switch collectorName {
+	case "Zapi", "ZapiPerf":
+		return "zapi"
+	case "Rest", "RestPerf", "Ems", "StorageGrid":
+		return "rest"
+	default:
+		return ""
+	}
+}
+
+// parseBounds reads the expected bounds of metrics, keyed by metric display name, e.g.
+//
+//	bounds:
+//	  power: [0, 20000]
+//	  max_temperature: [-20, 150]
+func parseBounds(n *node.Node, logger *logging.Logger) map[string]matrix.Bounds {
+	if n == nil {
+		return nil
+	}
+	bounds := make(map[string]matrix.Bounds)
+	for _, child := range n.GetChildren() {
+		values := child.GetAllChildContentS()
+		if len(values) != 2 {
+			logger.Warn().Str("metric", child.GetNameS()).Strs("bounds", values).Msg("bounds must be [min, max], ignoring")
+			continue
+		}
+		lo, err1 := strconv.ParseFloat(values[0], 64)
+		hi, err2 := strconv.ParseFloat(values[1], 64)
+		if err1 != nil || err2 != nil || lo > hi {
+			logger.Warn().Str("metric", child.GetNameS()).Strs("bounds", values).Msg("invalid bounds, ignoring")
+			continue
+		}
+		bounds[child.GetNameS()] = matrix.Bounds{Min: lo, Max: hi}
+	}
+	return bounds
+}
+
+// validateBounds sets the expected bounds on the metrics of results and logs the values outside them.
+// It returns the number of values out of bounds.
+func validateBounds(results []*matrix.Matrix, bounds map[string]matrix.Bounds, drop bool, logger *logging.Logger) int {
+	count := 0
+	for _, data := range results {
+		for _, metric := range data.GetMetrics() {
+			if b, ok := bounds[metric.GetName()]; ok {
+				metric.SetBounds(b.Min, b.Max)
+			}
+		}
+		for _, v := range data.ValidateBounds(drop) {
+			logger.Warn().
+				Str("object", data.Object).
+				Str("metric", v.Metric).
+				Str("instance", v.Instance).
+				Float64("value", v.Value).
+				Float64("min", v.Bounds.Min).
+				Float64("max", v.Bounds.Max).
+				Bool("dropped", drop).
+				Msg("value out of bounds")
+			count++
+		}
+	}
+	return count
+}
+
+// computedMetric is a metric computed from other metrics of the same instance, see matrix.Expr
+type computedMetric struct {
+	name string
+	expr *matrix.Expr
+}
+
+// parseComputedMetrics reads the metrics computed with an expression, e.g.
+//
+//	computed_metrics:
+//	  psu_efficiency: power_out / power_in
+//
+// Invalid expressions are logged and ignored.
+func parseComputedMetrics(n *node.Node, logger *logging.Logger) []computedMetric {
+	if n == nil {
+		return nil
+	}
+	var computed []computedMetric
+	for _, child := range n.GetChildren() {
+		expr, err := matrix.ParseExpr(child.GetContentS())
+		if err != nil {
+			logger.Warn().Err(err).Str("metric", child.GetNameS()).Msg("invalid computed metric, ignoring")
+			continue
+		}
+		computed = append(computed, computedMetric{name: child.GetNameS(), expr: expr})
+	}
+	return computed
+}
+
+// computeMetrics sets the computed metrics of the matrices that have all the metrics used by the expression.
+// Metrics are computed in order, so an expression can use the metrics computed before it.
+func computeMetrics(data map[string]*matrix.Matrix, computed []computedMetric, logger *logging.Logger) {
+	for _, mat := range data {
+		for _, c := range computed {
+			if _, ok := c.expr.Resolve(mat); !ok {
+				continue
+			}
+			if _, err := mat.ComputeMetric(c.name, c.expr.ComputeFunc(mat)); err != nil {
+				logger.Error().Err(err).Str("object", mat.Object).Str("metric", c.name).Msg("Unable to compute metric")
+			}
+		}
+	}
+}
+
+// parseExportEvery reads how often metrics are exported, in polls, e.g.
+//
+//	export_every:
+//	  average_ambient_temperature: 5
+//
+// It returns nil when no metric is decimated.
+func parseExportEvery(n *node.Node, logger *logging.Logger) *matrix.Decimator {
+	if n == nil {
+		return nil
+	}
+	every := make(map[string]int)
+	for _, child := range n.GetChildren() {
+		polls, err := strconv.Atoi(child.GetContentS())
+		if err != nil || polls < 1 {
+			logger.Warn().Str("metric", child.GetNameS()).Str("export_every", child.GetContentS()).Msg("invalid export_every, ignoring")
+			continue
+		}
+		every[child.GetNameS()] = polls
+	}
+	if len(every) == 0 {
+		return nil
+	}
+	return matrix.NewDecimator(every)
+}
+
+// ParseWarmup reads the warmup parameter of perf collectors. A number is a count of polls, e.g. 2,
+// anything else is a duration, e.g. 10m. An empty value disables the warmup and returns nil.
+func ParseWarmup(value string, start time.Time) (*matrix.Warmup, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if cycles, err := strconv.Atoi(value); err == nil && cycles >= 0 {
+		return matrix.NewWarmup(cycles, 0, start), nil
+	}
+	period, err := time.ParseDuration(value)
+	if err != nil || period < 0 {
+		return nil, errs.New(errs.ErrInvalidParam, "warmup "+value)
+	}
+	return matrix.NewWarmup(0, period, start), nil
+}
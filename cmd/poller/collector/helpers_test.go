@@ -3,8 +3,14 @@ package collector
 import (
 	"github.com/hashicorp/go-version"
 	"github.com/netapp/harvest/v2/pkg/conf"
+	"github.com/netapp/harvest/v2/pkg/logging"
+	"github.com/netapp/harvest/v2/pkg/matrix"
+	"github.com/netapp/harvest/v2/pkg/tree"
+	"math"
+	"slices"
 	"sort"
 	"testing"
+	"time"
 )
 
 func setupVersions(availableVersions []string) []*version.Version {
@@ -61,3 +67,272 @@ func Test_HARVEST_CONF(t *testing.T) {
 		t.Errorf("collectorName got=%s, want=Test", name)
 	}
 }
+
+func Test_setCycleTimestamp(t *testing.T) {
+	results := []*matrix.Matrix{
+		matrix.New("Zapi", "volume", "volume"),
+		matrix.New("Zapi.Volume", "volume_aggr", "volume_aggr"),
+	}
+	cycleStart := time.Now()
+	setCycleTimestamp(results, cycleStart)
+	for _, data := range results {
+		if got := data.GetTimestamp(); !got.Equal(cycleStart) {
+			t.Errorf("object=%s expected timestamp %v, got %v", data.Object, cycleStart, got)
+		}
+		if got := data.Clone(matrix.With{}).GetTimestamp(); !got.Equal(cycleStart) {
+			t.Errorf("object=%s clone expected timestamp %v, got %v", data.Object, cycleStart, got)
+		}
+	}
+}
+
+func Test_setExportNaNAsAbsent(t *testing.T) {
+	// the object matrix and the matrix of a plugin, e.g. Volume
+	results := []*matrix.Matrix{
+		matrix.New("ZapiPerf", "volume", "volume"),
+		matrix.New("ZapiPerf.Volume", "volume", "volume"),
+	}
+	setExportNaNAsAbsent(results)
+	for _, data := range results {
+		latency, _ := data.NewMetricFloat64("read_latency")
+		idle, _ := data.NewInstance("idle")
+		_ = latency.SetValueFloat64(idle, math.NaN())
+		if _, ok := data.ExportValueFloat64(latency, idle); ok {
+			t.Errorf("uuid=%s NaN exported", data.UUID)
+		}
+		if !data.Clone(matrix.With{}).ExportNaNAsAbsent() {
+			t.Errorf("uuid=%s clone exports NaN", data.UUID)
+		}
+	}
+}
+
+func Test_setSourceLabels(t *testing.T) {
+	tests := []struct {
+		collector    string
+		wantProtocol string
+	}{
+		{collector: "ZapiPerf", wantProtocol: "zapi"},
+		{collector: "Zapi", wantProtocol: "zapi"},
+		{collector: "Rest", wantProtocol: "rest"},
+		{collector: "RestPerf", wantProtocol: "rest"},
+		{collector: "Unix"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.collector, func(t *testing.T) {
+			// the object matrix and the matrix of a plugin, e.g. Sensor
+			results := []*matrix.Matrix{
+				matrix.New(tt.collector, "sensor", "sensor"),
+				matrix.New(tt.collector+".Sensor", "environment_sensor", "environment_sensor"),
+			}
+			setSourceLabels(results, tt.collector)
+			for _, data := range results {
+				labels := data.GetGlobalLabels()
+				if got := labels["collector"]; got != tt.collector {
+					t.Errorf("object=%s collector got=%s, want=%s", data.Object, got, tt.collector)
+				}
+				got, ok := labels["protocol"]
+				if got != tt.wantProtocol || ok != (tt.wantProtocol != "") {
+					t.Errorf("object=%s protocol got=%s, want=%s", data.Object, got, tt.wantProtocol)
+				}
+			}
+		})
+	}
+}
+
+func Test_validateBounds(t *testing.T) {
+	template, err := tree.LoadYaml([]byte(`
+bounds:
+  power: [0, 2000]
+  max_temperature: [-20, 150]
+  invalid: [10, 0]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bounds := parseBounds(template.GetChildS("bounds"), logging.Get())
+	if len(bounds) != 2 {
+		t.Fatalf("expected 2 bounds, got %d %v", len(bounds), bounds)
+	}
+
+	tests := []struct {
+		name     string
+		drop     bool
+		power    float64
+		temp     float64
+		count    int
+		recorded bool
+	}{
+		{name: "in range", power: 500, temp: 40, recorded: true},
+		{name: "out of range warn", power: -1, temp: 200, count: 2, recorded: true},
+		{name: "out of range drop", drop: true, power: 50000, temp: 40, count: 1, recorded: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := matrix.New("Zapi.Sensor", "environment_sensor", "environment_sensor")
+			power, _ := data.NewMetricFloat64("power")
+			temp, _ := data.NewMetricFloat64("max_temperature")
+			instance, _ := data.NewInstance("n1")
+			_ = power.SetValueFloat64(instance, tt.power)
+			_ = temp.SetValueFloat64(instance, tt.temp)
+
+			if got := validateBounds([]*matrix.Matrix{data}, bounds, tt.drop, logging.Get()); got != tt.count {
+				t.Errorf("out of bounds got=%d want=%d", got, tt.count)
+			}
+			if _, ok := power.GetValueFloat64(instance); ok != tt.recorded {
+				t.Errorf("power recorded got=%v want=%v", ok, tt.recorded)
+			}
+		})
+	}
+}
+
+func TestParseWarmup(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		value string
+		nil   bool
+		err   bool
+		// polls suppressed when polling every minute
+		suppressed int
+	}{
+		{value: "", nil: true},
+		{value: "2", suppressed: 2},
+		{value: "3m", suppressed: 3},
+		{value: "soon", err: true},
+		{value: "-1m", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			w, err := ParseWarmup(tt.value, start)
+			if (err != nil) != tt.err {
+				t.Fatalf("err got=%v want=%t", err, tt.err)
+			}
+			if tt.err {
+				return
+			}
+			if (w == nil) != tt.nil {
+				t.Fatalf("warmup got=%v want nil=%t", w, tt.nil)
+			}
+			if w == nil {
+				return
+			}
+			suppressed := 0
+			for i := 0; i < 10; i++ {
+				if w.Apply(matrix.New("uuid", "volume", "volume"), start.Add(time.Duration(i)*time.Minute)) {
+					suppressed++
+				}
+			}
+			if suppressed != tt.suppressed {
+				t.Errorf("suppressed got=%d want=%d", suppressed, tt.suppressed)
+			}
+		})
+	}
+}
+
+func Test_parseExportEvery(t *testing.T) {
+	template, err := tree.LoadYaml([]byte(`
+export_every:
+  average_ambient_temperature: 3
+  power: 1
+  max_temperature: never
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := parseExportEvery(nil, logging.Get()); d != nil {
+		t.Errorf("expected nil decimator without export_every")
+	}
+	d := parseExportEvery(template.GetChildS("export_every"), logging.Get())
+	if d == nil {
+		t.Fatal("expected a decimator")
+	}
+
+	data := matrix.New("Sensor", "environment_sensor", "environment_sensor")
+	for _, name := range []string{"average_ambient_temperature", "power", "max_temperature"} {
+		_, _ = data.NewMetricFloat64(name)
+	}
+	want := map[string][]bool{
+		"average_ambient_temperature": {true, false, false, true},
+		"power":                       {true, true, true, true},
+		// invalid interval is ignored
+		"max_temperature": {true, true, true, true},
+	}
+	for i := 0; i < 4; i++ {
+		got := d.Apply(data)
+		for name, exportable := range want {
+			if got.GetMetric(name).IsExportable() != exportable[i] {
+				t.Errorf("poll %d %s exportable got=%t want=%t", i, name, !exportable[i], exportable[i])
+			}
+		}
+	}
+}
+
+func Test_computeMetrics(t *testing.T) {
+	template, err := tree.LoadYaml([]byte(`
+computed_metrics:
+  psu_efficiency: power_out / power_in
+  psu_loss: power_in * (1 - psu_efficiency)
+  invalid: power_in /
+  other: iops / 2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	computed := parseComputedMetrics(template.GetChildS("computed_metrics"), logging.Get())
+	if len(computed) != 3 {
+		t.Fatalf("expected 3 computed metrics, got %d", len(computed))
+	}
+
+	data := matrix.New("Sensor", "psu", "psu")
+	in, _ := data.NewMetricFloat64("power_in")
+	out, _ := data.NewMetricFloat64("power_out")
+	a, _ := data.NewInstance("a")
+	_ = in.SetValueFloat64(a, 200)
+	_ = out.SetValueFloat64(a, 150)
+	b, _ := data.NewInstance("b")
+	_ = in.SetValueFloat64(b, 0)
+	_ = out.SetValueFloat64(b, 0)
+
+	computeMetrics(map[string]*matrix.Matrix{"psu": data}, computed, logging.Get())
+
+	if got, _ := data.GetMetric("psu_efficiency").GetValueFloat64(a); got != 0.75 {
+		t.Errorf("psu_efficiency got=%v want=0.75", got)
+	}
+	// computed metrics can use the metrics computed before them
+	if got, _ := data.GetMetric("psu_loss").GetValueFloat64(a); got != 50 {
+		t.Errorf("psu_loss got=%v want=50", got)
+	}
+	if got, _ := data.GetMetric("psu_efficiency").GetValueFloat64(b); !math.IsNaN(got) {
+		t.Errorf("psu_efficiency of b got=%v want=NaN", got)
+	}
+	// expressions over missing metrics are skipped
+	if data.GetMetric("other") != nil {
+		t.Errorf("expected other to be skipped, iops is missing")
+	}
+}
+
+func Test_heartbeat(t *testing.T) {
+	hb := newHeartbeat("ZapiPerf", "Volume")
+	labels := map[string]string{"datacenter": "dc1", "cluster": "c1"}
+	for want := uint64(1); want <= 3; want++ {
+		data := hb.beat(labels)
+		if data.Object != "harvest_collector" {
+			t.Errorf("object got=%s want=harvest_collector", data.Object)
+		}
+		instance := data.GetInstance("Volume")
+		if got, _ := data.GetMetric("heartbeat").GetValueUint64(instance); got != want {
+			t.Errorf("heartbeat got=%d want=%d", got, want)
+		}
+		if got := data.GetMetric("heartbeat").GetProperty(); got != "raw" {
+			t.Errorf("property got=%s want=raw", got)
+		}
+		if instance.GetLabel("collector") != "ZapiPerf" || instance.GetLabel("object") != "Volume" || instance.GetLabel("cluster") != "c1" {
+			t.Errorf("instance labels got=%v", instance.GetLabels())
+		}
+		if got := data.GetExportOptions().GetChildS("instance_keys").GetAllChildContentS(); !slices.Equal(got, []string{"collector", "object", "cluster"}) {
+			t.Errorf("instance keys got=%v", got)
+		}
+		// cluster is exported once, as instance label
+		if got := data.GetGlobalLabels(); got["cluster"] != "" || got["datacenter"] != "dc1" {
+			t.Errorf("global labels got=%v", got)
+		}
+	}
+}
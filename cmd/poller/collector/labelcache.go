@@ -0,0 +1,68 @@
+package collector
+
+import (
+	"github.com/netapp/harvest/v2/pkg/matrix"
+	"time"
+)
+
+// LabelCache keeps the slowly-changing instance labels of a collector, keyed by instance key (usually the UUID),
+// so polls in between two refreshes only need to fetch metric values.
+// The cache is refreshed by Update when the refresh interval expires. Callers should check Matches before
+// restoring, since a change in the instance set makes the cache stale.
+type LabelCache struct {
+	refresh   time.Duration
+	refreshed time.Time
+	labels    map[string]map[string]string
+}
+
+func NewLabelCache(refresh time.Duration) *LabelCache {
+	return &LabelCache{
+		refresh: refresh,
+		labels:  make(map[string]map[string]string),
+	}
+}
+
+// IsFresh returns true when the cache was updated within the refresh interval
+func (c *LabelCache) IsFresh(now time.Time) bool {
+	return !c.refreshed.IsZero() && now.Sub(c.refreshed) < c.refresh
+}
+
+// Update replaces the cached labels with the labels of the instances of mat
+func (c *LabelCache) Update(mat *matrix.Matrix, now time.Time) {
+	c.labels = make(map[string]map[string]string, len(mat.GetInstances()))
+	for key, instance := range mat.GetInstances() {
+		c.labels[key] = instance.Copy()
+	}
+	c.refreshed = now
+}
+
+// Matches returns true when keys are exactly the cached instance keys.
+// A mismatch invalidates the cache, so the next poll is a full refresh.
+func (c *LabelCache) Matches(keys []string) bool {
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if _, ok := c.labels[key]; !ok {
+			c.Invalidate()
+			return false
+		}
+		seen[key] = true
+	}
+	if len(seen) != len(c.labels) {
+		c.Invalidate()
+		return false
+	}
+	return true
+}
+
+// Restore sets the cached labels on the instances of mat
+func (c *LabelCache) Restore(mat *matrix.Matrix) {
+	for key, instance := range mat.GetInstances() {
+		for k, v := range c.labels[key] {
+			instance.SetLabel(k, v)
+		}
+	}
+}
+
+func (c *LabelCache) Invalidate() {
+	c.refreshed = time.Time{}
+}
@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"github.com/netapp/harvest/v2/pkg/matrix"
+	"testing"
+	"time"
+)
+
+func TestLabelCache(t *testing.T) {
+	now := time.Now()
+	mat := matrix.New("Volume", "volume", "volume")
+	for _, key := range []string{"uuid-1", "uuid-2"} {
+		instance, _ := mat.NewInstance(key)
+		instance.SetLabel("volume", "vol-"+key)
+		instance.SetLabel("svm", "svm1")
+	}
+
+	cache := NewLabelCache(10 * time.Minute)
+	if cache.IsFresh(now) {
+		t.Fatal("empty cache should not be fresh")
+	}
+	cache.Update(mat, now)
+	if !cache.IsFresh(now.Add(5 * time.Minute)) {
+		t.Error("cache should be fresh within the refresh interval")
+	}
+	if cache.IsFresh(now.Add(10 * time.Minute)) {
+		t.Error("cache should expire after the refresh interval")
+	}
+
+	// labels are cleared when only keys and metrics are polled
+	for _, instance := range mat.GetInstances() {
+		instance.ClearLabels()
+	}
+	if !cache.Matches([]string{"uuid-2", "uuid-1"}) {
+		t.Fatal("same instances should match")
+	}
+	cache.Restore(mat)
+	if got := mat.GetInstance("uuid-1").GetLabel("volume"); got != "vol-uuid-1" {
+		t.Errorf("restored volume label got=%s want=vol-uuid-1", got)
+	}
+	if got := mat.GetInstance("uuid-2").GetLabel("svm"); got != "svm1" {
+		t.Errorf("restored svm label got=%s want=svm1", got)
+	}
+
+	tests := []struct {
+		name string
+		keys []string
+	}{
+		{name: "instance added", keys: []string{"uuid-1", "uuid-2", "uuid-3"}},
+		{name: "instance removed", keys: []string{"uuid-1"}},
+		{name: "instance replaced", keys: []string{"uuid-1", "uuid-3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache.Update(mat, now)
+			if cache.Matches(tt.keys) {
+				t.Fatal("changed instances should not match")
+			}
+			if cache.IsFresh(now) {
+				t.Error("cache should be invalidated when instances change")
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"fmt"
+	"github.com/netapp/harvest/v2/pkg/errs"
+	"github.com/netapp/harvest/v2/pkg/tree/node"
+	"github.com/netapp/harvest/v2/pkg/util"
+	"sort"
+	"strings"
+)
+
+// MetricDef is a metric as defined by a collector template, before the first poll.
+// Property is the counter property set with override, Unit the type given in the template, e.g. duration in
+// last_transfer_duration(duration). Both are empty when the template does not set them.
+type MetricDef struct {
+	Name      string
+	Collector string
+	Template  string
+	Counter   string
+	Property  string
+	Unit      string
+}
+
+func (d MetricDef) String() string {
+	return fmt.Sprintf("%s:%s counter=%s property=%s unit=%s", d.Collector, d.Template, d.Counter, d.Property, d.Unit)
+}
+
+// Collision is an exported metric name that templates define with different semantics
+type Collision struct {
+	Name string
+	Defs []MetricDef
+}
+
+func (c Collision) String() string {
+	defs := make([]string, 0, len(c.Defs))
+	for _, d := range c.Defs {
+		defs = append(defs, d.String())
+	}
+	return c.Name + " defined as [" + strings.Join(defs, "], [") + "]"
+}
+
+// TemplateMetrics returns the metrics of a collector template whose exported name, <object>_<display name>, is known
+// before the first poll. These are the counters of flat lists and, for nested ZAPI templates, the renamed counters.
+// Metrics that plugins add at runtime are not included.
+func TemplateMetrics(class string, template *node.Node) []MetricDef {
+	counters := template.GetChildS("counters")
+	if counters == nil {
+		return nil
+	}
+	object := template.GetChildContentS("object")
+	override := template.GetChildS("override")
+
+	var defs []MetricDef
+	for _, leaf := range counters.Leaves() {
+		if len(leaf.Path) > 0 && (class != "Zapi" || !strings.Contains(leaf.Content, "=>")) {
+			continue
+		}
+		name, display, kind, metricType := util.ParseMetric(leaf.Content)
+		if kind != "float" || name == "" {
+			continue
+		}
+		var property string
+		if override != nil {
+			property = override.GetChildContentS(name)
+		}
+		defs = append(defs, MetricDef{
+			Name:      object + "_" + display,
+			Collector: class,
+			Template:  template.GetChildContentS("name"),
+			Counter:   name,
+			Property:  property,
+			Unit:      metricType,
+		})
+	}
+	return defs
+}
+
+// unitsDiffer reports whether two metric types export values with a different meaning. The type only tells the REST
+// collector how to parse a value: a duration is exported in seconds and a timestamp in seconds since the epoch,
+// the numbers that ZAPI and untyped REST counters return. A counter without type is therefore compatible with
+// any type, e.g. a ZAPI counter in seconds and a REST (duration) counter, and only two different types differ.
+func unitsDiffer(a, b string) bool {
+	return a != "" && b != "" && a != b
+}
+
+// FindCollisions returns, ordered by name, the exported names that are defined with different properties or types,
+// see unitsDiffer
+func FindCollisions(defs []MetricDef) []Collision {
+	byName := make(map[string][]MetricDef)
+	for _, d := range defs {
+		byName[d.Name] = append(byName[d.Name], d)
+	}
+
+	var collisions []Collision
+	for name, sameName := range byName {
+	sameNames:
+		for i, d := range sameName {
+			for _, other := range sameName[:i] {
+				if d.Property != other.Property || unitsDiffer(d.Unit, other.Unit) {
+					collisions = append(collisions, Collision{Name: name, Defs: sameName})
+					break sameNames
+				}
+			}
+		}
+	}
+	sort.Slice(collisions, func(i, j int) bool {
+		return collisions[i].Name < collisions[j].Name
+	})
+	return collisions
+}
+
+// CheckMetricCollisions returns an error listing every metric name that the templates of collectors export with
+// different semantics, since the values of such metrics would silently overwrite each other
+func CheckMetricCollisions(collectors []Collector) error {
+	var defs []MetricDef
+	for _, c := range collectors {
+		defs = append(defs, TemplateMetrics(c.GetName(), c.GetParams())...)
+	}
+	collisions := FindCollisions(defs)
+	if len(collisions) == 0 {
+		return nil
+	}
+	report := make([]string, 0, len(collisions))
+	for _, c := range collisions {
+		report = append(report, c.String())
+	}
+	return errs.New(errs.ErrConfig, "metric name collisions: "+strings.Join(report, "; "))
+}
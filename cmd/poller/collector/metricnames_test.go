@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"github.com/netapp/harvest/v2/pkg/tree"
+	"reflect"
+	"testing"
+)
+
+func TestTemplateMetrics(t *testing.T) {
+	restPerf, err := tree.LoadYaml([]byte(`
+name: Volume
+object: volume
+counters:
+  - ^^uuid
+  - ^name => volume
+  - read_ops
+  - total_write_ops => write_ops
+  - filter:
+      - is_constituent=*
+override:
+  - read_ops: rate
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []MetricDef{
+		{Name: "volume_read_ops", Collector: "RestPerf", Template: "Volume", Counter: "read_ops", Property: "rate"},
+		{Name: "volume_write_ops", Collector: "RestPerf", Template: "Volume", Counter: "total_write_ops"},
+	}
+	if got := TemplateMetrics("RestPerf", restPerf); !reflect.DeepEqual(got, want) {
+		t.Errorf("TemplateMetrics() got=%v want=%v", got, want)
+	}
+
+	zapi, err := tree.LoadYaml([]byte(`
+name: SnapMirror
+object: snapmirror
+counters:
+  snapmirror-info:
+    - ^^destination-volume
+    - lag-time
+    - last-transfer-duration(duration) => last_transfer_duration
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the display name of lag-time is only known once ZAPI returns it
+	want = []MetricDef{
+		{Name: "snapmirror_last_transfer_duration", Collector: "Zapi", Template: "SnapMirror", Counter: "last-transfer-duration", Unit: "duration"},
+	}
+	if got := TemplateMetrics("Zapi", zapi); !reflect.DeepEqual(got, want) {
+		t.Errorf("TemplateMetrics() got=%v want=%v", got, want)
+	}
+}
+
+func TestFindCollisions(t *testing.T) {
+	readOps := MetricDef{Name: "volume_read_ops", Collector: "RestPerf", Template: "Volume", Counter: "read_ops"}
+	sameOps := MetricDef{Name: "volume_read_ops", Collector: "Rest", Template: "VolumeOps", Counter: "statistics.iops_raw.read"}
+	rawOps := MetricDef{Name: "volume_read_ops", Collector: "Rest", Template: "VolumeRaw", Counter: "read_ops", Property: "raw"}
+	duration := MetricDef{Name: "volume_lag", Collector: "Rest", Template: "Volume", Counter: "lag", Unit: "duration"}
+	lag := MetricDef{Name: "volume_lag", Collector: "Zapi", Template: "Lag", Counter: "lag-time"}
+	timestamp := MetricDef{Name: "volume_lag", Collector: "Rest", Template: "LagTime", Counter: "lag_time", Unit: "timestamp"}
+
+	tests := []struct {
+		name string
+		defs []MetricDef
+		want []Collision
+	}{
+		{name: "no collision", defs: []MetricDef{readOps, duration}},
+		{name: "same semantics", defs: []MetricDef{readOps, sameOps}},
+		{name: "different property", defs: []MetricDef{readOps, rawOps},
+			want: []Collision{{Name: "volume_read_ops", Defs: []MetricDef{readOps, rawOps}}}},
+		// both export seconds
+		{name: "untyped and typed", defs: []MetricDef{lag, duration}},
+		{name: "different type", defs: []MetricDef{lag, duration, timestamp, readOps, rawOps},
+			want: []Collision{
+				{Name: "volume_lag", Defs: []MetricDef{lag, duration, timestamp}},
+				{Name: "volume_read_ops", Defs: []MetricDef{readOps, rawOps}},
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FindCollisions(tt.defs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindCollisions() got=%v want=%v", got, tt.want)
+			}
+		})
+	}
+
+	report := Collision{Name: "volume_read_ops", Defs: []MetricDef{readOps, rawOps}}.String()
+	want := "volume_read_ops defined as [RestPerf:Volume counter=read_ops property= unit=], [Rest:VolumeRaw counter=read_ops property=raw unit=]"
+	if report != want {
+		t.Errorf("report got=%s want=%s", report, want)
+	}
+}
@@ -9,6 +9,7 @@ functions.
 package exporter
 
 import (
+	"fmt"
 	"github.com/netapp/harvest/v2/cmd/poller/options"
 	"github.com/netapp/harvest/v2/pkg/conf"
 	"github.com/netapp/harvest/v2/pkg/logging"
@@ -29,6 +30,7 @@ type Exporter interface {
 	GetStatus() (uint8, string, string)   // return current state of the exporter
 	Export(*matrix.Matrix) (Stats, error) // render data in matrix to the desired format and emit
 	// this is the only function that should be implemented by "real" exporters
+	Relabel(*matrix.Matrix) *matrix.Matrix // apply the exporter's relabel_configs, called before Export
 }
 
 // status defines the possible states of an exporter
@@ -58,6 +60,7 @@ type AbstractExporter struct {
 	*sync.Mutex                // mutex to block exporter during export
 	exportCount uint64         // atomic
 	countMux    *sync.Mutex
+	relabel     []*matrix.RelabelRule
 }
 
 // New creates an AbstractExporter instance with the given arguments:
@@ -103,6 +106,14 @@ func (e *AbstractExporter) InitAbc() error {
 		return err
 	}
 
+	for i, c := range e.Params.RelabelConfigs {
+		rule, err := matrix.NewRelabelRule(c.Action, c.SourceLabels, c.Separator, c.Regex, c.TargetLabel, c.Replacement)
+		if err != nil {
+			return fmt.Errorf("relabel_configs[%d]: %w", i, err)
+		}
+		e.relabel = append(e.relabel, rule)
+	}
+
 	// e.Metadata.AddLabel("task", "")
 	if instance, err := e.Metadata.NewInstance("export"); err == nil {
 		instance.SetLabel("task", "export")
@@ -120,6 +131,11 @@ func (e *AbstractExporter) InitAbc() error {
 	return nil
 }
 
+// Relabel returns data with the relabel_configs of the exporter applied, data itself is not modified
+func (e *AbstractExporter) Relabel(data *matrix.Matrix) *matrix.Matrix {
+	return matrix.Relabel(data, e.relabel)
+}
+
 // GetClass returns the class of the AbstractExporter
 func (e *AbstractExporter) GetClass() string {
 	return e.Class
@@ -47,6 +47,11 @@ type Plugin interface {
 	Run(map[string]*matrix.Matrix) ([]*matrix.Matrix, error)
 }
 
+// Stopper is implemented by plugins that abort in-flight requests or release resources when their collector stops
+type Stopper interface {
+	Stop()
+}
+
 var (
 	modules   = make(map[string]ModuleInfo)
 	modulesMu sync.RWMutex
@@ -30,6 +30,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/netapp/harvest/v2/cmd/collectors"
 	_ "github.com/netapp/harvest/v2/cmd/collectors/ems"
 	_ "github.com/netapp/harvest/v2/cmd/collectors/restperf"
 	_ "github.com/netapp/harvest/v2/cmd/collectors/simple"
@@ -38,6 +39,7 @@ import (
 	_ "github.com/netapp/harvest/v2/cmd/collectors/zapi/collector"
 	_ "github.com/netapp/harvest/v2/cmd/collectors/zapiperf"
 	"github.com/netapp/harvest/v2/cmd/exporters/influxdb"
+	"github.com/netapp/harvest/v2/cmd/exporters/otlp"
 	"github.com/netapp/harvest/v2/cmd/exporters/prometheus"
 	"github.com/netapp/harvest/v2/cmd/harvest/version"
 	"github.com/netapp/harvest/v2/cmd/poller/collector"
@@ -59,7 +61,7 @@ import (
 	"io"
 	"math"
 	"net/http"
-	_ "net/http/pprof" // #nosec since pprof is off by default
+	"net/http/pprof" // #nosec since pprof is off by default
 	"os"
 	"os/exec"
 	"os/signal"
@@ -203,7 +205,7 @@ func (p *Poller) Init() error {
 		addr := fmt.Sprintf("localhost:%d", p.options.Profiling)
 		logger.Info().Msgf("profiling enabled on [%s]", addr)
 		go func() {
-			fmt.Println(http.ListenAndServe(addr, nil)) //nolint:gosec
+			fmt.Println(http.ListenAndServe(addr, debugMux())) //nolint:gosec
 		}()
 	}
 
@@ -301,6 +303,12 @@ func (p *Poller) Init() error {
 		logger.Error().Err(err).Msg("Failed to load collector")
 	}
 
+	// metrics that are exported under the same name with different semantics would corrupt each other
+	if err := collector.CheckMetricCollisions(p.collectors); err != nil {
+		logger.Error().Err(err).Msg("metric name collisions, stopping")
+		return err
+	}
+
 	// at least one collector should successfully initialize
 	if len(p.collectors) == 0 {
 		logger.Warn().Msg("no collectors initialized, stopping")
@@ -425,6 +433,18 @@ func (p *Poller) Start() {
 	p.Stop()
 }
 
+// debugMux serves pprof and the diagnostics of collectors and plugins on the profiling port
+func debugMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/sensor", collectors.ServeExplainSensor)
+	return mux
+}
+
 // Run will periodically check the status of collectors/exporters,
 // report metadata and do some housekeeping
 func (p *Poller) Run() {
@@ -538,6 +558,9 @@ func (p *Poller) Run() {
 // Stop gracefully exits the program by closing zeroLog
 func (p *Poller) Stop() {
 	logger.Info().Msgf("cleaning up and stopping [pid=%d]", os.Getpid())
+	for _, col := range p.collectors {
+		col.Stop()
+	}
 }
 
 // set up signal disposition
@@ -597,6 +620,7 @@ func (p *Poller) readObjects(c conf.Collector) ([]objectCollector, error) {
 	// load the template file(s) of the collector where we expect to find
 	// object name or list of objects
 	if c.Templates != nil {
+		var layers []*node.Node
 		for _, t := range *c.Templates {
 			if subTemplate, err = collector.ImportTemplate(p.options.ConfPaths, t, class); err != nil {
 				logEvent := logger.Warn() //nolint:zerologlint
@@ -612,18 +636,15 @@ func (p *Poller) readObjects(c conf.Collector) ([]objectCollector, error) {
 					Msg("Unable to load template.")
 				continue
 			}
-			if template == nil {
-				template = subTemplate
-			} else {
-				logger.Debug().Str("template", t).Msg("Merged template.")
-				if c.Name == "Zapi" || c.Name == "ZapiPerf" {
-					// Do not overwrite child of objects. They will be concatenated
-					template.Merge(subTemplate, []string{"objects"})
-				} else {
-					template.Merge(subTemplate, []string{""})
-				}
-			}
+			logger.Debug().Str("template", t).Msg("Loaded template.")
+			layers = append(layers, subTemplate)
+		}
+		skipOverwrite := []string{""}
+		if c.Name == "Zapi" || c.Name == "ZapiPerf" {
+			// Do not overwrite child of objects. They will be concatenated
+			skipOverwrite = []string{"objects"}
 		}
+		template = node.MergeAll(nil, layers, skipOverwrite)
 	}
 	if template == nil {
 		return nil, fmt.Errorf("no templates loaded for %s", c.Name)
@@ -671,6 +692,8 @@ func (p *Poller) loadCollectorObject(ocs []objectCollector) error {
 	for _, oc := range ocs {
 		col, err := p.newCollector(oc.class, oc.object, oc.template)
 		if err != nil {
+			// the target is unreachable, e.g. a ZAPI or REST request timed out, the remaining objects of the
+			// collector would time out as well
 			if errors.Is(err, errs.ErrConnection) {
 				logger.Warn().Err(err).
 					Str("collector", oc.class).
@@ -885,6 +908,8 @@ func (p *Poller) loadExporter(name string) exporter.Exporter {
 		exp = prometheus.New(absExp)
 	case "InfluxDB":
 		exp = influxdb.New(absExp)
+	case "OTLP":
+		exp = otlp.New(absExp)
 	default:
 		logger.Error().Msgf("no exporter of name:type %s:%s", name, class)
 		return nil
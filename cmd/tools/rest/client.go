@@ -4,6 +4,7 @@ package rest
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/netapp/harvest/v2/pkg/auth"
@@ -20,6 +21,7 @@ import (
 	"net/http/httputil"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -34,17 +36,23 @@ const (
 )
 
 type Client struct {
-	client  *http.Client
-	request *http.Request
-	buffer  *bytes.Buffer
-	Logger  *logging.Logger
-	baseURL string
-	cluster Cluster
-	Timeout time.Duration
-	logRest bool // used to log Rest request/response
-	auth    *auth.Credentials
+	client   *http.Client
+	buffer   *bytes.Buffer
+	Logger   *logging.Logger
+	baseURLs []string     // one per management LIF, in order of preference
+	lastGood atomic.Int32 // index of the baseURL of the last successful request
+	cluster  Cluster
+	Timeout  time.Duration
+	logRest  bool // used to log Rest request/response
+	auth     *auth.Credentials
+	// transient failures are retried, see WithRetry
+	maxAttempts int
+	retryDelay  time.Duration
 }
 
+// DefaultRetryDelay is the delay before the first retry when rest_max_attempts is set without rest_retry_delay
+const DefaultRetryDelay = time.Second
+
 type Cluster struct {
 	Name    string
 	Info    string
@@ -58,7 +66,7 @@ func New(poller *conf.Poller, timeout time.Duration, auth *auth.Credentials) (*C
 		httpclient *http.Client
 		transport  *http.Transport
 		addr       string
-		url        string
+		port       string
 		err        error
 	)
 
@@ -72,11 +80,12 @@ func New(poller *conf.Poller, timeout time.Duration, auth *auth.Credentials) (*C
 	}
 
 	if poller.IsKfs {
-		url = "https://" + addr + ":8443/"
-	} else {
-		url = "https://" + addr + "/"
+		port = ":8443"
+	}
+	// addr is preferred, the alternate management LIFs are tried in order when it is unreachable
+	for _, a := range append([]string{addr}, poller.AltAddrs...) {
+		client.baseURLs = append(client.baseURLs, "https://"+a+port+"/")
 	}
-	client.baseURL = url
 	client.Timeout = timeout
 
 	transport, err = auth.Transport(nil)
@@ -87,9 +96,60 @@ func New(poller *conf.Poller, timeout time.Duration, auth *auth.Credentials) (*C
 	httpclient = &http.Client{Transport: transport, Timeout: timeout}
 	client.client = httpclient
 
+	if poller.RestMaxAttempts > 1 {
+		retryDelay := DefaultRetryDelay
+		if poller.RestRetryDelay != "" {
+			if retryDelay, err = time.ParseDuration(poller.RestRetryDelay); err != nil {
+				return nil, errs.New(errs.ErrInvalidParam, "rest_retry_delay: "+err.Error())
+			}
+		}
+		client.WithRetry(poller.RestMaxAttempts, retryDelay)
+	}
+
 	return &client, nil
 }
 
+// WithRetry makes the client retry GET requests that fail with a 5xx status code or a network error.
+// A request is made at most maxAttempts times, the delay before the first retry is baseDelay and doubles
+// after each retry. Retries are made against the same management LIF before failing over to the next one
+func (c *Client) WithRetry(maxAttempts int, baseDelay time.Duration) *Client {
+	c.maxAttempts = max(1, maxAttempts)
+	c.retryDelay = baseDelay
+	return c
+}
+
+// isTransient returns true for errors that may succeed when the request is retried
+func isTransient(err error) bool {
+	if errors.Is(err, errs.ErrConnection) {
+		return true
+	}
+	var restErr *errs.RestError
+	return errors.As(err, &restErr) && restErr.StatusCode >= http.StatusInternalServerError
+}
+
+// invokeWithRetry calls invokeWithAuthRetry and retries transient failures, see WithRetry
+func (c *Client) invokeWithRetry(ctx context.Context, req *http.Request) ([]byte, error) {
+	delay := c.retryDelay
+	for attempt := 1; ; attempt++ {
+		result, err := c.invokeWithAuthRetry(req.WithContext(ctx))
+		if err == nil || attempt >= c.maxAttempts || req.Method != http.MethodGet || !isTransient(err) || ctx.Err() != nil {
+			return result, err
+		}
+		c.Logger.Debug().
+			Err(err).
+			Int("attempt", attempt).
+			Dur("delay", delay).
+			Str("api", util.GetURLWithoutHost(req)).
+			Msg("Retrying transient REST failure")
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
 func (c *Client) TraceLogSet(collectorName string, config *node.Node) {
 	// check for log sets and enable Rest request logging if collectorName is in the set
 	if llogs := config.GetChildS("log"); llogs != nil {
@@ -110,8 +170,15 @@ func (c *Client) printRequestAndResponse(req string, response []byte) {
 	}
 }
 
-// GetRest makes a REST request to the cluster and returns a json response as a []byte
+// GetRest makes a REST request to the cluster and returns a json response as a []byte.
+// GetRest is safe to call from multiple goroutines.
 func (c *Client) GetRest(request string) ([]byte, error) {
+	return c.GetRestContext(context.Background(), request)
+}
+
+// GetRestContext is GetRest with a context. The request is aborted when ctx is cancelled or its deadline expires,
+// in which case the error is ctx.Err() and no other management LIF is tried
+func (c *Client) GetRestContext(ctx context.Context, request string) ([]byte, error) {
 	var err error
 	if strings.Index(request, "/") == 0 {
 		request = request[1:]
@@ -120,30 +187,64 @@ func (c *Client) GetRest(request string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	u := c.baseURL + request
-	c.request, err = requests.New("GET", u, nil)
+
+	// start with the management LIF that answered last and fail over to the next one when it is unreachable.
+	// Since each request targets the LIF's address, TLS verifies the certificate against that address.
+	var result []byte
+	start := int(c.lastGood.Load())
+	for i := range c.baseURLs {
+		index := (start + i) % len(c.baseURLs)
+		req, err := c.newRequest(c.baseURLs[index] + request)
+		if err != nil {
+			return nil, err
+		}
+		result, err = c.invokeWithRetry(ctx, req)
+		if err == nil {
+			c.lastGood.Store(int32(index))
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !errors.Is(err, errs.ErrConnection) || i == len(c.baseURLs)-1 {
+			return nil, err
+		}
+		c.Logger.Warn().
+			Err(err).
+			Str("failed", c.baseURLs[index]).
+			Str("next", c.baseURLs[(index+1)%len(c.baseURLs)]).
+			Msg("Management LIF unreachable, failing over")
+	}
+	return result, err
+}
+
+func (c *Client) newRequest(u string) (*http.Request, error) {
+	req, err := requests.New("GET", u, nil)
 	if err != nil {
 		return nil, err
 	}
-	c.request.Header.Set("accept", "application/json")
+	req.Header.Set("accept", "application/json")
 	pollerAuth, err := c.auth.GetPollerAuth()
 	if err != nil {
 		return nil, err
 	}
 	if pollerAuth.Username != "" {
-		c.request.SetBasicAuth(pollerAuth.Username, pollerAuth.Password)
+		req.SetBasicAuth(pollerAuth.Username, pollerAuth.Password)
 	}
 	// ensure that we can change body dynamically
-	c.request.GetBody = func() (io.ReadCloser, error) {
+	req.GetBody = func() (io.ReadCloser, error) {
 		r := bytes.NewReader(c.buffer.Bytes())
 		return io.NopCloser(r), nil
 	}
+	return req, nil
+}
 
-	result, err := c.invokeWithAuthRetry()
-	return result, err
+// baseURL returns the URL of the management LIF that answered last
+func (c *Client) baseURL() string {
+	return c.baseURLs[c.lastGood.Load()]
 }
 
-func (c *Client) invokeWithAuthRetry() ([]byte, error) {
+func (c *Client) invokeWithAuthRetry(req *http.Request) ([]byte, error) {
 	var (
 		body []byte
 		err  error
@@ -156,7 +257,7 @@ func (c *Client) invokeWithAuthRetry() ([]byte, error) {
 			innerErr  error
 		)
 
-		if c.request.Body != nil {
+		if req.Body != nil {
 			//goland:noinspection GoUnhandledErrorResult
 			defer response.Body.Close()
 		}
@@ -164,12 +265,12 @@ func (c *Client) invokeWithAuthRetry() ([]byte, error) {
 			defer c.buffer.Reset()
 		}
 
-		restReq := c.request.URL.String()
-		api := util.GetURLWithoutHost(c.request)
+		restReq := req.URL.String()
+		api := util.GetURLWithoutHost(req)
 
 		// send request to server
-		if response, innerErr = c.client.Do(c.request); innerErr != nil {
-			return nil, fmt.Errorf("connection error %w", innerErr)
+		if response, innerErr = c.client.Do(req); innerErr != nil {
+			return nil, fmt.Errorf("%w: %w", errs.ErrConnection, innerErr)
 		}
 		//goland:noinspection GoUnhandledErrorResult
 		defer response.Body.Close()
@@ -247,7 +348,7 @@ func (c *Client) invokeWithAuthRetry() ([]byte, error) {
 					if err2 != nil {
 						return nil, err2
 					}
-					c.request.SetBasicAuth(pollerAuth2.Username, pollerAuth2.Password)
+					req.SetBasicAuth(pollerAuth2.Username, pollerAuth2.Password)
 					return doInvoke()
 				}
 			}
@@ -1,6 +1,7 @@
 package rest
 
 import (
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -35,11 +36,24 @@ func (b *HrefBuilder) CounterSchema(counterSchema []string) *HrefBuilder {
 	return b
 }
 
+// Filter sets the filters of the query, e.g. type=psu. Each filter is a separate query parameter
+// and ONTAP returns the records that match all of them. Filter replaces filters added before it
 func (b *HrefBuilder) Filter(filter []string) *HrefBuilder {
 	b.filter = filter
 	return b
 }
 
+// OrFilter adds a filter matching records whose field equals any of values, using the ONTAP | syntax,
+// e.g. OrFilter("type", "psu", "pcm") adds type=psu|pcm. Like the filters of Filter, it is ANDed with
+// the other filters, so call it after Filter. OrFilter does nothing without values
+func (b *HrefBuilder) OrFilter(field string, values ...string) *HrefBuilder {
+	if len(values) == 0 {
+		return b
+	}
+	b.filter = append(slices.Clone(b.filter), field+"="+strings.Join(values, "|"))
+	return b
+}
+
 func (b *HrefBuilder) QueryFields(queryFields string) *HrefBuilder {
 	b.queryFields = queryFields
 	return b
@@ -50,6 +64,8 @@ func (b *HrefBuilder) QueryValue(queryValue string) *HrefBuilder {
 	return b
 }
 
+// MaxRecords sets max_records. Fetch returns at most maxRecords records,
+// FetchAll uses it as the page size and collects all records
 func (b *HrefBuilder) MaxRecords(maxRecords *int) *HrefBuilder {
 	b.maxRecords = maxRecords
 	return b
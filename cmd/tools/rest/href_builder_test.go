@@ -0,0 +1,59 @@
+package rest
+
+import (
+	"testing"
+)
+
+func TestHrefBuilder_OrFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *HrefBuilder
+		want    string
+	}{
+		{
+			name:    "or",
+			builder: NewHrefBuilder().APIPath("private/cli/system/chassis/fru").OrFilter("type", "psu", "pcm"),
+			want:    "api/private/cli/system/chassis/fru?return_records=true&type=psu|pcm",
+		},
+		{
+			name: "and with or",
+			builder: NewHrefBuilder().APIPath("private/cli/system/chassis/fru").
+				Filter([]string{"node=a"}).
+				OrFilter("type", "psu", "pcm").
+				OrFilter("status", "ok", "degraded"),
+			want: "api/private/cli/system/chassis/fru?return_records=true&node=a&type=psu|pcm&status=ok|degraded",
+		},
+		{
+			name:    "single value",
+			builder: NewHrefBuilder().APIPath("private/cli/system/chassis/fru").OrFilter("type", "psu"),
+			want:    "api/private/cli/system/chassis/fru?return_records=true&type=psu",
+		},
+		{
+			name:    "no values",
+			builder: NewHrefBuilder().APIPath("private/cli/system/chassis/fru").OrFilter("type"),
+			want:    "api/private/cli/system/chassis/fru?return_records=true",
+		},
+		{
+			name: "filter replaces",
+			builder: NewHrefBuilder().APIPath("private/cli/system/chassis/fru").
+				OrFilter("type", "psu", "pcm").
+				Filter([]string{"node=a"}),
+			want: "api/private/cli/system/chassis/fru?return_records=true&node=a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.builder.Build(); got != tt.want {
+				t.Errorf("Build() got=%s want=%s", got, tt.want)
+			}
+		})
+	}
+
+	// OrFilter does not modify the slice passed to Filter
+	filter := make([]string, 1, 2)
+	filter[0] = "node=a"
+	NewHrefBuilder().Filter(filter).OrFilter("type", "psu", "pcm")
+	if got := filter[:2][1]; got != "" {
+		t.Errorf("expected the caller's filter to be unchanged, got %s", got)
+	}
+}
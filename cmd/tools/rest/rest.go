@@ -3,6 +3,7 @@
 package rest
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -21,6 +22,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -345,7 +347,7 @@ func FetchForCli(client *Client, href string, records *[]any, downloadAll bool,
 	if err != nil {
 		return err
 	}
-	*curls = append(*curls, fmt.Sprintf("curl --user %s --insecure '%s%s'", pollerAuth.Username, client.baseURL, href))
+	*curls = append(*curls, fmt.Sprintf("curl --user %s --insecure '%s%s'", pollerAuth.Username, client.baseURL(), href))
 
 	isNonIterRestCall := false
 	value := gjson.GetBytes(getRest, "records")
@@ -397,6 +399,11 @@ func FetchForCli(client *Client, href string, records *[]any, downloadAll bool,
 
 // Fetch collects all records
 func Fetch(client *Client, href string) ([]gjson.Result, error) {
+	return FetchContext(context.Background(), client, href)
+}
+
+// FetchContext is Fetch with a context, it stops and returns ctx.Err() when ctx is cancelled or its deadline expires
+func FetchContext(ctx context.Context, client *Client, href string) ([]gjson.Result, error) {
 	var (
 		records []gjson.Result
 		result  []gjson.Result
@@ -418,7 +425,7 @@ func Fetch(client *Client, href string) ([]gjson.Result, error) {
 			downloadAll = maxRecords == 0
 		}
 	}
-	err = fetch(client, href, &records, downloadAll, int64(maxRecords))
+	err = fetch(ctx, client, href, &records, downloadAll, int64(maxRecords))
 	if err != nil {
 		return nil, err
 	}
@@ -428,6 +435,61 @@ func Fetch(client *Client, href string) ([]gjson.Result, error) {
 	return result, nil
 }
 
+// FetchAll collects all records by following the next link of every page. Unlike Fetch, max_records in href
+// is the page size, not a limit on the number of records, see HrefBuilder.MaxRecords
+func FetchAll(client *Client, href string) ([]gjson.Result, error) {
+	return FetchAllContext(context.Background(), client, href)
+}
+
+// FetchAllContext is FetchAll with a context, see FetchContext
+func FetchAllContext(ctx context.Context, client *Client, href string) ([]gjson.Result, error) {
+	var (
+		records []gjson.Result
+		result  []gjson.Result
+	)
+	if err := fetch(ctx, client, href, &records, true, 0); err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		result = append(result, r.Array()...)
+	}
+	return result, nil
+}
+
+// FetchConcurrent fetches each href with Fetch, with at most concurrency hrefs in flight, and returns
+// the records in href order. A concurrency of one or less fetches the hrefs sequentially.
+//
+// ONTAP pagination is continuation based: the next link of a page is only known after the page is read,
+// so the pages of a single query are always fetched sequentially. Concurrency only helps when a query
+// can be split into independent queries, e.g. one filtered query per node or SVM.
+func FetchConcurrent(client *Client, hrefs []string, concurrency int) ([]gjson.Result, error) {
+	concurrency = max(1, min(concurrency, len(hrefs)))
+	pages := make([][]gjson.Result, len(hrefs))
+	fetchErrs := make([]error, len(hrefs))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i, href := range hrefs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, href string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			pages[i], fetchErrs[i] = Fetch(client, href)
+		}(i, href)
+	}
+	wg.Wait()
+
+	var result []gjson.Result
+	for i, page := range pages {
+		if fetchErrs[i] != nil {
+			return nil, fmt.Errorf("failed to fetch href=%s %w", hrefs[i], fetchErrs[i])
+		}
+		result = append(result, page...)
+	}
+	return result, nil
+}
+
 func FetchAnalytics(client *Client, href string) ([]gjson.Result, gjson.Result, error) {
 	var (
 		records   []gjson.Result
@@ -466,9 +528,12 @@ func FetchAnalytics(client *Client, href string) ([]gjson.Result, gjson.Result,
 	return result, *analytics, nil
 }
 
-func fetch(client *Client, href string, records *[]gjson.Result, downloadAll bool, maxRecords int64) error {
-	getRest, err := client.GetRest(href)
+func fetch(ctx context.Context, client *Client, href string, records *[]gjson.Result, downloadAll bool, maxRecords int64) error {
+	getRest, err := client.GetRestContext(ctx, href)
 	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
 		return fmt.Errorf("error making request %w", err)
 	}
 
@@ -505,7 +570,7 @@ func fetch(client *Client, href string, records *[]gjson.Result, downloadAll boo
 					// nextLink is same as previous link, no progress is being made, exit
 					return nil
 				}
-				err := fetch(client, nextLink, records, downloadAll, maxRecords)
+				err := fetch(ctx, client, nextLink, records, downloadAll, maxRecords)
 				if err != nil {
 					return err
 				}
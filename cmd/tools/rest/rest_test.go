@@ -0,0 +1,325 @@
+package rest
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/netapp/harvest/v2/pkg/auth"
+	"github.com/netapp/harvest/v2/pkg/conf"
+	"github.com/netapp/harvest/v2/pkg/errs"
+	"github.com/netapp/harvest/v2/pkg/logging"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newPagedServer serves three pages of two records for every node filter.
+// Each page links to the next one like ONTAP does.
+func newPagedServer(inFlight, maxInFlight *int32) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(inFlight, 1)
+		defer atomic.AddInt32(inFlight, -1)
+		for {
+			m := atomic.LoadInt32(maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(maxInFlight, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		nodeName := r.URL.Query().Get("node.name")
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		next := ""
+		if page < 2 {
+			next = fmt.Sprintf(`,"_links":{"next":{"href":"api/storage/disks?node.name=%s&page=%d"}}`, nodeName, page+1)
+		}
+		_, _ = fmt.Fprintf(w, `{"records":[{"name":"%[1]s-%[2]d-a"},{"name":"%[1]s-%[2]d-b"}],"num_records":2%[3]s}`, nodeName, page, next)
+	}))
+}
+
+func TestFetchConcurrent(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := newPagedServer(&inFlight, &maxInFlight)
+	defer server.Close()
+
+	insecure := true
+	poller := &conf.Poller{
+		Addr:           strings.TrimPrefix(server.URL, "https://"),
+		Username:       "admin",
+		Password:       "password",
+		UseInsecureTLS: &insecure,
+	}
+	client, err := New(poller, 5*time.Second, auth.NewCredentials(poller, logging.Get()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodes := []string{"node1", "node2", "node3", "node4"}
+	hrefs := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		hrefs = append(hrefs, "api/storage/disks?node.name="+n)
+	}
+
+	for _, concurrency := range []int{1, 3} {
+		t.Run(fmt.Sprintf("concurrency %d", concurrency), func(t *testing.T) {
+			atomic.StoreInt32(&maxInFlight, 0)
+
+			records, err := FetchConcurrent(client, hrefs, concurrency)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(records) != len(nodes)*6 {
+				t.Fatalf("expected %d records, got %d", len(nodes)*6, len(records))
+			}
+			// records are reassembled in href and page order
+			i := 0
+			for _, n := range nodes {
+				for page := 0; page < 3; page++ {
+					for _, suffix := range []string{"a", "b"} {
+						want := fmt.Sprintf("%s-%d-%s", n, page, suffix)
+						if got := records[i].Get("name").String(); got != want {
+							t.Errorf("record %d expected %s, got %s", i, want, got)
+						}
+						i++
+					}
+				}
+			}
+			if got := int(atomic.LoadInt32(&maxInFlight)); got > concurrency {
+				t.Errorf("expected at most %d requests in flight, got %d", concurrency, got)
+			}
+			if concurrency > 1 && atomic.LoadInt32(&maxInFlight) < 2 {
+				t.Errorf("expected concurrent requests, got %d in flight", maxInFlight)
+			}
+		})
+	}
+}
+
+func TestGetRestFailover(t *testing.T) {
+	var requests int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		_, _ = fmt.Fprint(w, `{"name":"cluster1"}`)
+	}))
+	defer server.Close()
+
+	// the first LIF refuses connections
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := listener.Addr().String()
+	_ = listener.Close()
+
+	insecure := false
+	poller := &conf.Poller{
+		Addr:           down,
+		AltAddrs:       []string{strings.TrimPrefix(server.URL, "https://")},
+		Username:       "admin",
+		Password:       "password",
+		UseInsecureTLS: &insecure,
+	}
+	client, err := New(poller, 5*time.Second, auth.NewCredentials(poller, logging.Get()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// verify the certificate of the second LIF against its address
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	client.client.Transport.(*http.Transport).TLSClientConfig.RootCAs = pool
+
+	for i := 0; i < 2; i++ {
+		content, err := client.GetRest("api/cluster")
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		if string(content) != `{"name":"cluster1"}` {
+			t.Errorf("request %d: unexpected response %s", i, content)
+		}
+		if got := client.baseURL(); got != server.URL+"/" {
+			t.Errorf("request %d: expected last good LIF %s, got %s", i, server.URL, got)
+		}
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("expected 2 requests, got %d", got)
+	}
+}
+
+func TestGetRestAllLIFsDown(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := listener.Addr().String()
+	_ = listener.Close()
+
+	poller := &conf.Poller{
+		Addr:     down,
+		AltAddrs: []string{down},
+		Username: "admin",
+		Password: "password",
+	}
+	client, err := New(poller, 5*time.Second, auth.NewCredentials(poller, logging.Get()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.GetRest("api/cluster"); !errors.Is(err, errs.ErrConnection) {
+		t.Errorf("expected a connection error, got %v", err)
+	}
+}
+
+func TestFetchAll(t *testing.T) {
+	var pages []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pages = append(pages, r.URL.Query().Get("max_records"))
+		if r.URL.Query().Get("start") == "" {
+			_, _ = fmt.Fprint(w, `{"records":[{"name":"psu1"},{"name":"psu2"}],"num_records":2,`+
+				`"_links":{"next":{"href":"api/private/cli/system/chassis/fru?max_records=2&start=2"}}}`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"records":[{"name":"psu3"},{"name":"psu4"}],"num_records":2}`)
+	}))
+	defer server.Close()
+
+	insecure := true
+	poller := &conf.Poller{
+		Addr:           strings.TrimPrefix(server.URL, "https://"),
+		Username:       "admin",
+		Password:       "password",
+		UseInsecureTLS: &insecure,
+	}
+	client, err := New(poller, 5*time.Second, auth.NewCredentials(poller, logging.Get()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pageSize := 2
+	href := NewHrefBuilder().APIPath("api/private/cli/system/chassis/fru").MaxRecords(&pageSize).Build()
+	records, err := FetchAll(client, href)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range records {
+		names = append(names, r.Get("name").String())
+	}
+	if want := "psu1,psu2,psu3,psu4"; strings.Join(names, ",") != want {
+		t.Errorf("expected records %s, got %s", want, strings.Join(names, ","))
+	}
+	if want := "2,2"; strings.Join(pages, ",") != want {
+		t.Errorf("expected max_records per page %s, got %s", want, strings.Join(pages, ","))
+	}
+
+	// Fetch treats max_records as a limit and stops after the first page
+	if records, err = Fetch(client, href); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Errorf("expected Fetch to return 2 records, got %d", len(records))
+	}
+}
+
+func TestFetchContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-release
+		_, _ = fmt.Fprint(w, `{"records":[],"num_records":0}`)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	insecure := true
+	poller := &conf.Poller{
+		Addr:           strings.TrimPrefix(server.URL, "https://"),
+		Username:       "admin",
+		Password:       "password",
+		UseInsecureTLS: &insecure,
+	}
+	client, err := New(poller, 5*time.Second, auth.NewCredentials(poller, logging.Get()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := FetchContext(ctx, client, "api/storage/disks"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the deadline to abort the request, took %s", elapsed)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := FetchAllContext(cancelled, client, "api/storage/disks"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var requests, failures, status int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			w.WriteHeader(int(atomic.LoadInt32(&status)))
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"records":[{"name":"psu1"}],"num_records":1}`)
+	}))
+	defer server.Close()
+
+	insecure := true
+	poller := &conf.Poller{
+		Addr:            strings.TrimPrefix(server.URL, "https://"),
+		Username:        "admin",
+		Password:        "password",
+		UseInsecureTLS:  &insecure,
+		RestMaxAttempts: 3,
+		RestRetryDelay:  "1ms",
+	}
+	client, err := New(poller, 5*time.Second, auth.NewCredentials(poller, logging.Get()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		status       int
+		failures     int32
+		wantErr      bool
+		wantRequests int32
+	}{
+		{name: "recovers", status: http.StatusServiceUnavailable, failures: 2, wantRequests: 3},
+		{name: "gives up", status: http.StatusInternalServerError, failures: 3, wantErr: true, wantRequests: 3},
+		{name: "client error", status: http.StatusNotFound, failures: 1, wantErr: true, wantRequests: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&status, int32(tt.status))
+			atomic.StoreInt32(&requests, 0)
+			atomic.StoreInt32(&failures, tt.failures)
+			records, err := Fetch(client, "api/private/cli/system/chassis/fru")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error=%v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && len(records) != 1 {
+				t.Errorf("expected 1 record, got %d", len(records))
+			}
+			if got := atomic.LoadInt32(&requests); got != tt.wantRequests {
+				t.Errorf("expected %d requests, got %d", tt.wantRequests, got)
+			}
+		})
+	}
+
+	poller.RestRetryDelay = "soon"
+	if _, err := New(poller, 5*time.Second, auth.NewCredentials(poller, logging.Get())); err == nil {
+		t.Errorf("expected an error for an invalid rest_retry_delay")
+	}
+}
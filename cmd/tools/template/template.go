@@ -339,6 +339,9 @@ func readLabelAgent(template *node.Node, model *Model) error {
 
 var setRe = regexp.MustCompile(`[sS]etLabel\("?(\w+)"?,`)
 
+// setPreservingRe matches the label keeping the original value, e.g. SetLabelPreserving("speed", bps, "speed_original")
+var setPreservingRe = regexp.MustCompile(`SetLabelPreserving\("?(\w+)"?,.*,\s*"(\w+)"\)`)
+
 func findCustomPlugins(path string, template *node.Node, model *Model) error {
 	plug := template.SearchChildren([]string{"plugins"})
 	if len(plug) == 0 {
@@ -416,6 +419,9 @@ func readPlugin(fileName string, model *Model) error {
 		if len(matches) == 2 {
 			model.pluginLabels = append(model.pluginLabels, matches[1])
 		}
+		if matches = setPreservingRe.FindStringSubmatch(trimmed); len(matches) == 3 {
+			model.pluginLabels = append(model.pluginLabels, matches[1], matches[2])
+		}
 	}
 	_ = file.Close()
 	return nil
@@ -0,0 +1,145 @@
+package template
+
+import (
+	"fmt"
+	"github.com/netapp/harvest/v2/pkg/tree"
+	"github.com/netapp/harvest/v2/pkg/tree/node"
+	"github.com/netapp/harvest/v2/pkg/util"
+	"slices"
+	"strings"
+)
+
+// MaxTemplateDepth is the deepest nesting a template is expected to have.
+// The deepest ZAPI templates nest counters four or five levels below the root.
+const MaxTemplateDepth = 10
+
+var requiredPaths = []string{"name", "query", "object", "counters"}
+
+// Problem describes one structural issue found while validating a template
+type Problem struct {
+	Kind    string
+	Path    string
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s [%s] %s", p.Kind, p.Path, p.Message)
+}
+
+// ValidationReport is the combined result of validating a template and its subtemplates
+type ValidationReport struct {
+	Problems []Problem
+}
+
+func (r *ValidationReport) add(kind string, path string, format string, a ...any) {
+	r.Problems = append(r.Problems, Problem{Kind: kind, Path: path, Message: fmt.Sprintf(format, a...)})
+}
+
+func (r *ValidationReport) IsValid() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *ValidationReport) String() string {
+	if r.IsValid() {
+		return "template is valid"
+	}
+	lines := make([]string, 0, len(r.Problems))
+	for _, p := range r.Problems {
+		lines = append(lines, p.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Validate loads the template and subtemplates, merges them the same way the poller does,
+// and reports structural problems in the merged result.
+// Validate is pure, it does not read files or contact a cluster.
+func Validate(template []byte, subTemplates ...[]byte) *ValidationReport {
+	report := &ValidationReport{}
+
+	base, err := tree.LoadYaml(template)
+	if err != nil {
+		report.add("load", "template", "%v", err)
+		return report
+	}
+	base.PreprocessTemplate()
+
+	layers := make([]*node.Node, 0, len(subTemplates))
+	for i, sub := range subTemplates {
+		subTemplate, err := tree.LoadYaml(sub)
+		if err != nil {
+			report.add("load", fmt.Sprintf("subtemplate %d", i), "%v", err)
+			continue
+		}
+		subTemplate.PreprocessTemplate()
+		layers = append(layers, subTemplate)
+	}
+	base = node.MergeAll(base, layers, nil)
+
+	checkRequiredPaths(base, report)
+	checkConflictingCounters(base, report)
+	checkDepth(base, report)
+
+	return report
+}
+
+func checkRequiredPaths(template *node.Node, report *ValidationReport) {
+	for _, p := range requiredPaths {
+		child := template.GetChildS(p)
+		if child == nil {
+			report.add("missing", p, "required path is missing")
+			continue
+		}
+		if len(child.GetChildren()) == 0 && strings.TrimSpace(child.GetContentS()) == "" {
+			report.add("missing", p, "required path is empty")
+		}
+	}
+}
+
+// checkConflictingCounters reports counters that are exported under the same display name
+// but read from different ONTAP fields
+func checkConflictingCounters(template *node.Node, report *ValidationReport) {
+	counters := template.GetChildS("counters")
+	if counters == nil {
+		return
+	}
+	sources := make(map[string]string)
+
+	for _, leaf := range counters.Leaves() {
+		if slices.Contains(leaf.Path, "hidden_fields") || slices.Contains(leaf.Path, "filter") {
+			continue
+		}
+		content := strings.TrimSpace(leaf.Content)
+		if content == "" {
+			continue
+		}
+		metric, display, _, _ := util.ParseMetric(content)
+		source := strings.Join(append(slices.Clone(leaf.Path), metric), ".")
+		if !strings.Contains(content, "=>") {
+			display = source
+		}
+		if prev, ok := sources[display]; ok && prev != source {
+			report.add("conflict", "counters", "%s is exported from both %s and %s", display, prev, source)
+			continue
+		}
+		sources[display] = source
+	}
+}
+
+func checkDepth(template *node.Node, report *ValidationReport) {
+	// path holds the names of the nodes from below the root to the node being visited
+	var path, deepest []string
+	template.Walk(func(n *node.Node, depth int) bool {
+		if depth > 0 {
+			path = append(path[:depth-1], n.GetNameS())
+		}
+		// the deepest node is a leaf, only leaves are compared so the path is not copied on the way down
+		if len(n.GetChildren()) == 0 && depth > len(deepest) {
+			deepest = slices.Clone(path[:depth])
+		}
+		return true
+	})
+
+	if len(deepest) > MaxTemplateDepth {
+		report.add("depth", strings.Join(deepest, "/"), "template depth %d exceeds maximum of %d", len(deepest), MaxTemplateDepth)
+	}
+}
@@ -0,0 +1,126 @@
+package template
+
+import (
+	"fmt"
+	"github.com/netapp/harvest/v2/pkg/tree/node"
+	"os"
+	"strings"
+	"testing"
+)
+
+const validTemplate = `
+name:    Volume
+query:   api/storage/volumes
+object:  volume
+
+counters:
+  - ^^name                 => volume
+  - ^^svm.name             => svm
+  - space.size             => size
+
+plugins:
+  - Volume
+`
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		template     string
+		subTemplates []string
+		kinds        []string
+	}{
+		{name: "valid", template: validTemplate},
+		{
+			name:         "valid with subtemplate",
+			template:     validTemplate,
+			subTemplates: []string{"counters:\n  - space.available => available\n"},
+		},
+		{
+			name:     "missing query and object",
+			template: "name: Volume\ncounters:\n  - ^^name => volume\n",
+			kinds:    []string{"missing", "missing"},
+		},
+		{
+			name:     "empty counters",
+			template: "name: Volume\nquery: api/storage/volumes\nobject: volume\ncounters: []\n",
+			kinds:    []string{"missing"},
+		},
+		{
+			name:         "conflicting counters",
+			template:     validTemplate,
+			subTemplates: []string{"counters:\n  - space.used => size\n"},
+			kinds:        []string{"conflict"},
+		},
+		{
+			name:     "too deep",
+			template: validTemplate + deepCounters(MaxTemplateDepth),
+			kinds:    []string{"depth"},
+		},
+		{
+			name:     "unparsable",
+			template: "name: [Volume",
+			kinds:    []string{"load"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subTemplates := make([][]byte, 0, len(tt.subTemplates))
+			for _, s := range tt.subTemplates {
+				subTemplates = append(subTemplates, []byte(s))
+			}
+			report := Validate([]byte(tt.template), subTemplates...)
+			if len(report.Problems) != len(tt.kinds) {
+				t.Fatalf("got %d problems, want %d\n%s", len(report.Problems), len(tt.kinds), report)
+			}
+			for i, p := range report.Problems {
+				if p.Kind != tt.kinds[i] {
+					t.Errorf("problem %d got kind=%s want=%s", i, p.Kind, tt.kinds[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateConfTemplates(t *testing.T) {
+	visitTemplates(t, func(path string, _ Model) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read %s err=%v", path, err)
+		}
+		if report := Validate(data); !report.IsValid() {
+			t.Errorf("template=%s is invalid\n%s", shortPath(path), report)
+		}
+	}, allTemplatesButEms...)
+}
+
+// deepCounters returns a ZAPI style counters block nested depth levels deep
+func deepCounters(depth int) string {
+	b := strings.Builder{}
+	b.WriteString("extra:\n")
+	for i := 0; i < depth; i++ {
+		b.WriteString(strings.Repeat("  ", i+1) + "- level:\n")
+	}
+	b.WriteString(strings.Repeat("  ", depth+1) + "- leaf\n")
+	return b.String()
+}
+
+func Test_checkDepth(t *testing.T) {
+	const depth = 100_000
+	template := node.NewS("root")
+	counters := template.NewChildS("counters", "")
+	parent := counters
+	for i := 0; i < depth; i++ {
+		parent = parent.NewChildS("nested", "")
+	}
+	parent.NewChildS("", "leaf => leaf")
+
+	report := &ValidationReport{}
+	checkDepth(template, report)
+	checkConflictingCounters(template, report)
+	if len(report.Problems) != 1 || report.Problems[0].Kind != "depth" {
+		t.Fatalf("expected one depth problem, got %d", len(report.Problems))
+	}
+	if want := fmt.Sprintf("template depth %d exceeds maximum of %d", depth+2, MaxTemplateDepth); report.Problems[0].Message != want {
+		t.Errorf("message got=%s want=%s", report.Problems[0].Message, want)
+	}
+}
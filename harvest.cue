@@ -27,6 +27,15 @@ label: [string]: string
 	httpsd?: #HTTPSD
 }
 
+#Relabel: {
+	action:         "keep" | "drop" | "replace" | "labelmap" | "labeldrop"
+	regex?:         string
+	replacement?:   string
+	separator?:     string
+	source_labels?: [...string]
+	target_label?:  string
+}
+
 #Prom: {
 	add_meta_tags?: bool
 	addr?:          string // deprecated
@@ -35,6 +44,7 @@ label: [string]: string
 	local_http_addr?: "0.0.0.0" | "localhost" | "127.0.0.1"
 	port?:            int
 	port_range?:      string
+	relabel_configs?: [...#Relabel]
 	sort_labels?:     bool
 	tls?:             #TLS
 }
@@ -42,11 +52,16 @@ label: [string]: string
 #Influx: {
 	addr?: string // one of addr|url
 	allow_addrs_regex: [...string]
-	bucket?:  string
-	exporter: "InfluxDB"
-	org?:     string
+	bucket?:       string
+	changed_only?: bool
+	changed_only_epsilon?: [string]: number
+	database?: string
+	exporter:  "InfluxDB"
+	org?:      string
+	relabel_configs?: [...#Relabel]
 	token?:   string
 	url?:     string
+	version?: string | int
 }
 
 #CertificateScript: {
@@ -81,13 +96,15 @@ Pollers: [Name=_]: #Poller
 	is_kfs?: bool
 	labels?: [...label]
 	log: [...string]
-	log_max_bytes?:    int
-	log_max_files?:    int
-	password?:         string
-	prefer_zapi?:      bool
-	ssl_cert?:         string
-	ssl_key?:          string
-	tls_min_version?:  string
-	use_insecure_tls?: bool
-	username?:         string
+	log_max_bytes?:     int
+	log_max_files?:     int
+	password?:          string
+	prefer_zapi?:       bool
+	rest_max_attempts?: int
+	rest_retry_delay?:  string
+	ssl_cert?:          string
+	ssl_key?:           string
+	tls_min_version?:   string
+	use_insecure_tls?:  bool
+	username?:          string
 }
@@ -433,6 +433,7 @@ type CertificateScript struct {
 
 type Poller struct {
 	Addr              string               `yaml:"addr,omitempty"`
+	AltAddrs          []string             `yaml:"alt_addrs,omitempty"`
 	APIVersion        string               `yaml:"api_version,omitempty"`
 	APIVfiler         string               `yaml:"api_vfiler,omitempty"`
 	AuthStyle         string               `yaml:"auth_style,omitempty"`
@@ -457,6 +458,8 @@ type Poller struct {
 	UseInsecureTLS    *bool                `yaml:"use_insecure_tls,omitempty"`
 	Username          string               `yaml:"username,omitempty"`
 	PreferZAPI        bool                 `yaml:"prefer_zapi,omitempty"`
+	RestMaxAttempts   int                  `yaml:"rest_max_attempts,omitempty"`
+	RestRetryDelay    string               `yaml:"rest_retry_delay,omitempty"`
 	ConfPath          string               `yaml:"conf_path,omitempty"`
 	promIndex         int
 	Name              string
@@ -514,6 +517,9 @@ func ZapiPoller(n *node.Node) *Poller {
 	if addr := n.GetChildContentS("addr"); addr != "" {
 		p.Addr = addr
 	}
+	if altAddrs := n.GetChildS("alt_addrs"); altAddrs != nil {
+		p.AltAddrs = altAddrs.GetAllChildContentS()
+	}
 	isKfs := n.GetChildContentS("is_kfs")
 	p.IsKfs = isKfs == "true"
 
@@ -563,6 +569,14 @@ func ZapiPoller(n *node.Node) *Poller {
 	if tlsMinVersion := n.GetChildContentS("tls_min_version"); tlsMinVersion != "" {
 		p.TLSMinVersion = tlsMinVersion
 	}
+	if x := n.GetChildContentS("rest_max_attempts"); x != "" {
+		if attempts, err := strconv.Atoi(x); err == nil {
+			p.RestMaxAttempts = attempts
+		}
+	}
+	if retryDelay := n.GetChildContentS("rest_retry_delay"); retryDelay != "" {
+		p.RestRetryDelay = retryDelay
+	}
 	if logSet := n.GetChildS("log"); logSet != nil {
 		names := logSet.GetAllChildNamesS()
 		p.LogSet = &names
@@ -598,6 +612,29 @@ type Exporter struct {
 	Precision     *string `yaml:"precision,omitempty"`
 	ClientTimeout *string `yaml:"client_timeout,omitempty"`
 	Version       *string `yaml:"version,omitempty"`
+	Database      *string `yaml:"database,omitempty"`
+
+	// OTLP specific
+	Endpoint *string           `yaml:"endpoint,omitempty"`
+	Protocol *string           `yaml:"protocol,omitempty"`
+	Headers  map[string]string `yaml:"headers,omitempty"`
+
+	// ChangedOnly exports only values that changed since the previous export
+	ChangedOnly        bool               `yaml:"changed_only,omitempty"`
+	ChangedOnlyEpsilon map[string]float64 `yaml:"changed_only_epsilon,omitempty"`
+
+	// RelabelConfigs rewrite instance labels before export, applied in order
+	RelabelConfigs []RelabelConfig `yaml:"relabel_configs,omitempty"`
+}
+
+// RelabelConfig is one exporter relabel rule, it mirrors Prometheus relabel_configs
+type RelabelConfig struct {
+	Action       string   `yaml:"action,omitempty"`
+	SourceLabels []string `yaml:"source_labels,omitempty"`
+	Separator    string   `yaml:"separator,omitempty"`
+	Regex        string   `yaml:"regex,omitempty"`
+	TargetLabel  string   `yaml:"target_label,omitempty"`
+	Replacement  string   `yaml:"replacement,omitempty"`
 }
 
 type Pollers struct {
@@ -274,6 +274,8 @@ func TestNodeToPoller(t *testing.T) {
 	defaultNode := node.NewS("root")
 	defaultNode.NewChildS("password", "pass")
 	defaultNode.NewChildS("use_insecure_tls", "true")
+	defaultNode.NewChildS("rest_max_attempts", "3")
+	defaultNode.NewChildS("rest_retry_delay", "500ms")
 	poller := ZapiPoller(defaultNode)
 
 	testArg(t, DefaultAPIVersion, poller.APIVersion)
@@ -281,6 +283,8 @@ func TestNodeToPoller(t *testing.T) {
 	testArg(t, "pass", poller.Password)
 	testArg(t, "30s", poller.ClientTimeout)
 	testArg(t, "true", strconv.FormatBool(*poller.UseInsecureTLS))
+	testArg(t, "3", strconv.Itoa(poller.RestMaxAttempts))
+	testArg(t, "500ms", poller.RestRetryDelay)
 }
 
 func TestReadHarvestConfigFromEnv(t *testing.T) {
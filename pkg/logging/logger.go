@@ -51,6 +51,8 @@ var logger *Logger
 
 var once sync.Once
 
+// Logger is the zerolog logger of Harvest. Log values as typed fields, e.g. Str("metric", name), instead of
+// interpolating them into the message with Msgf, so that JSON log pipelines can parse them.
 type Logger struct {
 	*zerolog.Logger
 }
@@ -0,0 +1,42 @@
+package matrix
+
+// Bounds is the inclusive range of values expected for a metric
+type Bounds struct {
+	Min float64
+	Max float64
+}
+
+func (b Bounds) Contains(value float64) bool {
+	return value >= b.Min && value <= b.Max
+}
+
+// BoundsViolation is a recorded value outside the bounds of its metric
+type BoundsViolation struct {
+	Metric   string
+	Instance string
+	Value    float64
+	Bounds   Bounds
+}
+
+// ValidateBounds checks the recorded values of all metrics with bounds and returns the values outside them.
+// When drop is true, those values are no longer recorded and will not be exported.
+func (m *Matrix) ValidateBounds(drop bool) []BoundsViolation {
+	var violations []BoundsViolation
+	for _, metric := range m.GetMetrics() {
+		bounds, ok := metric.GetBounds()
+		if !ok {
+			continue
+		}
+		for key, instance := range m.GetInstances() {
+			value, ok := metric.GetValueFloat64(instance)
+			if !ok || bounds.Contains(value) {
+				continue
+			}
+			violations = append(violations, BoundsViolation{Metric: metric.GetName(), Instance: key, Value: value, Bounds: bounds})
+			if drop {
+				metric.SetValueNAN(instance)
+			}
+		}
+	}
+	return violations
+}
@@ -0,0 +1,67 @@
+package matrix
+
+import (
+	"testing"
+)
+
+func TestMatrix_ValidateBounds(t *testing.T) {
+	tests := []struct {
+		name       string
+		drop       bool
+		values     map[string]float64
+		violations int
+		recorded   map[string]bool
+	}{
+		{
+			name:     "in range",
+			values:   map[string]float64{"n1": 0, "n2": 450, "n3": 2000},
+			recorded: map[string]bool{"n1": true, "n2": true, "n3": true},
+		},
+		{
+			name:       "out of range warn",
+			values:     map[string]float64{"n1": -5, "n2": 450, "n3": 90000},
+			violations: 2,
+			recorded:   map[string]bool{"n1": true, "n2": true, "n3": true},
+		},
+		{
+			name:       "out of range drop",
+			drop:       true,
+			values:     map[string]float64{"n1": -5, "n2": 450, "n3": 90000},
+			violations: 2,
+			recorded:   map[string]bool{"n1": false, "n2": true, "n3": false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := New("uuid", "environment_sensor", "environment_sensor")
+			power, _ := data.NewMetricFloat64("power")
+			power.SetBounds(0, 2000)
+			temp, _ := data.NewMetricFloat64("max_temperature")
+			for key, v := range tt.values {
+				instance, _ := data.NewInstance(key)
+				_ = power.SetValueFloat64(instance, v)
+				// no bounds, never validated
+				_ = temp.SetValueFloat64(instance, -v)
+			}
+
+			violations := data.ValidateBounds(tt.drop)
+
+			if len(violations) != tt.violations {
+				t.Fatalf("violations got=%d want=%d %+v", len(violations), tt.violations, violations)
+			}
+			for _, v := range violations {
+				if v.Metric != "power" || v.Bounds != (Bounds{Min: 0, Max: 2000}) || tt.values[v.Instance] != v.Value {
+					t.Errorf("unexpected violation %+v", v)
+				}
+			}
+			for key, want := range tt.recorded {
+				if _, got := power.GetValueFloat64(data.GetInstance(key)); got != want {
+					t.Errorf("%s recorded got=%v want=%v", key, got, want)
+				}
+				if _, ok := temp.GetValueFloat64(data.GetInstance(key)); !ok {
+					t.Errorf("%s max_temperature without bounds must be kept", key)
+				}
+			}
+		})
+	}
+}
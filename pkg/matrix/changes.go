@@ -0,0 +1,66 @@
+package matrix
+
+import "math"
+
+// ChangeTracker remembers the last exported value of each instance/metric so exporters can
+// skip values that have not changed since the previous export.
+// A ChangeTracker holds per-exporter state and must not be shared between exporters.
+type ChangeTracker struct {
+	// epsilon by metric display name, a value is changed when it differs by more than epsilon
+	epsilons       map[string]float64
+	defaultEpsilon float64
+	// object.uuid => instance key => metric key => last exported value
+	last map[string]map[string]map[string]float64
+}
+
+func NewChangeTracker(defaultEpsilon float64, epsilons map[string]float64) *ChangeTracker {
+	if epsilons == nil {
+		epsilons = make(map[string]float64)
+	}
+	return &ChangeTracker{
+		epsilons:       epsilons,
+		defaultEpsilon: defaultEpsilon,
+		last:           make(map[string]map[string]map[string]float64),
+	}
+}
+
+func (c *ChangeTracker) epsilon(metric *Metric) float64 {
+	if e, ok := c.epsilons[metric.GetName()]; ok {
+		return e
+	}
+	return c.defaultEpsilon
+}
+
+// Changed returns a copy of data where values that did not change by more than their epsilon since
+// the last call are not recorded. Instances that are no longer present in data are forgotten.
+// data is not modified.
+func (c *ChangeTracker) Changed(data *Matrix) *Matrix {
+	changed := data.Clone(With{Data: true, Metrics: true, Instances: true, ExportInstances: true})
+
+	matrixKey := data.Object + "." + data.UUID
+	previous := c.last[matrixKey]
+	current := make(map[string]map[string]float64, len(changed.GetInstances()))
+
+	for iKey, instance := range changed.GetInstances() {
+		prevValues := previous[iKey]
+		values := make(map[string]float64)
+		for mKey, metric := range changed.GetMetrics() {
+			value, ok := metric.GetValueFloat64(instance)
+			if !ok {
+				continue
+			}
+			prev, seen := prevValues[mKey]
+			if seen && math.Abs(value-prev) <= c.epsilon(metric) {
+				// keep the last exported value, so slow drifts are still exported once they exceed epsilon
+				values[mKey] = prev
+				metric.SetValueNAN(instance)
+				continue
+			}
+			values[mKey] = value
+		}
+		current[iKey] = values
+	}
+
+	c.last[matrixKey] = current
+	return changed
+}
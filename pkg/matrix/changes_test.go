@@ -0,0 +1,78 @@
+package matrix
+
+import (
+	"testing"
+)
+
+func TestChangeTracker_Changed(t *testing.T) {
+	type export struct {
+		temp    float64
+		power   float64
+		changed []string
+	}
+	tests := []struct {
+		name    string
+		exports []export
+	}{
+		{
+			name: "first export is complete",
+			exports: []export{
+				{temp: 21, power: 300, changed: []string{"temp", "power"}},
+			},
+		},
+		{
+			name: "unchanged values are skipped",
+			exports: []export{
+				{temp: 21, power: 300, changed: []string{"temp", "power"}},
+				{temp: 21, power: 300},
+				{temp: 21, power: 310, changed: []string{"power"}},
+			},
+		},
+		{
+			name: "per metric epsilon",
+			exports: []export{
+				{temp: 21, power: 300, changed: []string{"temp", "power"}},
+				{temp: 21.4, power: 300.5, changed: []string{"power"}},
+				{temp: 21.6, power: 300.5, changed: []string{"temp"}},
+			},
+		},
+		{
+			name: "slow drift is exported once above epsilon",
+			exports: []export{
+				{temp: 21, power: 300, changed: []string{"temp", "power"}},
+				{temp: 21.3, power: 300},
+				{temp: 21.6, power: 300, changed: []string{"temp"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewChangeTracker(0, map[string]float64{"temp": 0.5})
+			for i, e := range tt.exports {
+				data := New("uuid", "sensor", "sensor")
+				temp, _ := data.NewMetricFloat64("temp")
+				power, _ := data.NewMetricFloat64("power")
+				instance, _ := data.NewInstance("node1")
+				_ = temp.SetValueFloat64(instance, e.temp)
+				_ = power.SetValueFloat64(instance, e.power)
+
+				changed := tracker.Changed(data)
+
+				want := make(map[string]bool)
+				for _, m := range e.changed {
+					want[m] = true
+				}
+				for key, metric := range changed.GetMetrics() {
+					_, ok := metric.GetValueFloat64(changed.GetInstance("node1"))
+					if ok != want[key] {
+						t.Errorf("export %d metric %s expected changed=%v, got %v", i, key, want[key], ok)
+					}
+				}
+				if _, ok := temp.GetValueFloat64(instance); !ok {
+					t.Errorf("export %d source matrix was modified", i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package matrix
+
+// Decimator exports slowly changing metrics less often than they are collected,
+// e.g. ambient temperature every 5th poll while power is exported every poll.
+type Decimator struct {
+	// metric name => export every n polls
+	every map[string]int
+	// uuid/object/metric key => polls seen
+	polls map[string]int
+}
+
+// NewDecimator returns a decimator for the metrics of every, keyed by display name.
+// Intervals below 2 export every poll.
+func NewDecimator(every map[string]int) *Decimator {
+	return &Decimator{every: every, polls: make(map[string]int)}
+}
+
+// Apply counts one poll for the decimated metrics of data and returns data when all of them are due.
+// Otherwise, it returns a copy of data where the metrics that are not due are not exportable.
+// The first poll of a metric is always exported and since the count is per metric, all instances of a metric
+// are exported in the same polls.
+func (d *Decimator) Apply(data *Matrix) *Matrix {
+	var skip []string
+	for key, metric := range data.GetMetrics() {
+		every := d.every[metric.GetName()]
+		if every < 2 || !metric.IsExportable() {
+			continue
+		}
+		pollKey := data.UUID + "/" + data.Object + "/" + key
+		poll := d.polls[pollKey]
+		d.polls[pollKey] = (poll + 1) % every
+		if poll != 0 {
+			skip = append(skip, key)
+		}
+	}
+	if len(skip) == 0 {
+		return data
+	}
+	decimated := data.Clone(With{Data: true, Metrics: true, Instances: true, ExportInstances: true})
+	for _, key := range skip {
+		decimated.GetMetric(key).SetExportable(false)
+	}
+	return decimated
+}
@@ -0,0 +1,41 @@
+package matrix
+
+import (
+	"testing"
+)
+
+func TestDecimator_Apply(t *testing.T) {
+	d := NewDecimator(map[string]int{"ambient_temperature": 3, "power": 1})
+	data := New("Sensor", "environment_sensor", "environment_sensor")
+	ambient, _ := data.NewMetricFloat64("ambient_temperature")
+	power, _ := data.NewMetricFloat64("power")
+	for _, key := range []string{"n1", "n2"} {
+		instance, _ := data.NewInstance(key)
+		_ = ambient.SetValueFloat64(instance, 22)
+		_ = power.SetValueFloat64(instance, 400)
+	}
+
+	wantAmbient := []bool{true, false, false, true, false, false, true}
+	for i, want := range wantAmbient {
+		got := d.Apply(data)
+		if exportable := got.GetMetric("ambient_temperature").IsExportable(); exportable != want {
+			t.Errorf("poll %d ambient_temperature exportable got=%t want=%t", i, exportable, want)
+		}
+		if !got.GetMetric("power").IsExportable() {
+			t.Errorf("poll %d power not exportable", i)
+		}
+		// all instances are exported or skipped together
+		for _, instance := range got.GetInstances() {
+			if v, ok := got.GetMetric("ambient_temperature").GetValueFloat64(instance); !ok || v != 22 {
+				t.Errorf("poll %d ambient_temperature value got=%v,%t", i, v, ok)
+			}
+		}
+		// the collected matrix is not changed
+		if !ambient.IsExportable() {
+			t.Fatalf("poll %d original metric modified", i)
+		}
+		if want && got != data {
+			t.Errorf("poll %d expected data without copy", i)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package matrix
+
+import (
+	"fmt"
+	"github.com/netapp/harvest/v2/pkg/errs"
+	"math"
+	"strconv"
+)
+
+// Expr is an arithmetic expression over the metrics of an instance, e.g. power_out / power_in.
+// The grammar is
+//
+//	expr   = term { ("+" | "-") term }
+//	term   = factor { ("*" | "/") factor }
+//	factor = [ "-" ] ( number | metric | "(" expr ")" )
+//	metric = ( letter | "_" ) { letter | digit | "_" | "." }
+//
+// number is a decimal number, e.g. 100 or 0.93, and metric is the key or, when no metric has that key,
+// the display name of a metric of the matrix.
+// Division by zero evaluates to NaN. When a metric is missing or has no value for an instance, the
+// expression has no value for that instance.
+type Expr struct {
+	src     string
+	root    exprNode
+	metrics []string
+}
+
+type exprNode interface {
+	eval(values map[string]float64) float64
+}
+
+type exprNumber float64
+
+func (n exprNumber) eval(map[string]float64) float64 { return float64(n) }
+
+type exprMetric string
+
+func (n exprMetric) eval(values map[string]float64) float64 { return values[string(n)] }
+
+type exprNeg struct{ x exprNode }
+
+func (n exprNeg) eval(values map[string]float64) float64 { return -n.x.eval(values) }
+
+type exprBinary struct {
+	op   byte
+	l, r exprNode
+}
+
+func (n exprBinary) eval(values map[string]float64) float64 {
+	l, r := n.l.eval(values), n.r.eval(values)
+	switch n.op {
+	case '+':
+		return l + r
+	case '-':
+		return l - r
+	case '*':
+		return l * r
+	default:
+		if r == 0 {
+			return math.NaN()
+		}
+		return l / r
+	}
+}
+
+// ParseExpr parses an expression, see Expr for the grammar
+func ParseExpr(src string) (*Expr, error) {
+	p := &exprParser{src: src, seen: make(map[string]bool)}
+	root, err := p.expr()
+	if err == nil && p.peek() != 0 {
+		err = p.errorf("unexpected %q", p.src[p.pos])
+	}
+	if err != nil {
+		return nil, errs.New(errs.ErrInvalidParam, "expression "+strconv.Quote(src)+": "+err.Error())
+	}
+	return &Expr{src: src, root: root, metrics: p.metrics}, nil
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Metrics returns the metric keys or display names referenced by the expression in order of first use
+func (e *Expr) Metrics() []string {
+	return e.metrics
+}
+
+// Resolve returns the metrics of m referenced by the expression, in the order of Metrics.
+// ok is false when one of them is missing.
+func (e *Expr) Resolve(m *Matrix) (metrics []*Metric, ok bool) {
+	metrics = make([]*Metric, len(e.metrics))
+	ok = true
+	for i, name := range e.metrics {
+		if metrics[i] = m.GetMetric(name); metrics[i] == nil {
+			for _, metric := range m.GetMetrics() {
+				if metric.GetName() == name {
+					metrics[i] = metric
+					break
+				}
+			}
+		}
+		ok = ok && metrics[i] != nil
+	}
+	return metrics, ok
+}
+
+// ComputeFunc returns a ComputeMetric function that evaluates the expression for an instance of m
+func (e *Expr) ComputeFunc(m *Matrix) func(instance *Instance) (float64, bool) {
+	metrics, _ := e.Resolve(m)
+	values := make(map[string]float64, len(e.metrics))
+	return func(instance *Instance) (float64, bool) {
+		for i, metric := range metrics {
+			if metric == nil {
+				return 0, false
+			}
+			value, ok := metric.GetValueFloat64(instance)
+			if !ok {
+				return 0, false
+			}
+			values[e.metrics[i]] = value
+		}
+		return e.root.eval(values), true
+	}
+}
+
+type exprParser struct {
+	src     string
+	pos     int
+	metrics []string
+	seen    map[string]bool
+}
+
+func (p *exprParser) errorf(format string, a ...any) error {
+	return fmt.Errorf("at %d: "+format, append([]any{p.pos}, a...)...)
+}
+
+// peek skips spaces and returns the next byte, 0 at the end of the source
+func (p *exprParser) peek() byte {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+	if p.pos == len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *exprParser) expr() (exprNode, error) {
+	l, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		r, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		l = exprBinary{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *exprParser) term() (exprNode, error) {
+	l, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		r, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		l = exprBinary{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *exprParser) factor() (exprNode, error) {
+	c := p.peek()
+	switch {
+	case c == '-':
+		p.pos++
+		x, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return exprNeg{x: x}, nil
+	case c == '(':
+		p.pos++
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, p.errorf("missing )")
+		}
+		p.pos++
+		return x, nil
+	case isDigit(c) || c == '.':
+		start := p.pos
+		for p.pos < len(p.src) && (isDigit(p.src[p.pos]) || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		n, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", p.src[start:p.pos])
+		}
+		return exprNumber(n), nil
+	case isLetter(c):
+		start := p.pos
+		for p.pos < len(p.src) && (isLetter(p.src[p.pos]) || isDigit(p.src[p.pos]) || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		name := p.src[start:p.pos]
+		if !p.seen[name] {
+			p.seen[name] = true
+			p.metrics = append(p.metrics, name)
+		}
+		return exprMetric(name), nil
+	case c == 0:
+		return nil, p.errorf("unexpected end")
+	default:
+		return nil, p.errorf("unexpected %q", c)
+	}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
@@ -0,0 +1,80 @@
+package matrix
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestParseExpr(t *testing.T) {
+	m := New("TestExpr", "psu", "psu")
+	in, _ := m.NewMetricFloat64("power_in")
+	out, _ := m.NewMetricFloat64("power_out")
+	// referenced by display name
+	fan, _ := m.NewMetricFloat64("fan-speed-rpm", "fan_speed")
+	idle, _ := m.NewMetricFloat64("idle")
+
+	a, _ := m.NewInstance("a")
+	_ = in.SetValueFloat64(a, 200)
+	_ = out.SetValueFloat64(a, 180)
+	_ = fan.SetValueFloat64(a, 3000)
+	_ = idle.SetValueFloat64(a, 0)
+
+	tests := []struct {
+		expr    string
+		want    float64
+		ok      bool
+		metrics []string
+	}{
+		{expr: "power_out / power_in", want: 0.9, ok: true, metrics: []string{"power_out", "power_in"}},
+		{expr: "power_in - power_out * 2", want: -160, ok: true, metrics: []string{"power_in", "power_out"}},
+		{expr: "(power_in - power_out) * 2", want: 40, ok: true, metrics: []string{"power_in", "power_out"}},
+		{expr: "-power_in + 0.5 * power_in", want: -100, ok: true, metrics: []string{"power_in"}},
+		{expr: "fan_speed / 60", want: 50, ok: true, metrics: []string{"fan_speed"}},
+		{expr: "power_in / idle", want: math.NaN(), ok: true, metrics: []string{"power_in", "idle"}},
+		{expr: "power_in / missing", ok: false, metrics: []string{"power_in", "missing"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := ParseExpr(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(e.Metrics(), tt.metrics) {
+				t.Errorf("metrics got=%v want=%v", e.Metrics(), tt.metrics)
+			}
+			got, ok := e.ComputeFunc(m)(a)
+			if ok != tt.ok {
+				t.Fatalf("ok got=%v want=%v", ok, tt.ok)
+			}
+			if math.IsNaN(tt.want) {
+				if !math.IsNaN(got) {
+					t.Errorf("got=%v want=NaN", got)
+				}
+			} else if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("got=%v want=%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExprInvalid(t *testing.T) {
+	for _, expr := range []string{"", "power_in /", "(power_in", "power_in)", "power_in % 2", "1.2.3", "power_in power_out"} {
+		if _, err := ParseExpr(expr); err == nil {
+			t.Errorf("expected an error for %q", expr)
+		}
+	}
+}
+
+func TestExprUnsetValue(t *testing.T) {
+	m := New("TestExpr", "psu", "psu")
+	in, _ := m.NewMetricFloat64("power_in")
+	_, _ = m.NewMetricFloat64("power_out")
+	a, _ := m.NewInstance("a")
+	_ = in.SetValueFloat64(a, 200)
+
+	e, _ := ParseExpr("power_out / power_in")
+	if _, ok := e.ComputeFunc(m)(a); ok {
+		t.Errorf("expected no value when power_out is not set")
+	}
+}
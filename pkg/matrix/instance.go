@@ -6,6 +6,7 @@ package matrix
 
 import (
 	"maps"
+	"time"
 )
 
 // Instance struct and related methods
@@ -14,6 +15,7 @@ type Instance struct {
 	index      int
 	labels     map[string]string
 	exportable bool
+	timestamp  time.Time
 }
 
 func NewInstance(index int) *Instance {
@@ -39,6 +41,20 @@ func (i *Instance) SetLabel(key, value string) {
 	i.labels[key] = value
 }
 
+func (i *Instance) RemoveLabel(key string) {
+	delete(i.labels, key)
+}
+
+// SetLabelPreserving sets the label key to value and keeps its previous value in the label originalKey, so a plugin
+// that normalizes a label in place, e.g. a speed of 10000M to 10000000000, does not lose the original value.
+// originalKey is left unchanged when key is not set or already has value.
+func (i *Instance) SetLabelPreserving(key, value, originalKey string) {
+	if previous, ok := i.labels[key]; ok && previous != value {
+		i.labels[originalKey] = previous
+	}
+	i.labels[key] = value
+}
+
 func (i *Instance) SetLabels(labels map[string]string) {
 	i.labels = labels
 }
@@ -51,10 +67,23 @@ func (i *Instance) SetExportable(b bool) {
 	i.exportable = b
 }
 
+// SetTimestamp sets when the values of the instance were measured, e.g. the last-updated time of a sensor reading.
+// Exporters use it instead of the timestamp of the matrix, see Matrix.ExportTimestamp.
+// The zero time removes the timestamp.
+func (i *Instance) SetTimestamp(t time.Time) {
+	i.timestamp = t
+}
+
+// GetTimestamp returns the timestamp of the instance, the zero time when it has none
+func (i *Instance) GetTimestamp() time.Time {
+	return i.timestamp
+}
+
 func (i *Instance) Clone(isExportable bool, labels ...string) *Instance {
 	clone := NewInstance(i.index)
 	clone.labels = i.Copy(labels...)
 	clone.exportable = isExportable
+	clone.timestamp = i.timestamp
 	return clone
 }
 
@@ -4,6 +4,8 @@
 
 package matrix
 
+import "github.com/netapp/harvest/v2/pkg/errs"
+
 func (m *Matrix) InstanceWiseAdditionUint64(toInstance, fromInstance *Instance, fromData *Matrix) {
 	for key, fromMetric := range fromData.GetMetrics() {
 		if toMetric := m.GetMetric(key); toMetric != nil {
@@ -13,3 +15,154 @@ func (m *Matrix) InstanceWiseAdditionUint64(toInstance, fromInstance *Instance,
 		}
 	}
 }
+
+// ComputeMetric sets the value of metric dest for every instance to the value returned by fn.
+// Instances for which fn returns false are left unchanged. dest is created as a float64 metric when missing.
+func (m *Matrix) ComputeMetric(dest string, fn func(instance *Instance) (float64, bool)) (*Metric, error) {
+	metric := m.GetMetric(dest)
+	if metric == nil {
+		var err error
+		if metric, err = m.NewMetricFloat64(dest); err != nil {
+			return nil, err
+		}
+	}
+	for _, instance := range m.GetInstances() {
+		if value, ok := fn(instance); ok {
+			if err := metric.SetValueFloat64(instance, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return metric, nil
+}
+
+// SumOf returns a ComputeMetric function that adds the named metrics.
+// Missing metrics and values are skipped, the result is false when none of the values is set.
+func (m *Matrix) SumOf(names ...string) func(instance *Instance) (float64, bool) {
+	return m.reduce(func(acc, v float64) float64 { return acc + v }, names...)
+}
+
+// MaxOf returns a ComputeMetric function that picks the largest of the named metrics.
+// Missing metrics and values are skipped, the result is false when none of the values is set.
+func (m *Matrix) MaxOf(names ...string) func(instance *Instance) (float64, bool) {
+	return m.reduce(func(acc, v float64) float64 { return max(acc, v) }, names...)
+}
+
+// RatioOf returns a ComputeMetric function that divides numerator by denominator.
+// The result is false when either value is not set or the denominator is zero.
+func (m *Matrix) RatioOf(numerator, denominator string) func(instance *Instance) (float64, bool) {
+	num := m.GetMetric(numerator)
+	den := m.GetMetric(denominator)
+	return func(instance *Instance) (float64, bool) {
+		if num == nil || den == nil {
+			return 0, false
+		}
+		n, nOk := num.GetValueFloat64(instance)
+		d, dOk := den.GetValueFloat64(instance)
+		if !nOk || !dOk || d == 0 {
+			return 0, false
+		}
+		return n / d, true
+	}
+}
+
+// ValueState is the value RatioMetric leaves for an instance without a denominator
+type ValueState int
+
+const (
+	// ValueSkip leaves the value of the instance unchanged
+	ValueSkip ValueState = iota
+	// ValueNaN removes the value of the instance, see Metric.SetValueNAN
+	ValueNaN
+)
+
+// RatioMetric sets dest to numerator / denominator for every instance with a numerator value. When the denominator is
+// zero or has no value, the instance is handled as onZero says. dest may be the numerator, and is created as a float64
+// metric when missing.
+func (m *Matrix) RatioMetric(dest, numerator, denominator string, onZero ValueState) (*Metric, error) {
+	num := m.GetMetric(numerator)
+	if num == nil {
+		return nil, errs.New(ErrInvalidMetricKey, numerator)
+	}
+	den := m.GetMetric(denominator)
+	if den == nil {
+		return nil, errs.New(ErrInvalidMetricKey, denominator)
+	}
+	metric := m.GetMetric(dest)
+	if metric == nil {
+		var err error
+		if metric, err = m.NewMetricFloat64(dest); err != nil {
+			return nil, err
+		}
+	}
+	for _, instance := range m.GetInstances() {
+		n, ok := num.GetValueFloat64(instance)
+		if !ok {
+			continue
+		}
+		if d, ok := den.GetValueFloat64(instance); ok && d != 0 {
+			if err := metric.SetValueFloat64(instance, n/d); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if onZero == ValueNaN {
+			metric.SetValueNAN(instance)
+		}
+	}
+	return metric, nil
+}
+
+// AddScaled adds factor times the value of other to the value of m, for every instance where both are set.
+// Instances where either value is not set are skipped. other must be a metric of the same matrix as m.
+func (m *Metric) AddScaled(other *Metric, factor float64) {
+	n := min(len(m.values), len(other.values))
+	for i := 0; i < n; i++ {
+		if m.record[i] && other.record[i] {
+			m.values[i] += factor * other.values[i]
+		}
+	}
+}
+
+// DivideBy divides the value of m by the value of other, for every instance where both are set.
+// Instances where either value is not set are skipped, instances where other is zero are set to NaN,
+// see SetValueNAN. other must be a metric of the same matrix as m.
+func (m *Metric) DivideBy(other *Metric) {
+	n := min(len(m.values), len(other.values))
+	for i := 0; i < n; i++ {
+		if !m.record[i] || !other.record[i] {
+			continue
+		}
+		if other.values[i] == 0 {
+			m.record[i] = false
+			continue
+		}
+		m.values[i] /= other.values[i]
+	}
+}
+
+func (m *Matrix) reduce(fn func(acc, v float64) float64, names ...string) func(instance *Instance) (float64, bool) {
+	metrics := make([]*Metric, 0, len(names))
+	for _, name := range names {
+		if metric := m.GetMetric(name); metric != nil {
+			metrics = append(metrics, metric)
+		}
+	}
+	return func(instance *Instance) (float64, bool) {
+		var result float64
+		found := false
+		for _, metric := range metrics {
+			v, ok := metric.GetValueFloat64(instance)
+			if !ok {
+				continue
+			}
+			if found {
+				result = fn(result, v)
+			} else {
+				result = v
+				found = true
+			}
+		}
+		return result, found
+	}
+}
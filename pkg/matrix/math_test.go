@@ -0,0 +1,217 @@
+package matrix
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMatrix_ComputeMetric(t *testing.T) {
+	setUp := func() *Matrix {
+		m := New("TestComputeMetric", "nic", "nic")
+		rx, _ := m.NewMetricFloat64("rx_percent")
+		tx, _ := m.NewMetricFloat64("tx_percent")
+		bytes, _ := m.NewMetricFloat64("bytes")
+		ops, _ := m.NewMetricFloat64("ops")
+
+		a, _ := m.NewInstance("a")
+		_ = rx.SetValueFloat64(a, 10)
+		_ = tx.SetValueFloat64(a, 30)
+		_ = bytes.SetValueFloat64(a, 100)
+		_ = ops.SetValueFloat64(a, 4)
+
+		b, _ := m.NewInstance("b")
+		_ = rx.SetValueFloat64(b, 20)
+		_ = bytes.SetValueFloat64(b, 100)
+		_ = ops.SetValueFloat64(b, 0)
+
+		_, _ = m.NewInstance("c")
+		return m
+	}
+
+	type want struct {
+		value float64
+		ok    bool
+	}
+	tests := []struct {
+		name string
+		fn   func(m *Matrix) func(*Instance) (float64, bool)
+		want map[string]want
+	}{
+		{
+			name: "max",
+			fn:   func(m *Matrix) func(*Instance) (float64, bool) { return m.MaxOf("rx_percent", "tx_percent") },
+			want: map[string]want{"a": {30, true}, "b": {20, true}, "c": {0, false}},
+		},
+		{
+			name: "sum",
+			fn:   func(m *Matrix) func(*Instance) (float64, bool) { return m.SumOf("rx_percent", "tx_percent", "missing") },
+			want: map[string]want{"a": {40, true}, "b": {20, true}, "c": {0, false}},
+		},
+		{
+			name: "ratio",
+			fn:   func(m *Matrix) func(*Instance) (float64, bool) { return m.RatioOf("bytes", "ops") },
+			want: map[string]want{"a": {25, true}, "b": {0, false}, "c": {0, false}},
+		},
+		{
+			name: "custom",
+			fn: func(m *Matrix) func(*Instance) (float64, bool) {
+				rx := m.GetMetric("rx_percent")
+				return func(i *Instance) (float64, bool) {
+					v, ok := rx.GetValueFloat64(i)
+					return v * 2, ok
+				}
+			},
+			want: map[string]want{"a": {20, true}, "b": {40, true}, "c": {0, false}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := setUp()
+			metric, err := m.ComputeMetric("result", tt.fn(m))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.GetMetric("result") != metric {
+				t.Fatalf("expected result metric to be created")
+			}
+			for key, w := range tt.want {
+				got, ok := metric.GetValueFloat64(m.GetInstance(key))
+				if ok != w.ok || got != w.value {
+					t.Errorf("instance %s got=(%v, %v) want=(%v, %v)", key, got, ok, w.value, w.ok)
+				}
+			}
+		})
+	}
+}
+
+func TestRatioMetric(t *testing.T) {
+	newData := func() *Matrix {
+		m := New("test", "test", "test")
+		num, _ := m.NewMetricFloat64("latency")
+		den, _ := m.NewMetricFloat64("ops")
+		for _, v := range []struct {
+			key      string
+			num, den float64
+			noNum    bool
+			noDen    bool
+		}{
+			{key: "a", num: 100, den: 4},
+			{key: "zero", num: 100, den: 0},
+			{key: "noDen", num: 100, noDen: true},
+			{key: "noNum", den: 4, noNum: true},
+		} {
+			instance, _ := m.NewInstance(v.key)
+			if !v.noNum {
+				_ = num.SetValueFloat64(instance, v.num)
+			}
+			if !v.noDen {
+				_ = den.SetValueFloat64(instance, v.den)
+			}
+		}
+		return m
+	}
+	type result struct {
+		value float64
+		ok    bool
+	}
+	tests := []struct {
+		name   string
+		dest   string
+		onZero ValueState
+		want   map[string]result
+	}{
+		{name: "skip", dest: "avg_latency", onZero: ValueSkip, want: map[string]result{
+			"a": {25, true}, "zero": {0, false}, "noDen": {0, false}, "noNum": {0, false},
+		}},
+		{name: "in place skip", dest: "latency", onZero: ValueSkip, want: map[string]result{
+			"a": {25, true}, "zero": {100, true}, "noDen": {100, true}, "noNum": {0, false},
+		}},
+		{name: "in place NaN", dest: "latency", onZero: ValueNaN, want: map[string]result{
+			"a": {25, true}, "zero": {0, false}, "noDen": {0, false}, "noNum": {0, false},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newData()
+			metric, err := m.RatioMetric(tt.dest, "latency", "ops", tt.onZero)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, want := range tt.want {
+				value, ok := metric.GetValueFloat64(m.GetInstance(key))
+				if ok != want.ok || (ok && value != want.value) {
+					t.Errorf("%s got=%v %v want=%v %v", key, value, ok, want.value, want.ok)
+				}
+			}
+		})
+	}
+
+	if _, err := newData().RatioMetric("x", "latency", "missing", ValueNaN); !errors.Is(err, ErrInvalidMetricKey) {
+		t.Errorf("missing denominator err got=%v want=%v", err, ErrInvalidMetricKey)
+	}
+}
+
+func TestMetric_AddScaledDivideBy(t *testing.T) {
+	m := New("TestVector", "volume", "volume")
+	latency, _ := m.NewMetricFloat64("read_latency")
+	ops, _ := m.NewMetricFloat64("temp_read_ops")
+	c1, _ := m.NewMetricFloat64("c1_read_ops")
+	c2, _ := m.NewMetricFloat64("c2_read_ops")
+
+	// latency holds the sum of the constituent latencies weighted by their ops, like Volume.Run.
+	// fg1 has constituents with latencies 10 and 20 and ops 2 and 6, so (10*2 + 20*6) / (2+6) = 17.5
+	for _, v := range []struct {
+		key     string
+		latency float64
+		c1, c2  float64
+		noC2    bool
+		noOps   bool
+	}{
+		{key: "fg1", latency: 140, c1: 2, c2: 6},
+		{key: "fg2", latency: 100, c1: 2, c2: 6},
+		{key: "idle", latency: 0, c1: 0, c2: 0},
+		{key: "partial", latency: 50, c1: 5, noC2: true},
+		{key: "noOps", latency: 30, noC2: true, noOps: true},
+	} {
+		instance, _ := m.NewInstance(v.key)
+		_ = latency.SetValueFloat64(instance, v.latency)
+		if v.noOps {
+			continue
+		}
+		_ = ops.SetValueFloat64(instance, 0)
+		_ = c1.SetValueFloat64(instance, v.c1)
+		if !v.noC2 {
+			_ = c2.SetValueFloat64(instance, v.c2)
+		}
+	}
+	unset, _ := m.NewInstance("unset")
+	_ = ops.SetValueFloat64(unset, 4)
+
+	ops.AddScaled(c1, 1)
+	ops.AddScaled(c2, 1)
+	latency.DivideBy(ops)
+
+	type result struct {
+		value float64
+		ok    bool
+	}
+	check := func(metric *Metric, want map[string]result) {
+		t.Helper()
+		for key, w := range want {
+			value, ok := metric.GetValueFloat64(m.GetInstance(key))
+			if ok != w.ok || (ok && value != w.value) {
+				t.Errorf("%s %s got=%v %v want=%v %v", metric.GetName(), key, value, ok, w.value, w.ok)
+			}
+		}
+	}
+	check(ops, map[string]result{
+		"fg1": {8, true}, "fg2": {8, true}, "idle": {0, true}, "partial": {5, true}, "noOps": {0, false}, "unset": {4, true},
+	})
+	check(latency, map[string]result{
+		"fg1": {17.5, true}, "fg2": {12.5, true}, "idle": {0, false}, "partial": {10, true}, "noOps": {30, true}, "unset": {0, false},
+	})
+
+	// the factor scales the added values, e.g. to convert units
+	c1.AddScaled(c2, 0.5)
+	check(c1, map[string]result{"fg1": {5, true}, "idle": {0, true}, "partial": {5, true}})
+}
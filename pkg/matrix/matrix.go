@@ -15,7 +15,11 @@ import (
 	"github.com/netapp/harvest/v2/pkg/errs"
 	"github.com/netapp/harvest/v2/pkg/logging"
 	"github.com/netapp/harvest/v2/pkg/tree/node"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Matrix struct {
@@ -28,6 +32,8 @@ type Matrix struct {
 	displayMetrics map[string]string  // display name of metric to => metric name (in templates, this is right side)
 	exportOptions  *node.Node
 	exportable     bool
+	timestamp      time.Time // when set, exporters use it as the timestamp of all points
+	nanAsAbsent    bool      // when set, exporters skip NaN values, see SetExportNaNAsAbsent
 }
 
 type With struct {
@@ -73,11 +79,69 @@ func (m *Matrix) SetExportable(b bool) {
 	m.exportable = b
 }
 
+// SetExportNaNAsAbsent controls whether exporters skip NaN values of this matrix instead of emitting them.
+// Values set with SetValueNAN are never exported, this also covers values that are NaN because a plugin computed
+// them, e.g. a latency divided by zero ops in Volume.Run or a utilization without speed in Nic.Run.
+// Dashboards then show a gap instead of a misleading NaN or 0. Collectors set it on all matrices of a poll when the
+// template has export_nan: absent.
+func (m *Matrix) SetExportNaNAsAbsent(b bool) {
+	m.nanAsAbsent = b
+}
+
+// ExportNaNAsAbsent returns true when exporters should skip NaN values of this matrix
+func (m *Matrix) ExportNaNAsAbsent() bool {
+	return m.nanAsAbsent
+}
+
+// ExportValueFloat64 returns the value of metric for instance as exporters should see it.
+// ok is false when the value is not set, or when it is NaN and ExportNaNAsAbsent is true
+func (m *Matrix) ExportValueFloat64(metric *Metric, instance *Instance) (float64, bool) {
+	value, ok := metric.GetValueFloat64(instance)
+	if ok && m.nanAsAbsent && math.IsNaN(value) {
+		return value, false
+	}
+	return value, ok
+}
+
+// ExportValueString is ExportValueFloat64 formatted like Metric.GetValueString
+func (m *Matrix) ExportValueString(metric *Metric, instance *Instance) (string, bool) {
+	value, ok := m.ExportValueFloat64(metric, instance)
+	return strconv.FormatFloat(value, 'f', -1, 64), ok
+}
+
+// SetTimestamp sets the timestamp exporters should use for every point of this matrix.
+// Collectors use it to align all matrices of a collection cycle to the cycle start.
+func (m *Matrix) SetTimestamp(t time.Time) {
+	m.timestamp = t
+}
+
+// GetTimestamp returns the timestamp of the matrix, the zero time means exporters should
+// not set a timestamp
+func (m *Matrix) GetTimestamp() time.Time {
+	return m.timestamp
+}
+
+// ExportTimestamp returns the timestamp exporters should use for the value of metric for instance.
+// The timestamp of the metric for the instance takes precedence over the timestamp of the instance,
+// which takes precedence over the timestamp of the matrix, i.e. the cycle.
+// override is true when the timestamp is the one of the metric or the instance.
+func (m *Matrix) ExportTimestamp(metric *Metric, instance *Instance) (ts time.Time, override bool) {
+	if ts = metric.GetTimestamp(instance); !ts.IsZero() {
+		return ts, true
+	}
+	if ts = instance.GetTimestamp(); !ts.IsZero() {
+		return ts, true
+	}
+	return m.timestamp, false
+}
+
 func (m *Matrix) Clone(with With) *Matrix {
 	clone := &Matrix{UUID: m.UUID, Object: m.Object, Identifier: m.Identifier}
 	clone.globalLabels = m.globalLabels
 	clone.exportOptions = m.exportOptions
 	clone.exportable = m.exportable
+	clone.timestamp = m.timestamp
+	clone.nanAsAbsent = m.nanAsAbsent
 	clone.displayMetrics = make(map[string]string)
 
 	if with.Instances {
@@ -192,6 +256,33 @@ func (m *Matrix) RemoveMetric(key string) {
 	delete(m.metrics, key)
 }
 
+// PruneEmptyMetrics stops exporting the metrics for which no exportable instance has a valid value, i.e. a value
+// that is set and not NaN. The metrics are not removed, so their metadata is kept, but they stay non-exportable.
+// Call it on matrices created for one poll, e.g. the clone a plugin returns. It returns the keys of the pruned metrics.
+func (m *Matrix) PruneEmptyMetrics() []string {
+	var pruned []string
+	for key, metric := range m.metrics {
+		if !metric.IsExportable() {
+			continue
+		}
+		empty := true
+		for _, instance := range m.instances {
+			if !instance.IsExportable() {
+				continue
+			}
+			if v, ok := metric.GetValueFloat64(instance); ok && !math.IsNaN(v) {
+				empty = false
+				break
+			}
+		}
+		if empty {
+			metric.SetExportable(false)
+			pruned = append(pruned, key)
+		}
+	}
+	return pruned
+}
+
 func (m *Matrix) PurgeMetrics() {
 	m.metrics = make(map[string]*Metric)
 }
@@ -229,6 +320,18 @@ func (m *Matrix) GetInstances() map[string]*Instance {
 	return m.instances
 }
 
+// GetInstancesOrdered returns the instances sorted by instance key.
+// Use it instead of GetInstances when the iteration order affects the result or the logs.
+func (m *Matrix) GetInstancesOrdered() []*Instance {
+	keys := m.GetInstanceKeys()
+	sort.Strings(keys)
+	instances := make([]*Instance, 0, len(keys))
+	for _, key := range keys {
+		instances = append(instances, m.instances[key])
+	}
+	return instances
+}
+
 func (m *Matrix) PurgeInstances() {
 	m.instances = make(map[string]*Instance)
 }
@@ -1,7 +1,10 @@
 package matrix
 
 import (
+	"math"
+	"slices"
 	"testing"
+	"time"
 )
 
 func setUpMatrix() *Matrix {
@@ -47,3 +50,137 @@ func TestMatrix_RemoveInstance(t *testing.T) {
 		})
 	}
 }
+
+func TestMatrix_GetInstancesOrdered(t *testing.T) {
+	m := New("TestGetInstancesOrdered", "test", "test")
+	keys := []string{"node2.PSU2", "node1.PSU2", "node2.PSU1", "node1.PSU1"}
+	for _, key := range keys {
+		instance, _ := m.NewInstance(key)
+		instance.SetLabel("key", key)
+	}
+	want := []string{"node1.PSU1", "node1.PSU2", "node2.PSU1", "node2.PSU2"}
+
+	for run := 0; run < 10; run++ {
+		instances := m.GetInstancesOrdered()
+		if len(instances) != len(want) {
+			t.Fatalf("expected %d instances, got %d", len(want), len(instances))
+		}
+		for i, instance := range instances {
+			if got := instance.GetLabel("key"); got != want[i] {
+				t.Errorf("run %d position %d expected %s, got %s", run, i, want[i], got)
+			}
+		}
+	}
+}
+
+func TestMatrix_PruneEmptyMetrics(t *testing.T) {
+	m := New("TestPruneEmptyMetrics", "volume", "volume")
+	readLatency, _ := m.NewMetricFloat64("read_latency")
+	writeLatency, _ := m.NewMetricFloat64("write_latency")
+	_, _ = m.NewMetricFloat64("other_latency")
+	hidden, _ := m.NewMetricFloat64("total_ops")
+	hidden.SetExportable(false)
+
+	a, _ := m.NewInstance("a")
+	b, _ := m.NewInstance("b")
+	c, _ := m.NewInstance("c")
+	c.SetExportable(false)
+
+	// NaN for every volume
+	_ = readLatency.SetValueFloat64(a, math.NaN())
+	_ = readLatency.SetValueFloat64(b, math.NaN())
+	// only set for a non-exportable volume
+	_ = readLatency.SetValueFloat64(c, 1)
+	// partially populated
+	_ = writeLatency.SetValueFloat64(a, math.NaN())
+	_ = writeLatency.SetValueFloat64(b, 2)
+
+	pruned := m.PruneEmptyMetrics()
+	slices.Sort(pruned)
+	if want := []string{"other_latency", "read_latency"}; !slices.Equal(pruned, want) {
+		t.Errorf("pruned got=%v want=%v", pruned, want)
+	}
+	want := map[string]bool{"read_latency": false, "write_latency": true, "other_latency": false, "total_ops": false}
+	for key, exportable := range want {
+		metric := m.GetMetric(key)
+		if metric == nil {
+			t.Fatalf("metric %s removed", key)
+		}
+		if metric.IsExportable() != exportable {
+			t.Errorf("metric %s exportable got=%v want=%v", key, metric.IsExportable(), exportable)
+		}
+	}
+	if v, ok := writeLatency.GetValueFloat64(b); !ok || v != 2 {
+		t.Errorf("write_latency of b got=%v,%v want=2,true", v, ok)
+	}
+}
+
+func TestInstance_SetLabelPreserving(t *testing.T) {
+	instance := NewInstance(0)
+	instance.SetLabel("speed", "10000M")
+
+	instance.SetLabelPreserving("speed", "10000000000", "speed_original")
+	if got := instance.GetLabel("speed"); got != "10000000000" {
+		t.Errorf("speed got=%s want=10000000000", got)
+	}
+	if got := instance.GetLabel("speed_original"); got != "10000M" {
+		t.Errorf("speed_original got=%s want=10000M", got)
+	}
+
+	// normalizing an already normalized label keeps the original
+	instance.SetLabelPreserving("speed", "10000000000", "speed_original")
+	if got := instance.GetLabel("speed_original"); got != "10000M" {
+		t.Errorf("speed_original got=%s want=10000M", got)
+	}
+
+	// nothing to preserve when the label is not set
+	instance.SetLabelPreserving("duplex", "full", "duplex_original")
+	if _, ok := instance.GetLabels()["duplex_original"]; ok {
+		t.Errorf("expected no duplex_original")
+	}
+}
+
+func TestMatrix_ExportTimestamp(t *testing.T) {
+	cycle := time.Unix(1700000060, 0)
+	instanceTime := time.Unix(1700000030, 0)
+	metricTime := time.Unix(1700000010, 0)
+
+	m := New("Test", "test", "test")
+	m.SetTimestamp(cycle)
+	metric, _ := m.NewMetricFloat64("reading")
+	a, _ := m.NewInstance("a")
+	b, _ := m.NewInstance("b")
+	c, _ := m.NewInstance("c")
+	b.SetTimestamp(instanceTime)
+	c.SetTimestamp(instanceTime)
+	metric.SetTimestamp(c, metricTime)
+
+	tests := []struct {
+		name         string
+		instance     *Instance
+		want         time.Time
+		wantOverride bool
+	}{
+		{name: "cycle", instance: a, want: cycle},
+		{name: "instance", instance: b, want: instanceTime, wantOverride: true},
+		{name: "metric", instance: c, want: metricTime, wantOverride: true},
+	}
+	for _, tt := range tests {
+		got, override := m.ExportTimestamp(metric, tt.instance)
+		if !got.Equal(tt.want) || override != tt.wantOverride {
+			t.Errorf("%s: got %v %v, want %v %v", tt.name, got, override, tt.want, tt.wantOverride)
+		}
+	}
+
+	// the metric timestamp follows its instance when another instance is removed
+	m.RemoveInstance("a")
+	if got := metric.GetTimestamp(c); !got.Equal(metricTime) {
+		t.Errorf("after remove expected %v, got %v", metricTime, got)
+	}
+	if got := metric.GetTimestamp(b); !got.IsZero() {
+		t.Errorf("after remove expected no timestamp, got %v", got)
+	}
+	if clone := m.Clone(With{Data: true, Metrics: true, Instances: true}); !clone.GetMetric("reading").GetTimestamp(clone.GetInstance("c")).Equal(metricTime) {
+		t.Errorf("clone lost the metric timestamp")
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"fmt"
 	"maps"
 	"strconv"
+	"time"
 )
 
 type Metric struct {
@@ -27,8 +28,10 @@ type Metric struct {
 	exportable bool
 	labels     map[string]string
 	buckets    *[]string
+	bounds     *Bounds
 	record     []bool
 	values     []float64
+	timestamps []int64 // unix nanoseconds, allocated by the first SetTimestamp, 0 means no timestamp
 }
 
 func (m *Metric) Clone(deep bool) *Metric {
@@ -41,6 +44,7 @@ func (m *Metric) Clone(deep bool) *Metric {
 		array:      m.array,
 		histogram:  m.histogram,
 		buckets:    m.buckets,
+		bounds:     m.bounds,
 	}
 	clone.labels = maps.Clone(m.labels)
 	if deep {
@@ -52,10 +56,27 @@ func (m *Metric) Clone(deep bool) *Metric {
 			clone.values = make([]float64, len(m.values))
 			copy(clone.values, m.values)
 		}
+		if m.timestamps != nil {
+			clone.timestamps = make([]int64, len(m.timestamps))
+			copy(clone.timestamps, m.timestamps)
+		}
 	}
 	return &clone
 }
 
+// SetBounds sets the range of values expected for this metric, see Matrix.ValidateBounds
+func (m *Metric) SetBounds(lo, hi float64) {
+	m.bounds = &Bounds{Min: lo, Max: hi}
+}
+
+// GetBounds returns the expected range of values and false when the metric has no bounds
+func (m *Metric) GetBounds() (Bounds, bool) {
+	if m.bounds == nil {
+		return Bounds{}, false
+	}
+	return *m.bounds, true
+}
+
 func (m *Metric) GetName() string {
 	return m.name
 }
@@ -151,11 +172,15 @@ func (m *Metric) SetValueNAN(i *Instance) {
 func (m *Metric) Reset(size int) {
 	m.record = make([]bool, size)
 	m.values = make([]float64, size)
+	m.timestamps = nil
 }
 
 func (m *Metric) Append() {
 	m.record = append(m.record, false)
 	m.values = append(m.values, 0)
+	if m.timestamps != nil {
+		m.timestamps = append(m.timestamps, 0)
+	}
 }
 
 // Remove element at index, shift everything to the left
@@ -166,6 +191,35 @@ func (m *Metric) Remove(index int) {
 	}
 	m.record = m.record[:len(m.record)-1]
 	m.values = m.values[:len(m.values)-1]
+	if m.timestamps != nil {
+		copy(m.timestamps[index:], m.timestamps[index+1:])
+		m.timestamps = m.timestamps[:len(m.timestamps)-1]
+	}
+}
+
+// SetTimestamp sets when the value of the metric for instance i was measured. It takes precedence over the
+// timestamp of the instance, see Matrix.ExportTimestamp. The zero time removes the timestamp.
+// The timestamp is kept until it is changed or the metric is reset.
+func (m *Metric) SetTimestamp(i *Instance, t time.Time) {
+	if m.timestamps == nil {
+		if t.IsZero() {
+			return
+		}
+		m.timestamps = make([]int64, len(m.values))
+	}
+	if t.IsZero() {
+		m.timestamps[i.index] = 0
+	} else {
+		m.timestamps[i.index] = t.UnixNano()
+	}
+}
+
+// GetTimestamp returns the timestamp of the value of the metric for instance i, the zero time when it has none
+func (m *Metric) GetTimestamp(i *Instance) time.Time {
+	if m.timestamps == nil || m.timestamps[i.index] == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, m.timestamps[i.index])
 }
 
 // Write methods
@@ -194,6 +248,36 @@ func (m *Metric) SetValueFloat64(i *Instance, v float64) error {
 	return nil
 }
 
+// SetValues sets the values of many instances of mat at once, keyed by instance key.
+// Instances not yet in mat are created. m must be a metric of mat.
+// It returns the number of instances created.
+func (m *Metric) SetValues(mat *Matrix, values map[string]float64) int {
+	created := 0
+	for key, v := range values {
+		instance, has := mat.instances[key]
+		if !has {
+			instance, _ = mat.NewInstance(key)
+			created++
+		}
+		m.record[instance.index] = true
+		m.values[instance.index] = v
+	}
+	return created
+}
+
+// SetValuesAt writes values directly into the value slice, values[i] is the value of instances[i].
+// This is the fastest way to set many values when the instances are already known, e.g. in a rollup.
+func (m *Metric) SetValuesAt(instances []*Instance, values []float64) error {
+	if len(instances) != len(values) {
+		return ErrUnequalVectors
+	}
+	for i, instance := range instances {
+		m.record[instance.index] = true
+		m.values[instance.index] = values[i]
+	}
+	return nil
+}
+
 func (m *Metric) SetValueString(i *Instance, v string) error {
 	var x float64
 	var err error
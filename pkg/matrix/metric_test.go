@@ -2,6 +2,7 @@ package matrix
 
 import (
 	"github.com/netapp/harvest/v2/pkg/logging"
+	"strconv"
 	"testing"
 )
 
@@ -311,3 +312,87 @@ func TestMetricReset(t *testing.T) {
 		t.Errorf("expected metric to be skipped but passed")
 	}
 }
+
+func TestMetric_SetValues(t *testing.T) {
+	m := New("Test", "test", "test")
+	size, _ := m.NewMetricFloat64("size")
+	used, _ := m.NewMetricFloat64("used")
+	a, _ := m.NewInstance("a")
+	_ = used.SetValueFloat64(a, 5)
+
+	created := size.SetValues(m, map[string]float64{"a": 10, "b": 20, "c": 30})
+	if created != 2 {
+		t.Errorf("created expected = 2, got %d", created)
+	}
+	for key, want := range map[string]float64{"a": 10, "b": 20, "c": 30} {
+		got, ok := size.GetValueFloat64(m.GetInstance(key))
+		if !ok || got != want {
+			t.Errorf("%s size expected = %v, got %v,%t", key, want, got, ok)
+		}
+	}
+
+	// other metrics grow with the new instances and keep their values
+	if got, ok := used.GetValueFloat64(a); !ok || got != 5 {
+		t.Errorf("a used expected = 5, got %v,%t", got, ok)
+	}
+	if _, ok := used.GetValueFloat64(m.GetInstance("b")); ok {
+		t.Errorf("b used expected to be unset")
+	}
+
+	instances := []*Instance{m.GetInstance("c"), a}
+	if err := used.SetValuesAt(instances, []float64{7, 8}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for key, want := range map[string]float64{"a": 8, "c": 7} {
+		if got, ok := used.GetValueFloat64(m.GetInstance(key)); !ok || got != want {
+			t.Errorf("%s used expected = %v, got %v,%t", key, want, got, ok)
+		}
+	}
+	if err := used.SetValuesAt(instances, []float64{1}); err != ErrUnequalVectors {
+		t.Errorf("expected ErrUnequalVectors, got %v", err)
+	}
+}
+
+func benchmarkValues(n int) (*Matrix, *Metric, map[string]float64) {
+	m := New("Test", "test", "test")
+	metric, _ := m.NewMetricFloat64("size")
+	values := make(map[string]float64, n)
+	for i := 0; i < n; i++ {
+		key := strconv.Itoa(i)
+		_, _ = m.NewInstance(key)
+		values[key] = float64(i)
+	}
+	return m, metric, values
+}
+
+func BenchmarkMetric_SetValues(b *testing.B) {
+	m, metric, values := benchmarkValues(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		metric.SetValues(m, values)
+	}
+}
+
+func BenchmarkMetric_SetValuesAt(b *testing.B) {
+	m, metric, values := benchmarkValues(10000)
+	instances := make([]*Instance, 0, len(values))
+	vs := make([]float64, 0, len(values))
+	for key, v := range values {
+		instances = append(instances, m.GetInstance(key))
+		vs = append(vs, v)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = metric.SetValuesAt(instances, vs)
+	}
+}
+
+func BenchmarkMetric_SetValueFloat64(b *testing.B) {
+	m, metric, values := benchmarkValues(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for key, v := range values {
+			_ = metric.SetValueFloat64(m.GetInstance(key), v)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package matrix
+
+import "sync"
+
+// Reader gives plugins read-only access to the matrices published by other collectors of the same poller
+type Reader interface {
+	// Get returns the latest published matrix of object, e.g. node
+	Get(object string) (*Matrix, bool)
+}
+
+// Registry holds the latest published matrix of each object. It is safe for concurrent use.
+// Published matrices are copies, so the publishing collector can keep modifying its own matrix.
+type Registry struct {
+	mu   sync.RWMutex
+	data map[string]*Matrix
+}
+
+// Shared is the registry of the poller, collectors publish to it when their template sets publish: true
+var Shared = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{data: make(map[string]*Matrix)}
+}
+
+// Publish stores a copy of data under its object name, replacing the previous one
+func (r *Registry) Publish(data *Matrix) {
+	clone := data.Clone(With{Data: true, Metrics: true, Instances: true, ExportInstances: true})
+	r.mu.Lock()
+	r.data[data.Object] = clone
+	r.mu.Unlock()
+}
+
+// Get returns the latest matrix published for object. The matrix is shared between readers and must not be modified.
+func (r *Registry) Get(object string) (*Matrix, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	data, ok := r.data[object]
+	return data, ok
+}
@@ -0,0 +1,46 @@
+package matrix
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	if _, ok := r.Get("node"); ok {
+		t.Fatal("expected empty registry")
+	}
+
+	data := New("ZapiPerf", "node", "node")
+	ops, _ := data.NewMetricFloat64("total_ops")
+	instance, _ := data.NewInstance("n1")
+	_ = ops.SetValueFloat64(instance, 1000)
+	r.Publish(data)
+
+	// the publisher keeps modifying its own matrix
+	_ = ops.SetValueFloat64(instance, 5)
+
+	published, ok := r.Get("node")
+	if !ok {
+		t.Fatal("expected node to be published")
+	}
+	got, _ := published.DisplayMetric("total_ops").GetValueFloat64(published.GetInstance("n1"))
+	if got != 1000 {
+		t.Errorf("published total_ops got=%v want=1000", got)
+	}
+
+	// concurrent publish and read, run with -race
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			r.Publish(data)
+		}()
+		go func() {
+			defer wg.Done()
+			_, _ = r.Get("node")
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,131 @@
+package matrix
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Relabel actions, see RelabelRule
+const (
+	RelabelKeep      = "keep"
+	RelabelDrop      = "drop"
+	RelabelReplace   = "replace"
+	RelabelLabelMap  = "labelmap"
+	RelabelLabelDrop = "labeldrop"
+)
+
+// RelabelRule rewrites instance labels at export time, following the semantics of Prometheus relabel_configs.
+//
+//   - keep: instances whose joined source labels do not match Regex are not exported
+//   - drop: instances whose joined source labels match Regex are not exported
+//   - replace: when the joined source labels match Regex, TargetLabel is set to Replacement with $1, $2... expanded
+//   - labelmap: labels whose name matches Regex are copied to the label named by Replacement
+//   - labeldrop: labels whose name matches Regex are removed
+type RelabelRule struct {
+	Action       string
+	SourceLabels []string
+	Separator    string
+	Regex        *regexp.Regexp
+	TargetLabel  string
+	Replacement  string
+}
+
+// NewRelabelRule validates a rule and fills in the Prometheus defaults.
+// The regex is anchored on both ends and defaults to (.*), the separator to ; and the replacement to $1
+func NewRelabelRule(action string, sourceLabels []string, separator string, regex string, targetLabel string, replacement string) (*RelabelRule, error) {
+	if regex == "" {
+		regex = "(.*)"
+	}
+	re, err := regexp.Compile("^(?:" + regex + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid relabel regex %s: %w", regex, err)
+	}
+	if separator == "" {
+		separator = ";"
+	}
+	if replacement == "" {
+		replacement = "$1"
+	}
+	switch action {
+	case RelabelKeep, RelabelDrop:
+		if len(sourceLabels) == 0 {
+			return nil, fmt.Errorf("relabel action %s requires source_labels", action)
+		}
+	case RelabelReplace:
+		if targetLabel == "" {
+			return nil, fmt.Errorf("relabel action %s requires target_label", action)
+		}
+	case RelabelLabelMap, RelabelLabelDrop:
+	default:
+		return nil, fmt.Errorf("unknown relabel action %s", action)
+	}
+	return &RelabelRule{
+		Action:       action,
+		SourceLabels: sourceLabels,
+		Separator:    separator,
+		Regex:        re,
+		TargetLabel:  targetLabel,
+		Replacement:  replacement,
+	}, nil
+}
+
+// apply rewrites the labels of instance and returns false when the instance should not be exported
+func (r *RelabelRule) apply(instance *Instance) bool {
+	switch r.Action {
+	case RelabelKeep:
+		return r.Regex.MatchString(r.sourceValue(instance))
+	case RelabelDrop:
+		return !r.Regex.MatchString(r.sourceValue(instance))
+	case RelabelReplace:
+		value := r.sourceValue(instance)
+		match := r.Regex.FindStringSubmatchIndex(value)
+		if match == nil {
+			return true
+		}
+		instance.SetLabel(r.TargetLabel, string(r.Regex.ExpandString(nil, r.Replacement, value, match)))
+	case RelabelLabelMap:
+		for name, value := range instance.Copy() {
+			if match := r.Regex.FindStringSubmatchIndex(name); match != nil {
+				instance.SetLabel(string(r.Regex.ExpandString(nil, r.Replacement, name, match)), value)
+			}
+		}
+	case RelabelLabelDrop:
+		for name := range instance.Copy() {
+			if r.Regex.MatchString(name) {
+				instance.RemoveLabel(name)
+			}
+		}
+	}
+	return true
+}
+
+func (r *RelabelRule) sourceValue(instance *Instance) string {
+	values := make([]string, 0, len(r.SourceLabels))
+	for _, label := range r.SourceLabels {
+		values = append(values, instance.GetLabel(label))
+	}
+	return strings.Join(values, r.Separator)
+}
+
+// Relabel returns a copy of data with the rules applied in order to the labels of each exportable instance.
+// Instances dropped by a keep or drop rule are not exportable in the copy. data is not modified.
+// When there are no rules, data is returned as is.
+func Relabel(data *Matrix, rules []*RelabelRule) *Matrix {
+	if len(rules) == 0 {
+		return data
+	}
+	relabeled := data.Clone(With{Data: true, Metrics: true, Instances: true, ExportInstances: true})
+	for _, instance := range relabeled.GetInstances() {
+		if !instance.IsExportable() {
+			continue
+		}
+		for _, rule := range rules {
+			if !rule.apply(instance) {
+				instance.SetExportable(false)
+				break
+			}
+		}
+	}
+	return relabeled
+}
@@ -0,0 +1,128 @@
+package matrix
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestRelabel(t *testing.T) {
+	type rule struct {
+		action       string
+		sourceLabels []string
+		regex        string
+		targetLabel  string
+		replacement  string
+	}
+	tests := []struct {
+		name       string
+		rules      []rule
+		exportable map[string]bool
+		labels     map[string]map[string]string
+	}{
+		{
+			name:       "keep",
+			rules:      []rule{{action: RelabelKeep, sourceLabels: []string{"svm"}, regex: "svm1|svm2"}},
+			exportable: map[string]bool{"vol1": true, "vol2": true, "vol3": false},
+		},
+		{
+			name:       "drop",
+			rules:      []rule{{action: RelabelDrop, sourceLabels: []string{"svm", "volume"}, regex: "svm1;vol.*"}},
+			exportable: map[string]bool{"vol1": false, "vol2": true, "vol3": true},
+		},
+		{
+			name: "regex replace",
+			rules: []rule{{action: RelabelReplace, sourceLabels: []string{"node"}, regex: "(.*)-(\\d+)",
+				targetLabel: "node_number", replacement: "n$2"}},
+			exportable: map[string]bool{"vol1": true, "vol2": true, "vol3": true},
+			labels: map[string]map[string]string{
+				"vol1": {"node": "cluster-01", "node_number": "n01"},
+				"vol3": {"node": "cluster-02", "node_number": "n02"},
+			},
+		},
+		{
+			name: "rename with labelmap and labeldrop",
+			rules: []rule{
+				{action: RelabelLabelMap, regex: "svm", replacement: "vserver"},
+				{action: RelabelLabelDrop, regex: "svm"},
+			},
+			exportable: map[string]bool{"vol1": true, "vol2": true, "vol3": true},
+			labels: map[string]map[string]string{
+				"vol2": {"vserver": "svm2", "svm": ""},
+			},
+		},
+		{
+			name: "rules applied in order",
+			rules: []rule{
+				{action: RelabelReplace, sourceLabels: []string{"svm"}, regex: "svm(\\d)", targetLabel: "tenant", replacement: "t$1"},
+				{action: RelabelKeep, sourceLabels: []string{"tenant"}, regex: "t1"},
+			},
+			exportable: map[string]bool{"vol1": true, "vol2": false, "vol3": false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := New("uuid", "volume", "volume")
+			instances := map[string]map[string]string{
+				"vol1": {"volume": "vol1", "svm": "svm1", "node": "cluster-01"},
+				"vol2": {"volume": "vol2", "svm": "svm2", "node": "cluster-01"},
+				"vol3": {"volume": "vol3", "svm": "svm3", "node": "cluster-02"},
+			}
+			for key, labels := range instances {
+				instance, _ := data.NewInstance(key)
+				instance.SetLabels(maps.Clone(labels))
+			}
+			var rules []*RelabelRule
+			for _, r := range tt.rules {
+				rule, err := NewRelabelRule(r.action, r.sourceLabels, "", r.regex, r.targetLabel, r.replacement)
+				if err != nil {
+					t.Fatal(err)
+				}
+				rules = append(rules, rule)
+			}
+
+			relabeled := Relabel(data, rules)
+
+			for key, exp := range tt.exportable {
+				if got := relabeled.GetInstance(key).IsExportable(); got != exp {
+					t.Errorf("%s exportable got=%v want=%v", key, got, exp)
+				}
+			}
+			for key, labels := range tt.labels {
+				for k, exp := range labels {
+					if got := relabeled.GetInstance(key).GetLabel(k); got != exp {
+						t.Errorf("%s label %s got=%q want=%q", key, k, got, exp)
+					}
+				}
+			}
+			// the source matrix is shared by all exporters and must not change
+			for key, labels := range instances {
+				instance := data.GetInstance(key)
+				if !maps.Equal(instance.GetLabels(), labels) || !instance.IsExportable() {
+					t.Errorf("%s source instance was modified", key)
+				}
+			}
+		})
+	}
+}
+
+func TestNewRelabelRule(t *testing.T) {
+	tests := []struct {
+		name         string
+		action       string
+		sourceLabels []string
+		regex        string
+		targetLabel  string
+	}{
+		{name: "unknown action", action: "hashmod", sourceLabels: []string{"svm"}},
+		{name: "keep without source labels", action: RelabelKeep},
+		{name: "replace without target", action: RelabelReplace, sourceLabels: []string{"svm"}},
+		{name: "invalid regex", action: RelabelDrop, sourceLabels: []string{"svm"}, regex: "("},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRelabelRule(tt.action, tt.sourceLabels, "", tt.regex, tt.targetLabel, ""); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package matrix
+
+// Thresholds used by SemanticsChecker
+const (
+	// SemanticsMinSamples is the number of polls a metric is compared with its previous values before it is judged.
+	// Polls are counted per metric, not per instance, so a matrix with many instances is not judged sooner
+	SemanticsMinSamples = 5
+	// RawMonotonicRatio is the ratio of increasing changes above which a raw metric looks like a counter
+	RawMonotonicRatio = 0.95
+	// CounterDecreaseRatio is the ratio of decreasing changes above which a counter looks like a raw gauge.
+	// Counters may decrease occasionally when they wrap or are reset, so this ratio is well above zero.
+	CounterDecreaseRatio = 0.3
+)
+
+// Advisory describes a metric whose values do not behave like its property suggests
+type Advisory struct {
+	Metric    string
+	Property  string
+	Suggested string
+	// Ratio is the ratio of increasing changes for raw metrics and decreasing changes for counters
+	Ratio float64
+}
+
+type semanticsStats struct {
+	// polls in which at least one instance had a previous value to compare with
+	polls     int
+	increases int
+	decreases int
+}
+
+// SemanticsChecker is a diagnostic aid that watches raw (uncooked) values of a matrix over several polls
+// and flags metrics whose property is likely wrong.
+// A raw metric that only ever increases is probably a counter and should be cooked as delta or rate.
+// A counter that frequently decreases is probably a gauge and should be raw.
+// Each metric is reported at most once and nothing is changed.
+type SemanticsChecker struct {
+	// metric key => instance key => last value
+	last map[string]map[string]float64
+	// metric key => observed polls and changes
+	stats map[string]*semanticsStats
+	// metric keys already reported
+	advised map[string]bool
+}
+
+func NewSemanticsChecker() *SemanticsChecker {
+	return &SemanticsChecker{
+		last:    make(map[string]map[string]float64),
+		stats:   make(map[string]*semanticsStats),
+		advised: make(map[string]bool),
+	}
+}
+
+// Observe records the values of data and returns the advisories for metrics that crossed a threshold
+// in this call. data must hold raw values, i.e. it must be observed before delta or rate calculations.
+// Metrics without property, the timestamp and histograms are ignored.
+func (s *SemanticsChecker) Observe(data *Matrix) []Advisory {
+	var advisories []Advisory
+	for mKey, metric := range data.GetMetrics() {
+		property := metric.GetProperty()
+		if property == "" || metric.GetName() == "timestamp" || metric.IsHistogram() || s.advised[mKey] {
+			continue
+		}
+		last, ok := s.last[mKey]
+		if !ok {
+			last = make(map[string]float64)
+			s.last[mKey] = last
+		}
+		stats, ok := s.stats[mKey]
+		if !ok {
+			stats = &semanticsStats{}
+			s.stats[mKey] = stats
+		}
+		compared := false
+		for iKey, instance := range data.GetInstances() {
+			value, ok := metric.GetValueFloat64(instance)
+			if !ok {
+				continue
+			}
+			if prev, seen := last[iKey]; seen {
+				compared = true
+				if value > prev {
+					stats.increases++
+				} else if value < prev {
+					stats.decreases++
+				}
+			}
+			last[iKey] = value
+		}
+		if compared {
+			stats.polls++
+		}
+		if advisory, ok := stats.judge(metric.GetName(), property); ok {
+			s.advised[mKey] = true
+			// nothing more to learn about this metric
+			delete(s.last, mKey)
+			delete(s.stats, mKey)
+			advisories = append(advisories, advisory)
+		}
+	}
+	return advisories
+}
+
+func (st *semanticsStats) judge(name string, property string) (Advisory, bool) {
+	changes := st.increases + st.decreases
+	if st.polls < SemanticsMinSamples || changes == 0 {
+		return Advisory{}, false
+	}
+	if property == "raw" {
+		ratio := float64(st.increases) / float64(changes)
+		if ratio >= RawMonotonicRatio {
+			return Advisory{Metric: name, Property: property, Suggested: "delta", Ratio: ratio}, true
+		}
+		return Advisory{}, false
+	}
+	ratio := float64(st.decreases) / float64(changes)
+	if ratio >= CounterDecreaseRatio {
+		return Advisory{Metric: name, Property: property, Suggested: "raw", Ratio: ratio}, true
+	}
+	return Advisory{}, false
+}
@@ -0,0 +1,82 @@
+package matrix
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestSemanticsChecker_Observe(t *testing.T) {
+	tests := []struct {
+		name      string
+		property  string
+		series    []float64
+		suggested string
+		// poll on which the advisory is expected, -1 for none
+		advisedAt int
+	}{
+		{name: "monotonic raw", property: "raw", series: []float64{10, 20, 30, 40, 50, 60, 70}, suggested: "delta", advisedAt: 5},
+		{name: "fluctuating raw", property: "raw", series: []float64{10, 30, 20, 40, 35, 50, 45}, advisedAt: -1},
+		{name: "monotonic counter", property: "rate", series: []float64{10, 20, 30, 40, 50, 60, 70}, advisedAt: -1},
+		{name: "counter with one reset", property: "delta", series: []float64{10, 20, 30, 0, 10, 20, 30, 40, 50}, advisedAt: -1},
+		{name: "fluctuating counter", property: "delta", series: []float64{10, 30, 20, 40, 35, 50, 45}, suggested: "raw", advisedAt: 5},
+		{name: "flat raw", property: "raw", series: []float64{10, 10, 10, 10, 10, 10, 10}, advisedAt: -1},
+		{name: "no property", series: []float64{10, 20, 30, 40, 50, 60, 70}, advisedAt: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewSemanticsChecker()
+			data := New("uuid", "object", "identifier")
+			metric, _ := data.NewMetricFloat64("read_ops")
+			metric.SetProperty(tt.property)
+			instance, _ := data.NewInstance("a")
+			data.Reset()
+
+			advisedAt := -1
+			for i, v := range tt.series {
+				_ = metric.SetValueFloat64(instance, v)
+				raw := data.Clone(With{Data: true, Metrics: true, Instances: true})
+				got := checker.Observe(raw)
+				if len(got) == 0 {
+					continue
+				}
+				if advisedAt != -1 {
+					t.Fatalf("advisory repeated on poll %d", i)
+				}
+				advisedAt = i
+				if got[0].Metric != "read_ops" || got[0].Property != tt.property || got[0].Suggested != tt.suggested {
+					t.Errorf("unexpected advisory %+v", got[0])
+				}
+			}
+			if advisedAt != tt.advisedAt {
+				t.Errorf("advised on poll %d, expected %d", advisedAt, tt.advisedAt)
+			}
+		})
+	}
+}
+
+func TestSemanticsChecker_ManyInstances(t *testing.T) {
+	checker := NewSemanticsChecker()
+	data := New("uuid", "object", "identifier")
+	metric, _ := data.NewMetricFloat64("read_ops")
+	metric.SetProperty("raw")
+	var instances []*Instance
+	for i := 0; i < 20; i++ {
+		instance, _ := data.NewInstance(strconv.Itoa(i))
+		instances = append(instances, instance)
+	}
+	data.Reset()
+
+	// every instance increases on every poll, changes add up quickly but the polls do not
+	for poll := 0; poll <= SemanticsMinSamples; poll++ {
+		for i, instance := range instances {
+			_ = metric.SetValueFloat64(instance, float64(poll*100+i))
+		}
+		got := checker.Observe(data.Clone(With{Data: true, Metrics: true, Instances: true}))
+		if poll < SemanticsMinSamples && len(got) != 0 {
+			t.Fatalf("advisory on poll %d with %d instances", poll, len(instances))
+		}
+		if poll == SemanticsMinSamples && (len(got) != 1 || got[0].Suggested != "delta") {
+			t.Errorf("advisories on poll %d got=%+v want one suggesting delta", poll, got)
+		}
+	}
+}
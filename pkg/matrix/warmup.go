@@ -0,0 +1,39 @@
+package matrix
+
+import "time"
+
+// Warmup suppresses cooked values, i.e. metrics with a property other than raw, for the first polls after
+// a collector starts. Counters are often reset or incomplete right after a restart, which turns the first
+// deltas and rates into spikes.
+type Warmup struct {
+	cycles int
+	until  time.Time
+	seen   int
+}
+
+// NewWarmup returns a warmup lasting cycles polls and, when period is not zero, at least until start+period
+func NewWarmup(cycles int, period time.Duration, start time.Time) *Warmup {
+	w := &Warmup{cycles: cycles}
+	if period > 0 {
+		w.until = start.Add(period)
+	}
+	return w
+}
+
+// Apply counts one poll and, while warming up, marks the cooked values of data as missing.
+// It returns true when values were suppressed. Raw metrics are exported as usual.
+func (w *Warmup) Apply(data *Matrix, now time.Time) bool {
+	w.seen++
+	if w.seen > w.cycles && !now.Before(w.until) {
+		return false
+	}
+	for _, metric := range data.GetMetrics() {
+		if property := metric.GetProperty(); property == "" || property == "raw" {
+			continue
+		}
+		for i := range metric.record {
+			metric.record[i] = false
+		}
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package matrix
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWarmup_Apply(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name   string
+		warmup *Warmup
+		polls  []time.Time
+		// expected suppression per poll
+		suppressed []bool
+	}{
+		{
+			name:       "cycles",
+			warmup:     NewWarmup(2, 0, start),
+			polls:      []time.Time{start, start, start, start},
+			suppressed: []bool{true, true, false, false},
+		},
+		{
+			name:       "period",
+			warmup:     NewWarmup(0, 5*time.Minute, start),
+			polls:      []time.Time{start.Add(time.Minute), start.Add(4 * time.Minute), start.Add(5 * time.Minute)},
+			suppressed: []bool{true, true, false},
+		},
+		{
+			name:       "cycles and period",
+			warmup:     NewWarmup(2, time.Minute, start),
+			polls:      []time.Time{start.Add(2 * time.Minute), start.Add(3 * time.Minute), start.Add(4 * time.Minute)},
+			suppressed: []bool{true, true, false},
+		},
+		{
+			name:       "disabled",
+			warmup:     NewWarmup(0, 0, start),
+			polls:      []time.Time{start},
+			suppressed: []bool{false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, now := range tt.polls {
+				data := New("uuid", "volume", "volume")
+				ops, _ := data.NewMetricFloat64("read_ops")
+				ops.SetProperty("rate")
+				size, _ := data.NewMetricFloat64("size")
+				size.SetProperty("raw")
+				instance, _ := data.NewInstance("a")
+				_ = ops.SetValueFloat64(instance, 10)
+				_ = size.SetValueFloat64(instance, 20)
+
+				got := tt.warmup.Apply(data, now)
+				if got != tt.suppressed[i] {
+					t.Errorf("poll %d suppressed got=%t want=%t", i, got, tt.suppressed[i])
+				}
+				if _, ok := ops.GetValueFloat64(instance); ok == tt.suppressed[i] {
+					t.Errorf("poll %d read_ops exported=%t", i, ok)
+				}
+				if _, ok := size.GetValueFloat64(instance); !ok {
+					t.Errorf("poll %d raw size not exported", i)
+				}
+			}
+		})
+	}
+}
@@ -6,11 +6,13 @@ package node
 
 import (
 	"bytes"
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"github.com/netapp/harvest/v2/pkg/util"
 	"regexp"
 	"slices"
+	"sort"
 	"strings"
 )
 
@@ -74,6 +76,16 @@ func (n *Node) GetParent() *Node {
 	return n.parent
 }
 
+// Depth returns the number of ancestors of n, the root has depth 0.
+// Nodes added with AddChild have no parent and also have depth 0.
+func (n *Node) Depth() int {
+	depth := 0
+	for p := n.GetParent(); p != nil; p = p.GetParent() {
+		depth++
+	}
+	return depth
+}
+
 func (n *Node) GetAttr(name string) (xml.Attr, bool) {
 	var attr xml.Attr
 	for _, attr = range n.Attrs {
@@ -129,11 +141,14 @@ func (n *Node) HasChildS(name string) bool {
 	return n.GetChildS(name) != nil
 }
 
+// PopChild removes the first child with the given name and returns it.
+// The parent of the returned child is cleared, so it can be added to another node.
 func (n *Node) PopChild(name []byte) *Node {
 	for i, child := range n.Children {
 		if bytes.Equal(child.GetName(), name) {
 			n.Children[i] = n.Children[len(n.Children)-1]
 			n.Children = n.Children[:len(n.Children)-1]
+			child.parent = nil
 			return child
 		}
 	}
@@ -144,6 +159,12 @@ func (n *Node) PopChildS(name string) *Node {
 	return n.PopChild([]byte(name))
 }
 
+// DetachChild removes the child with the given name from n and returns it without a parent.
+// It returns nil when n has no such child.
+func (n *Node) DetachChild(name string) *Node {
+	return n.PopChildS(name)
+}
+
 func (n *Node) NewChild(name, content []byte) *Node {
 	var child *Node
 	if n.GetXMLNameS() != "" {
@@ -165,6 +186,25 @@ func (n *Node) AddChild(child *Node) {
 	n.Children = append(n.Children, child)
 }
 
+// SortChildren sorts the children of n and of every node below it with less. The sort is stable,
+// so children that compare equal, e.g. unnamed list items, keep their order.
+// Nodes are never sorted implicitly since child order can be meaningful
+func (n *Node) SortChildren(less func(a, b *Node) bool) {
+	n.Walk(func(node *Node, _ int) bool {
+		sort.SliceStable(node.Children, func(i, j int) bool {
+			return less(node.Children[i], node.Children[j])
+		})
+		return true
+	})
+}
+
+// SortChildrenByName sorts the children of n and of every node below it by name, see SortChildren
+func (n *Node) SortChildrenByName() {
+	n.SortChildren(func(a, b *Node) bool {
+		return a.GetNameS() < b.GetNameS()
+	})
+}
+
 func (n *Node) GetContent() []byte {
 	if content := bytes.TrimSpace(n.Content); len(content) != 0 {
 		if content[0] != '<' {
@@ -212,6 +252,27 @@ func (n *Node) GetChildByContent(content string) *Node {
 	return nil
 }
 
+// GetChildByAttr returns the first child with an attribute name equal to value, nil when there is none
+func (n *Node) GetChildByAttr(name, value string) *Node {
+	for _, child := range n.Children {
+		if v, ok := child.GetAttrValueS(name); ok && v == value {
+			return child
+		}
+	}
+	return nil
+}
+
+// GetChildrenByAttr returns all children with an attribute name equal to value, in document order
+func (n *Node) GetChildrenByAttr(name, value string) []*Node {
+	children := make([]*Node, 0)
+	for _, child := range n.Children {
+		if v, ok := child.GetAttrValueS(name); ok && v == value {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
 func (n *Node) SetChildContentS(name, content string) {
 	if child := n.GetChildS(name); child != nil {
 		child.SetContentS(content)
@@ -258,6 +319,28 @@ func (n *Node) Copy() *Node {
 	return clone
 }
 
+// Map returns a deep copy of n where the content of each node is replaced by fn of the original node.
+// Names, attributes and structure are kept, n is not modified.
+func (n *Node) Map(fn func(*Node) string) *Node {
+	if n == nil {
+		return nil
+	}
+	var clone *Node
+	if n.GetXMLNameS() != "" {
+		clone = NewXML(n.GetName())
+	} else {
+		clone = New(n.GetName())
+	}
+	clone.Attrs = slices.Clone(n.Attrs)
+	clone.SetContentS(fn(n))
+	for _, child := range n.Children {
+		mapped := child.Map(fn)
+		mapped.parent = clone
+		clone.AddChild(mapped)
+	}
+	return clone
+}
+
 func (n *Node) Union(source *Node) {
 	if len(n.GetContent()) == 0 {
 		n.SetContent(source.GetContent())
@@ -305,8 +388,48 @@ func (n *Node) PreprocessTemplate() {
 	}
 }
 
+// RemoveSentinel is the content a subtemplate uses to delete a node during Merge.
+// A named child with this content removes the receiver's child of the same name, including its children.
+// An unnamed child, e.g. a counter, with the content RemoveSentinel followed by a space and a value removes
+// the receiver's unnamed child with that value as content
+var RemoveSentinel = "__REMOVE__"
+
+// removeChild deletes child from the children of n, keeping the order of the others
+func (n *Node) removeChild(child *Node) {
+	if i := slices.Index(n.Children, child); i >= 0 {
+		n.Children = slices.Delete(n.Children, i, i+1)
+		child.parent = nil
+	}
+}
+
+// mergeRemove handles a child of a subtemplate that uses RemoveSentinel and reports whether it did
+func (n *Node) mergeRemove(child *Node) bool {
+	if RemoveSentinel == "" {
+		return false
+	}
+	content := string(child.GetContent())
+	if len(child.GetName()) != 0 {
+		if content != RemoveSentinel {
+			return false
+		}
+		if mine := n.GetChild(child.GetName()); mine != nil {
+			n.removeChild(mine)
+		}
+		return true
+	}
+	value, ok := strings.CutPrefix(content, RemoveSentinel+" ")
+	if !ok {
+		return false
+	}
+	if mine := n.GetChildByContent(strings.TrimSpace(value)); mine != nil {
+		n.removeChild(mine)
+	}
+	return true
+}
+
 // Merge method will merge the subtemplate into the receiver, modifying the receiver in-place.
 // skipOverwrite is a readonly list of keys that will not be overwritten in the receiver.
+// A subtemplate child that uses RemoveSentinel removes the receiver's matching child instead of being merged.
 func (n *Node) Merge(subtemplate *Node, skipOverwrite []string) {
 	if subtemplate == nil {
 		return
@@ -315,6 +438,9 @@ func (n *Node) Merge(subtemplate *Node, skipOverwrite []string) {
 		n.Content = subtemplate.Content
 	}
 	for _, child := range subtemplate.Children {
+		if n.mergeRemove(child) {
+			continue
+		}
 		mine := n.GetChild(child.GetName())
 		if len(child.GetName()) == 0 {
 			if mine != nil && mine.GetParent() != nil && mine.GetParent().GetChildByContent(child.GetContentS()) == nil {
@@ -337,26 +463,267 @@ func (n *Node) Merge(subtemplate *Node, skipOverwrite []string) {
 	}
 }
 
+// MergeAll merges layers into base from left to right and returns the result, base is modified in-place.
+// Later layers take precedence: content of a layer overwrites content of base and of all layers before it, except
+// for children of keys in skipOverwrite, whose content is concatenated in layer order. Nil layers are skipped.
+// When base is nil, the first non-nil layer is the base. MergeAll returns nil when there is nothing to merge.
+func MergeAll(base *Node, layers []*Node, skipOverwrite []string) *Node {
+	for _, layer := range layers {
+		if layer == nil {
+			continue
+		}
+		if base == nil {
+			base = layer
+			continue
+		}
+		base.Merge(layer, skipOverwrite)
+	}
+	return base
+}
+
+// MergeChildrenByKey merges the children named childName of sub into the receiver, matching them by key
+// instead of by name. The key of a child is its keyAttr attribute or, for templates parsed from YAML, the content of
+// its keyAttr child. Matching children are merged with Merge and sub's attributes win.
+// Children of sub without a match or without a key are appended in order, other children of sub are ignored.
+func (n *Node) MergeChildrenByKey(sub *Node, childName, keyAttr string) {
+	if sub == nil {
+		return
+	}
+	mine := make(map[string]*Node)
+	for _, child := range n.Children {
+		if child.GetNameS() != childName {
+			continue
+		}
+		if key, ok := child.childKey(keyAttr); ok {
+			if _, seen := mine[key]; !seen {
+				mine[key] = child
+			}
+		}
+	}
+	for _, child := range sub.Children {
+		if child.GetNameS() != childName {
+			continue
+		}
+		key, ok := child.childKey(keyAttr)
+		target, found := mine[key]
+		if !ok || !found {
+			n.AddChild(child)
+			continue
+		}
+		for _, attr := range child.Attrs {
+			target.setAttr(attr)
+		}
+		target.Merge(child, nil)
+	}
+}
+
+func (n *Node) childKey(keyAttr string) (string, bool) {
+	if value, ok := n.GetAttrValueS(keyAttr); ok {
+		return value, true
+	}
+	if key := n.GetChildS(keyAttr); key != nil {
+		return key.GetContentS(), true
+	}
+	return "", false
+}
+
+func (n *Node) setAttr(attr xml.Attr) {
+	for i := range n.Attrs {
+		if n.Attrs[i].Name.Local == attr.Name.Local {
+			n.Attrs[i].Value = attr.Value
+			return
+		}
+	}
+	n.AddAttr(attr)
+}
+
 func (n *Node) UnmarshalXML(dec *xml.Decoder, root xml.StartElement) error {
 	n.Attrs = root.Attr
 	type node Node
 	return dec.DecodeElement((*node)(n), &root)
 }
 
-func (n *Node) FlatList(list *[]string, prefix string) {
+// jsonNode is the JSON representation of a Node. Content is the trimmed content returned by GetContent
+type jsonNode struct {
+	Name     string            `json:"name,omitempty"`
+	Content  string            `json:"content,omitempty"`
+	Attrs    map[string]string `json:"attrs,omitempty"`
+	Children []*Node           `json:"children,omitempty"`
+}
+
+// MarshalJSON encodes the name, content, attributes and children of n recursively
+func (n *Node) MarshalJSON() ([]byte, error) {
+	j := jsonNode{
+		Name:     n.GetNameS(),
+		Content:  string(n.GetContent()),
+		Children: n.Children,
+	}
+	if len(n.Attrs) > 0 {
+		j.Attrs = make(map[string]string, len(n.Attrs))
+		for _, attr := range n.Attrs {
+			j.Attrs[attr.Name.Local] = attr.Value
+		}
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON decodes a node written by MarshalJSON. Attributes are sorted by name since JSON objects are unordered
+func (n *Node) UnmarshalJSON(data []byte) error {
+	var j jsonNode
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	n.SetNameS(j.Name)
+	n.SetContentS(j.Content)
+	n.Attrs = nil
+	for _, name := range util.GetSortedKeys(j.Attrs) {
+		n.NewAttrS(name, j.Attrs[name])
+	}
+	n.Children = nil
+	for _, child := range j.Children {
+		if child == nil {
+			continue
+		}
+		child.parent = n
+		n.AddChild(child)
+	}
+	return nil
+}
+
+// Equals reports whether n and other have the same name, content, attributes and children.
+// Content is compared the way GetContent returns it: leading and trailing whitespace is trimmed and
+// content starting with '<', i.e. the inner xml of a parent, counts as empty.
+// Attributes are compared regardless of order, children are compared in order
+func (n *Node) Equals(other *Node) bool {
+	if n == nil || other == nil {
+		return n == other
+	}
+	if n.GetNameS() != other.GetNameS() || !bytes.Equal(n.GetContent(), other.GetContent()) {
+		return false
+	}
+	if len(n.Attrs) != len(other.Attrs) {
+		return false
+	}
+	for _, attr := range n.Attrs {
+		if value, ok := other.GetAttrValueS(attr.Name.Local); !ok || value != attr.Value {
+			return false
+		}
+	}
+	if len(n.Children) != len(other.Children) {
+		return false
+	}
+	for i, child := range n.Children {
+		if !child.Equals(other.Children[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+type DiffKind string
+
+const (
+	DiffAdded   DiffKind = "added"
+	DiffRemoved DiffKind = "removed"
+	DiffChanged DiffKind = "changed"
+)
+
+// NodeDiff is a single difference found by Diff. Old and New hold the trimmed content
+// of the node before and after, Old is empty for added nodes and New for removed nodes
+type NodeDiff struct {
+	Kind DiffKind
+	Path []string
+	Old  string
+	New  string
+}
+
+// Diff returns the nodes that were added, removed or whose content changed going from n to other.
+// Children are matched by name, unnamed children, e.g. counters, by their content. The path of each
+// diff starts below n and ends with the key of the node. Added or removed subtrees are reported once, at their top
+func (n *Node) Diff(other *Node) []NodeDiff {
+	var diffs []NodeDiff
+	n.diff(other, nil, &diffs)
+	return diffs
+}
+
+func (n *Node) diffKey() string {
+	if name := n.GetNameS(); name != "" {
+		return name
+	}
+	return string(n.GetContent())
+}
+
+func (n *Node) diff(other *Node, path []string, diffs *[]NodeDiff) {
+	if oldContent, newContent := string(n.GetContent()), string(other.GetContent()); oldContent != newContent {
+		*diffs = append(*diffs, NodeDiff{Kind: DiffChanged, Path: slices.Clone(path), Old: oldContent, New: newContent})
+	}
+
+	// children with the same key are matched in order
+	unmatched := make(map[string][]*Node)
+	for _, child := range other.Children {
+		key := child.diffKey()
+		unmatched[key] = append(unmatched[key], child)
+	}
+	matched := make(map[*Node]bool)
+	for _, child := range n.Children {
+		key := child.diffKey()
+		childPath := append(slices.Clone(path), key)
+		if candidates := unmatched[key]; len(candidates) > 0 {
+			unmatched[key] = candidates[1:]
+			matched[candidates[0]] = true
+			child.diff(candidates[0], childPath, diffs)
+			continue
+		}
+		*diffs = append(*diffs, NodeDiff{Kind: DiffRemoved, Path: childPath, Old: string(child.GetContent())})
+	}
+	for _, child := range other.Children {
+		if !matched[child] {
+			childPath := append(slices.Clone(path), child.diffKey())
+			*diffs = append(*diffs, NodeDiff{Kind: DiffAdded, Path: childPath, New: string(child.GetContent())})
+		}
+	}
+}
+
+// Walk visits n and every node below it depth first, in document order. The depth of n is 0.
+// Walk stops as soon as fn returns false. An explicit stack is used so deep trees do not exhaust the goroutine stack
+func (n *Node) Walk(fn func(node *Node, depth int) bool) {
 	if n == nil {
 		return
 	}
-	if len(n.Children) == 0 {
-		var sub string
-		if len(prefix) > 0 {
-			sub = prefix + " " + simpleName(n.GetContentS())
-		} else {
-			sub = simpleName(n.GetContentS())
+	type frame struct {
+		node  *Node
+		depth int
+	}
+	stack := []frame{{node: n}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !fn(top.node, top.depth) {
+			return
 		}
-		*list = append(*list, sub)
-	} else {
-		nameS := n.GetNameS()
+		// push in reverse so the first child is visited first
+		for i := len(top.node.Children) - 1; i >= 0; i-- {
+			stack = append(stack, frame{node: top.node.Children[i], depth: top.depth + 1})
+		}
+	}
+}
+
+func (n *Node) FlatList(list *[]string, prefix string) {
+	// prefixes[d] is the prefix of the nodes at depth d, set by their parent
+	prefixes := []string{prefix}
+	n.Walk(func(node *Node, depth int) bool {
+		prefix := prefixes[depth]
+		if len(node.Children) == 0 {
+			var sub string
+			if len(prefix) > 0 {
+				sub = prefix + " " + simpleName(node.GetContentS())
+			} else {
+				sub = simpleName(node.GetContentS())
+			}
+			*list = append(*list, sub)
+			return true
+		}
+		nameS := node.GetNameS()
 		if len(nameS) > 0 && nameS != "counters" {
 			if prefix == "" {
 				prefix = nameS
@@ -364,10 +731,9 @@ func (n *Node) FlatList(list *[]string, prefix string) {
 				prefix += " " + nameS
 			}
 		}
-		for _, child := range n.Children {
-			child.FlatList(list, prefix)
-		}
-	}
+		prefixes = append(prefixes[:depth+1], prefix)
+		return true
+	})
 }
 
 var wordRegex = regexp.MustCompile(`(\w|-)+`)
@@ -378,6 +744,37 @@ func simpleName(s string) string {
 	return wordRegex.FindString(s)
 }
 
+// Leaf is a node without children along with the names of the nodes leading to it
+type Leaf struct {
+	Path    []string
+	Content string
+}
+
+// Leaves returns every leaf below n in document order. The path of each leaf starts
+// below n and ends with the leaf's own name. Unnamed nodes, e.g. list items, are left out of the path.
+func (n *Node) Leaves() []Leaf {
+	var leaves []Leaf
+	// path of the node being visited, n itself is not part of it.
+	// pathLen[d] is the length of the path of the last node visited at depth d
+	var path []string
+	pathLen := []int{0}
+	n.Walk(func(node *Node, depth int) bool {
+		if depth == 0 {
+			return true
+		}
+		path = path[:pathLen[depth-1]]
+		if name := node.GetNameS(); name != "" {
+			path = append(path, name)
+		}
+		pathLen = append(pathLen[:depth], len(path))
+		if len(node.Children) == 0 {
+			leaves = append(leaves, Leaf{Path: slices.Clone(path), Content: node.GetContentS()})
+		}
+		return true
+	})
+	return leaves
+}
+
 func (n *Node) Print(depth int) string {
 	builder := strings.Builder{}
 	n.printN(depth, &builder)
@@ -463,13 +860,71 @@ func (n *Node) SearchChildren(path []string) []*Node {
 	return matches
 }
 
+var variableRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?}`)
+
+// Substitute replaces ${VAR} and ${VAR:-default} in the content and attribute values of n and its descendants
+// with the values of env. The default is used when VAR is undefined or empty.
+// An undefined variable without default is an error, the tree is left partially substituted in that case.
+func (n *Node) Substitute(env map[string]string) error {
+	var err error
+	expand := func(s string) string {
+		return variableRegex.ReplaceAllStringFunc(s, func(match string) string {
+			groups := variableRegex.FindStringSubmatch(match)
+			if value := env[groups[1]]; value != "" {
+				return value
+			}
+			if groups[2] != "" {
+				return groups[3]
+			}
+			if _, ok := env[groups[1]]; ok {
+				return ""
+			}
+			if err == nil {
+				err = fmt.Errorf("undefined variable %s in %s", groups[1], n.GetNameS())
+			}
+			return match
+		})
+	}
+	if bytes.Contains(n.Content, []byte("${")) {
+		n.Content = []byte(expand(string(n.Content)))
+	}
+	for i := range n.Attrs {
+		n.Attrs[i].Value = expand(n.Attrs[i].Value)
+	}
+	if err != nil {
+		return err
+	}
+	for _, child := range n.Children {
+		if err := child.Substitute(env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	htmlUnescaper = strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">", "&apos;", "'", "&quot;", "\"")
+	htmlEscaper   = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "'", "&apos;", "\"", "&quot;")
+	separators    = strings.NewReplacer(" ", "_", "-", "_")
+)
+
+// DecodeHTML unescapes the entities in x and replaces spaces and hyphens with underscores.
+// The underscores are lossy, use UnescapeHTML when x needs to be encoded again with EncodeHTML
 func DecodeHTML(x string) string {
-	x = strings.ReplaceAll(x, "&amp;", "&")
-	x = strings.ReplaceAll(x, "&lt;", "<")
-	x = strings.ReplaceAll(x, "&gt;", ">")
-	x = strings.ReplaceAll(x, "&apos;", "'")
-	x = strings.ReplaceAll(x, "&quot;", "\"")
-	x = strings.ReplaceAll(x, " ", "_") // not escape char, but wanted
-	x = strings.ReplaceAll(x, "-", "_")
-	return x
+	return UnderscoreSeparators(UnescapeHTML(x))
+}
+
+// UnescapeHTML replaces the entities &amp; &lt; &gt; &apos; and &quot; with the characters they stand for
+func UnescapeHTML(x string) string {
+	return htmlUnescaper.Replace(x)
+}
+
+// EncodeHTML is the reverse of UnescapeHTML, it escapes & < > ' and " as entities
+func EncodeHTML(x string) string {
+	return htmlEscaper.Replace(x)
+}
+
+// UnderscoreSeparators replaces spaces and hyphens in x with underscores
+func UnderscoreSeparators(x string) string {
+	return separators.Replace(x)
 }
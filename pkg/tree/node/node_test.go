@@ -1,6 +1,10 @@
 package node
 
 import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -52,6 +56,79 @@ func TestNode_FlatList(t *testing.T) {
 	}
 }
 
+func TestNode_Leaves(t *testing.T) {
+	root := NewS("root")
+	root.NewChildS("collector", "ZapiPerf")
+	schedule := root.NewChildS("schedule", "")
+	schedule.NewChildS("counter", "20m")
+	schedule.NewChildS("data", "1m")
+	counters := root.NewChildS("counters", "")
+	counters.NewChildS("", "instance_name")
+	counters.NewChildS("", "read_ops => reads")
+
+	want := []Leaf{
+		{Path: []string{"collector"}, Content: "ZapiPerf"},
+		{Path: []string{"schedule", "counter"}, Content: "20m"},
+		{Path: []string{"schedule", "data"}, Content: "1m"},
+		{Path: []string{"counters"}, Content: "instance_name"},
+		{Path: []string{"counters"}, Content: "read_ops => reads"},
+	}
+	got := root.Leaves()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Leaves() got=%v, want=%v", got, want)
+	}
+
+	var empty *Node
+	if got := empty.Leaves(); len(got) != 0 {
+		t.Errorf("Leaves() of nil node got=%v, want none", got)
+	}
+}
+
+func TestNode_Map(t *testing.T) {
+	root := NewS("root")
+	root.NewChildS("collector", "ZapiPerf")
+	auth := root.NewChildS("auth", "")
+	auth.NewChildS("username", "admin")
+	auth.NewChildS("password", "secret")
+	original := root.Print(0)
+
+	redacted := root.Map(func(n *Node) string {
+		if n.GetNameS() == "password" {
+			return "***"
+		}
+		return n.GetContentS()
+	})
+
+	if got := root.Print(0); got != original {
+		t.Errorf("original changed got=%s want=%s", got, original)
+	}
+	if got := root.GetChildS("auth").GetChildContentS("password"); got != "secret" {
+		t.Errorf("original password got=%s want=secret", got)
+	}
+	if got := redacted.GetChildS("auth").GetChildContentS("password"); got != "***" {
+		t.Errorf("redacted password got=%s want=***", got)
+	}
+	if got := redacted.GetChildS("auth").GetChildContentS("username"); got != "admin" {
+		t.Errorf("redacted username got=%s want=admin", got)
+	}
+	if got := redacted.GetChildContentS("collector"); got != "ZapiPerf" {
+		t.Errorf("redacted collector got=%s want=ZapiPerf", got)
+	}
+	if got := redacted.GetChildS("auth").GetChildS("password").GetParent(); got != redacted.GetChildS("auth") {
+		t.Errorf("mapped node has the wrong parent")
+	}
+
+	upper := root.Map(func(n *Node) string {
+		return strings.ToUpper(n.GetContentS())
+	})
+	if got, want := len(upper.Leaves()), len(root.Leaves()); got != want {
+		t.Errorf("leaves got=%d want=%d", got, want)
+	}
+	if got := upper.GetChildContentS("collector"); got != "ZAPIPERF" {
+		t.Errorf("upper collector got=%s want=ZAPIPERF", got)
+	}
+}
+
 func makeTree(names ...string) *Node {
 	tree := Node{
 		name:     []byte("root"),
@@ -148,3 +225,545 @@ func testNodeUnionCase3(t *testing.T, parent *Node, child *Node) {
 		t.Errorf("client timeout after union got=[%v], want=[%v]", nil, "3m")
 	}
 }
+
+func TestNode_DetachChild(t *testing.T) {
+	root := New([]byte("root"))
+	plugins := root.NewChildS("plugins", "")
+	labelAgent := plugins.NewChildS("LabelAgent", "")
+	split := labelAgent.NewChildS("split", "")
+
+	if split.searchAncestor("LabelAgent") == nil {
+		t.Fatalf("expected split to have LabelAgent ancestor")
+	}
+
+	detached := plugins.DetachChild("LabelAgent")
+	if detached != labelAgent {
+		t.Fatalf("expected LabelAgent to be detached, got %v", detached)
+	}
+	if detached.GetParent() != nil {
+		t.Errorf("expected detached node to have no parent")
+	}
+	if plugins.HasChildS("LabelAgent") {
+		t.Errorf("expected LabelAgent to be removed from plugins")
+	}
+	if got := split.searchAncestor("plugins"); got != nil {
+		t.Errorf("expected no plugins ancestor after detach, got %s", got.GetNameS())
+	}
+	if got := split.searchAncestor("LabelAgent"); got != split {
+		t.Errorf("expected LabelAgent ancestor to still be found")
+	}
+	if plugins.DetachChild("LabelAgent") != nil {
+		t.Errorf("expected nil when detaching a missing child")
+	}
+}
+
+func TestNode_Depth(t *testing.T) {
+	root := NewS("root")
+	counters := root.NewChildS("counters", "")
+	info := counters.NewChildS("volume-attributes", "")
+	leaf := info.NewChildS("name", "")
+	added := NewS("added")
+	counters.AddChild(added)
+
+	tests := []struct {
+		name string
+		node *Node
+		want int
+	}{
+		{name: "root", node: root, want: 0},
+		{name: "child", node: counters, want: 1},
+		{name: "grandchild", node: info, want: 2},
+		{name: "leaf", node: leaf, want: 3},
+		{name: "added without parent", node: added, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.node.Depth(); got != tt.want {
+				t.Errorf("Depth() got=%d want=%d", got, tt.want)
+			}
+		})
+	}
+
+	detached := counters.DetachChild("volume-attributes")
+	if got := detached.Depth(); got != 0 {
+		t.Errorf("detached Depth() got=%d want=0", got)
+	}
+	if got := leaf.Depth(); got != 1 {
+		t.Errorf("leaf of detached node Depth() got=%d want=1", got)
+	}
+}
+
+func TestNode_Substitute(t *testing.T) {
+	root := NewS("root")
+	root.NewAttrS("interval", "${INTERVAL:-1m}")
+	child := root.NewChildS("query", "api/${VERSION}/storage/volumes")
+
+	if err := root.Substitute(map[string]string{"VERSION": "v2"}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got, _ := root.GetAttrValueS("interval"); got != "1m" {
+		t.Errorf("attr got=%s want=1m", got)
+	}
+	if got := child.GetContentS(); got != "api/v2/storage/volumes" {
+		t.Errorf("content got=%s want=api/v2/storage/volumes", got)
+	}
+
+	missing := NewS("root")
+	missing.NewChildS("query", "${UNDEFINED}")
+	if err := missing.Substitute(nil); err == nil {
+		t.Errorf("expected an error for an undefined variable")
+	}
+}
+
+func TestNode_MergeChildrenByKey(t *testing.T) {
+	rule := func(index string, clientMatch string, ro string) *Node {
+		r := NewS("rule")
+		r.NewAttrS("index", index)
+		r.NewChildS("client_match", clientMatch)
+		r.NewChildS("ro_rule", ro)
+		return r
+	}
+	base := NewS("rules")
+	base.AddChild(rule("1", "0.0.0.0/0", "sys"))
+	base.AddChild(rule("2", "10.0.0.0/8", "any"))
+	base.NewChildS("comment", "base")
+
+	layer := NewS("rules")
+	layer.AddChild(rule("2", "10.1.0.0/16", "krb5"))
+	layer.AddChild(rule("3", "192.168.0.0/24", "none"))
+	layer.NewChildS("comment", "layer")
+
+	base.MergeChildrenByKey(layer, "rule", "index")
+
+	want := []struct {
+		index       string
+		clientMatch string
+	}{
+		{index: "1", clientMatch: "0.0.0.0/0"},
+		{index: "2", clientMatch: "10.1.0.0/16"},
+		{index: "3", clientMatch: "192.168.0.0/24"},
+	}
+	var got []*Node
+	for _, child := range base.GetChildren() {
+		if child.GetNameS() == "rule" {
+			got = append(got, child)
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("rules got=%d want=%d", len(got), len(want))
+	}
+	for i, w := range want {
+		if index, _ := got[i].GetAttrValueS("index"); index != w.index {
+			t.Errorf("rule %d index got=%s want=%s", i, index, w.index)
+		}
+		if clientMatch := got[i].GetChildContentS("client_match"); clientMatch != w.clientMatch {
+			t.Errorf("rule %d client_match got=%s want=%s", i, clientMatch, w.clientMatch)
+		}
+	}
+	if ro := got[1].GetChildContentS("ro_rule"); ro != "krb5" {
+		t.Errorf("rule 2 ro_rule got=%s want=krb5", ro)
+	}
+	// only rule children are merged
+	if comment := base.GetChildContentS("comment"); comment != "base" {
+		t.Errorf("comment got=%s want=base", comment)
+	}
+}
+
+func TestNode_MergeChildrenByKeyYaml(t *testing.T) {
+	record := func(index string, value string) *Node {
+		r := NewS("")
+		r.NewChildS("index", index)
+		r.NewChildS("value", value)
+		return r
+	}
+	base := NewS("records")
+	base.AddChild(record("a", "1"))
+	layer := NewS("records")
+	layer.AddChild(record("a", "2"))
+	layer.AddChild(record("b", "3"))
+
+	base.MergeChildrenByKey(layer, "", "index")
+
+	if len(base.GetChildren()) != 2 {
+		t.Fatalf("records got=%d want=2", len(base.GetChildren()))
+	}
+	if v := base.GetChildren()[0].GetChildContentS("value"); v != "2" {
+		t.Errorf("a value got=%s want=2", v)
+	}
+	if v := base.GetChildren()[1].GetChildContentS("value"); v != "3" {
+		t.Errorf("b value got=%s want=3", v)
+	}
+}
+
+func TestMergeAll(t *testing.T) {
+	layer := func(schedule string, counter string) *Node {
+		n := NewS("")
+		if schedule != "" {
+			n.NewChildS("schedule", schedule)
+		}
+		n.NewChildS("objects", "").NewChildS("Volume", counter)
+		return n
+	}
+
+	t.Run("later layers win", func(t *testing.T) {
+		got := MergeAll(layer("1m", "volume.yaml"), []*Node{layer("2m", "custom_volume.yaml"), nil, layer("3m", "")}, nil)
+		if s := got.GetChildS("objects").GetChildren(); len(s) != 1 {
+			t.Errorf("objects got=%d children want=1", len(s))
+		}
+		if s := got.GetChildContentS("schedule"); s != "3m" {
+			t.Errorf("schedule got=%s want=3m", s)
+		}
+		if v := got.GetChildS("objects").GetChildContentS("Volume"); v != "" {
+			t.Errorf("Volume got=%s want empty", v)
+		}
+	})
+
+	t.Run("skipOverwrite concatenates in layer order", func(t *testing.T) {
+		got := MergeAll(layer("1m", "a.yaml"), []*Node{layer("", "b.yaml"), layer("", "c.yaml")}, []string{"objects"})
+		if v := got.GetChildS("objects").GetChildContentS("Volume"); v != "a.yaml,b.yaml,c.yaml" {
+			t.Errorf("Volume got=%s want=a.yaml,b.yaml,c.yaml", v)
+		}
+		if s := got.GetChildContentS("schedule"); s != "1m" {
+			t.Errorf("schedule got=%s want=1m", s)
+		}
+	})
+
+	t.Run("nil base", func(t *testing.T) {
+		got := MergeAll(nil, []*Node{nil, layer("1m", "a.yaml"), layer("2m", "")}, nil)
+		if s := got.GetChildContentS("schedule"); s != "2m" {
+			t.Errorf("schedule got=%s want=2m", s)
+		}
+		if MergeAll(nil, []*Node{nil}, nil) != nil {
+			t.Errorf("expected nil when there is nothing to merge")
+		}
+	})
+}
+
+func TestNode_JSON(t *testing.T) {
+	root := NewS("object")
+	root.NewAttrS("version", "1")
+	root.NewAttrS("kind", "perf")
+	counters := root.NewChildS("counters", "")
+	counters.NewChildS("", "read_ops")
+	counters.NewChildS("", "write_ops => writes")
+	root.NewChildS("name", " volume ")
+
+	b, err := json.Marshal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &Node{}
+	if err := json.Unmarshal(b, got); err != nil {
+		t.Fatal(err)
+	}
+	if !root.Equals(got) {
+		t.Errorf("round trip mismatch\nwant\n%s\ngot\n%s", root.Print(0), got.Print(0))
+	}
+	if got.GetChildS("counters").GetParent() != got {
+		t.Errorf("expected children to point to their parent")
+	}
+
+	got.GetChildS("counters").NewChildS("", "other_ops")
+	if root.Equals(got) {
+		t.Errorf("expected trees with different children to differ")
+	}
+}
+
+func TestNode_Equals(t *testing.T) {
+	tree := func(content string, attrs ...string) *Node {
+		n := NewS("counter")
+		for i := 0; i+1 < len(attrs); i += 2 {
+			n.NewAttrS(attrs[i], attrs[i+1])
+		}
+		n.NewChildS("name", content)
+		return n
+	}
+	tests := []struct {
+		name  string
+		a     *Node
+		b     *Node
+		equal bool
+	}{
+		{name: "same", a: tree("read_ops", "a", "1"), b: tree("read_ops", "a", "1"), equal: true},
+		{name: "attrs reordered", a: tree("read_ops", "a", "1", "b", "2"), b: tree("read_ops", "b", "2", "a", "1"), equal: true},
+		{name: "attr value", a: tree("read_ops", "a", "1"), b: tree("read_ops", "a", "2")},
+		{name: "attr missing", a: tree("read_ops", "a", "1", "b", "2"), b: tree("read_ops", "a", "1")},
+		{name: "content whitespace", a: tree("read_ops"), b: tree("  read_ops\n"), equal: true},
+		{name: "content", a: tree("read_ops"), b: tree("write_ops")},
+		{name: "inner xml", a: tree(""), b: tree("<a>b</a>"), equal: true},
+		{name: "nil", a: tree("read_ops"), b: nil},
+		{name: "both nil", equal: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Equals(tt.b); got != tt.equal {
+				t.Errorf("Equals() = %v, want %v", got, tt.equal)
+			}
+		})
+	}
+
+	a := tree("read_ops")
+	a.NewChildS("unit", "per_sec")
+	b := tree("read_ops")
+	b.Children = append([]*Node{NewS("unit")}, b.Children...)
+	b.Children[0].SetContentS("per_sec")
+	if a.Equals(b) {
+		t.Errorf("expected children in a different order to differ")
+	}
+}
+
+func TestNode_Diff(t *testing.T) {
+	base := NewS("")
+	base.NewChildS("schedule", "1m")
+	objects := base.NewChildS("objects", "")
+	objects.NewChildS("Volume", "volume.yaml")
+	objects.NewChildS("Qtree", "qtree.yaml")
+	counters := base.NewChildS("counters", "")
+	counters.NewChildS("", "read_ops")
+	counters.NewChildS("", "write_ops")
+
+	sub := NewS("")
+	sub.NewChildS("objects", "").NewChildS("Volume", "custom_volume.yaml")
+	sub.NewChildS("schedule", "2m")
+
+	merged := base.Copy()
+	merged.Merge(sub, nil)
+	merged.GetChildS("objects").PopChildS("Qtree")
+	merged.GetChildS("objects").NewChildS("Lun", "lun.yaml")
+	mergedCounters := merged.GetChildS("counters")
+	mergedCounters.PopChildS("")
+	mergedCounters.NewChildS("", "other_ops")
+
+	want := []NodeDiff{
+		{Kind: DiffChanged, Path: []string{"schedule"}, Old: "1m", New: "2m"},
+		{Kind: DiffChanged, Path: []string{"objects", "Volume"}, Old: "volume.yaml", New: "custom_volume.yaml"},
+		{Kind: DiffRemoved, Path: []string{"objects", "Qtree"}, Old: "qtree.yaml"},
+		{Kind: DiffAdded, Path: []string{"objects", "Lun"}, New: "lun.yaml"},
+		{Kind: DiffRemoved, Path: []string{"counters", "read_ops"}, Old: "read_ops"},
+		{Kind: DiffAdded, Path: []string{"counters", "other_ops"}, New: "other_ops"},
+	}
+	if got := base.Diff(merged); !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff() got=%+v\nwant=%+v", got, want)
+	}
+	if got := base.Diff(base.Copy()); len(got) != 0 {
+		t.Errorf("expected no diffs against a copy, got=%+v", got)
+	}
+}
+
+func TestEncodeHTML(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+		decoded string
+	}{
+		{name: "plain", encoded: "read_ops", decoded: "read_ops"},
+		{name: "all entities", encoded: "&amp;&lt;&gt;&apos;&quot;", decoded: "&<>'\""},
+		{name: "labels", encoded: "&lt;1us,&lt;20us,&gt;1s", decoded: "<1us,<20us,>1s"},
+		{name: "escaped entity", encoded: "&amp;lt;", decoded: "&lt;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DecodeHTML(tt.encoded); got != tt.decoded {
+				t.Errorf("DecodeHTML() = %v, want %v", got, tt.decoded)
+			}
+			if got := EncodeHTML(DecodeHTML(tt.encoded)); got != tt.encoded {
+				t.Errorf("EncodeHTML(DecodeHTML()) = %v, want %v", got, tt.encoded)
+			}
+		})
+	}
+
+	if got := DecodeHTML("read ops-&lt;1us"); got != "read_ops_<1us" {
+		t.Errorf("DecodeHTML() = %v, want read_ops_<1us", got)
+	}
+	if got := EncodeHTML(UnescapeHTML("read ops-&lt;1us")); got != "read ops-&lt;1us" {
+		t.Errorf("EncodeHTML(UnescapeHTML()) = %v, want read ops-&lt;1us", got)
+	}
+}
+
+func TestNode_Walk(t *testing.T) {
+	root := NewS("root")
+	a := root.NewChildS("a", "")
+	a.NewChildS("a1", "x")
+	a.NewChildS("a2", "y")
+	root.NewChildS("b", "z")
+
+	var visited []string
+	root.Walk(func(node *Node, depth int) bool {
+		visited = append(visited, node.GetNameS()+":"+strconv.Itoa(depth))
+		return true
+	})
+	want := []string{"root:0", "a:1", "a1:2", "a2:2", "b:1"}
+	if !reflect.DeepEqual(visited, want) {
+		t.Errorf("Walk() visited=%v want=%v", visited, want)
+	}
+
+	visited = nil
+	root.Walk(func(node *Node, _ int) bool {
+		visited = append(visited, node.GetNameS())
+		return node.GetNameS() != "a1"
+	})
+	if want := []string{"root", "a", "a1"}; !reflect.DeepEqual(visited, want) {
+		t.Errorf("Walk() with early stop visited=%v want=%v", visited, want)
+	}
+
+	deep := NewS("deep")
+	parent := deep
+	for i := 0; i < 1_000_000; i++ {
+		parent = parent.NewChildS("child", "")
+	}
+	maxDepth := 0
+	deep.Walk(func(_ *Node, depth int) bool {
+		maxDepth = max(maxDepth, depth)
+		return true
+	})
+	if maxDepth != 1_000_000 {
+		t.Errorf("Walk() max depth=%d want=1000000", maxDepth)
+	}
+}
+
+func TestNode_FlatListNested(t *testing.T) {
+	root := NewS("counters")
+	details := root.NewChildS("node-details-info", "")
+	details.NewChildS("", "cpu-busytime")
+	env := details.NewChildS("environment", "")
+	env.NewChildS("", "temp => temperature")
+	details.NewChildS("", "uptime")
+	root.NewChildS("", "instance_name")
+
+	var list []string
+	root.FlatList(&list, "")
+	want := []string{
+		"node-details-info cpu-busytime",
+		"node-details-info environment temp",
+		"node-details-info uptime",
+		"instance_name",
+	}
+	if !reflect.DeepEqual(list, want) {
+		t.Errorf("FlatList() got=%v want=%v", list, want)
+	}
+}
+
+func TestNode_GetChildByAttr(t *testing.T) {
+	root := NewS("counters")
+	for _, c := range []struct{ name, unit, content string }{
+		{name: "read_ops", unit: "per_sec", content: "1"},
+		{name: "write_ops", unit: "per_sec", content: "2"},
+		{name: "read_latency", unit: "microsec", content: "3"},
+	} {
+		counter := root.NewChildS("counter", c.content)
+		counter.NewAttrS("name", c.name)
+		counter.NewAttrS("unit", c.unit)
+	}
+
+	if got := root.GetChildByAttr("name", "write_ops"); got == nil || got.GetContentS() != "2" {
+		t.Errorf("GetChildByAttr(name, write_ops) got=%v want content 2", got)
+	}
+	if got := root.GetChildByAttr("unit", "per_sec"); got == nil || got.GetContentS() != "1" {
+		t.Errorf("GetChildByAttr(unit, per_sec) expected the first match")
+	}
+	if got := root.GetChildByAttr("name", "other_ops"); got != nil {
+		t.Errorf("GetChildByAttr(name, other_ops) got=%v want nil", got)
+	}
+	if got := root.GetChildByAttr("missing", ""); got != nil {
+		t.Errorf("GetChildByAttr(missing) got=%v want nil", got)
+	}
+
+	got := root.GetChildrenByAttr("unit", "per_sec")
+	if len(got) != 2 || got[0].GetContentS() != "1" || got[1].GetContentS() != "2" {
+		t.Errorf("GetChildrenByAttr(unit, per_sec) got=%d children want 2 in order", len(got))
+	}
+	if got := root.GetChildrenByAttr("unit", "sec"); len(got) != 0 {
+		t.Errorf("GetChildrenByAttr(unit, sec) got=%d children want 0", len(got))
+	}
+}
+
+func TestNode_SortChildren(t *testing.T) {
+	root := NewS("root")
+	objects := root.NewChildS("objects", "")
+	objects.NewChildS("Volume", "volume.yaml")
+	objects.NewChildS("Lun", "lun.yaml")
+	counters := root.NewChildS("counters", "")
+	counters.NewChildS("", "write_ops")
+	counters.NewChildS("", "read_ops")
+	root.NewChildS("collector", "ZapiPerf")
+	unsorted := root.Copy()
+
+	root.SortChildrenByName()
+	if got := root.GetAllChildNamesS(); !reflect.DeepEqual(got, []string{"collector", "counters", "objects"}) {
+		t.Errorf("root children got=%v", got)
+	}
+	if got := root.GetChildS("objects").GetAllChildNamesS(); !reflect.DeepEqual(got, []string{"Lun", "Volume"}) {
+		t.Errorf("objects children got=%v, expected nested children to be sorted", got)
+	}
+	if got := root.GetChildS("counters").GetAllChildContentS(); !reflect.DeepEqual(got, []string{"write_ops", "read_ops"}) {
+		t.Errorf("counters got=%v, expected unnamed children to keep their order", got)
+	}
+	if got := unsorted.GetAllChildNamesS(); !reflect.DeepEqual(got, []string{"objects", "counters", "collector"}) {
+		t.Errorf("expected only the sorted tree to change, got=%v", got)
+	}
+
+	root.SortChildren(func(a, b *Node) bool {
+		return a.GetContentS() < b.GetContentS()
+	})
+	if got := root.GetChildS("counters").GetAllChildContentS(); !reflect.DeepEqual(got, []string{"read_ops", "write_ops"}) {
+		t.Errorf("counters by content got=%v", got)
+	}
+}
+
+func TestNode_MergeRemove(t *testing.T) {
+	base := func() *Node {
+		n := NewS("")
+		n.NewChildS("name", "Volume")
+		objects := n.NewChildS("objects", "")
+		objects.NewChildS("Volume", "volume.yaml")
+		objects.NewChildS("Qtree", "qtree.yaml")
+		objects.NewChildS("Lun", "lun.yaml")
+		counters := n.NewChildS("counters", "")
+		counters.NewChildS("", "read_ops")
+		counters.NewChildS("", "write_ops")
+		plugins := n.NewChildS("plugins", "")
+		plugins.NewChildS("LabelAgent", "").NewChildS("split", "name `_` a,b")
+		return n
+	}
+
+	sub := NewS("")
+	objects := sub.NewChildS("objects", "")
+	objects.NewChildS("Volume", "custom_volume.yaml")
+	objects.NewChildS("Qtree", "__REMOVE__")
+	objects.NewChildS("Missing", "__REMOVE__")
+	sub.NewChildS("counters", "").NewChildS("", "__REMOVE__ read_ops")
+	sub.NewChildS("plugins", "__REMOVE__")
+
+	got := base()
+	got.Merge(sub, []string{"objects"})
+
+	if names := got.GetChildS("objects").GetAllChildNamesS(); !reflect.DeepEqual(names, []string{"Volume", "Lun"}) {
+		t.Errorf("objects got=%v want=[Volume Lun]", names)
+	}
+	if v := got.GetChildS("objects").GetChildContentS("Volume"); v != "volume.yaml,custom_volume.yaml" {
+		t.Errorf("Volume got=%s want=volume.yaml,custom_volume.yaml", v)
+	}
+	if c := got.GetChildS("counters").GetAllChildContentS(); !reflect.DeepEqual(c, []string{"write_ops"}) {
+		t.Errorf("counters got=%v want=[write_ops]", c)
+	}
+	if got.HasChildS("plugins") {
+		t.Errorf("expected the plugins subtree to be removed")
+	}
+	if v := got.GetChildContentS("name"); v != "Volume" {
+		t.Errorf("name got=%s want=Volume", v)
+	}
+
+	defer func(sentinel string) { RemoveSentinel = sentinel }(RemoveSentinel)
+	RemoveSentinel = "~"
+	got = base()
+	got.Merge(sub, nil)
+	if v := got.GetChildS("objects").GetChildContentS("Qtree"); v != "__REMOVE__" {
+		t.Errorf("Qtree got=%s want=__REMOVE__ when the sentinel is changed", v)
+	}
+	removeLun := NewS("")
+	removeLun.NewChildS("objects", "").NewChildS("Lun", "~")
+	got.Merge(removeLun, nil)
+	if got.GetChildS("objects").HasChildS("Lun") {
+		t.Errorf("expected Lun to be removed with the configured sentinel")
+	}
+}
@@ -22,6 +22,27 @@ func ImportYaml(filepath string) (*node.Node, error) {
 	return LoadYaml(data)
 }
 
+// ImportYamlEnv imports a template and substitutes ${VAR} and ${VAR:-default} with the values of env,
+// see node.Substitute. The process environment is not used unless the caller passes it.
+func ImportYamlEnv(filepath string, env map[string]string) (*node.Node, error) {
+	data, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	return LoadYamlEnv(data, env)
+}
+
+func LoadYamlEnv(data []byte, env map[string]string) (*node.Node, error) {
+	r, err := LoadYaml(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Substitute(env); err != nil {
+		return nil, errs.New(errs.ErrConfig, err.Error())
+	}
+	return r, nil
+}
+
 func LoadYaml(data []byte) (*node.Node, error) {
 	root := y3.Node{}
 	err := y3.Unmarshal(data, &root)
@@ -245,3 +245,52 @@ func TestImport2108Yaml(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadYamlEnv(t *testing.T) {
+	template := []byte(`
+name: Volume
+schedule:
+  - data: ${DATA_INTERVAL:-3m}
+  - instance: ${INSTANCE_INTERVAL:-10m}
+filter:
+  - svm.name=${SVM}
+`)
+	tests := []struct {
+		name     string
+		env      map[string]string
+		data     string
+		instance string
+		filter   string
+		err      bool
+	}{
+		{name: "substituted", env: map[string]string{"DATA_INTERVAL": "1m", "INSTANCE_INTERVAL": "5m", "SVM": "vs1"}, data: "1m", instance: "5m", filter: "svm.name=vs1"},
+		{name: "defaults", env: map[string]string{"SVM": "vs1"}, data: "3m", instance: "10m", filter: "svm.name=vs1"},
+		{name: "empty uses default", env: map[string]string{"DATA_INTERVAL": "", "SVM": "vs1"}, data: "3m", instance: "10m", filter: "svm.name=vs1"},
+		{name: "missing variable", env: map[string]string{}, err: true},
+		{name: "no env", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := LoadYamlEnv(template, tt.env)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error for undefined SVM")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			schedule := n.GetChildS("schedule")
+			if got := schedule.GetChildContentS("data"); got != tt.data {
+				t.Errorf("data got=%s want=%s", got, tt.data)
+			}
+			if got := schedule.GetChildContentS("instance"); got != tt.instance {
+				t.Errorf("instance got=%s want=%s", got, tt.instance)
+			}
+			if got := n.GetChildS("filter").GetAllChildContentS(); len(got) != 1 || got[0] != tt.filter {
+				t.Errorf("filter got=%v want=%s", got, tt.filter)
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/shirou/gopsutil/v3/process"
 	"golang.org/x/sys/unix"
 	"gopkg.in/yaml.v3"
+	"math"
 	"net"
 	"net/http"
 	"net/url"
@@ -282,14 +283,28 @@ func ParseMetricType(metricName string) (string, string) {
 	return metricName, ""
 }
 
-func SumNumbers(s []float64) float64 {
+// Sum returns the sum of input, 0 when passed an empty slice
+func Sum(input []float64) float64 {
 	var total float64
-	for _, num := range s {
+	for _, num := range input {
 		total += num
 	}
 	return total
 }
 
+// StdDev returns the population standard deviation of input, 0 when passed an empty slice
+func StdDev(input []float64) float64 {
+	if len(input) == 0 {
+		return 0
+	}
+	mean := Avg(input)
+	var squares float64
+	for _, value := range input {
+		squares += (value - mean) * (value - mean)
+	}
+	return math.Sqrt(squares / float64(len(input)))
+}
+
 // Max returns 0 when passed an empty slice, slices.Max panics if input is empty
 // This function can be removed once all callers are checked for empty slices
 func Max(input []float64) float64 {
@@ -310,11 +325,49 @@ func Min(input []float64) float64 {
 
 func Avg(input []float64) float64 {
 	if len(input) > 0 {
-		return SumNumbers(input) / float64(len(input))
+		return Sum(input) / float64(len(input))
 	}
 	return 0
 }
 
+// Median returns the 50th percentile of input, see Percentile
+func Median(input []float64) float64 {
+	return Percentile(input, 50)
+}
+
+// Percentile returns the p-th percentile, p in [0, 100], of input with linear interpolation between the closest
+// ranks. input is not modified. Percentile returns 0 when passed an empty slice, like Avg.
+func Percentile(input []float64, p float64) float64 {
+	if len(input) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(input)
+	slices.Sort(sorted)
+	rank := Clamp(p, 0, 100) / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
+
+// TrimmedMean returns the mean of values without the lowest and highest trimFraction of them, e.g. a trimFraction
+// of 0.1 discards the lowest and highest 10%. values is not modified. TrimmedMean falls back to the mean of all
+// values when trimFraction is not positive or trimming would discard every value, and returns 0 when passed an
+// empty slice, like Avg.
+func TrimmedMean(values []float64, trimFraction float64) float64 {
+	trim := int(math.Floor(float64(len(values)) * trimFraction))
+	if trim <= 0 || 2*trim >= len(values) {
+		return Avg(values)
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	return Avg(sorted[trim : len(sorted)-trim])
+}
+
+// Clamp limits value to the range [lo, hi]
+func Clamp(value, lo, hi float64) float64 {
+	return min(max(value, lo), hi)
+}
+
 func ParseZAPIDisplay(obj string, path []string) string {
 	var (
 		ignore = map[string]int{"attributes": 0, "info": 0, "list": 0, "details": 0, "storage": 0}
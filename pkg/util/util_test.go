@@ -1,6 +1,8 @@
 package util
 
 import (
+	"math"
+	"slices"
 	"testing"
 )
 
@@ -123,3 +125,124 @@ func TestHasDuplicates(t *testing.T) {
 		}
 	}
 }
+
+func TestClamp(t *testing.T) {
+	tests := []struct {
+		name  string
+		value float64
+		want  float64
+	}{
+		{name: "in range", value: 0.5, want: 0.5},
+		{name: "lower bound", value: 0, want: 0},
+		{name: "upper bound", value: 1, want: 1},
+		{name: "above", value: 1.07, want: 1},
+		{name: "below", value: -0.2, want: 0},
+		{name: "infinity", value: math.Inf(1), want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Clamp(tt.value, 0, 1); got != tt.want {
+				t.Errorf("Clamp(%v, 0, 1) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	values := []float64{400, 100, 300, 200, 500}
+	tests := []struct {
+		name  string
+		input []float64
+		p     float64
+		want  float64
+	}{
+		{name: "median", input: values, p: 50, want: 300},
+		{name: "p95", input: values, p: 95, want: 480},
+		{name: "p25", input: values, p: 25, want: 200},
+		{name: "max", input: values, p: 100, want: 500},
+		{name: "min", input: values, p: 0, want: 100},
+		{name: "interpolated median", input: []float64{1, 2, 3, 4}, p: 50, want: 2.5},
+		{name: "single", input: []float64{7}, p: 95, want: 7},
+		{name: "empty", p: 50, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Percentile(tt.input, tt.p); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Percentile(%v, %v) = %v, want %v", tt.input, tt.p, got, tt.want)
+			}
+		})
+	}
+	if values[0] != 400 {
+		t.Errorf("Percentile modified its input %v", values)
+	}
+}
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []float64
+		want  float64
+	}{
+		{name: "odd", input: []float64{3, 1, 2}, want: 2},
+		{name: "even", input: []float64{4, 1, 3, 2}, want: 2.5},
+		{name: "empty", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Median(tt.input); got != tt.want {
+				t.Errorf("Median(%v) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrimmedMean(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []float64
+		trim  float64
+		want  float64
+	}{
+		{name: "no trim", input: []float64{1, 2, 3, 10}, want: 4},
+		{name: "outliers", input: []float64{100, 1, 2, 3, -50}, trim: 0.2, want: 2},
+		{name: "fraction rounds down", input: []float64{1, 2, 3, 10}, trim: 0.2, want: 4},
+		{name: "everything trimmed", input: []float64{1, 3}, trim: 0.5, want: 2},
+		{name: "negative", input: []float64{1, 3}, trim: -1, want: 2},
+		{name: "empty", trim: 0.1, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := slices.Clone(tt.input)
+			if got := TrimmedMean(tt.input, tt.trim); got != tt.want {
+				t.Errorf("TrimmedMean(%v, %v) = %v, want %v", tt.input, tt.trim, got, tt.want)
+			}
+			if !slices.Equal(input, tt.input) {
+				t.Errorf("TrimmedMean modified its input, got %v", tt.input)
+			}
+		})
+	}
+}
+
+func TestSumStdDev(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      []float64
+		wantSum    float64
+		wantStdDev float64
+	}{
+		{name: "values", input: []float64{2, 4, 4, 4, 5, 5, 7, 9}, wantSum: 40, wantStdDev: 2},
+		{name: "same values", input: []float64{3, 3, 3}, wantSum: 9, wantStdDev: 0},
+		{name: "single", input: []float64{-1.5}, wantSum: -1.5, wantStdDev: 0},
+		{name: "empty", wantSum: 0, wantStdDev: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sum(tt.input); got != tt.wantSum {
+				t.Errorf("Sum(%v) = %v, want %v", tt.input, got, tt.wantSum)
+			}
+			if got := StdDev(tt.input); got != tt.wantStdDev {
+				t.Errorf("StdDev(%v) = %v, want %v", tt.input, got, tt.wantStdDev)
+			}
+		})
+	}
+}